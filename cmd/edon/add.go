@@ -0,0 +1,92 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/fatih/color"
+	"github.com/katungi/edon/internal/modules/loader"
+)
+
+var (
+	AddCmd        = flag.NewFlagSet("add", flag.ExitOnError)
+	addDev        = AddCmd.Bool("dev", false, "Save to devDependencies instead of dependencies")
+	addExact      = AddCmd.Bool("exact", false, "Save the exact resolved version instead of a ^ range")
+	addSaveExact  = AddCmd.Bool("save-exact", false, "Same as --exact")
+	addSavePrefix = AddCmd.String("save-prefix", "^", "Range operator to save versions with: ^ or ~")
+)
+
+// HandleAdd installs packages and records them in package.json
+func HandleAdd() error {
+	if AddCmd.NArg() < 1 {
+		return fmt.Errorf("package name is required")
+	}
+	for _, pkg := range AddCmd.Args() {
+		if loader.IsLocalPackage(pkg) {
+			return fmt.Errorf("cannot add local package %s; use 'edon install %s' instead", pkg, pkg)
+		}
+	}
+
+	dir, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get current directory: %w", err)
+	}
+
+	manifest, err := readManifest(dir)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("no %s found in %s; run 'edon init' first", manifestFile, dir)
+	}
+	if err != nil {
+		return err
+	}
+
+	opts, err := projectOptions()
+	if err != nil {
+		return err
+	}
+
+	pm, err := loader.NewNPMPackageManager(opts...)
+	if err != nil {
+		return fmt.Errorf("failed to initialize NPM package manager: %v", err)
+	}
+
+	prefix := *addSavePrefix
+	if *addExact || *addSaveExact {
+		prefix = ""
+	}
+	// Check the prefix before anything is installed
+	if _, err := loader.PinVersion("0.0.0", prefix); err != nil {
+		return err
+	}
+
+	field := "dependencies"
+	if *addDev {
+		field = "devDependencies"
+	}
+	deps := dependencyBlock(manifest, field)
+
+	ctx, stop := installContext()
+	defer stop()
+
+	for _, pkg := range AddCmd.Args() {
+		fmt.Printf("Installing %s...\n", pkg)
+		installed, err := pm.InstallPackage(ctx, pkg)
+		if err != nil {
+			if ctx.Err() != nil {
+				return errInstallCanceled
+			}
+			return fmt.Errorf("failed to install %s: %v", pkg, err)
+		}
+
+		version, err := loader.PinVersion(installed.Version, prefix)
+		if err != nil {
+			return err
+		}
+		deps[installed.Name] = version
+		warnInstalled(installed)
+		color.Green("✓ Added %s@%s to %s", installed.Name, version, field)
+	}
+
+	return writeManifest(dir, manifest)
+}
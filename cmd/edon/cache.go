@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/katungi/edon/internal/config"
+	"github.com/katungi/edon/internal/modules/loader"
+)
+
+var (
+	CacheCmd = flag.NewFlagSet("cache", flag.ExitOnError)
+
+	// CachePruneCmd parses the flags after "cache prune"
+	CachePruneCmd = flag.NewFlagSet("cache prune", flag.ExitOnError)
+	pruneMax      = CachePruneCmd.String("max", "", "Size to shrink the package cache to, such as 500MB or 1GB")
+	pruneForce    = CachePruneCmd.Bool("force", false, "Also remove packages pinned by the project's lockfile")
+)
+
+// HandleCache runs the cache subcommands: "export" writes the cache to stdout
+// as a gzipped tarball, "import" restores one from stdin, "size" reports how
+// much space packages take up and "prune" evicts the least recently used
+// ones to fit a budget
+func HandleCache() error {
+	opts, err := projectOptions()
+	if err != nil {
+		return err
+	}
+	pm, err := loader.NewNPMPackageManager(opts...)
+	if err != nil {
+		return fmt.Errorf("failed to open cache: %v", err)
+	}
+
+	switch CacheCmd.Arg(0) {
+	case "export":
+		// An archive dumped into a terminal is no use to anyone
+		if info, err := os.Stdout.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+			return fmt.Errorf("refusing to write the cache archive to a terminal; redirect it to a file")
+		}
+		out := bufio.NewWriter(os.Stdout)
+		if err := pm.ExportCache(out); err != nil {
+			return fmt.Errorf("failed to export cache: %w", err)
+		}
+		return out.Flush()
+	case "import":
+		if err := pm.ImportCache(bufio.NewReader(os.Stdin)); err != nil {
+			return fmt.Errorf("failed to import cache: %w", err)
+		}
+		color.Green("✓ Imported cache")
+		return nil
+	case "size":
+		size, err := pm.CacheSize()
+		if err != nil {
+			return fmt.Errorf("failed to measure cache: %w", err)
+		}
+		fmt.Printf("%s in %s\n", formatSize(size), pm.CacheDir())
+		return nil
+	case "prune":
+		return prunePackageCache(pm)
+	case "":
+		return fmt.Errorf("cache subcommand is required: export, import, size or prune")
+	default:
+		return fmt.Errorf("unknown cache subcommand %q: expected export, import, size or prune", CacheCmd.Arg(0))
+	}
+}
+
+// prunePackageCache shrinks the package cache to --max, keeping the packages
+// the project's lockfiles pin unless --force is given
+func prunePackageCache(pm *loader.NPMPackageManager) error {
+	CachePruneCmd.Parse(CacheCmd.Args()[1:])
+	if *pruneMax == "" {
+		return fmt.Errorf("--max is required, e.g. edon cache prune --max 1GB")
+	}
+	maxBytes, err := parseSize(*pruneMax)
+	if err != nil {
+		return err
+	}
+
+	var keep []string
+	if !*pruneForce {
+		dir, err := os.Getwd()
+		if err != nil {
+			return fmt.Errorf("failed to get current directory: %w", err)
+		}
+		cfg, err := config.Load(dir)
+		if err != nil {
+			return err
+		}
+		if keep, err = lockedPackages(filepath.Join(dir, packageLockFile), cfg.Lock); err != nil {
+			return err
+		}
+	}
+
+	freed, err := pm.PruneCache(maxBytes, keep...)
+	if err != nil {
+		return fmt.Errorf("failed to prune cache: %w", err)
+	}
+	size, err := pm.CacheSize()
+	if err != nil {
+		return fmt.Errorf("failed to measure cache: %w", err)
+	}
+	color.Green("✓ Freed %s; the cache now takes %s", formatSize(freed), formatSize(size))
+	if size > maxBytes && len(keep) > 0 {
+		color.Yellow("Warning: packages pinned by the lockfile keep the cache over %s (use --force to remove them too)", *pruneMax)
+	}
+	return nil
+}
+
+// sizeUnits are the suffixes parseSize accepts, in powers of 1024
+var sizeUnits = []struct {
+	suffix string
+	bytes  int64
+}{
+	{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10},
+	{"T", 1 << 40}, {"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10}, {"B", 1},
+}
+
+// parseSize parses a size such as "1GB", "500M" or "1.5G"; a bare number is
+// bytes
+func parseSize(s string) (int64, error) {
+	number, multiplier := strings.ToUpper(strings.TrimSpace(s)), int64(1)
+	for _, unit := range sizeUnits {
+		if rest, ok := strings.CutSuffix(number, unit.suffix); ok {
+			number, multiplier = strings.TrimSpace(rest), unit.bytes
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q: use a number of bytes or a size like 500MB or 1GB", s)
+	}
+	return int64(n * float64(multiplier)), nil
+}
+
+// formatSize renders bytes with the largest unit that keeps it above one
+func formatSize(bytes int64) string {
+	for _, unit := range sizeUnits[:4] {
+		if bytes >= unit.bytes {
+			return fmt.Sprintf("%.1f %s", float64(bytes)/float64(unit.bytes), unit.suffix)
+		}
+	}
+	return fmt.Sprintf("%d B", bytes)
+}
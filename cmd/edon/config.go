@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/fatih/color"
+	"github.com/katungi/edon/internal/config"
+	"github.com/katungi/edon/internal/modules/loader"
+)
+
+// projectOptions reads edon.json (or deno.json) from the working directory and
+// turns it into loader options. Options derived from CLI flags are appended
+// after these by each command, so flags take precedence over the config file.
+func projectOptions() ([]loader.Option, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get current directory: %w", err)
+	}
+
+	cfg, err := config.Load(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, warning := range cfg.Warnings {
+		color.Yellow("Warning: %s", warning)
+	}
+
+	opts := []loader.Option{loader.WithUserAgent("edon/" + version), loader.WithMaxConcurrency(jobs)}
+	npmrc, err := npmrcOptions(dir)
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, npmrc...)
+	// edon.json's registry wins over .npmrc's
+	if cfg.Registry != "" {
+		opts = append(opts, loader.WithRegistry(cfg.Registry))
+	}
+	// --cache-dir wins over edon.json, which wins over EDON_CACHE_DIR
+	switch {
+	case *cacheDir != "":
+		opts = append(opts, loader.WithCacheDir(*cacheDir))
+	case cfg.CacheDir != "":
+		opts = append(opts, loader.WithCacheDir(cfg.CacheDir))
+	}
+	if cfg.Offline {
+		opts = append(opts, loader.WithOffline(true))
+	}
+	if cfg.ImportMap != "" {
+		importMap, err := loader.LoadImportMap(cfg.ImportMap)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load import map: %w", err)
+		}
+		opts = append(opts, loader.WithImportMap(importMap))
+	}
+
+	return opts, nil
+}
+
+// npmrcOptions turns the registry settings of ~/.npmrc and the project's
+// .npmrc, which wins, into loader options: the default registry, scoped
+// registries and the tokens sent to each registry host
+func npmrcOptions(dir string) ([]loader.Option, error) {
+	dirs := []string{dir}
+	if home, err := os.UserHomeDir(); err == nil && home != dir {
+		dirs = []string{home, dir}
+	}
+	rc, err := config.LoadNPMRC(dirs...)
+	if err != nil {
+		return nil, err
+	}
+
+	var opts []loader.Option
+	if rc.Registry != "" {
+		opts = append(opts, loader.WithRegistry(rc.Registry))
+	}
+	if len(rc.Scopes) > 0 {
+		opts = append(opts, loader.WithScopedRegistries(rc.Scopes))
+	}
+	if len(rc.Tokens) > 0 {
+		opts = append(opts, loader.WithCredentialProvider(loader.TokenCredentials(rc.Tokens)))
+	}
+	return opts, nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/katungi/edon/internal/config"
+	"github.com/katungi/edon/internal/modules/loader"
+)
+
+var DoctorCmd = flag.NewFlagSet("doctor", flag.ExitOnError)
+
+// pingTimeout bounds the registry check so an unreachable host doesn't hang
+const pingTimeout = 10 * time.Second
+
+// doctorCheck is one diagnostic. run returns what it found, or an error
+// that fix suggests how to resolve.
+type doctorCheck struct {
+	name string
+	run  func() (string, error)
+	fix  string
+}
+
+// HandleDoctor checks the environment edon depends on and prints a pass or
+// fail line for each check, with a suggested fix for failures. It fails if
+// any check does.
+func HandleDoctor() error {
+	dir, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get current directory: %w", err)
+	}
+
+	// Later checks fall back to the defaults if the project config is broken
+	cfg := &config.Config{}
+	var opts []loader.Option
+	var pm *loader.NPMPackageManager
+
+	checks := []doctorCheck{
+		{
+			name: "home directory",
+			run:  os.UserHomeDir,
+			fix:  "set HOME, or set EDON_CACHE_DIR so edon doesn't need it",
+		},
+		{
+			name: "project config",
+			run: func() (string, error) {
+				loaded, err := config.Load(dir)
+				if err != nil {
+					return "", err
+				}
+				cfg = loaded
+				if opts, err = projectOptions(); err != nil {
+					return "", err
+				}
+				if cfg.Path == "" {
+					return "none found, using defaults", nil
+				}
+				return cfg.Path, nil
+			},
+			fix: "fix the reported problem in edon.json or deno.json",
+		},
+		{
+			name: manifestFile,
+			run: func() (string, error) {
+				if _, err := readManifest(dir); os.IsNotExist(err) {
+					return "none found", nil
+				} else if err != nil {
+					return "", err
+				}
+				return "parses", nil
+			},
+			fix: "fix the JSON syntax in " + manifestFile,
+		},
+		{
+			name: "lockfile",
+			run: func() (string, error) {
+				if cfg.Lock == "" {
+					return "not configured", nil
+				}
+				data, err := os.ReadFile(cfg.Lock)
+				if os.IsNotExist(err) {
+					return cfg.Lock + " not created yet", nil
+				} else if err != nil {
+					return "", err
+				}
+				if !json.Valid(data) {
+					return "", fmt.Errorf("%s isn't valid JSON", cfg.Lock)
+				}
+				return cfg.Lock + " parses", nil
+			},
+			fix: "restore the lockfile from version control, or delete it so it is regenerated",
+		},
+		{
+			name: "cache directory",
+			run: func() (string, error) {
+				var err error
+				if pm, err = loader.NewNPMPackageManager(opts...); err != nil {
+					return "", err
+				}
+				return pm.CacheDir() + " is writable", nil
+			},
+			fix: "check the directory's permissions, or point --cache-dir or EDON_CACHE_DIR somewhere writable",
+		},
+		{
+			name: "registry",
+			run: func() (string, error) {
+				if pm == nil {
+					return "", fmt.Errorf("skipped until the cache directory check passes")
+				}
+				ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+				defer cancel()
+				if err := pm.Ping(ctx); err != nil {
+					return "", err
+				}
+				return pm.Registry() + " is reachable", nil
+			},
+			fix: "check your network and proxy settings (HTTPS_PROXY), or set \"registry\" in edon.json to a mirror",
+		},
+	}
+
+	failed := 0
+	for _, check := range checks {
+		detail, err := check.run()
+		if err != nil {
+			failed++
+			color.Red("✗ %s: %v", check.name, err)
+			fmt.Printf("  fix: %s\n", check.fix)
+			continue
+		}
+		color.Green("✓ %s: %s", check.name, detail)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, len(checks))
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/katungi/edon/internal/modules/loader"
+	"github.com/katungi/edon/internal/runtime"
+)
+
+var ExecCmd = flag.NewFlagSet("exec", flag.ExitOnError)
+
+// HandleExec installs a package if it isn't cached and runs one of its bins
+// with the arguments after "--", like npx. A package with several bins
+// needs the bin named after the package.
+func HandleExec() error {
+	positional, args := ExecCmd.Args(), []string(nil)
+	if i := slices.Index(positional, "--"); i >= 0 {
+		positional, args = positional[:i], positional[i+1:]
+	}
+	if len(positional) == 0 || len(positional) > 2 {
+		return fmt.Errorf("usage: edon exec <package> [bin] [-- args...]")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	opts, err := projectOptions()
+	if err != nil {
+		return err
+	}
+	pm, err := loader.NewNPMPackageManager(opts...)
+	if err != nil {
+		return fmt.Errorf("failed to initialize NPM package manager: %w", err)
+	}
+	installed, err := pm.InstallPackage(ctx, positional[0])
+	if err != nil {
+		return fmt.Errorf("failed to install %s: %w", positional[0], err)
+	}
+
+	bin, err := pickBin(installed, positional[1:])
+	if err != nil {
+		return err
+	}
+	opts = append(opts, loader.WithLogger(loadEventLogger(false)))
+	ml := loader.NewModuleLoader(opts...)
+	module, err := ml.LoadModule(ctx, bin)
+	if err != nil {
+		return fmt.Errorf("failed to load %s: %w", bin, err)
+	}
+
+	rt, err := runtime.New()
+	if err != nil {
+		return fmt.Errorf("failed to initialize runtime: %w", err)
+	}
+	defer rt.Close()
+	rt.SetArgs(module.URL, args)
+	return rt.RunLoaded(ctx, ml, bin)
+}
+
+// pickBin returns the file of the bin named in names, or of the package's
+// only bin when names is empty
+func pickBin(installed *loader.InstalledPackage, names []string) (string, error) {
+	pkg := installed.Name + "@" + installed.Version
+	commands := make([]string, 0, len(installed.Bins))
+	for command := range installed.Bins {
+		commands = append(commands, command)
+	}
+	sort.Strings(commands)
+
+	switch {
+	case len(commands) == 0:
+		return "", fmt.Errorf("%s has no bins to run", pkg)
+	case len(names) == 1:
+		if file, ok := installed.Bins[names[0]]; ok {
+			return file, nil
+		}
+		return "", fmt.Errorf("%s has no bin %q (it has %s)", pkg, names[0], strings.Join(commands, ", "))
+	case len(commands) > 1:
+		return "", fmt.Errorf("%s has several bins; pick one of %s with edon exec %s <bin>", pkg, strings.Join(commands, ", "), installed.Name)
+	}
+	return installed.Bins[commands[0]], nil
+}
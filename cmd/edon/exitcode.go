@@ -0,0 +1,62 @@
+package main
+
+import (
+	"io"
+	"os"
+
+	"github.com/fatih/color"
+	"github.com/katungi/edon/internal/errors"
+	"github.com/katungi/edon/internal/runtime"
+)
+
+// Exit codes edon install reports, so CI can branch on why it failed.
+// Succeeding, with or without anything to install, exits 0; flag errors
+// exit 2, as the flag package does.
+const (
+	exitFailure   = 1
+	exitNetwork   = 3
+	exitNotFound  = 4
+	exitIntegrity = 5
+)
+
+// installExitCode maps an install error to its exit code. When several
+// packages failed for different reasons, an integrity mismatch outranks a
+// missing package, which outranks a network failure.
+func installExitCode(err error) int {
+	switch {
+	case errors.Is(err, errors.ErrIntegrityMismatch):
+		return exitIntegrity
+	case errors.Is(err, errors.ErrPackageNotFound), errors.Is(err, errors.ErrVersionNotFound),
+		errors.Is(err, errors.ErrModuleNotFound):
+		return exitNotFound
+	case errors.Is(err, errors.ErrPackageFetch), errors.Is(err, errors.ErrModuleFetch),
+		errors.Is(err, errors.ErrOffline):
+		return exitNetwork
+	}
+	return exitFailure
+}
+
+// exitScript exits with the code a script passed to process.exit, if err
+// says it did, without printing anything: the script has already said why
+func exitScript(err error) {
+	var exit *runtime.ExitError
+	if errors.As(err, &exit) {
+		os.Exit(exit.Code)
+	}
+}
+
+// silenceOutput discards everything written to stdout, colored warnings
+// included, until the returned function restores it. Errors are printed
+// after it has been restored.
+func silenceOutput() (restore func()) {
+	stdout, output := os.Stdout, color.Output
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		return func() {}
+	}
+	os.Stdout, color.Output = devNull, io.Discard
+	return func() {
+		os.Stdout, color.Output = stdout, output
+		devNull.Close()
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+
+	"github.com/katungi/edon/internal/modules/loader"
+)
+
+var (
+	GraphCmd  = flag.NewFlagSet("graph", flag.ExitOnError)
+	graphJSON = GraphCmd.Bool("json", false, "Print the graph as JSON")
+	graphDot  = GraphCmd.Bool("dot", false, "Print the graph in Graphviz DOT format")
+)
+
+// graphNode is a module in the import graph. A module imported from several
+// places is expanded once; later occurrences are marked Deduped, and imports
+// back into the current path are marked Cycle instead of being followed.
+type graphNode struct {
+	URL     string             `json:"url"`
+	Type    loader.PackageType `json:"type,omitempty"`
+	Imports []*graphNode       `json:"imports,omitempty"`
+	Cycle   bool               `json:"cycle,omitempty"`
+	Deduped bool               `json:"deduped,omitempty"`
+	Error   string             `json:"error,omitempty"`
+}
+
+// graphBuilder walks the import graph, sharing one loader so every module is
+// fetched at most once
+type graphBuilder struct {
+	ml      *loader.ModuleLoader
+	visited map[string]bool
+	onPath  map[string]bool
+}
+
+func HandleGraph() error {
+	if GraphCmd.NArg() < 1 {
+		return fmt.Errorf("entry specifier is required")
+	}
+	if *graphJSON && *graphDot {
+		return fmt.Errorf("--json and --dot can't be used together")
+	}
+	entry := GraphCmd.Arg(0)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	// Plain file names like "index.js" are treated as local paths
+	if info, err := os.Stat(entry); err == nil && !info.IsDir() {
+		abs, err := filepath.Abs(entry)
+		if err != nil {
+			return fmt.Errorf("failed to resolve %s: %w", entry, err)
+		}
+		entry = abs
+	}
+
+	opts, err := projectOptions()
+	if err != nil {
+		return err
+	}
+
+	b := &graphBuilder{
+		ml:      loader.NewModuleLoader(opts...),
+		visited: make(map[string]bool),
+		onPath:  make(map[string]bool),
+	}
+	root := b.visit(ctx, entry)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	switch {
+	case *graphJSON:
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(root)
+	case *graphDot:
+		printGraphDot(root)
+	default:
+		printGraphTree(root)
+	}
+	return nil
+}
+
+// visit loads specifier and, the first time it's seen, its imports
+func (b *graphBuilder) visit(ctx context.Context, specifier string) *graphNode {
+	node := &graphNode{URL: specifier, Type: loader.ValidateURL(specifier).PackageType}
+	switch {
+	case b.onPath[specifier]:
+		node.Cycle = true
+		return node
+	case b.visited[specifier]:
+		node.Deduped = true
+		return node
+	}
+	b.visited[specifier] = true
+	b.onPath[specifier] = true
+	defer delete(b.onPath, specifier)
+
+	module, err := b.ml.LoadModule(ctx, specifier)
+	if err != nil {
+		node.Error = err.Error()
+		return node
+	}
+	node.Type = module.Type
+
+	imports, err := b.ml.Imports(module)
+	if err != nil {
+		node.Error = err.Error()
+		return node
+	}
+	for _, imp := range imports {
+		resolved, err := b.ml.ResolveImport(module, imp)
+		if err != nil {
+			node.Imports = append(node.Imports, &graphNode{URL: imp, Error: err.Error()})
+			continue
+		}
+		node.Imports = append(node.Imports, b.visit(ctx, resolved))
+	}
+	return node
+}
+
+// label describes a node for the tree output
+func (n *graphNode) label() string {
+	label := n.URL
+	if n.Type != "" {
+		label += fmt.Sprintf(" [%s]", n.Type)
+	}
+	switch {
+	case n.Cycle:
+		label += " (cycle)"
+	case n.Deduped:
+		label += " (deduped)"
+	case n.Error != "":
+		label += fmt.Sprintf(" (error: %s)", n.Error)
+	}
+	return label
+}
+
+// printGraphTree prints the graph as an indented tree
+func printGraphTree(root *graphNode) {
+	fmt.Println(root.label())
+	printGraphChildren(root, "")
+}
+
+func printGraphChildren(node *graphNode, prefix string) {
+	for i, child := range node.Imports {
+		branch, indent := "├── ", "│   "
+		if i == len(node.Imports)-1 {
+			branch, indent = "└── ", "    "
+		}
+		fmt.Println(prefix + branch + child.label())
+		printGraphChildren(child, prefix+indent)
+	}
+}
+
+// printGraphDot prints the graph in Graphviz DOT format, one node per module
+func printGraphDot(root *graphNode) {
+	fmt.Println("digraph imports {")
+	seen := make(map[string]bool)
+	var walk func(n *graphNode)
+	walk = func(n *graphNode) {
+		if !seen[n.URL] {
+			seen[n.URL] = true
+			fmt.Printf("  %q [label=%q];\n", n.URL, fmt.Sprintf("%s\n%s", n.URL, n.Type))
+		}
+		for _, child := range n.Imports {
+			fmt.Printf("  %q -> %q;\n", n.URL, child.URL)
+			walk(child)
+		}
+	}
+	walk(root)
+	fmt.Println("}")
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/katungi/edon/internal/errors"
+	"github.com/katungi/edon/internal/modules/loader"
+)
+
+var (
+	InfoCmd  = flag.NewFlagSet("info", flag.ExitOnError)
+	infoJSON = InfoCmd.Bool("json", false, "Print the registry's metadata as JSON: the version's when one is given, the package's otherwise")
+)
+
+// HandleInfo prints what the registry knows about a package, or about one
+// of its versions when it is given as name@version
+func HandleInfo() error {
+	if InfoCmd.NArg() != 1 {
+		return fmt.Errorf("usage: edon info <package>[@version]")
+	}
+	name, spec := InfoCmd.Arg(0), ""
+	// Names may be scoped, so the version follows the last "@"
+	if at := strings.LastIndex(name, "@"); at > 0 {
+		name, spec = name[:at], name[at+1:]
+	}
+
+	opts, err := projectOptions()
+	if err != nil {
+		return err
+	}
+	pm, err := loader.NewNPMPackageManager(opts...)
+	if err != nil {
+		return fmt.Errorf("failed to initialize NPM package manager: %w", err)
+	}
+
+	ctx, stop := installContext()
+	defer stop()
+	info, err := pm.Info(ctx, name, spec)
+	switch {
+	case errors.Is(err, errors.ErrPackageNotFound):
+		return fmt.Errorf("%s is not in the registry: %w", name, err)
+	case errors.Is(err, errors.ErrRegistryAuth):
+		return fmt.Errorf("%s can't be looked up without credentials: %w", name, err)
+	case err != nil:
+		return err
+	}
+
+	if *infoJSON {
+		_, err := fmt.Fprintf(os.Stdout, "%s\n", info.Raw)
+		return err
+	}
+	printInfo(info, spec != "")
+	return nil
+}
+
+// printInfo prints a package's metadata, with the versions it has published
+// unless a single version was asked about
+func printInfo(info *loader.PackageInfo, single bool) {
+	title := info.Name
+	if info.Version != "" {
+		title += "@" + info.Version
+	}
+	color.New(color.Bold).Println(title)
+	if info.Description != "" {
+		fmt.Println(info.Description)
+	}
+	fmt.Println()
+
+	license := info.License
+	if license == "" {
+		license = "none"
+	}
+	fmt.Printf("license: %s\n", license)
+	if single {
+		fmt.Printf("tarball: %s\n", info.Tarball)
+		if info.Integrity != "" {
+			fmt.Printf("integrity: %s\n", info.Integrity)
+		}
+	} else {
+		fmt.Printf("latest: %s\n", info.Latest)
+	}
+
+	if len(info.DistTags) > 0 {
+		fmt.Println("\ndist-tags:")
+		tags := make([]string, 0, len(info.DistTags))
+		for tag := range info.DistTags {
+			tags = append(tags, tag)
+		}
+		slices.Sort(tags)
+		for _, tag := range tags {
+			fmt.Printf("  %s: %s\n", tag, info.DistTags[tag])
+		}
+	}
+
+	fmt.Printf("\ndependencies (%d):\n", len(info.Dependencies))
+	deps := make([]string, 0, len(info.Dependencies))
+	for dep := range info.Dependencies {
+		deps = append(deps, dep)
+	}
+	slices.Sort(deps)
+	for _, dep := range deps {
+		fmt.Printf("  %s: %s\n", dep, info.Dependencies[dep])
+	}
+
+	if !single {
+		fmt.Printf("\nversions (%d):\n", len(info.Versions))
+		fmt.Printf("  %s\n", strings.Join(info.Versions, ", "))
+	}
+}
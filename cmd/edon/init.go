@@ -1,20 +1,36 @@
 package main
 
 import (
-	"encoding/json"
 	"flag"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 
 	"github.com/fatih/color"
 )
 
-var InitCmd = flag.NewFlagSet("init", flag.ExitOnError)
+var (
+	InitCmd = flag.NewFlagSet("init", flag.ExitOnError)
+
+	initEntry    = InitCmd.String("entry", "index.js", "Entry file to create and use as main and the start script")
+	initForce    = InitCmd.Bool("force", false, "Overwrite an existing package.json and entry file")
+	initQuiet    = InitCmd.Bool("quiet", false, "Only print errors")
+	initIndent   = InitCmd.String("indent", "2", "Indentation for package.json: tab, 2 or 4")
+	initTemplate = InitCmd.String("template", "", "Scaffold from a template: a directory, .tgz, github:owner/repo[#ref] or tarball URL")
+	initCheck    = InitCmd.Bool("check", false, "Validate the existing package.json instead of creating one; writes nothing")
+)
+
+// defaultProjectVersion is the version new projects start at
+const defaultProjectVersion = "1.0.0"
+
+// entryExtensions are the file types edon can run as a project entry
+var entryExtensions = []string{".js", ".ts", ".mjs"}
 
 func HandleInit() error {
 	// Get current directory or use the provided path
-	dir := InitCmd.Arg(0)
+	dir := initTarget(InitCmd.Arg(0))
 	if dir == "" {
 		var err error
 		dir, err = os.Getwd()
@@ -23,40 +39,84 @@ func HandleInit() error {
 		}
 	}
 
+	if *initCheck {
+		return checkManifest(dir)
+	}
+
+	entry := filepath.ToSlash(filepath.Clean(*initEntry))
+	if !slices.Contains(entryExtensions, filepath.Ext(entry)) {
+		return fmt.Errorf("entry %s must be a .js, .ts or .mjs file", *initEntry)
+	}
+	indent, err := parseIndent(*initIndent)
+	if err != nil {
+		return err
+	}
+	if *initTemplate != "" {
+		return initFromTemplate(dir, entry, indent)
+	}
+
+	// Refuse to clobber a project that's already there, naming everything
+	// that would have been overwritten
+	entryPath := filepath.Join(dir, filepath.FromSlash(entry))
+	if !*initForce {
+		var existing []string
+		for _, path := range []string{filepath.Join(dir, manifestFile), entryPath} {
+			if _, err := os.Lstat(path); err == nil {
+				existing = append(existing, path)
+			}
+		}
+		if len(existing) > 0 {
+			return fmt.Errorf("%s already exists (use --force to overwrite)", strings.Join(existing, " and "))
+		}
+	}
+
 	// Create project directory if it doesn't exist
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return fmt.Errorf("failed to create project directory: %w", err)
 	}
 
-	// Create package.json
-	packageJSON := map[string]interface{}{
+	if err := writeDefaultManifest(dir, entry, indent); err != nil {
+		return err
+	}
+
+	// Create the entry file
+	if err := os.MkdirAll(filepath.Dir(entryPath), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(entry), err)
+	}
+	entryContent := "console.log('Hello from Edon!');"
+	if err := os.WriteFile(entryPath, []byte(entryContent), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", entry, err)
+	}
+
+	// color already drops the escapes when NO_COLOR is set or stdout isn't a terminal
+	if !*initQuiet {
+		color.Green("✓ Successfully initialized new Edon project in %s", dir)
+		color.Green("✓ Created package.json")
+		color.Green("✓ Created %s", entry)
+	}
+
+	return nil
+}
+
+// writeDefaultManifest writes the package.json of a new project to dir
+func writeDefaultManifest(dir, entry, indent string) error {
+	packageJSON := map[string]any{
 		"name":        filepath.Base(dir),
-		"version":     "1.0.0",
+		"version":     defaultProjectVersion,
 		"description": "A new Edon project",
-		"main":        "index.js",
+		"main":        entry,
 		"scripts": map[string]string{
-			"start": "edon index.js",
+			"start": "edon " + entry,
 		},
 	}
 
-	packageJSONBytes, err := json.MarshalIndent(packageJSON, "", "  ")
+	packageJSONBytes, err := encodeManifest(packageJSON, indent)
 	if err != nil {
 		return fmt.Errorf("failed to create package.json: %w", err)
 	}
 
-	if err := os.WriteFile(filepath.Join(dir, "package.json"), packageJSONBytes, 0644); err != nil {
+	if err := writeFileAtomic(filepath.Join(dir, "package.json"), packageJSONBytes); err != nil {
 		return fmt.Errorf("failed to write package.json: %w", err)
 	}
-
-	// Create index.js
-	indexJSContent := "console.log('Hello from Edon!');"
-	if err := os.WriteFile(filepath.Join(dir, "index.js"), []byte(indexJSContent), 0644); err != nil {
-		return fmt.Errorf("failed to write index.js: %w", err)
-	}
-
-	color.Green("✓ Successfully initialized new Edon project in %s", dir)
-	color.Green("✓ Created package.json")
-	color.Green("✓ Created index.js")
-
 	return nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+)
+
+// jobsEnv sets --jobs when the flag isn't given
+const jobsEnv = "EDON_JOBS"
+
+// maxDefaultJobs caps the default, so a machine with many cores doesn't
+// open as many connections to one registry at once. --jobs may go higher.
+const maxDefaultJobs = 16
+
+var jobsFlag = flag.Int("jobs", 0, "How many modules or packages every command loads or installs at once (also set by EDON_JOBS; default: one per CPU, at most 16)")
+
+// jobs is the parallelism checkJobs settled on
+var jobs int
+
+// checkJobs settles how many jobs run at once: --jobs, then EDON_JOBS, then
+// one per CPU up to maxDefaultJobs. It rejects counts below one.
+func checkJobs() error {
+	given := false
+	flag.Visit(func(f *flag.Flag) {
+		given = given || f.Name == "jobs"
+	})
+	switch env := os.Getenv(jobsEnv); {
+	case given:
+		if *jobsFlag < 1 {
+			return fmt.Errorf("invalid --jobs %d: must be at least 1", *jobsFlag)
+		}
+		jobs = *jobsFlag
+	case env != "":
+		n, err := strconv.Atoi(env)
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid %s %q: must be a number of at least 1", jobsEnv, env)
+		}
+		jobs = n
+	default:
+		jobs = min(runtime.NumCPU(), maxDefaultJobs)
+	}
+	return nil
+}
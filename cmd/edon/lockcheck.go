@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/fatih/color"
+	"github.com/katungi/edon/internal/modules/loader"
+)
+
+// lockChangeRecord is the install --check --json output object for one
+// difference between deno.lock and the resolution
+type lockChangeRecord struct {
+	Type     string `json:"type"`
+	Key      string `json:"key"`
+	Field    string `json:"field"`
+	Locked   string `json:"locked,omitempty"`
+	Resolved string `json:"resolved"`
+}
+
+// checkLock compares lock, read from path, with what roots resolved to in
+// tree, printing each difference: "+" for what the lock lacks and "~" for
+// what it records otherwise. It writes nothing, and fails if anything
+// differs, so CI can catch a package.json changed without its lock.
+func checkLock(lock *loader.DenoLock, path string, roots []string, tree []*loader.ResolvedPackage) error {
+	changes := lock.Diff(roots, tree)
+	if *installJSON {
+		for _, change := range changes {
+			if err := printJSONLine(lockChangeRecord{Type: "lock", Key: change.Key, Field: change.Field, Locked: change.Locked, Resolved: change.Resolved}); err != nil {
+				return err
+			}
+		}
+	} else if len(changes) == 0 {
+		color.Green("✓ %s matches %s", path, manifestFile)
+	} else {
+		fmt.Printf("%s doesn't match %s:\n", path, manifestFile)
+		for _, change := range changes {
+			switch {
+			case change.Field == "package":
+				fmt.Printf("  + %s\n", change.Key)
+			case change.Locked == "":
+				fmt.Printf("  + %s → %s\n", change.Key, change.Resolved)
+			case change.Field == "specifier":
+				fmt.Printf("  ~ %s: %s → %s\n", change.Key, change.Locked, change.Resolved)
+			default:
+				fmt.Printf("  ~ %s %s: %s → %s\n", change.Key, change.Field, change.Locked, change.Resolved)
+			}
+		}
+	}
+
+	switch len(changes) {
+	case 0:
+		return nil
+	case 1:
+		return fmt.Errorf("%s is out of date: 1 difference", path)
+	}
+	return fmt.Errorf("%s is out of date: %d differences", path, len(changes))
+}
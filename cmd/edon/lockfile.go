@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/katungi/edon/internal/config"
+	"github.com/katungi/edon/internal/modules/loader"
+)
+
+// packageLockFile is npm's lockfile, which edon reads to keep locked packages
+const packageLockFile = "package-lock.json"
+
+// denoLockFile is Deno's lockfile. A lock named so in edon.json is read and
+// written in Deno's format; any other is taken to be in npm's.
+const denoLockFile = "deno.lock"
+
+// isDenoLock reports whether the lockfile at path is in Deno's format
+func isDenoLock(path string) bool {
+	return filepath.Base(path) == denoLockFile
+}
+
+// lockedPackages returns the "name@version" of every package pinned by the
+// lockfiles among paths that exist. It understands npm's lockfile formats,
+// the "packages" map keyed by node_modules path and the older nested
+// "dependencies" tree, and deno.lock.
+func lockedPackages(paths ...string) ([]string, error) {
+	var locked []string
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if isDenoLock(path) {
+			lock, err := loader.ParseDenoLock(data)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+			}
+			locked = append(locked, lock.Packages()...)
+			continue
+		}
+
+		var lock struct {
+			Packages map[string]struct {
+				Version string `json:"version"`
+			} `json:"packages"`
+			Dependencies map[string]lockDependency `json:"dependencies"`
+		}
+		if err := json.Unmarshal(data, &lock); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		for key, pkg := range lock.Packages {
+			i := strings.LastIndex(key, "node_modules/")
+			if i == -1 || pkg.Version == "" {
+				// The root project has an empty key
+				continue
+			}
+			locked = append(locked, key[i+len("node_modules/"):]+"@"+pkg.Version)
+		}
+		locked = appendLockDependencies(locked, lock.Dependencies)
+	}
+	return locked, nil
+}
+
+// lockDependency is an entry of the nested "dependencies" tree of lockfile
+// version 1
+type lockDependency struct {
+	Version      string                    `json:"version"`
+	Requires     map[string]string         `json:"requires"`
+	Dependencies map[string]lockDependency `json:"dependencies"`
+}
+
+// appendLockDependencies appends each package of a version 1 dependency
+// tree, nested ones included
+func appendLockDependencies(locked []string, deps map[string]lockDependency) []string {
+	for name, dep := range deps {
+		if dep.Version != "" {
+			locked = append(locked, name+"@"+dep.Version)
+		}
+		locked = appendLockDependencies(locked, dep.Dependencies)
+	}
+	return locked
+}
+
+// lockedTree reads the packages a lockfile pins along with the dependency
+// ranges each one declares, the same shape ResolveTree returns. Each
+// name@version appears once however often it's nested.
+func lockedTree(path string) ([]*loader.ResolvedPackage, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var lock struct {
+		Packages map[string]struct {
+			Name                 string            `json:"name"`
+			Version              string            `json:"version"`
+			Dependencies         map[string]string `json:"dependencies"`
+			OptionalDependencies map[string]string `json:"optionalDependencies"`
+		} `json:"packages"`
+		Dependencies map[string]lockDependency `json:"dependencies"`
+	}
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	seen := make(map[string]bool)
+	var tree []*loader.ResolvedPackage
+	add := func(pkg *loader.ResolvedPackage) {
+		if !seen[pkg.String()] {
+			seen[pkg.String()] = true
+			tree = append(tree, pkg)
+		}
+	}
+	for key, entry := range lock.Packages {
+		i := strings.LastIndex(key, "node_modules/")
+		if i == -1 || entry.Version == "" {
+			continue
+		}
+		pkg := &loader.ResolvedPackage{Name: entry.Name, Version: entry.Version, Dependencies: entry.Dependencies}
+		if pkg.Name == "" {
+			pkg.Name = key[i+len("node_modules/"):]
+		}
+		for name, spec := range entry.OptionalDependencies {
+			if pkg.Dependencies == nil {
+				pkg.Dependencies = make(map[string]string)
+			}
+			pkg.Dependencies[name] = spec
+		}
+		add(pkg)
+	}
+	// Version 1 lockfiles have no "packages" map
+	var walk func(deps map[string]lockDependency)
+	walk = func(deps map[string]lockDependency) {
+		for name, dep := range deps {
+			if dep.Version != "" {
+				add(&loader.ResolvedPackage{Name: name, Version: dep.Version, Dependencies: dep.Requires})
+			}
+			walk(dep.Dependencies)
+		}
+	}
+	if len(lock.Packages) == 0 {
+		walk(lock.Dependencies)
+	}
+	return tree, nil
+}
+
+// projectDenoLock returns the deno.lock the project config names as its
+// lock, empty when the file doesn't exist yet, along with its path. Both are
+// empty when the config names no lock, or one in npm's format.
+func projectDenoLock() (*loader.DenoLock, string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get current directory: %w", err)
+	}
+	cfg, err := config.Load(dir)
+	if err != nil || !isDenoLock(cfg.Lock) {
+		return nil, "", err
+	}
+
+	data, err := os.ReadFile(cfg.Lock)
+	if os.IsNotExist(err) {
+		return loader.NewDenoLock(), cfg.Lock, nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	lock, err := loader.ParseDenoLock(data)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to parse %s: %w", cfg.Lock, err)
+	}
+	return lock, cfg.Lock, nil
+}
+
+// writeDenoLock writes lock to path
+func writeDenoLock(path string, lock *loader.DenoLock) error {
+	data, err := lock.Encode()
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", path, err)
+	}
+	if err := writeFileAtomic(path, data); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
@@ -8,6 +8,7 @@ import (
 	"runtime/debug"
 
 	"github.com/fatih/color"
+	"github.com/katungi/edon/internal/errors"
 	"github.com/katungi/edon/internal/runtime"
 )
 
@@ -16,34 +17,136 @@ var (
 	evalScript  = flag.String("eval", "", "Evaluate a JavaScript expression")
 	showVersion = flag.Bool("version", false, "Show version information")
 	showHelp    = flag.Bool("help", false, "Show help information")
+	cacheDir    = flag.String("cache-dir", "", "Base cache directory for every command, overriding edon.json and EDON_CACHE_DIR")
 )
 
 func main() {
-	if len(os.Args) > 1 {
-		switch os.Args[1] {
+	// Global flags come before the subcommand, which ends flag parsing
+	flag.Usage = printHelp
+	flag.Parse()
+	if err := checkOutputFormat(); err != nil {
+		color.Red("Error: %v", err)
+		os.Exit(2)
+	}
+	if err := checkJobs(); err != nil {
+		reportError(err)
+		os.Exit(2)
+	}
+	if err := enterWorkDir(flag.Arg(0)); err != nil {
+		reportError(err)
+		os.Exit(2)
+	}
+
+	if flag.NArg() > 0 {
+		args := flag.Args()[1:]
+		// Before parsing, so a command's own --json=false still wins
+		enableJSON()
+		switch flag.Arg(0) {
 		case "install":
-			InstallCmd.Parse(os.Args[2:])
+			InstallCmd.Parse(args)
 			if err := HandleInstall(); err != nil {
-				color.Red("Error: %v", err)
+				reportError(err)
+				os.Exit(installExitCode(err))
+			}
+			return
+		case "update":
+			// An alias of install --update, taking the same flags
+			InstallCmd.Parse(args)
+			*installUpdate = true
+			if err := HandleInstall(); err != nil {
+				reportError(err)
+				os.Exit(installExitCode(err))
+			}
+			return
+		case "add":
+			AddCmd.Parse(args)
+			if err := HandleAdd(); err != nil {
+				reportError(err)
 				os.Exit(1)
 			}
 			return
 		case "init":
-			InitCmd.Parse(os.Args[2:])
+			InitCmd.Parse(args)
 			if err := HandleInit(); err != nil {
-				color.Red("Error: %v", err)
+				reportError(err)
+				os.Exit(1)
+			}
+			return
+		case "warm":
+			WarmCmd.Parse(args)
+			if err := HandleWarm(); err != nil {
+				reportError(err)
+				os.Exit(1)
+			}
+			return
+		case "cache":
+			CacheCmd.Parse(args)
+			if err := HandleCache(); err != nil {
+				reportError(err)
+				os.Exit(1)
+			}
+			return
+		case "doctor":
+			DoctorCmd.Parse(args)
+			if err := HandleDoctor(); err != nil {
+				reportError(err)
+				os.Exit(1)
+			}
+			return
+		case "outdated":
+			OutdatedCmd.Parse(args)
+			if err := HandleOutdated(); err != nil {
+				reportError(err)
+				os.Exit(1)
+			}
+			return
+		case "info":
+			InfoCmd.Parse(args)
+			if err := HandleInfo(); err != nil {
+				reportError(err)
+				os.Exit(1)
+			}
+			return
+		case "why":
+			WhyCmd.Parse(args)
+			if err := HandleWhy(); err != nil {
+				reportError(err)
+				os.Exit(1)
+			}
+			return
+		case "exec":
+			ExecCmd.Parse(args)
+			if err := HandleExec(); err != nil {
+				exitScript(err)
+				if !errors.Is(err, runtime.ErrInterrupt) {
+					reportError(err)
+				}
+				os.Exit(1)
+			}
+			return
+		case "graph":
+			GraphCmd.Parse(args)
+			if err := HandleGraph(); err != nil {
+				reportError(err)
+				os.Exit(1)
+			}
+			return
+		case "run":
+			RunCmd.Parse(args)
+			if err := HandleRun(); err != nil {
+				exitScript(err)
+				if !errors.Is(err, runtime.ErrInterrupt) {
+					reportError(err)
+				}
 				os.Exit(1)
 			}
 			return
 		}
 	}
 
-	flag.Usage = printHelp
-	flag.Parse()
-
 	if err := run(); err != nil {
 		if err != runtime.ErrExit && err != runtime.ErrInterrupt {
-			color.Red("Error: %v", err)
+			reportError(err)
 		}
 
 		os.Exit(1)
@@ -117,9 +220,15 @@ Halo JavaScript Runtime
 
 Usage:
   %s [options] [file]
+  %s run <specifier>
+  %s graph [--json|--dot] <specifier>
 
 Options:
   -eval string    Execute a JavaScript expression
+  -cache-dir dir  Use dir as the cache directory (before any subcommand)
+  -dir, -C dir    Work in dir rather than the current directory (before any subcommand)
+  -output format  Print errors, and results where a command has them, as text or json
+  -jobs n         Load or install n modules or packages at once (default: one per CPU, at most 16; or set EDON_JOBS)
   -version        Show version information
   -help           Show this help message
 
@@ -132,6 +241,12 @@ Examples:
 
   # Evaluate expression
   %s -eval "console.log('Hello, World!')"
+
+  # Run a local or remote module
+  %s run npm:cowsay
+
+  # Show what a module imports
+  %s graph main.js
 `
-	fmt.Printf(help, exe, exe, exe, exe)
+	fmt.Printf(help, exe, exe, exe, exe, exe, exe, exe, exe)
 }
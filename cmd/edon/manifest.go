@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/katungi/edon/internal/modules/loader"
+)
+
+// manifestFile is the project manifest read by install and updated by add
+const manifestFile = "package.json"
+
+// readManifest reads package.json from dir as a generic map so fields edon
+// doesn't know about survive a rewrite
+func readManifest(dir string) (map[string]any, error) {
+	data, err := os.ReadFile(filepath.Join(dir, manifestFile))
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest map[string]any
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", manifestFile, err)
+	}
+	return manifest, nil
+}
+
+// writeManifest writes package.json to dir, keeping the indentation the
+// file already uses
+func writeManifest(dir string, manifest map[string]any) error {
+	indent := defaultIndent
+	if existing, err := os.ReadFile(filepath.Join(dir, manifestFile)); err == nil {
+		indent = detectIndent(existing)
+	}
+
+	data, err := encodeManifest(manifest, indent)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", manifestFile, err)
+	}
+
+	if err := writeFileAtomic(filepath.Join(dir, manifestFile), data); err != nil {
+		return fmt.Errorf("failed to write %s: %w", manifestFile, err)
+	}
+	return nil
+}
+
+// defaultIndent is the indentation new manifests are written with
+const defaultIndent = "  "
+
+// manifestKeyOrder is the conventional order of package.json's top-level
+// fields. Other fields follow them alphabetically.
+var manifestKeyOrder = []string{
+	"name", "version", "private", "description", "keywords", "homepage", "bugs",
+	"license", "author", "contributors", "repository", "type", "main", "module",
+	"types", "exports", "bin", "files", "scripts", "dependencies",
+	"devDependencies", "peerDependencies", "optionalDependencies", "engines",
+}
+
+// encodeManifest encodes a manifest with its top-level keys in conventional
+// order, so rewrites don't reshuffle the file
+func encodeManifest(manifest map[string]any, indent string) ([]byte, error) {
+	keys := make([]string, 0, len(manifest))
+	for key := range manifest {
+		keys = append(keys, key)
+	}
+	rank := func(key string) int {
+		if i := slices.Index(manifestKeyOrder, key); i != -1 {
+			return i
+		}
+		return len(manifestKeyOrder)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if ri, rj := rank(keys[i]), rank(keys[j]); ri != rj {
+			return ri < rj
+		}
+		return keys[i] < keys[j]
+	})
+
+	var buf bytes.Buffer
+	buf.WriteString("{")
+	for i, key := range keys {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		name, err := encodeJSON(key, "", "")
+		if err != nil {
+			return nil, err
+		}
+		value, err := encodeJSON(manifest[key], indent, indent)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&buf, "\n%s%s: %s", indent, name, value)
+	}
+	if len(keys) > 0 {
+		buf.WriteString("\n")
+	}
+	buf.WriteString("}\n")
+	return buf.Bytes(), nil
+}
+
+// encodeJSON marshals v like json.MarshalIndent, without escaping the "&",
+// "<" and ">" that scripts are full of
+func encodeJSON(v any, prefix, indent string) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent(prefix, indent)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// detectIndent returns the indentation of the first indented line of data,
+// or defaultIndent if there is none
+func detectIndent(data []byte) string {
+	for _, line := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed != "" && len(trimmed) < len(line) {
+			return line[:len(line)-len(trimmed)]
+		}
+	}
+	return defaultIndent
+}
+
+// parseIndent maps an --indent value to the indentation it stands for
+func parseIndent(value string) (string, error) {
+	switch value {
+	case "tab":
+		return "\t", nil
+	case "2", "4":
+		n, _ := strconv.Atoi(value)
+		return strings.Repeat(" ", n), nil
+	}
+	return "", fmt.Errorf("invalid --indent %q: use tab, 2 or 4", value)
+}
+
+// writeFileAtomic replaces path with data through a temporary file in the
+// same directory, so a crash mid-write never leaves a half-written file. An
+// existing file keeps its permissions; new files are created 0644.
+func writeFileAtomic(path string, data []byte) error {
+	perm := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	// Removing after a successful rename is a harmless no-op
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	// Flush to disk first so the rename can't expose an empty file after a crash
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// dependencyBlock returns the named dependency block (e.g. "dependencies"),
+// creating it in the manifest if it doesn't exist
+func dependencyBlock(manifest map[string]any, field string) map[string]any {
+	block, ok := manifest[field].(map[string]any)
+	if !ok {
+		block = make(map[string]any)
+		manifest[field] = block
+	}
+	return block
+}
+
+// dependencySpecs returns "name@range" specifiers for the named dependency
+// blocks, sorted for a stable install order
+func dependencySpecs(manifest map[string]any, fields ...string) []string {
+	var specs []string
+	for _, field := range fields {
+		block, ok := manifest[field].(map[string]any)
+		if !ok {
+			continue
+		}
+		for name, value := range block {
+			if version, ok := value.(string); ok {
+				specs = append(specs, name+"@"+version)
+			}
+		}
+	}
+	sort.Strings(specs)
+	return specs
+}
+
+// manifestWorkspaces returns the packages matched by the "workspaces" field
+// of the package.json in dir, which is either a list of globs or, as yarn
+// writes it, an object with the list under "packages"
+func manifestWorkspaces(dir string, manifest map[string]any) ([]*loader.Workspace, error) {
+	field := manifest["workspaces"]
+	if object, ok := field.(map[string]any); ok {
+		field = object["packages"]
+	}
+	if field == nil {
+		return nil, nil
+	}
+	list, ok := field.([]any)
+	if !ok {
+		return nil, fmt.Errorf("%s: workspaces must be a list of globs", manifestFile)
+	}
+	patterns := make([]string, 0, len(list))
+	for _, item := range list {
+		pattern, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s: workspaces must be a list of globs", manifestFile)
+		}
+		patterns = append(patterns, pattern)
+	}
+	workspaces, err := loader.FindWorkspaces(dir, patterns)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", manifestFile, err)
+	}
+	return workspaces, nil
+}
+
+// workspaceSpecs returns the dependency specs of a workspace, including its
+// devDependencies when dev is set
+func workspaceSpecs(ws *loader.Workspace, dev bool) []string {
+	var specs []string
+	for name, version := range ws.Dependencies {
+		specs = append(specs, name+"@"+version)
+	}
+	if dev {
+		for name, version := range ws.DevDependencies {
+			specs = append(specs, name+"@"+version)
+		}
+	}
+	sort.Strings(specs)
+	return specs
+}
+
+// overrideOptions returns the loader option for the "overrides" block of the
+// package.json in dir, if it has one. Overrides apply to every resolution in
+// the project, including installs of named packages.
+func overrideOptions(dir string) ([]loader.Option, error) {
+	manifest, err := readManifest(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	block, ok := manifest["overrides"].(map[string]any)
+	if !ok {
+		return nil, nil
+	}
+	overrides, err := loader.ParseOverrides(block)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", manifestFile, err)
+	}
+	return []loader.Option{loader.WithOverrides(overrides)}, nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/fatih/color"
+	"github.com/katungi/edon/internal/modules/loader"
+)
+
+// manifestProblem is something wrong with package.json, at a 1-based line,
+// or 0 when the problem isn't on any one line
+type manifestProblem struct {
+	line    int
+	message string
+}
+
+// checkManifest validates the package.json in dir without writing anything:
+// it must parse, have a valid name and a semver version, and its main, if
+// set, must name an existing file. Each problem is printed with the line it
+// is on, and checkManifest fails if there were any.
+func checkManifest(dir string) error {
+	path := filepath.Join(dir, manifestFile)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("no %s found in %s", manifestFile, dir)
+	}
+	if err != nil {
+		return err
+	}
+
+	problems := manifestProblems(dir, data)
+	if len(problems) == 0 {
+		if !*initQuiet {
+			color.Green("✓ %s is valid", path)
+		}
+		return nil
+	}
+
+	lines := bytes.Split(data, []byte("\n"))
+	for _, p := range problems {
+		if p.line == 0 {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", path, p.message)
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "%s:%d: %s\n", path, p.line, p.message)
+		if p.line <= len(lines) {
+			fmt.Fprintf(os.Stderr, "    %s\n", bytes.TrimSpace(lines[p.line-1]))
+		}
+	}
+	if len(problems) == 1 {
+		return fmt.Errorf("%s has a problem", manifestFile)
+	}
+	return fmt.Errorf("%s has %d problems", manifestFile, len(problems))
+}
+
+// manifestProblems returns the problems with data, the contents of the
+// package.json in dir
+func manifestProblems(dir string, data []byte) []manifestProblem {
+	var manifest map[string]any
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		line := 0
+		switch err := err.(type) {
+		case *json.SyntaxError:
+			line = lineAt(data, err.Offset)
+		case *json.UnmarshalTypeError:
+			line = lineAt(data, err.Offset)
+		}
+		return []manifestProblem{{line: line, message: "invalid JSON: " + err.Error()}}
+	}
+
+	lines := manifestKeyLines(data)
+	var problems []manifestProblem
+	field := func(key string) (string, bool) {
+		value, ok := manifest[key]
+		if !ok {
+			problems = append(problems, manifestProblem{message: "missing " + key})
+			return "", false
+		}
+		s, ok := value.(string)
+		if !ok {
+			problems = append(problems, manifestProblem{lines[key], key + " must be a string"})
+		}
+		return s, ok
+	}
+	problem := func(key string, err error) {
+		problems = append(problems, manifestProblem{lines[key], fmt.Sprintf("%s: %v", key, err)})
+	}
+
+	if name, ok := field("name"); ok {
+		if err := loader.ValidatePackageName(name); err != nil {
+			problem("name", err)
+		}
+	}
+	if version, ok := field("version"); ok {
+		if err := loader.ValidateVersion(version); err != nil {
+			problem("version", err)
+		}
+	}
+	if _, set := manifest["main"]; set {
+		if main, ok := field("main"); ok {
+			info, err := os.Stat(filepath.Join(dir, filepath.FromSlash(main)))
+			switch {
+			case err != nil:
+				problem("main", fmt.Errorf("%s doesn't exist", main))
+			case info.IsDir():
+				problem("main", fmt.Errorf("%s is a directory", main))
+			}
+		}
+	}
+	return problems
+}
+
+// manifestKeyLines returns the line each top-level key of the JSON object
+// in data is on
+func manifestKeyLines(data []byte) map[string]int {
+	lines := make(map[string]int)
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return lines
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return lines
+		}
+		// The offset is just past the key, which is on the line it ends on
+		if key, ok := tok.(string); ok {
+			lines[key] = lineAt(data, dec.InputOffset())
+		}
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return lines
+		}
+	}
+	return lines
+}
+
+// lineAt returns the 1-based line of the byte at offset in data
+func lineAt(data []byte, offset int64) int {
+	offset = min(max(offset, 0), int64(len(data)))
+	return bytes.Count(data[:offset], []byte("\n")) + 1
+}
@@ -2,34 +2,704 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
 
+	"github.com/fatih/color"
 	"github.com/katungi/edon/internal/modules/loader"
 )
 
 var (
-	InstallCmd = flag.NewFlagSet("install", flag.ExitOnError)
+	InstallCmd       = flag.NewFlagSet("install", flag.ExitOnError)
+	installRegistry  = InstallCmd.String("registry", "", "Install from this registry instead of the configured one")
+	installDryRun    = InstallCmd.Bool("dry-run", false, "Resolve and list the packages that would be installed without downloading them")
+	installJSON      = InstallCmd.Bool("json", false, "Print one JSON object per package and a final summary object")
+	installReload    = reloadVar(InstallCmd)
+	installIntegrity = InstallCmd.Bool("print-integrity", false, "Download the packages and print their SRI integrity instead of installing them")
+	installProd      = InstallCmd.Bool("production", false, "Install only dependencies from package.json, skipping devDependencies (also set by EDON_ENV=production)")
+	installStrict    = InstallCmd.Bool("strict-engines", false, "Fail instead of warning when a package's engines field doesn't match the runtime")
+	installSilent    = InstallCmd.Bool("silent", false, "Print nothing but errors; the exit code still says how the install went")
+	installFailFast  = InstallCmd.Bool("fail-fast", false, "Stop at the first package that fails to install instead of attempting them all")
+	installUpdate    = InstallCmd.Bool("update", false, "Install the newest versions package.json allows instead of those deno.lock pins, for the named packages or all of them, and rewrite the lock")
+	installMaxDepth  = InstallCmd.Int("max-depth", -1, "Resolve at most this many levels of dependencies; 0 installs only the named packages, -1 sets no limit")
+	installNoOpt     = InstallCmd.Bool("no-optional", false, "Skip optionalDependencies instead of installing those that are available")
+	installCheck     = InstallCmd.Bool("check", false, "Compare what package.json resolves to with deno.lock, printing the differences and failing if there are any, without installing or writing anything")
 )
 
+// installRecord is the --json output for a single package
+type installRecord struct {
+	Type    string `json:"type"`
+	Name    string `json:"name,omitempty"`
+	Version string `json:"version,omitempty"`
+	Path    string `json:"path,omitempty"`
+	Bytes   int64  `json:"bytes"`
+	// Cache is "hit" when the package was already installed, "miss" when it
+	// was downloaded, "local" when it came from a path and "linked" when it
+	// is a workspace; dry runs of registry packages leave it empty
+	Cache string `json:"cache,omitempty"`
+	// Integrity is the tarball's SRI digest, printed by --print-integrity
+	Integrity string `json:"integrity,omitempty"`
+	// Warnings lists the package's unmet engines requirements and the
+	// install scripts edon didn't run
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// workspaceRecord is the --json output object for one workspace, listing
+// the "name@version" its dependencies resolved to
+type workspaceRecord struct {
+	Type         string   `json:"type"`
+	Name         string   `json:"name"`
+	Version      string   `json:"version"`
+	Path         string   `json:"path"`
+	Dependencies []string `json:"dependencies"`
+}
+
+// updateRecord is the --json output object for a package --update changed.
+// From is empty for a package the lock didn't have.
+type updateRecord struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+	From string `json:"from,omitempty"`
+	To   string `json:"to"`
+}
+
+// installSummary is the final --json output object
+type installSummary struct {
+	Type       string `json:"type"`
+	Packages   int    `json:"packages"`
+	Downloaded int    `json:"downloaded"`
+	Cached     int    `json:"cached"`
+	Bytes      int64  `json:"bytes"`
+	DryRun     bool   `json:"dryRun,omitempty"`
+	// Linked counts workspace packages linked rather than installed
+	Linked int `json:"linked,omitempty"`
+	// Truncated counts packages whose dependencies --max-depth left out
+	Truncated int `json:"truncated,omitempty"`
+	// Skipped counts the devDependencies --production left out
+	Skipped int `json:"skipped,omitempty"`
+	// Warnings lists the peer dependencies the installed tree doesn't meet
+	Warnings []string `json:"warnings,omitempty"`
+	// SkippedOptional lists the optionalDependencies left out because they
+	// couldn't be resolved or installed
+	SkippedOptional []string `json:"skippedOptional,omitempty"`
+}
+
+// envVar names the deployment environment; "production" implies --production
+const envVar = "EDON_ENV"
+
+// productionInstall reports whether install should skip devDependencies
+func productionInstall() bool {
+	return *installProd || os.Getenv(envVar) == "production"
+}
+
+// HandleInstall installs the named packages, or every dependency declared in
+// package.json when no packages are given, along with their transitive
+// dependencies. Unlike add, it never modifies package.json. With --update the
+// arguments instead name the packages whose deno.lock pins are lifted, and
+// with --check nothing is installed: package.json is only compared with the
+// lock.
 func HandleInstall() error {
-	if InstallCmd.NArg() < 1 {
-		return fmt.Errorf("package name is required")
+	if *installSilent {
+		defer silenceOutput()()
+	}
+	if *installCheck {
+		switch {
+		case *installUpdate:
+			return fmt.Errorf("--check and --update can't be used together")
+		case *installDryRun:
+			return fmt.Errorf("--check and --dry-run can't be used together")
+		case *installIntegrity:
+			return fmt.Errorf("--check and --print-integrity can't be used together")
+		case InstallCmd.NArg() > 0:
+			return fmt.Errorf("--check compares package.json with the lock and takes no packages")
+		}
+	}
+
+	// Reject a bad registry before reading anything or touching the network
+	if *installRegistry != "" {
+		if err := validateRegistryURL(*installRegistry); err != nil {
+			return err
+		}
 	}
 
-	pm, err := loader.NewNPMPackageManager()
+	packages := InstallCmd.Args()
+	// An update always installs package.json; its arguments name what to
+	// update
+	var updating []string
+	if *installUpdate {
+		updating, packages = packages, nil
+		for _, name := range updating {
+			if err := loader.ValidatePackageName(name); err != nil {
+				return err
+			}
+		}
+	}
+	skipped := 0
+	// Workspaces are only installed with the rest of package.json, as are
+	// its optionalDependencies
+	var workspaces []*loader.Workspace
+	var optional []string
+	if len(packages) == 0 {
+		dir, err := os.Getwd()
+		if err != nil {
+			return fmt.Errorf("failed to get current directory: %w", err)
+		}
+		manifest, err := readManifest(dir)
+		if os.IsNotExist(err) {
+			return fmt.Errorf("package name is required when no %s is present", manifestFile)
+		}
+		if err != nil {
+			return err
+		}
+		if productionInstall() {
+			packages = dependencySpecs(manifest, "dependencies")
+			skipped = len(dependencySpecs(manifest, "devDependencies"))
+		} else {
+			packages = dependencySpecs(manifest, "dependencies", "devDependencies")
+		}
+		if !*installNoOpt {
+			// As in npm, a dependency also listed as optional is optional
+			optional = dependencySpecs(manifest, "optionalDependencies")
+			packages = slices.DeleteFunc(packages, func(spec string) bool {
+				return slices.Contains(optional, spec)
+			})
+		}
+		if workspaces, err = manifestWorkspaces(dir, manifest); err != nil {
+			return err
+		}
+		for _, ws := range workspaces {
+			// Each workspace is linked even when nothing depends on it
+			packages = append(packages, ws.Name+"@"+ws.Version)
+			packages = append(packages, workspaceSpecs(ws, !productionInstall())...)
+			if productionInstall() {
+				skipped += len(ws.DevDependencies)
+			}
+		}
+		if skipped > 0 && !*installJSON {
+			fmt.Printf("Skipping %d devDependencies for a production install\n", skipped)
+		}
+		if len(packages) == 0 && len(optional) == 0 {
+			if *installJSON {
+				return printJSONLine(installSummary{Type: "summary", DryRun: *installDryRun, Skipped: skipped})
+			}
+			fmt.Println("No dependencies to install")
+			return nil
+		}
+	}
+
+	opts, err := projectOptions()
 	if err != nil {
-		return fmt.Errorf("failed to initialize NPM package manager: %v", err)
+		return err
+	}
+	if *installRegistry != "" {
+		opts = append(opts, loader.WithRegistry(*installRegistry))
+	}
+	opts = append(opts, installReload.options()...)
+	opts = append(opts, loader.WithMaxDepth(*installMaxDepth), loader.WithStrictEngines(*installStrict), loader.WithOptionalDependencies(!*installNoOpt))
+	dir, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get current directory: %w", err)
+	}
+	overrides, err := overrideOptions(dir)
+	if err != nil {
+		return err
+	}
+	opts = append(opts, overrides...)
+	if len(workspaces) > 0 {
+		opts = append(opts, loader.WithWorkspaces(workspaces))
+	}
+	// A deno.lock pins the versions it records, and records the resolutions
+	// once the install succeeds
+	lock, lockPath, err := projectDenoLock()
+	if err != nil {
+		return err
+	}
+	if lock != nil {
+		opts = append(opts, loader.WithLockedVersions(lockPins(lock, updating)))
+	}
+	if *installCheck {
+		if lock == nil {
+			return fmt.Errorf("--check needs a %s named as the lock in edon.json", denoLockFile)
+		}
+		// Resolved from the registry, so every package has an integrity
+		// to compare and the cache isn't written to
+		opts = append(opts, loader.WithNoCache(), loader.WithResolveOnly())
+	}
+
+	pm, err := loader.NewNPMPackageManager(opts...)
+	if err != nil {
+		return fmt.Errorf("failed to initialize NPM package manager: %w", err)
+	}
+
+	ctx, stop := installContext()
+	defer stop()
+
+	// Local packages skip the registry, but their dependencies don't
+	var local []*loader.InstalledPackage
+	packages, localPaths := splitLocalPackages(packages)
+	if *installIntegrity && len(localPaths) > 0 {
+		return fmt.Errorf("--print-integrity only works with registry packages, not %s", localPaths[0])
+	}
+	if !*installDryRun && !*installIntegrity && !*installCheck {
+		for _, path := range localPaths {
+			installed, err := pm.InstallLocal(path)
+			if err != nil {
+				return fmt.Errorf("failed to install %s: %w", path, err)
+			}
+			local = append(local, installed)
+
+			manifest, err := readManifest(installed.Path)
+			if err != nil {
+				return err
+			}
+			packages = append(packages, dependencySpecs(manifest, "dependencies")...)
+		}
+	}
+
+	// Resolution only reads registry metadata, so a dry run stops after it.
+	// Optional dependencies that can't be resolved are left out.
+	tree, unresolved, err := pm.ResolveOptionalTree(ctx, packages, optional)
+	if err != nil {
+		if ctx.Err() != nil {
+			return errInstallCanceled
+		}
+		return fmt.Errorf("failed to resolve dependencies: %w", err)
+	}
+	var skippedOptional []string
+	for _, skip := range unresolved {
+		skippedOptional = append(skippedOptional, skip.Spec)
+		if !*installJSON {
+			warnOptional(skip.Spec, skip.Dependent, skip.Err)
+		}
+	}
+	truncated := 0
+	for _, pkg := range tree {
+		if pkg.Truncated {
+			truncated++
+		}
+	}
+	if truncated > 0 && !*installJSON {
+		color.Yellow("Warning: --max-depth %d left out the dependencies of %d packages", *installMaxDepth, truncated)
+	}
+
+	if *installCheck {
+		return checkLock(lock, lockPath, slices.Concat(packages, optional), tree)
+	}
+	if *installIntegrity {
+		return printIntegrity(ctx, pm, tree)
+	}
+	// Unmet peers are only worth a warning; the packages may well work
+	peerWarnings := loader.PeerWarnings(tree)
+
+	if *installDryRun {
+		if *installJSON {
+			for _, path := range localPaths {
+				if err := printJSONLine(installRecord{Type: "package", Path: path, Cache: "local"}); err != nil {
+					return err
+				}
+			}
+			for _, pkg := range tree {
+				if err := printJSONLine(installRecord{Type: "package", Name: pkg.Name, Version: pkg.Version}); err != nil {
+					return err
+				}
+			}
+			return printJSONLine(installSummary{Type: "summary", Packages: len(localPaths) + len(tree), DryRun: true, Truncated: truncated, Skipped: skipped, Warnings: peerWarnings, SkippedOptional: skippedOptional})
+		}
+		fmt.Printf("Would install %d packages:\n", len(localPaths)+len(tree))
+		for _, path := range localPaths {
+			fmt.Printf("  %s (local)\n", path)
+		}
+		for _, pkg := range tree {
+			if pkg.Workspace != "" {
+				fmt.Printf("  %s (linked)\n", pkg)
+				continue
+			}
+			fmt.Printf("  %s\n", pkg)
+		}
+		warnPeers(peerWarnings)
+		return nil
 	}
 
-	for _, pkg := range InstallCmd.Args() {
-		fmt.Printf("Installing %s...\n", pkg)
-		path, err := pm.InstallPackage(context.Background(), pkg)
+	summary := installSummary{Type: "summary", Packages: len(local) + len(tree), Truncated: truncated, Skipped: skipped, Warnings: peerWarnings, SkippedOptional: skippedOptional}
+	for _, installed := range local {
+		if !*installJSON {
+			warnInstalled(installed)
+			fmt.Printf("Successfully installed %s@%s at %s\n", installed.Name, installed.Version, installed.Path)
+			continue
+		}
+		if err := printJSONLine(installRecord{
+			Type:     "package",
+			Name:     installed.Name,
+			Version:  installed.Version,
+			Path:     installed.Path,
+			Cache:    "local",
+			Warnings: installWarnings(installed),
+		}); err != nil {
+			return err
+		}
+	}
+	// Every package is attempted unless --fail-fast, so one run reports
+	// everything that's wrong. Optional packages that fail are only warned
+	// about and left out of the lock. Packages install --jobs at a time but
+	// are reported in order.
+	var failures []error
+	var failedOptional []*loader.ResolvedPackage
+	installCtx, cancelInstalls := context.WithCancel(ctx)
+	defer cancelInstalls()
+	results := installAll(installCtx, pm, tree, jobs)
+	for i, pkg := range tree {
+		if !*installJSON {
+			fmt.Printf("Installing %s...\n", pkg)
+		}
+		result := <-results[i]
+		installed, err := result.installed, result.err
 		if err != nil {
-			return fmt.Errorf("failed to install %s: %v", pkg, err)
+			if ctx.Err() != nil {
+				return errInstallCanceled
+			}
+			if pkg.Optional {
+				failedOptional = append(failedOptional, pkg)
+				summary.Packages--
+				summary.SkippedOptional = append(summary.SkippedOptional, pkg.String())
+				if !*installJSON {
+					warnOptional(pkg.String(), "", err)
+				}
+				continue
+			}
+			err = fmt.Errorf("failed to install %s: %w", pkg, err)
+			if *installFailFast {
+				return err
+			}
+			failures = append(failures, err)
+			continue
+		}
+
+		cache := "miss"
+		if installed.Workspace != "" {
+			cache = "linked"
+			summary.Linked++
+		} else if installed.FromCache {
+			cache = "hit"
+			summary.Cached++
+		} else {
+			summary.Downloaded++
+		}
+		summary.Bytes += installed.Bytes
+
+		if !*installJSON {
+			warnInstalled(installed)
+			fmt.Printf("Successfully installed %s (%s) at %s\n", pkg, cacheLabel(installed), installed.Path)
+			continue
 		}
-		fmt.Printf("Successfully installed %s at %s\n", pkg, path)
+		if err := printJSONLine(installRecord{
+			Type:     "package",
+			Name:     installed.Name,
+			Version:  installed.Version,
+			Path:     installed.Path,
+			Bytes:    installed.Bytes,
+			Cache:    cache,
+			Warnings: installWarnings(installed),
+		}); err != nil {
+			return err
+		}
+	}
+
+	if len(failures) > 0 {
+		return errors.Join(failures...)
+	}
+
+	if err := reportWorkspaces(workspaces, tree); err != nil {
+		return err
 	}
 
+	tree = slices.DeleteFunc(tree, func(pkg *loader.ResolvedPackage) bool {
+		return slices.Contains(failedOptional, pkg)
+	})
+	var updates []updateRecord
+	if lock != nil {
+		changed := false
+		if *installUpdate {
+			updates = lockUpdates(lock.Packages(), tree)
+			changed = lock.RemoveSuperseded(tree)
+		}
+		if lock.AddPackages(slices.Concat(packages, optional), tree) || changed {
+			if err := writeDenoLock(lockPath, lock); err != nil {
+				return err
+			}
+		}
+	}
+	if *installUpdate {
+		if err := reportUpdates(lock != nil, updates); err != nil {
+			return err
+		}
+	}
+
+	if *installJSON {
+		return printJSONLine(summary)
+	}
+	warnPeers(peerWarnings)
+	return nil
+}
+
+// installResult is the outcome of installing one package
+type installResult struct {
+	installed *loader.InstalledPackage
+	err       error
+}
+
+// installAll installs tree's packages in the background, jobs at a time and
+// starting them in order. Each package's result arrives on its own channel,
+// so they can be reported in order however they finish; once ctx is done,
+// the packages not yet started fail with its error.
+func installAll(ctx context.Context, pm *loader.NPMPackageManager, tree []*loader.ResolvedPackage, jobs int) []chan installResult {
+	results := make([]chan installResult, len(tree))
+	for i := range results {
+		results[i] = make(chan installResult, 1)
+	}
+	go func() {
+		slots := make(chan struct{}, max(jobs, 1))
+		for i, pkg := range tree {
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				for _, result := range results[i:] {
+					result <- installResult{err: ctx.Err()}
+				}
+				return
+			}
+			go func() {
+				defer func() { <-slots }()
+				installed, err := pm.Install(ctx, pkg)
+				results[i] <- installResult{installed, err}
+			}()
+		}
+	}()
+	return results
+}
+
+// lockPins returns the "name@version"s of lock that install keeps: all of
+// them, none for a bare --update, or all but the packages --update names
+func lockPins(lock *loader.DenoLock, updating []string) []string {
+	if *installUpdate && len(updating) == 0 {
+		return nil
+	}
+	var pins []string
+	for _, pkg := range lock.Packages() {
+		// Names may be scoped, so the version follows the last "@"
+		if name := pkg[:strings.LastIndex(pkg, "@")]; !slices.Contains(updating, name) {
+			pins = append(pins, pkg)
+		}
+	}
+	return pins
+}
+
+// lockUpdates compares the "name@version"s locked before an update with the
+// tree it installed, listing each package of tree whose versions changed.
+// Packages with several versions list them all, comma-separated.
+func lockUpdates(locked []string, tree []*loader.ResolvedPackage) []updateRecord {
+	before := make(map[string][]string)
+	for _, pkg := range locked {
+		at := strings.LastIndex(pkg, "@")
+		before[pkg[:at]] = append(before[pkg[:at]], pkg[at+1:])
+	}
+	after := make(map[string][]string)
+	var names []string
+	for _, pkg := range tree {
+		// Workspaces are never locked
+		if pkg.Workspace != "" {
+			continue
+		}
+		if _, ok := after[pkg.Name]; !ok {
+			names = append(names, pkg.Name)
+		}
+		after[pkg.Name] = append(after[pkg.Name], pkg.Version)
+	}
+
+	var updates []updateRecord
+	for _, name := range names {
+		// The lock sorts versions as strings, so both sides do
+		slices.Sort(before[name])
+		slices.Sort(after[name])
+		from, to := strings.Join(before[name], ", "), strings.Join(after[name], ", ")
+		if from != to {
+			updates = append(updates, updateRecord{Type: "update", Name: name, From: from, To: to})
+		}
+	}
+	return updates
+}
+
+// reportUpdates prints what --update changed, as "name old → new" lines, or
+// "+ name@new" for packages the lock didn't have
+func reportUpdates(locked bool, updates []updateRecord) error {
+	if *installJSON {
+		for _, update := range updates {
+			if err := printJSONLine(update); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	switch {
+	case !locked:
+		fmt.Println("No deno.lock pins versions, so the newest that package.json allows were installed")
+		return nil
+	case len(updates) == 0:
+		fmt.Println("Everything was already up to date")
+		return nil
+	}
+	fmt.Printf("Updated %d packages:\n", len(updates))
+	for _, update := range updates {
+		if update.From == "" {
+			fmt.Printf("  + %s@%s\n", update.Name, update.To)
+			continue
+		}
+		fmt.Printf("  %s %s → %s\n", update.Name, update.From, update.To)
+	}
+	return nil
+}
+
+// printIntegrity downloads each package in tree and prints its SRI
+// integrity, one "name@version sha512-..." line per package
+func printIntegrity(ctx context.Context, pm *loader.NPMPackageManager, tree []*loader.ResolvedPackage) error {
+	for _, pkg := range tree {
+		integrity, err := pm.Integrity(ctx, pkg)
+		if err != nil {
+			if ctx.Err() != nil {
+				return errInstallCanceled
+			}
+			return fmt.Errorf("failed to hash %s: %w", pkg, err)
+		}
+		if *installJSON {
+			if err := printJSONLine(installRecord{Type: "package", Name: pkg.Name, Version: pkg.Version, Integrity: integrity}); err != nil {
+				return err
+			}
+			continue
+		}
+		fmt.Printf("%s %s\n", pkg, integrity)
+	}
+	return nil
+}
+
+// reportWorkspaces prints what each workspace's dependencies resolved to,
+// marking those linked to other workspaces
+func reportWorkspaces(workspaces []*loader.Workspace, tree []*loader.ResolvedPackage) error {
+	cwd, _ := os.Getwd()
+	for _, ws := range workspaces {
+		path := ws.Dir
+		if rel, err := filepath.Rel(cwd, ws.Dir); err == nil {
+			path = rel
+		}
+		resolved := ws.Resolved(tree, !productionInstall())
+		if *installJSON {
+			record := workspaceRecord{Type: "workspace", Name: ws.Name, Version: ws.Version, Path: filepath.ToSlash(path), Dependencies: []string{}}
+			for _, pkg := range resolved {
+				record.Dependencies = append(record.Dependencies, pkg.String())
+			}
+			if err := printJSONLine(record); err != nil {
+				return err
+			}
+			continue
+		}
+		fmt.Printf("Workspace %s@%s (%s)\n", ws.Name, ws.Version, path)
+		if len(resolved) == 0 {
+			fmt.Println("  no dependencies")
+		}
+		for _, pkg := range resolved {
+			if pkg.Workspace != "" {
+				fmt.Printf("  %s (linked)\n", pkg)
+				continue
+			}
+			fmt.Printf("  %s\n", pkg)
+		}
+	}
+	return nil
+}
+
+// installWarnings lists the engines requirements installed doesn't meet and
+// the install scripts it declares
+func installWarnings(installed *loader.InstalledPackage) []string {
+	return append(slices.Clip(installed.EngineWarnings), installed.ScriptWarnings...)
+}
+
+// warnInstalled prints installWarnings
+func warnInstalled(installed *loader.InstalledPackage) {
+	for _, warning := range installWarnings(installed) {
+		color.Yellow("Warning: %s", warning)
+	}
+}
+
+// warnOptional prints why an optional dependency was left out; dependent is
+// the package that declared it, if it wasn't package.json
+func warnOptional(spec, dependent string, err error) {
+	if dependent != "" {
+		spec += " (optional dependency of " + dependent + ")"
+	}
+	color.Yellow("Warning: skipping optional %s: %v", spec, err)
+}
+
+// warnPeers prints the peer dependencies the installed tree doesn't meet
+func warnPeers(warnings []string) {
+	for _, warning := range warnings {
+		color.Yellow("Warning: %s", warning)
+	}
+}
+
+// cacheLabel says whether an install was served from the cache
+func cacheLabel(installed *loader.InstalledPackage) string {
+	if installed.Workspace != "" {
+		return "linked"
+	}
+	if installed.FromCache {
+		return "cached"
+	}
+	return "downloaded"
+}
+
+// splitLocalPackages separates directory and tarball paths from registry
+// package specs
+func splitLocalPackages(specs []string) (registry, local []string) {
+	for _, spec := range specs {
+		if loader.IsLocalPackage(spec) {
+			local = append(local, spec)
+		} else {
+			registry = append(registry, spec)
+		}
+	}
+	return registry, local
+}
+
+// errInstallCanceled is reported when an install is interrupted. The package
+// being downloaded is discarded, so the cache only holds complete installs.
+var errInstallCanceled = errors.New("installation canceled")
+
+// installContext returns a context canceled on SIGINT or SIGTERM, so an
+// interrupted install aborts its in-flight download
+func installContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
+
+// printJSONLine writes v to stdout as a single line of JSON
+func printJSONLine(v any) error {
+	return json.NewEncoder(os.Stdout).Encode(v)
+}
+
+// validateRegistryURL checks that registry is an absolute http(s) URL
+func validateRegistryURL(registry string) error {
+	u, err := url.Parse(registry)
+	if err != nil {
+		return fmt.Errorf("invalid registry URL %q: %w", registry, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid registry URL %q: must be an http or https URL", registry)
+	}
 	return nil
 }
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/fatih/color"
+	"github.com/katungi/edon/internal/modules/loader"
+)
+
+var (
+	OutdatedCmd  = flag.NewFlagSet("outdated", flag.ExitOnError)
+	outdatedJSON = OutdatedCmd.Bool("json", false, "Print one JSON object per dependency instead of a table")
+)
+
+// outdatedRecord is the --json output for a single dependency
+type outdatedRecord struct {
+	Name     string `json:"name"`
+	Range    string `json:"range"`
+	Current  string `json:"current,omitempty"`
+	Wanted   string `json:"wanted,omitempty"`
+	Latest   string `json:"latest,omitempty"`
+	Outdated bool   `json:"outdated"`
+	Error    string `json:"error,omitempty"`
+}
+
+// HandleOutdated compares the dependencies package.json declares with the
+// versions installed and published, listing those with newer versions.
+// A package the registry can't be asked about gets its own error row rather
+// than stopping the rest.
+func HandleOutdated() error {
+	dir, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get current directory: %w", err)
+	}
+	manifest, err := readManifest(dir)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("no %s found in %s", manifestFile, dir)
+	}
+	if err != nil {
+		return err
+	}
+
+	opts, err := projectOptions()
+	if err != nil {
+		return err
+	}
+	pm, err := loader.NewNPMPackageManager(opts...)
+	if err != nil {
+		return fmt.Errorf("failed to initialize NPM package manager: %w", err)
+	}
+
+	ctx, stop := installContext()
+	defer stop()
+
+	specs := dependencySpecs(manifest, "dependencies", "devDependencies")
+	records := make([]outdatedRecord, len(specs))
+	var wg sync.WaitGroup
+	for i, spec := range specs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Names may be scoped, so the range follows the last "@"
+			at := strings.LastIndex(spec, "@")
+			name, versionRange := spec[:at], spec[at+1:]
+			records[i] = outdatedRecord{Name: name, Range: versionRange}
+
+			pkg, err := pm.Outdated(ctx, name, versionRange)
+			if err != nil {
+				records[i].Error = err.Error()
+				return
+			}
+			records[i].Current, records[i].Wanted, records[i].Latest = pkg.Current, pkg.Wanted, pkg.Latest
+			records[i].Outdated = pkg.IsOutdated()
+		}()
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return fmt.Errorf("outdated check canceled")
+	}
+
+	failed := 0
+	for _, record := range records {
+		if record.Error != "" {
+			failed++
+		}
+	}
+	if *outdatedJSON {
+		for _, record := range records {
+			if err := printJSONLine(record); err != nil {
+				return err
+			}
+		}
+	} else {
+		printOutdated(records)
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to check %d of %d packages", failed, len(records))
+	}
+	return nil
+}
+
+// printOutdated prints the dependencies with newer versions as a table,
+// followed by those that couldn't be checked
+func printOutdated(records []outdatedRecord) {
+	var rows, failed []outdatedRecord
+	for _, record := range records {
+		switch {
+		case record.Error != "":
+			failed = append(failed, record)
+		case record.Outdated:
+			rows = append(rows, record)
+		}
+	}
+
+	if len(rows) > 0 {
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "Package\tCurrent\tWanted\tLatest")
+		for _, row := range rows {
+			current := row.Current
+			if current == "" {
+				current = "missing"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", row.Name, current, row.Wanted, row.Latest)
+		}
+		tw.Flush()
+	} else if len(failed) == 0 {
+		color.Green("✓ All %d dependencies are up to date", len(records))
+	}
+	for _, record := range failed {
+		color.Red("%s: %s", record.Name, record.Error)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/fatih/color"
+	"github.com/katungi/edon/internal/errors"
+)
+
+// outputFormat is the global --output flag: "text", the default, or "json"
+var outputFormat = flag.String("output", "text", "Output format for every command: text or json (errors as JSON objects on stderr, results as JSON where a command has them)")
+
+// jsonOutput reports whether --output=json was given
+func jsonOutput() bool {
+	return *outputFormat == "json"
+}
+
+// checkOutputFormat rejects an --output other than text or json
+func checkOutputFormat() error {
+	if *outputFormat != "text" && *outputFormat != "json" {
+		return fmt.Errorf("unknown --output %q: use text or json", *outputFormat)
+	}
+	return nil
+}
+
+// enableJSON turns on the JSON output of commands that have it, for
+// --output=json
+func enableJSON() {
+	if jsonOutput() {
+		*installJSON, *graphJSON, *outdatedJSON, *infoJSON = true, true, true, true
+	}
+}
+
+// errorOutput is the --output=json form of a failure
+type errorOutput struct {
+	Error struct {
+		// Code names the kind of failure, as errors.Code does
+		Code    string `json:"code"`
+		Message string `json:"message"`
+		// Cause is the underlying error's own message, when there is one
+		Cause string `json:"cause,omitempty"`
+	} `json:"error"`
+}
+
+// reportError prints a command's error: in red for people, or as an
+// errorOutput object on stderr for --output=json
+func reportError(err error) {
+	if !jsonOutput() {
+		color.Red("Error: %v", err)
+		return
+	}
+	var out errorOutput
+	out.Error.Code = errors.Code(err)
+	out.Error.Message = err.Error()
+	if cause := rootCause(err); cause != nil && cause.Error() != out.Error.Message {
+		out.Error.Cause = cause.Error()
+	}
+	data, _ := json.Marshal(out)
+	fmt.Fprintln(os.Stderr, string(data))
+}
+
+// rootCause follows err's wrapped errors to the innermost one. Of several
+// joined errors the last is followed, since errors.WrapWith puts the
+// category first and the cause after it.
+func rootCause(err error) error {
+	for {
+		switch e := err.(type) {
+		case interface{ Unwrap() error }:
+			inner := e.Unwrap()
+			if inner == nil {
+				return err
+			}
+			err = inner
+		case interface{ Unwrap() []error }:
+			inner := e.Unwrap()
+			if len(inner) == 0 {
+				return err
+			}
+			err = inner[len(inner)-1]
+		default:
+			return err
+		}
+	}
+}
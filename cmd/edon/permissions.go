@@ -0,0 +1,63 @@
+package main
+
+import (
+	"flag"
+	"path/filepath"
+	"strings"
+
+	"github.com/katungi/edon/internal/modules/loader"
+)
+
+// grantFlag is a permission flag that works both bare ("--allow-net") to
+// grant everything and with a comma-separated list ("--allow-net=a.com,b.com")
+type grantFlag struct {
+	grant loader.Grant
+}
+
+func (f *grantFlag) String() string {
+	if f.grant.All {
+		return "true"
+	}
+	return strings.Join(f.grant.Allow, ",")
+}
+
+func (f *grantFlag) Set(value string) error {
+	switch value {
+	case "true":
+		f.grant = loader.Grant{All: true}
+	case "false":
+		f.grant = loader.Grant{}
+	default:
+		for _, entry := range strings.Split(value, ",") {
+			if entry = strings.TrimSpace(entry); entry != "" {
+				f.grant.Allow = append(f.grant.Allow, entry)
+			}
+		}
+	}
+	return nil
+}
+
+// IsBoolFlag lets the flag package accept the bare form without a value
+func (f *grantFlag) IsBoolFlag() bool { return true }
+
+// grantVar defines a permission flag on fs
+func grantVar(fs *flag.FlagSet, name, usage string) *grantFlag {
+	f := &grantFlag{}
+	fs.Var(f, name, usage)
+	return f
+}
+
+// runPermissions builds the permissions for a run. Network access is denied
+// unless granted; reads are limited to the granted paths plus the directory
+// of a local entry file, which has to be readable to run at all.
+func runPermissions(entry string) loader.Permissions {
+	perms := loader.Permissions{
+		Net:  allowNet.grant,
+		Read: allowRead.grant,
+	}
+
+	if loader.ValidateURL(entry).PackageType == loader.TypeLocal && !perms.Read.All {
+		perms.Read.Allow = append([]string{filepath.Dir(entry)}, perms.Read.Allow...)
+	}
+	return perms
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"flag"
+	"strings"
+
+	"github.com/katungi/edon/internal/modules/loader"
+)
+
+// reloadFlag is --reload, which refreshes every module when given bare and
+// only those starting with one of its comma-separated prefixes otherwise
+type reloadFlag struct {
+	all      bool
+	prefixes []string
+}
+
+func (f *reloadFlag) String() string {
+	if f.all {
+		return "true"
+	}
+	return strings.Join(f.prefixes, ",")
+}
+
+func (f *reloadFlag) Set(value string) error {
+	switch value {
+	case "true":
+		*f = reloadFlag{all: true}
+	case "false":
+		*f = reloadFlag{}
+	default:
+		for _, prefix := range strings.Split(value, ",") {
+			if prefix = strings.TrimSpace(prefix); prefix != "" {
+				f.prefixes = append(f.prefixes, prefix)
+			}
+		}
+	}
+	return nil
+}
+
+// IsBoolFlag lets the flag package accept the bare form without a value
+func (f *reloadFlag) IsBoolFlag() bool { return true }
+
+// reloadVar defines a --reload flag on fs
+func reloadVar(fs *flag.FlagSet) *reloadFlag {
+	f := &reloadFlag{}
+	fs.Var(f, "reload", "Fetch modules afresh even if cached, optionally only URLs starting with `prefixes` (comma-separated)")
+	return f
+}
+
+// options returns the loader option for the flag, if it was given
+func (f *reloadFlag) options() []loader.Option {
+	if !f.all && len(f.prefixes) == 0 {
+		return nil
+	}
+	return []loader.Option{loader.WithReloadMatcher(f.matches)}
+}
+
+func (f *reloadFlag) matches(url string) bool {
+	if f.all {
+		return true
+	}
+	for _, prefix := range f.prefixes {
+		if strings.HasPrefix(url, prefix) {
+			return true
+		}
+	}
+	return false
+}
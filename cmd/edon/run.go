@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/katungi/edon/internal/modules/loader"
+	"github.com/katungi/edon/internal/runtime"
+)
+
+var (
+	RunCmd     = flag.NewFlagSet("run", flag.ExitOnError)
+	runWatch   = RunCmd.Bool("watch", false, "Restart when the entry file or its local imports change")
+	runVerbose = RunCmd.Bool("verbose", false, "Print where each module is loaded from")
+	runNoCache = RunCmd.Bool("no-cache", false, "Fetch every module afresh, ignoring cached copies (can't be used offline)")
+	runReload  = reloadVar(RunCmd)
+	runConds   = RunCmd.String("conditions", "", "Package exports `conditions` to match, in order (comma-separated; default import,default)")
+
+	allowNet  = grantVar(RunCmd, "allow-net", "Allow network access, optionally only to `hosts` (comma-separated)")
+	allowRead = grantVar(RunCmd, "allow-read", "Allow file reads, optionally only under `paths` (comma-separated)")
+)
+
+func HandleRun() error {
+	if RunCmd.NArg() < 1 {
+		return fmt.Errorf("module specifier is required")
+	}
+	specifier := RunCmd.Arg(0)
+
+	// Cancel loading and execution on Ctrl-C
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	// Plain file names like "index.js" are treated as local paths
+	if info, err := os.Stat(specifier); err == nil && !info.IsDir() {
+		abs, err := filepath.Abs(specifier)
+		if err != nil {
+			return fmt.Errorf("failed to resolve %s: %w", specifier, err)
+		}
+		specifier = abs
+	}
+
+	opts, err := projectOptions()
+	if err != nil {
+		return err
+	}
+	opts = append(opts, loader.WithPermissions(runPermissions(specifier)))
+	opts = append(opts, loader.WithLogger(loadEventLogger(*runVerbose)))
+	if *runNoCache {
+		opts = append(opts, loader.WithCacheMode(loader.CacheBypassRead))
+	}
+	opts = append(opts, runReload.options()...)
+	if *runConds != "" {
+		opts = append(opts, loader.WithConditions(strings.Split(*runConds, ",")...))
+	}
+	lock, lockPath, err := projectDenoLock()
+	if err != nil {
+		return err
+	}
+	if lock != nil {
+		opts = append(opts, loader.WithLockedHashes(lock.Remote))
+	}
+	ml := loader.NewModuleLoader(opts...)
+
+	if *runWatch {
+		if loader.ValidateURL(specifier).PackageType != loader.TypeLocal {
+			return fmt.Errorf("--watch only supports local files: %s", specifier)
+		}
+		return watchAndRun(ctx, ml, specifier)
+	}
+
+	err = runModule(ctx, ml, specifier)
+	if lock != nil {
+		// Modules that loaded passed the lock, so even a failed run adds
+		// the new ones
+		if lockErr := lockModules(lock, lockPath, ml); err == nil {
+			err = lockErr
+		}
+	}
+	return err
+}
+
+// lockModules adds the remote modules ml loaded to lock, writing it to
+// path if any were new
+func lockModules(lock *loader.DenoLock, path string, ml *loader.ModuleLoader) error {
+	changed := false
+	for _, module := range ml.Snapshot() {
+		if lock.AddModule(module) {
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return writeDenoLock(path, lock)
+}
+
+// runModule loads specifier through the loader and executes it in a fresh runtime
+func runModule(ctx context.Context, ml *loader.ModuleLoader, specifier string) error {
+	module, err := ml.LoadModule(ctx, specifier)
+	if err != nil {
+		return fmt.Errorf("failed to load %s: %w", specifier, err)
+	}
+	if *runVerbose {
+		source := "fetched"
+		if module.FromCache {
+			source = "from cache"
+		}
+		color.New(color.Faint).Fprintf(os.Stderr, "loaded %s (%s at %s)\n", module.URL, source, module.LoadedAt.Format(time.TimeOnly))
+	}
+
+	rt, err := runtime.New()
+	if err != nil {
+		return fmt.Errorf("failed to initialize runtime: %w", err)
+	}
+	defer rt.Close()
+
+	// Imports are loaded through ml too, so the same permissions apply
+	return rt.RunLoaded(ctx, ml, specifier)
+}
+
+// loadEventLogger warns about damaged cache entries and unversioned imports
+// and, for --verbose, prints every other loader event too
+func loadEventLogger(verbose bool) loader.LoadLogger {
+	return func(e loader.LoadEvent) {
+		switch e.Kind {
+		case loader.EventCacheCorrupt:
+			color.New(color.FgYellow).Fprintf(os.Stderr, "Warning: %v; fetching it again\n", e.Err)
+			return
+		case loader.EventUnversionedImport:
+			pin := ""
+			if e.ResolvedURL != "" {
+				pin = " (pin " + e.ResolvedURL + ")"
+			}
+			color.New(color.FgYellow).Fprintf(os.Stderr, "Warning: %s has no version and follows the latest release%s\n", e.URL, pin)
+			return
+		case loader.EventManifestFallback:
+			color.New(color.FgYellow).Fprintf(os.Stderr, "Warning: %v; loading %s from %s\n", e.Err, e.URL, e.ResolvedURL)
+			return
+		}
+		if verbose {
+			logLoadEvent(e)
+		}
+	}
+}
+
+// logLoadEvent prints loader events for --verbose
+func logLoadEvent(e loader.LoadEvent) {
+	faint := color.New(color.Faint)
+	switch e.Kind {
+	case loader.EventCacheHit:
+		faint.Fprintf(os.Stderr, "cache hit (%s) %s\n", e.Cache, e.URL)
+	case loader.EventCacheMiss:
+		faint.Fprintf(os.Stderr, "cache miss %s\n", e.URL)
+	case loader.EventFetchStart:
+		faint.Fprintf(os.Stderr, "fetch %s [%s]\n", e.URL, e.Type)
+	case loader.EventFetchEnd:
+		if e.Err != nil {
+			faint.Fprintf(os.Stderr, "fetch failed %s after %s: %v\n", e.URL, e.Duration, e.Err)
+			return
+		}
+		faint.Fprintf(os.Stderr, "fetched %s in %s\n", e.URL, e.Duration)
+	}
+}
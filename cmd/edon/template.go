@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/katungi/edon/internal/modules/loader"
+)
+
+// initFromTemplate scaffolds a project in dir from --template. Template files
+// may use {{name}} and {{version}}, in their contents and their paths. A
+// template without a package.json gets the default one, unless dir already
+// has one.
+func initFromTemplate(dir, entry, indent string) error {
+	opts, err := projectOptions()
+	if err != nil {
+		return err
+	}
+	ml := loader.NewModuleLoader(opts...)
+	defer ml.Close()
+
+	staging, err := os.MkdirTemp("", "edon-template-*")
+	if err != nil {
+		return fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	defer os.RemoveAll(staging)
+
+	ctx, stop := installContext()
+	defer stop()
+	if err := ml.FetchTemplate(ctx, *initTemplate, staging); err != nil {
+		return fmt.Errorf("failed to fetch template %s: %w", *initTemplate, err)
+	}
+
+	placeholders := strings.NewReplacer(
+		"{{name}}", filepath.Base(dir),
+		"{{version}}", defaultProjectVersion,
+	)
+	files, err := templateFiles(staging, placeholders)
+	if err != nil {
+		return err
+	}
+
+	// Check every file before writing any, so a conflict leaves dir untouched
+	if !*initForce {
+		for _, file := range files {
+			if _, err := os.Lstat(filepath.Join(dir, file.path)); err == nil {
+				return fmt.Errorf("%s already exists (use --force to overwrite it)", filepath.Join(dir, file.path))
+			}
+		}
+	}
+
+	hasManifest := false
+	for _, file := range files {
+		target := filepath.Join(dir, file.path)
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return fmt.Errorf("failed to create %s: %w", filepath.Dir(target), err)
+		}
+		if err := os.WriteFile(target, file.content, file.mode); err != nil {
+			return fmt.Errorf("failed to write %s: %w", target, err)
+		}
+		hasManifest = hasManifest || file.path == manifestFile
+	}
+	if _, err := os.Stat(filepath.Join(dir, manifestFile)); err != nil && !hasManifest {
+		if err := writeDefaultManifest(dir, entry, indent); err != nil {
+			return err
+		}
+	}
+
+	if !*initQuiet {
+		color.Green("✓ Successfully initialized new Edon project in %s", dir)
+		color.Green("✓ Created %d files from %s", len(files), *initTemplate)
+	}
+	return nil
+}
+
+// templateFile is a file of an expanded template, relative to the project
+type templateFile struct {
+	path    string
+	content []byte
+	mode    fs.FileMode
+}
+
+// templateFiles reads the regular files under root with placeholders
+// substituted. Binary files, recognised by a NUL byte, are left as they are.
+func templateFiles(root string, placeholders *strings.Replacer) ([]templateFile, error) {
+	var files []templateFile
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		rel = placeholders.Replace(rel)
+		if !filepath.IsLocal(rel) {
+			return fmt.Errorf("template path %s escapes the project", rel)
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if !bytes.ContainsRune(content, 0) {
+			content = []byte(placeholders.Replace(string(content)))
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		files = append(files, templateFile{path: rel, content: content, mode: info.Mode().Perm()})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read template: %w", err)
+	}
+	return files, nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/fatih/color"
+	"github.com/katungi/edon/internal/modules/loader"
+)
+
+var WarmCmd = flag.NewFlagSet("warm", flag.ExitOnError)
+
+func HandleWarm() error {
+	if WarmCmd.NArg() < 1 {
+		return fmt.Errorf("at least one module specifier is required")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	opts, err := projectOptions()
+	if err != nil {
+		return err
+	}
+
+	specifiers := WarmCmd.Args()
+	fmt.Printf("Warming cache with %d modules...\n", len(specifiers))
+	if err := loader.NewModuleLoader(opts...).Warm(ctx, specifiers); err != nil {
+		return fmt.Errorf("failed to warm cache: %w", err)
+	}
+
+	color.Green("✓ Cached %d modules", len(specifiers))
+	return nil
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	goruntime "runtime"
+	"slices"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/fsnotify/fsnotify"
+	"github.com/katungi/edon/internal/errors"
+	"github.com/katungi/edon/internal/modules/loader"
+	"github.com/katungi/edon/internal/runtime"
+)
+
+// watchDebounce coalesces the burst of events a single save produces
+const watchDebounce = 100 * time.Millisecond
+
+// watchedExtensions are the local files whose changes trigger a restart
+var watchedExtensions = map[string]bool{
+	".js":   true,
+	".mjs":  true,
+	".cjs":  true,
+	".ts":   true,
+	".json": true,
+}
+
+// watchAndRun runs entry and restarts it whenever it or a local module it
+// imports changes, until ctx is canceled
+func watchAndRun(ctx context.Context, ml *loader.ModuleLoader, entry string) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to start file watcher: %w", err)
+	}
+	defer watcher.Close()
+	color.Cyan("Watching %s and its local imports for changes...", entry)
+
+	for {
+		// Imports may have been added or moved since the last run
+		files, err := watchGraph(ctx, ml, watcher, entry)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		runCtx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			// QuickJS must stay on the thread that created it
+			goruntime.LockOSThread()
+			defer goruntime.UnlockOSThread()
+
+			if err := runModule(runCtx, ml, entry); err != nil && !errors.Is(err, runtime.ErrInterrupt) {
+				color.Red("Error: %v", err)
+			}
+		}()
+
+		changed, err := waitForChange(ctx, watcher, done)
+		cancel()
+		<-done
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		ml.Invalidate(changed)
+		for _, specifier := range files[changed] {
+			ml.Invalidate(specifier)
+		}
+		color.Yellow("Restarting due to change in %s", changed)
+	}
+}
+
+// watchGraph loads entry and the local modules it imports, directly or not,
+// and adds the directory of each to watcher. It returns the specifiers each
+// file was loaded by, so a change to it can invalidate them. Remote imports
+// aren't followed, and modules that fail to load are left for the run to
+// report.
+func watchGraph(ctx context.Context, ml *loader.ModuleLoader, watcher *fsnotify.Watcher, entry string) (map[string][]string, error) {
+	files := map[string][]string{entry: {entry}}
+	seen := map[string]bool{entry: true}
+	for queue := []string{entry}; len(queue) > 0; queue = queue[1:] {
+		specifier := queue[0]
+		module, err := ml.LoadModule(ctx, specifier)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			continue
+		}
+		// Extensionless and directory imports are read from another file
+		file := specifier
+		if module.ResolvedURL != "" {
+			file = module.ResolvedURL
+		}
+		if !slices.Contains(files[file], specifier) {
+			files[file] = append(files[file], specifier)
+		}
+
+		imports, err := ml.Imports(module)
+		if err != nil {
+			continue
+		}
+		for _, imp := range imports {
+			resolved, err := ml.ResolveImport(module, imp)
+			if err != nil || seen[resolved] || loader.ValidateURL(resolved).PackageType != loader.TypeLocal {
+				continue
+			}
+			seen[resolved] = true
+			queue = append(queue, resolved)
+		}
+	}
+
+	for file := range files {
+		dir := filepath.Dir(file)
+		if err := watcher.Add(dir); err != nil {
+			return nil, fmt.Errorf("failed to watch %s: %w", dir, err)
+		}
+	}
+	return files, nil
+}
+
+// waitForChange blocks until a watched file changes and the debounce window
+// has passed, returning the last changed path
+func waitForChange(ctx context.Context, watcher *fsnotify.Watcher, done <-chan struct{}) (string, error) {
+	var changed string
+	var debounce <-chan time.Time
+
+	for {
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-done:
+			done = nil
+			color.Cyan("Process finished. Waiting for changes...")
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return "", fmt.Errorf("file watcher closed")
+			}
+			if !watchedExtensions[filepath.Ext(event.Name)] || event.Has(fsnotify.Chmod) {
+				continue
+			}
+			changed = event.Name
+			debounce = time.After(watchDebounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return "", fmt.Errorf("file watcher closed")
+			}
+			return "", fmt.Errorf("file watcher: %w", err)
+		case <-debounce:
+			return changed, nil
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/fatih/color"
+	"github.com/katungi/edon/internal/modules/loader"
+)
+
+var WhyCmd = flag.NewFlagSet("why", flag.ExitOnError)
+
+// HandleWhy prints each chain of dependencies through which package.json
+// brings in a package. The tree comes from package-lock.json when there is
+// one, and is otherwise resolved afresh from package.json.
+func HandleWhy() error {
+	if WhyCmd.NArg() != 1 {
+		return fmt.Errorf("usage: edon why <package>")
+	}
+	name := WhyCmd.Arg(0)
+	if err := loader.ValidatePackageName(name); err != nil {
+		return err
+	}
+
+	dir, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get current directory: %w", err)
+	}
+	manifest, err := readManifest(dir)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("no %s found in %s", manifestFile, dir)
+	}
+	if err != nil {
+		return err
+	}
+	roots := dependencySpecs(manifest, "dependencies", "devDependencies")
+
+	tree, err := lockedTree(filepath.Join(dir, packageLockFile))
+	if os.IsNotExist(err) {
+		tree, err = resolveProjectTree(dir, roots)
+	}
+	if err != nil {
+		return err
+	}
+
+	paths := loader.DependencyPaths(roots, tree, name)
+	if len(paths) == 0 {
+		color.Yellow("%s is not installed", name)
+		return nil
+	}
+	for _, path := range paths {
+		line := "root"
+		for _, pkg := range path {
+			line += " > " + pkg.String()
+		}
+		fmt.Println(line)
+	}
+	return nil
+}
+
+// resolveProjectTree resolves the full dependency tree of roots from the
+// cache and registry, honoring the overrides of the project in dir
+func resolveProjectTree(dir string, roots []string) ([]*loader.ResolvedPackage, error) {
+	opts, err := projectOptions()
+	if err != nil {
+		return nil, err
+	}
+	overrides, err := overrideOptions(dir)
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, overrides...)
+	pm, err := loader.NewNPMPackageManager(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize NPM package manager: %w", err)
+	}
+
+	ctx, stop := installContext()
+	defer stop()
+	tree, err := pm.ResolveTree(ctx, roots)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve dependencies: %w", err)
+	}
+	return tree, nil
+}
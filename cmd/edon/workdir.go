@@ -0,0 +1,51 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// workDir is the global --dir flag, or -C as with make and git: the
+// directory every command works in instead of the current one
+var workDir = flag.String("dir", "", "Work in dir rather than the current directory, as if edon had been started there")
+
+func init() {
+	flag.StringVar(workDir, "C", "", "Shorthand for --dir")
+}
+
+// initDir is the --dir that didn't exist yet when init was run, which
+// HandleInit creates instead of edon changing into it
+var initDir string
+
+// enterWorkDir changes into --dir before command runs, so package.json,
+// edon.json and local modules are found there and relative paths, --cache-dir
+// included, are taken from it. The directory must exist, except for init,
+// which creates it.
+func enterWorkDir(command string) error {
+	if *workDir == "" {
+		return nil
+	}
+	info, err := os.Stat(*workDir)
+	if os.IsNotExist(err) && command == "init" {
+		initDir = *workDir
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("--dir: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("--dir %s is not a directory", *workDir)
+	}
+	return os.Chdir(*workDir)
+}
+
+// initTarget returns the directory init works on: its argument, taken from
+// --dir when that is yet to be created, or --dir itself when there is none
+func initTarget(arg string) string {
+	if initDir == "" {
+		return arg
+	}
+	return filepath.Join(initDir, arg)
+}
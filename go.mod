@@ -6,6 +6,7 @@ require (
 	github.com/buke/quickjs-go v0.6.8
 	github.com/chzyer/readline v1.5.1
 	github.com/fatih/color v1.18.0
+	github.com/fsnotify/fsnotify v1.9.0
 )
 
 require (
@@ -0,0 +1,94 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/katungi/edon/internal/errors"
+)
+
+// FileNames are the project config files looked up in a project root, in
+// order of preference
+var FileNames = []string{"edon.json", "deno.json"}
+
+// knownKeys are the top-level keys understood in a config file
+var knownKeys = map[string]bool{
+	"importMap": true,
+	"registry":  true,
+	"cacheDir":  true,
+	"lock":      true,
+	"offline":   true,
+}
+
+// Config is the project-level configuration read from edon.json or deno.json
+type Config struct {
+	ImportMap string `json:"importMap"`
+	Registry  string `json:"registry"`
+	CacheDir  string `json:"cacheDir"`
+	Lock      string `json:"lock"`
+	Offline   bool   `json:"offline"`
+
+	// Path is the file the config was read from, empty when none was found
+	Path string `json:"-"`
+	// Warnings lists problems that didn't prevent loading, like unknown keys
+	Warnings []string `json:"-"`
+}
+
+// Load reads the project config from dir. A missing config file is not an
+// error and yields an empty Config.
+func Load(dir string) (*Config, error) {
+	for _, name := range FileNames {
+		path := filepath.Join(dir, name)
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, errors.WrapWith(errors.ErrConfigInvalid, err, path)
+		}
+		return parse(path, data)
+	}
+	return &Config{}, nil
+}
+
+// parse decodes a config file and resolves its relative paths against the
+// file's directory
+func parse(path string, data []byte) (*Config, error) {
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, errors.WrapWith(errors.ErrConfigInvalid, err, path)
+	}
+	cfg.Path = path
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, errors.WrapWith(errors.ErrConfigInvalid, err, path)
+	}
+	unknown := make([]string, 0)
+	for key := range raw {
+		if !knownKeys[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+	for _, key := range unknown {
+		cfg.Warnings = append(cfg.Warnings, fmt.Sprintf("%s: unknown key %q is ignored", path, key))
+	}
+
+	dir := filepath.Dir(path)
+	cfg.ImportMap = resolvePath(dir, cfg.ImportMap)
+	cfg.CacheDir = resolvePath(dir, cfg.CacheDir)
+	cfg.Lock = resolvePath(dir, cfg.Lock)
+
+	return &cfg, nil
+}
+
+func resolvePath(dir, path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
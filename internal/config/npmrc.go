@@ -0,0 +1,78 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/katungi/edon/internal/errors"
+)
+
+// NPMRCFile is npm's per-user and per-project config file
+const NPMRCFile = ".npmrc"
+
+// NPMRC holds the registry settings of .npmrc files; npm's other settings
+// are ignored
+type NPMRC struct {
+	// Registry is the default registry, from "registry="
+	Registry string
+	// Scopes maps a scope such as "@myorg" to the registry its packages are
+	// fetched from, from "@myorg:registry="
+	Scopes map[string]string
+	// Tokens maps a registry host, with its port if it has one, to the
+	// token sent to it, from "//host/path/:_authToken="
+	Tokens map[string]string
+}
+
+// LoadNPMRC reads the .npmrc in each of dirs, typically the user's home then
+// the project, with settings in later files winning. Missing files are
+// skipped, so no .npmrc at all yields an empty NPMRC.
+func LoadNPMRC(dirs ...string) (*NPMRC, error) {
+	rc := &NPMRC{Scopes: make(map[string]string), Tokens: make(map[string]string)}
+	for _, dir := range dirs {
+		path := filepath.Join(dir, NPMRCFile)
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, errors.WrapWith(errors.ErrConfigInvalid, err, path)
+		}
+		rc.parse(data)
+	}
+	return rc, nil
+}
+
+// parse reads the "key=value" lines of an .npmrc into rc. Values may refer
+// to environment variables as ${NAME}, which is how tokens are usually kept
+// out of the file.
+func (rc *NPMRC) parse(data []byte) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		key = strings.TrimSpace(key)
+		value = os.ExpandEnv(strings.Trim(strings.TrimSpace(value), `"'`))
+
+		switch {
+		case key == "registry":
+			rc.Registry = strings.TrimSuffix(value, "/")
+		case strings.HasPrefix(key, "@") && strings.HasSuffix(key, ":registry"):
+			rc.Scopes[strings.TrimSuffix(key, ":registry")] = strings.TrimSuffix(value, "/")
+		case strings.HasPrefix(key, "//") && strings.HasSuffix(key, ":_authToken"):
+			// The key is the registry URL without its scheme
+			if u, err := url.Parse("https:" + strings.TrimSuffix(key, ":_authToken")); err == nil && u.Host != "" {
+				rc.Tokens[u.Host] = value
+			}
+		}
+	}
+}
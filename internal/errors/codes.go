@@ -0,0 +1,102 @@
+package errors
+
+// codes names each sentinel for machine-readable output, such as the CLI's
+// --output=json. A code never changes once released, so scripts can rely on
+// it where messages are reworded.
+var codes = []struct {
+	err  error
+	code string
+}{
+	{ErrInterrupt, "INTERRUPT"},
+	{ErrExit, "EXIT"},
+	{ErrRuntimeInit, "RUNTIME_INIT"},
+	{ErrBuiltinInit, "BUILTIN_INIT"},
+	{ErrConsoleInit, "CONSOLE_INIT"},
+	{ErrEvalFailed, "EVAL_FAILED"},
+	{ErrFileNotFound, "FILE_NOT_FOUND"},
+	{ErrFileRead, "FILE_READ"},
+	{ErrPathEscape, "PATH_ESCAPE"},
+	{ErrSymlinkLoop, "SYMLINK_LOOP"},
+	{ErrInvalidScript, "INVALID_SCRIPT"},
+	{ErrEmptyURL, "EMPTY_URL"},
+	{ErrInvalidURL, "INVALID_URL"},
+	{ErrUnsupportedModule, "UNSUPPORTED_MODULE"},
+	{ErrModuleNotFound, "MODULE_NOT_FOUND"},
+	{ErrModuleFetch, "MODULE_FETCH"},
+	{ErrCircularDependency, "CIRCULAR_DEPENDENCY"},
+	{ErrInvalidImportMap, "INVALID_IMPORT_MAP"},
+	{ErrOffline, "OFFLINE"},
+	{ErrTranspile, "TRANSPILE"},
+	{ErrInvalidJSON, "INVALID_JSON"},
+	{ErrInvalidWasm, "INVALID_WASM"},
+	{ErrUnknownBuiltin, "UNKNOWN_BUILTIN"},
+	{ErrBuiltinExists, "BUILTIN_EXISTS"},
+	{ErrModuleTooLarge, "MODULE_TOO_LARGE"},
+	{ErrTruncated, "TRUNCATED"},
+	{ErrModuleTimeout, "MODULE_TIMEOUT"},
+	{ErrInvalidRange, "INVALID_RANGE"},
+	{ErrLoaderClosed, "LOADER_CLOSED"},
+	{ErrCacheCorrupt, "CACHE_CORRUPT"},
+	{ErrTLSConfig, "TLS_CONFIG"},
+	{ErrInsecureURL, "INSECURE_URL"},
+	{ErrNotSeeded, "NOT_SEEDED"},
+	{ErrModuleEncoding, "MODULE_ENCODING"},
+	{ErrModuleExcluded, "MODULE_EXCLUDED"},
+	{ErrHTMLResponse, "HTML_RESPONSE"},
+	{ErrTransform, "TRANSFORM"},
+	{ErrInvalidModule, "INVALID_MODULE"},
+	{ErrPackageRequired, "PACKAGE_REQUIRED"},
+	{ErrInvalidPackageName, "INVALID_PACKAGE_NAME"},
+	{ErrPackageNotFound, "PACKAGE_NOT_FOUND"},
+	{ErrVersionNotFound, "VERSION_NOT_FOUND"},
+	{ErrInvalidVersion, "INVALID_VERSION"},
+	{ErrInvalidSavePrefix, "INVALID_SAVE_PREFIX"},
+	{ErrPackageInstall, "PACKAGE_INSTALL"},
+	{ErrPackageFetch, "PACKAGE_FETCH"},
+	{ErrCacheDir, "CACHE_DIR"},
+	{ErrIntegrityMismatch, "INTEGRITY_MISMATCH"},
+	{ErrInvalidPackage, "INVALID_PACKAGE"},
+	{ErrCacheArchive, "CACHE_ARCHIVE"},
+	{ErrMaliciousArchive, "MALICIOUS_ARCHIVE"},
+	{ErrEngineMismatch, "ENGINE_MISMATCH"},
+	{ErrGitUnavailable, "GIT_UNAVAILABLE"},
+	{ErrGitClone, "GIT_CLONE"},
+	{ErrInvalidOverride, "INVALID_OVERRIDE"},
+	{ErrRegistryAuth, "REGISTRY_AUTH"},
+	{ErrInvalidLockfile, "INVALID_LOCKFILE"},
+	{ErrIntegrityAlgorithm, "INTEGRITY_ALGORITHM"},
+	{ErrPermissionDenied, "PERMISSION_DENIED"},
+	{ErrConfigInvalid, "CONFIG_INVALID"},
+	{ErrServerInit, "SERVER_INIT"},
+	{ErrServerStart, "SERVER_START"},
+	{ErrInvalidRequest, "INVALID_REQUEST"},
+}
+
+// CodeUnknown is the code of errors that wrap none of the sentinels
+const CodeUnknown = "UNKNOWN"
+
+// Code returns the code of the outermost sentinel in err's tree, such as
+// "MODULE_NOT_FOUND" for an error wrapping ErrModuleNotFound, or CodeUnknown
+// when it wraps none. Outermost first means an error made by WrapWith gets
+// its category's code rather than its cause's.
+func Code(err error) string {
+	if err == nil {
+		return ""
+	}
+	for _, c := range codes {
+		if err == c.err {
+			return c.code
+		}
+	}
+	switch e := err.(type) {
+	case interface{ Unwrap() error }:
+		return Code(e.Unwrap())
+	case interface{ Unwrap() []error }:
+		for _, inner := range e.Unwrap() {
+			if code := Code(inner); code != CodeUnknown {
+				return code
+			}
+		}
+	}
+	return CodeUnknown
+}
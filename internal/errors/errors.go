@@ -19,6 +19,8 @@ var (
 	ErrEvalFailed    = errors.New("evaluation failed")
 	ErrFileNotFound  = errors.New("file not found")
 	ErrFileRead      = errors.New("failed to read file")
+	ErrPathEscape    = errors.New("path is outside the allowed roots")
+	ErrSymlinkLoop   = errors.New("symbolic links form a loop")
 	ErrInvalidScript = errors.New("invalid script")
 )
 
@@ -28,17 +30,63 @@ var (
 	ErrInvalidURL         = errors.New("invalid URL format")
 	ErrUnsupportedModule  = errors.New("unsupported module type")
 	ErrModuleNotFound     = errors.New("module not found")
+	ErrModuleFetch        = errors.New("failed to fetch module")
 	ErrCircularDependency = errors.New("circular dependency detected")
-	ErrJSRNotImplemented  = errors.New("JSR module loading not implemented yet")
+	ErrInvalidImportMap   = errors.New("invalid import map")
+	ErrOffline            = errors.New("network access disabled in offline mode")
+	ErrTranspile          = errors.New("failed to transpile module")
+	ErrInvalidJSON        = errors.New("invalid JSON module")
+	ErrInvalidWasm        = errors.New("invalid WASM module: missing \\0asm header")
+	ErrUnknownBuiltin     = errors.New("unknown builtin module")
+	ErrBuiltinExists      = errors.New("builtin module already registered")
+	ErrModuleTooLarge     = errors.New("module exceeds the maximum size")
+	ErrTruncated          = errors.New("response body shorter than its Content-Length")
+	ErrModuleTimeout      = errors.New("module load timed out")
+	ErrInvalidRange       = errors.New("invalid byte range")
+	ErrLoaderClosed       = errors.New("module loader is closed")
+	ErrCacheCorrupt       = errors.New("corrupt cache entry")
+	ErrTLSConfig          = errors.New("invalid TLS configuration")
+	ErrInsecureURL        = errors.New("plain HTTP is only allowed for trusted hosts")
+	ErrNotSeeded          = errors.New("module was not seeded into the in-memory loader")
+	ErrModuleEncoding     = errors.New("invalid encoded module")
+	ErrModuleExcluded     = errors.New("module excluded by the package's browser field")
+	ErrHTMLResponse       = errors.New("server returned an HTML page instead of a module")
+	ErrTransform          = errors.New("module transform failed")
+	ErrInvalidModule      = errors.New("invalid module content")
 )
 
 // NPM errors
 var (
-	ErrPackageRequired = errors.New("package name is required")
-	ErrPackageNotFound = errors.New("package not found")
-	ErrPackageInstall  = errors.New("failed to install package")
-	ErrPackageFetch    = errors.New("failed to fetch package metadata")
-	ErrCacheDir        = errors.New("failed to create cache directory")
+	ErrPackageRequired    = errors.New("package name is required")
+	ErrInvalidPackageName = errors.New("invalid package name")
+	ErrPackageNotFound    = errors.New("package not found")
+	ErrVersionNotFound    = errors.New("package version not found")
+	ErrInvalidVersion     = errors.New("invalid version")
+	ErrInvalidSavePrefix  = errors.New("save prefix must be ^, ~ or empty")
+	ErrPackageInstall     = errors.New("failed to install package")
+	ErrPackageFetch       = errors.New("failed to fetch package metadata")
+	ErrCacheDir           = errors.New("failed to create cache directory")
+	ErrIntegrityMismatch  = errors.New("package integrity check failed")
+	ErrInvalidPackage     = errors.New("invalid package")
+	ErrCacheArchive       = errors.New("invalid cache archive")
+	ErrMaliciousArchive   = errors.New("package archive escapes its directory")
+	ErrEngineMismatch     = errors.New("package needs an engine the runtime doesn't provide")
+	ErrGitUnavailable     = errors.New("git is not installed or not on PATH")
+	ErrGitClone           = errors.New("failed to clone git repository")
+	ErrInvalidOverride    = errors.New("invalid override")
+	ErrRegistryAuth       = errors.New("registry authentication failed")
+	ErrInvalidLockfile    = errors.New("invalid lockfile")
+	ErrIntegrityAlgorithm = errors.New("unsupported integrity algorithm")
+)
+
+// Permission errors
+var (
+	ErrPermissionDenied = errors.New("permission denied")
+)
+
+// Config errors
+var (
+	ErrConfigInvalid = errors.New("invalid config file")
 )
 
 // Server errors
@@ -68,6 +116,11 @@ func WrapWith(sentinel, cause error, msg string) error {
 	return fmt.Errorf("%s: %w", msg, joined)
 }
 
+// Join combines multiple errors into one, discarding nils
+func Join(errs ...error) error {
+	return errors.Join(errs...)
+}
+
 // Is checks if an error matches a target error
 func Is(err, target error) bool {
 	return errors.Is(err, target)
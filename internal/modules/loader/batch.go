@@ -0,0 +1,95 @@
+package loader
+
+import (
+	"context"
+	"sync"
+
+	"github.com/katungi/edon/internal/errors"
+)
+
+// LoadModules loads several modules concurrently, as many at once as
+// WithMaxConcurrency allows, and returns those that loaded, keyed by the
+// requested URL. Failures are aggregated into a single error naming each
+// failed URL, or with WithFailFast the first failure cancels the rest. The
+// loads share one WithRetryBudget budget.
+func (l *ModuleLoader) LoadModules(ctx context.Context, urls []string) (map[string]*Module, error) {
+	ctx = l.withRetryBudget(ctx)
+	ctx, failures := l.newFailures(ctx)
+	defer failures.cancel()
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		modules = make(map[string]*Module, len(urls))
+	)
+
+	for _, url := range urls {
+		wg.Add(1)
+		go func(url string) {
+			defer wg.Done()
+
+			release, err := l.config.acquire(ctx)
+			if err != nil {
+				failures.add(errors.Wrap(err, url))
+				return
+			}
+			defer release()
+
+			module, err := l.LoadModule(ctx, url)
+			if err != nil {
+				failures.add(errors.Wrap(err, url))
+				return
+			}
+			mu.Lock()
+			modules[url] = module
+			mu.Unlock()
+		}(url)
+	}
+	wg.Wait()
+
+	return modules, failures.err()
+}
+
+// failures collects the errors of a batch of loads. With WithFailFast the
+// first one cancels the batch's context, and the errors the cancellation
+// causes aren't collected.
+type failures struct {
+	mu       sync.Mutex
+	errs     []error
+	failFast bool
+	cancel   context.CancelFunc
+}
+
+// newFailures returns a context for a batch of loads and the failures to
+// collect their errors in. Callers must call failures.cancel when done.
+func (l *ModuleLoader) newFailures(ctx context.Context) (context.Context, *failures) {
+	ctx, cancel := context.WithCancel(ctx)
+	return ctx, &failures{failFast: l.config.failFast, cancel: cancel}
+}
+
+// add records err, canceling the batch if it fails fast
+func (f *failures) add(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.failFast {
+		if len(f.errs) > 0 {
+			return
+		}
+		f.cancel()
+	}
+	f.errs = append(f.errs, err)
+}
+
+// err joins the errors collected, so errors.Is and errors.As see each one
+// and Unwrap() []error lists them, or returns nil when there were none
+func (f *failures) err() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return errors.Join(f.errs...)
+}
+
+// Warm preloads modules into the in-memory and disk caches so a later run can
+// be served entirely from cache
+func (l *ModuleLoader) Warm(ctx context.Context, urls []string) error {
+	_, err := l.LoadModules(ctx, urls)
+	return err
+}
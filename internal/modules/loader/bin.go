@@ -0,0 +1,55 @@
+package loader
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/katungi/edon/internal/errors"
+)
+
+// withBins fills in installed.Bins from the package's package.json
+func withBins(installed *InstalledPackage) (*InstalledPackage, error) {
+	manifest, err := readPackageManifest(installed.Path)
+	if brokenManifest(err) {
+		// Loading the package can still guess its entry, but not its bins
+		return installed, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	bins, err := parseBin(manifest.Bin, installed.Name)
+	if err != nil {
+		return nil, errors.Wrap(err, installed.Name+"@"+installed.Version)
+	}
+	for command, file := range bins {
+		target, ok := containedPath(installed.Path, file)
+		// Commands become file names when linked, so they can't hold a path
+		if !ok || command == "" || command == "." || command == ".." || strings.ContainsAny(command, `/\`) {
+			return nil, errors.Wrap(errors.ErrInvalidPackage,
+				fmt.Sprintf("%s@%s: invalid bin %q: %q", installed.Name, installed.Version, command, file))
+		}
+		bins[command] = target
+	}
+	installed.Bins = bins
+	return installed, nil
+}
+
+// parseBin reads a "bin" field, which is either a single file run as the
+// package's unscoped name or a map of command names to files
+func parseBin(raw json.RawMessage, name string) (map[string]string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+
+	var file string
+	if err := json.Unmarshal(raw, &file); err == nil {
+		return map[string]string{path.Base(name): file}, nil
+	}
+	var bins map[string]string
+	if err := json.Unmarshal(raw, &bins); err != nil {
+		return nil, errors.Wrap(errors.ErrInvalidPackage, "bin must be a string or an object of strings")
+	}
+	return bins, nil
+}
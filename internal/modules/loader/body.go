@@ -0,0 +1,100 @@
+package loader
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/katungi/edon/internal/errors"
+)
+
+// defaultMaxModuleSize is the largest remote module loaded unless
+// WithMaxModuleSize says otherwise
+const defaultMaxModuleSize = 64 << 20
+
+// readModuleBody reads a module response body of at most limit bytes, or any
+// size when limit is zero or less. A declared Content-Length sizes the buffer
+// up front, rejects oversized modules before reading, and must match what
+// arrives, so a truncated download isn't mistaken for the whole module.
+func readModuleBody(resp *http.Response, limit int64) ([]byte, error) {
+	url := resp.Request.URL.String()
+	declared := resp.ContentLength
+	if limit > 0 && declared > limit {
+		return nil, errors.Wrap(errors.ErrModuleTooLarge, fmt.Sprintf("%s is %d bytes (limit %d)", url, declared, limit))
+	}
+
+	// Without a limit the declared length isn't trusted with a huge allocation
+	var buf bytes.Buffer
+	if declared > 0 {
+		buf.Grow(int(min(declared, defaultMaxModuleSize)))
+	}
+	body := io.Reader(resp.Body)
+	if limit > 0 {
+		// One byte over the limit is enough to know it was exceeded
+		body = io.LimitReader(body, limit+1)
+	}
+	if _, err := buf.ReadFrom(body); err != nil {
+		if err == io.ErrUnexpectedEOF && declared >= 0 {
+			return nil, errors.Wrap(errors.ErrTruncated, fmt.Sprintf("%s: got %d of %d bytes", url, buf.Len(), declared))
+		}
+		return nil, errors.Wrap(errors.ErrFileRead, err.Error())
+	}
+
+	switch n := int64(buf.Len()); {
+	case limit > 0 && n > limit:
+		return nil, errors.Wrap(errors.ErrModuleTooLarge, fmt.Sprintf("%s is over %d bytes", url, limit))
+	case declared >= 0 && n != declared:
+		return nil, errors.Wrap(errors.ErrTruncated, fmt.Sprintf("%s: got %d of %d bytes", url, n, declared))
+	}
+	return buf.Bytes(), nil
+}
+
+// readModuleFile reads a local module of at most limit bytes, or any size
+// when limit is zero or less. The file is sized up front so an oversized one
+// is rejected before any of it is read and the buffer is allocated once; a
+// file that grows while it's read is still stopped at the limit.
+func readModuleFile(path string, limit int64) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrFileRead, err.Error())
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrFileRead, err.Error())
+	}
+	if err := checkFileSize(path, info.Size(), limit); err != nil {
+		return nil, err
+	}
+
+	// As for bodies, an unlimited read doesn't trust the size with a huge
+	// allocation. One more byte lets ReadFrom see EOF without growing.
+	size := info.Size()
+	if limit <= 0 {
+		size = min(size, defaultMaxModuleSize)
+	}
+	var buf bytes.Buffer
+	buf.Grow(int(size) + 1)
+	body := io.Reader(file)
+	if limit > 0 {
+		body = io.LimitReader(body, limit+1)
+	}
+	if _, err := buf.ReadFrom(body); err != nil {
+		return nil, errors.Wrap(errors.ErrFileRead, err.Error())
+	}
+	if limit > 0 && int64(buf.Len()) > limit {
+		return nil, errors.Wrap(errors.ErrModuleTooLarge, fmt.Sprintf("%s is over %d bytes", path, limit))
+	}
+	return buf.Bytes(), nil
+}
+
+// checkFileSize fails with errors.ErrModuleTooLarge when a local module of
+// size bytes is over limit
+func checkFileSize(path string, size, limit int64) error {
+	if limit > 0 && size > limit {
+		return errors.Wrap(errors.ErrModuleTooLarge, fmt.Sprintf("%s is %d bytes (limit %d)", path, size, limit))
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package loader
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"slices"
+
+	"github.com/katungi/edon/internal/errors"
+)
+
+// browserCondition is the condition under which a package's "browser" field
+// is honored, along with the "browser" branches of its "exports"
+const browserCondition = "browser"
+
+// browserMain returns the entry the string form of a package's "browser"
+// field names in place of "main", as in "browser": "./dist/browser.js"
+func browserMain(manifest *packageManifest) (string, bool) {
+	var main string
+	if err := json.Unmarshal(manifest.Browser, &main); err != nil || main == "" {
+		return "", false
+	}
+	return main, true
+}
+
+// remapBrowserFile applies the map form of a package's "browser" field to
+// file, a file inside the package at packagePath. A key naming file, with
+// or without its extension, swaps in the file its value names, and a false
+// value excludes it, failing with errors.ErrModuleExcluded. Keys naming
+// other packages, such as "fs": false, aren't applied.
+func remapBrowserFile(packagePath string, manifest *packageManifest, file string) (string, error) {
+	var remaps map[string]json.RawMessage
+	if err := json.Unmarshal(manifest.Browser, &remaps); err != nil {
+		return file, nil
+	}
+	// Sorted, so that "./a" and "./a.js" mapping one file differently always
+	// agree on which applies
+	keys := make([]string, 0, len(remaps))
+	for key := range remaps {
+		if isRelativeSpecifier(key) {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		if from, ok := probeFile(filepath.Join(packagePath, filepath.FromSlash(key))); !ok || from != file {
+			continue
+		}
+		var excluded bool
+		if err := json.Unmarshal(remaps[key], &excluded); err == nil && !excluded {
+			return "", errors.Wrap(errors.ErrModuleExcluded, fmt.Sprintf("%s in %s", key, packageName(manifest)))
+		}
+		var target string
+		if err := json.Unmarshal(remaps[key], &target); err != nil {
+			continue
+		}
+		to, ok := probeFile(filepath.Join(packagePath, filepath.FromSlash(target)))
+		if !ok {
+			return "", errors.Wrap(errors.ErrModuleNotFound,
+				fmt.Sprintf("%s maps %s to %s, which doesn't exist", packageName(manifest), key, target))
+		}
+		return to, nil
+	}
+	return file, nil
+}
+
+// excludedModule stands in for a file a package's "browser" field maps to
+// false: an ES module whose default export is an empty object, as bundlers
+// substitute
+func excludedModule(url string, packageType PackageType, version string) *Module {
+	return &Module{
+		URL:             url,
+		Content:         "export default {};\n",
+		Type:            packageType,
+		MediaType:       MediaJavaScript,
+		Format:          FormatESM,
+		ResolvedVersion: version,
+	}
+}
@@ -0,0 +1,322 @@
+package loader
+
+import (
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/katungi/edon/internal/errors"
+)
+
+// nodeBuiltinPrefix marks Node.js builtin specifiers such as "node:path"
+const nodeBuiltinPrefix = "node:"
+
+// nodeBuiltinNames lists the Node.js core modules. Their bare names
+// ("fs", "path") are treated as builtins rather than unsupported specifiers,
+// whether or not edon ships a shim for them.
+var nodeBuiltinNames = map[string]bool{
+	"assert": true, "async_hooks": true, "buffer": true, "child_process": true,
+	"cluster": true, "console": true, "constants": true, "crypto": true,
+	"dgram": true, "diagnostics_channel": true, "dns": true, "domain": true,
+	"events": true, "fs": true, "fs/promises": true, "http": true,
+	"http2": true, "https": true, "inspector": true, "module": true,
+	"net": true, "os": true, "path": true, "path/posix": true,
+	"perf_hooks": true, "process": true, "punycode": true, "querystring": true,
+	"readline": true, "repl": true, "stream": true, "string_decoder": true,
+	"timers": true, "tls": true, "tty": true, "url": true, "util": true,
+	"v8": true, "vm": true, "worker_threads": true, "zlib": true,
+}
+
+// isBuiltin reports whether specifier names a builtin module, either with
+// the node: scheme or as the bare name of a Node.js core module
+func isBuiltin(specifier string) bool {
+	return strings.HasPrefix(specifier, nodeBuiltinPrefix) || nodeBuiltinNames[specifier]
+}
+
+// canonicalBuiltin returns the node: form of a builtin specifier so "path"
+// and "node:path" share a cache entry
+func canonicalBuiltin(specifier string) string {
+	if nodeBuiltinNames[specifier] {
+		return nodeBuiltinPrefix + specifier
+	}
+	return specifier
+}
+
+// builtinRegistry maps canonical builtin specifiers to their source. Each
+// loader starts with the node: shims and embedders may add their own.
+type builtinRegistry struct {
+	mu      sync.RWMutex
+	modules map[string]string
+}
+
+func newBuiltinRegistry() *builtinRegistry {
+	modules := make(map[string]string, len(nodeShims))
+	for name, source := range nodeShims {
+		modules[nodeBuiltinPrefix+name] = source
+	}
+	return &builtinRegistry{modules: modules}
+}
+
+// get returns the source registered under a canonical specifier
+func (r *builtinRegistry) get(name string) (string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	source, ok := r.modules[name]
+	return source, ok
+}
+
+// names returns the registered specifiers in sorted order
+func (r *builtinRegistry) names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.modules))
+	for name := range r.modules {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// RegisterBuiltin makes source loadable under name, e.g. "node:fs" or
+// "host:db", without touching the disk or network. Bare Node.js core names
+// are registered under their node: form. Replacing an existing builtin,
+// including a shipped node: shim, fails with errors.ErrBuiltinExists unless
+// force is set.
+func (l *ModuleLoader) RegisterBuiltin(name, source string, force bool) error {
+	if name == "" {
+		return errors.ErrEmptyURL
+	}
+	name = canonicalBuiltin(name)
+
+	l.builtins.mu.Lock()
+	defer l.builtins.mu.Unlock()
+	if _, ok := l.builtins.modules[name]; ok && !force {
+		return errors.Wrap(errors.ErrBuiltinExists, name)
+	}
+	l.builtins.modules[name] = source
+	// Drop any copy loaded before the registration changed
+	l.cache.remove(newCacheKey(TypeBuiltin, name))
+	return nil
+}
+
+// UnregisterBuiltin removes the builtin registered under name, reporting
+// whether it was present
+func (l *ModuleLoader) UnregisterBuiltin(name string) bool {
+	name = canonicalBuiltin(name)
+
+	l.builtins.mu.Lock()
+	defer l.builtins.mu.Unlock()
+	_, ok := l.builtins.modules[name]
+	delete(l.builtins.modules, name)
+	l.cache.remove(newCacheKey(TypeBuiltin, name))
+	return ok
+}
+
+// validate classifies a normalized specifier by the source that loads it.
+// Registered builtins take precedence over the other built-in sources, so
+// embedders can claim any specifier for a host API.
+func (l *ModuleLoader) validate(url string) ValidationResult {
+	if _, packageType := l.sources.find(url); packageType != "" {
+		return ValidationResult{IsValid: true, PackageType: packageType}
+	}
+	// Nothing handles it, so let ValidateURL say why
+	return ValidateURL(url)
+}
+
+// loadBuiltinModule returns the in-process source registered for a builtin.
+// Nothing is read from disk or the network.
+func (l *ModuleLoader) loadBuiltinModule(url string) (*Module, error) {
+	source, ok := l.builtins.get(url)
+	if !ok {
+		return nil, errors.Wrap(errors.ErrUnknownBuiltin,
+			url+" (supported: "+strings.Join(l.builtins.names(), ", ")+")")
+	}
+
+	return &Module{
+		URL:       url,
+		Content:   source,
+		Type:      TypeBuiltin,
+		MediaType: MediaJavaScript,
+	}, nil
+}
+
+// nodeShims holds the JavaScript implementations of the node: builtins edon
+// ships. Modules that need host access, like fs, aren't shimmed; embedders
+// can provide them with RegisterBuiltin.
+var nodeShims = map[string]string{
+	"path":   pathShim,
+	"events": eventsShim,
+	"assert": assertShim,
+}
+
+const pathShim = `export const sep = "/";
+export const delimiter = ":";
+
+export function isAbsolute(p) {
+  return p.startsWith("/");
+}
+
+export function normalize(p) {
+  if (p === "") return ".";
+  const absolute = isAbsolute(p);
+  const trailing = p.endsWith("/");
+  const out = [];
+  for (const part of p.split("/")) {
+    if (part === "" || part === ".") continue;
+    if (part === "..") {
+      if (out.length && out[out.length - 1] !== "..") out.pop();
+      else if (!absolute) out.push("..");
+    } else {
+      out.push(part);
+    }
+  }
+  let result = out.join("/");
+  if (absolute) result = "/" + result;
+  if (trailing && result !== "/" && result !== "") result += "/";
+  return result || (absolute ? "/" : ".");
+}
+
+export function join(...parts) {
+  const joined = parts.filter((p) => p !== "").join("/");
+  return joined === "" ? "." : normalize(joined);
+}
+
+export function dirname(p) {
+  const trimmed = p.replace(/\/+$/, "");
+  const idx = trimmed.lastIndexOf("/");
+  if (idx === -1) return ".";
+  return idx === 0 ? "/" : trimmed.slice(0, idx);
+}
+
+export function basename(p, ext) {
+  let base = p.replace(/\/+$/, "");
+  base = base.slice(base.lastIndexOf("/") + 1);
+  if (ext && base.endsWith(ext) && base !== ext) base = base.slice(0, -ext.length);
+  return base;
+}
+
+export function extname(p) {
+  const base = basename(p);
+  const idx = base.lastIndexOf(".");
+  return idx <= 0 ? "" : base.slice(idx);
+}
+
+export default { sep, delimiter, isAbsolute, normalize, join, dirname, basename, extname };
+`
+
+const eventsShim = `export class EventEmitter {
+  #listeners = new Map();
+
+  on(event, listener) {
+    if (!this.#listeners.has(event)) this.#listeners.set(event, []);
+    this.#listeners.get(event).push(listener);
+    return this;
+  }
+
+  addListener(event, listener) {
+    return this.on(event, listener);
+  }
+
+  once(event, listener) {
+    const wrapper = (...args) => {
+      this.off(event, wrapper);
+      listener.apply(this, args);
+    };
+    wrapper.listener = listener;
+    return this.on(event, wrapper);
+  }
+
+  off(event, listener) {
+    const list = this.#listeners.get(event);
+    if (!list) return this;
+    const idx = list.findIndex((l) => l === listener || l.listener === listener);
+    if (idx !== -1) list.splice(idx, 1);
+    if (list.length === 0) this.#listeners.delete(event);
+    return this;
+  }
+
+  removeListener(event, listener) {
+    return this.off(event, listener);
+  }
+
+  removeAllListeners(event) {
+    if (event === undefined) this.#listeners.clear();
+    else this.#listeners.delete(event);
+    return this;
+  }
+
+  emit(event, ...args) {
+    const list = this.#listeners.get(event);
+    if (!list) {
+      if (event === "error") throw args[0];
+      return false;
+    }
+    for (const listener of [...list]) listener.apply(this, args);
+    return true;
+  }
+
+  listenerCount(event) {
+    return this.#listeners.get(event)?.length ?? 0;
+  }
+}
+
+export default EventEmitter;
+`
+
+const assertShim = `export class AssertionError extends Error {
+  constructor(message) {
+    super(message);
+    this.name = "AssertionError";
+  }
+}
+
+function fail(message, fallback) {
+  if (message instanceof Error) throw message;
+  throw new AssertionError(message ?? fallback);
+}
+
+export function ok(value, message) {
+  if (!value) fail(message, "The expression evaluated to a falsy value");
+}
+
+export function equal(actual, expected, message) {
+  if (actual != expected) fail(message, actual + " == " + expected);
+}
+
+export function strictEqual(actual, expected, message) {
+  if (!Object.is(actual, expected)) fail(message, actual + " === " + expected);
+}
+
+export function notStrictEqual(actual, expected, message) {
+  if (Object.is(actual, expected)) fail(message, actual + " !== " + expected);
+}
+
+function isDeepEqual(a, b) {
+  if (Object.is(a, b)) return true;
+  if (typeof a !== "object" || typeof b !== "object" || a === null || b === null) return false;
+  if (Object.getPrototypeOf(a) !== Object.getPrototypeOf(b)) return false;
+  const keys = Object.keys(a);
+  if (keys.length !== Object.keys(b).length) return false;
+  return keys.every((key) => Object.hasOwn(b, key) && isDeepEqual(a[key], b[key]));
+}
+
+export function deepStrictEqual(actual, expected, message) {
+  if (!isDeepEqual(actual, expected)) fail(message, "Values are not deeply equal");
+}
+
+export function throws(fn, message) {
+  try {
+    fn();
+  } catch {
+    return;
+  }
+  fail(message, "Missing expected exception");
+}
+
+function assert(value, message) {
+  ok(value, message);
+}
+Object.assign(assert, { AssertionError, ok, equal, strictEqual, notStrictEqual, deepStrictEqual, throws });
+
+export default assert;
+`
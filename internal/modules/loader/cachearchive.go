@@ -0,0 +1,304 @@
+package loader
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/katungi/edon/internal/errors"
+)
+
+// Directories under the base cache directory
+const (
+	npmCacheDir    = "npm-cache"
+	remoteCacheDir = "remote"
+)
+
+// baseDir returns the base cache directory the package manager's npm cache
+// lives in, which also holds the remote module cache
+func (pm *NPMPackageManager) baseDir() string {
+	return filepath.Dir(pm.cacheDir)
+}
+
+// ExportCache writes the installed npm packages and cached remote modules to
+// w as a gzipped tarball, for restoring elsewhere with ImportCache.
+// In-progress installs and temporary files are left out.
+func (pm *NPMPackageManager) ExportCache(w io.Writer) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	base := pm.baseDir()
+
+	packages, err := listPackageDirs(pm.cacheDir)
+	if err != nil {
+		return err
+	}
+	for _, dir := range packages {
+		if err := addTree(tw, base, filepath.Join(pm.cacheDir, dir)); err != nil {
+			return err
+		}
+	}
+
+	remote, err := listRemoteEntries(filepath.Join(base, remoteCacheDir))
+	if err != nil {
+		return err
+	}
+	for _, name := range remote {
+		if err := addFile(tw, base, filepath.Join(base, remoteCacheDir, name)); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return errors.Wrap(errors.ErrCacheArchive, err.Error())
+	}
+	if err := gz.Close(); err != nil {
+		return errors.Wrap(errors.ErrCacheArchive, err.Error())
+	}
+	return nil
+}
+
+// ImportCache restores a tarball written by ExportCache. Entries already in
+// the cache are kept as they are. The archive is unpacked into a staging
+// directory and checked before anything is moved into the cache: every path
+// must stay inside the npm or remote cache, and each package's package.json
+// must name the package and version its directory claims.
+func (pm *NPMPackageManager) ImportCache(r io.Reader) error {
+	base := pm.baseDir()
+	staging, err := os.MkdirTemp(base, ".import-*")
+	if err != nil {
+		return errors.Wrap(errors.ErrCacheDir, err.Error())
+	}
+	defer os.RemoveAll(staging)
+
+	if err := extractCacheArchive(r, staging); err != nil {
+		return err
+	}
+
+	packages, err := listPackageDirs(filepath.Join(staging, npmCacheDir))
+	if err != nil {
+		return err
+	}
+	for _, dir := range packages {
+		if err := checkPackageDir(filepath.Join(staging, npmCacheDir, dir), dir); err != nil {
+			return err
+		}
+	}
+
+	// Packages move in whole, so an installed package is never half-imported
+	for _, dir := range packages {
+		if err := moveIfAbsent(filepath.Join(staging, npmCacheDir, dir), filepath.Join(pm.cacheDir, dir)); err != nil {
+			return err
+		}
+	}
+
+	remote, err := listRemoteEntries(filepath.Join(staging, remoteCacheDir))
+	if err != nil {
+		return err
+	}
+	// Hash sidecars sort after their entries; move them first so a visible
+	// entry always has its hash, as diskCache.set does
+	slices.Reverse(remote)
+	for _, name := range remote {
+		if err := moveIfAbsent(filepath.Join(staging, remoteCacheDir, name), filepath.Join(base, remoteCacheDir, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// listPackageDirs returns the "name/version" (or "@scope/name/version")
+// directories of installed packages under dir. Anything that isn't laid out
+// like an install, such as staging directories and downloads, is skipped.
+func listPackageDirs(dir string) ([]string, error) {
+	var names []string
+	entries, err := readDirIfExists(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if !e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		if !strings.HasPrefix(e.Name(), "@") {
+			names = append(names, e.Name())
+			continue
+		}
+		scoped, err := readDirIfExists(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range scoped {
+			if s.IsDir() && !strings.HasPrefix(s.Name(), ".") {
+				names = append(names, e.Name()+"/"+s.Name())
+			}
+		}
+	}
+
+	var dirs []string
+	for _, name := range names {
+		versions, err := readDirIfExists(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range versions {
+			if v.IsDir() && isExactVersion(v.Name()) {
+				dirs = append(dirs, name+"/"+v.Name())
+			}
+		}
+	}
+	return dirs, nil
+}
+
+// listRemoteEntries returns the names of the cached remote modules under dir
+// and their hash sidecars, in sorted order
+func listRemoteEntries(dir string) ([]string, error) {
+	entries, err := readDirIfExists(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		key := strings.TrimSuffix(e.Name(), ".sha256")
+		if _, err := hex.DecodeString(key); e.Type().IsRegular() && err == nil && len(key) == 64 {
+			names = append(names, e.Name())
+		}
+	}
+	return names, nil
+}
+
+func readDirIfExists(dir string) ([]os.DirEntry, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrFileRead, err.Error())
+	}
+	return entries, nil
+}
+
+// checkPackageDir verifies that the package in dir is the name@version its
+// "name/version" cache path claims
+func checkPackageDir(dir, cachePath string) error {
+	manifest, err := readPackageManifest(dir)
+	if err != nil {
+		return err
+	}
+	name, version := path.Split(cachePath)
+	if manifest.Name != strings.TrimSuffix(name, "/") || manifest.Version != version {
+		return errors.Wrap(errors.ErrCacheArchive,
+			fmt.Sprintf("%s contains %s@%s", cachePath, manifest.Name, manifest.Version))
+	}
+	return nil
+}
+
+// moveIfAbsent renames src to dest unless dest already exists
+func moveIfAbsent(src, dest string) error {
+	dest = filepath.FromSlash(dest)
+	if _, err := os.Lstat(dest); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return errors.Wrap(errors.ErrCacheDir, err.Error())
+	}
+	if err := os.Rename(filepath.FromSlash(src), dest); err != nil {
+		// Lost a race with an install of the same entry, which is just as good
+		if _, statErr := os.Lstat(dest); statErr == nil {
+			return nil
+		}
+		return errors.Wrap(errors.ErrCacheDir, err.Error())
+	}
+	return nil
+}
+
+// addTree adds every regular file under dir to tw, named relative to base
+func addTree(tw *tar.Writer, base, dir string) error {
+	return filepath.WalkDir(dir, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return errors.Wrap(errors.ErrFileRead, err.Error())
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		return addFile(tw, base, p)
+	})
+}
+
+// addFile adds the regular file at p to tw, named relative to base
+func addFile(tw *tar.Writer, base, p string) error {
+	info, err := os.Stat(p)
+	if err != nil {
+		return errors.Wrap(errors.ErrFileRead, err.Error())
+	}
+	rel, err := filepath.Rel(base, p)
+	if err != nil {
+		return errors.Wrap(errors.ErrFileRead, err.Error())
+	}
+
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return errors.Wrap(errors.ErrCacheArchive, err.Error())
+	}
+	header.Name = filepath.ToSlash(rel)
+	if err := tw.WriteHeader(header); err != nil {
+		return errors.Wrap(errors.ErrCacheArchive, err.Error())
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		return errors.Wrap(errors.ErrFileRead, err.Error())
+	}
+	defer f.Close()
+	if _, err := io.Copy(tw, f); err != nil {
+		return errors.Wrap(errors.ErrCacheArchive, err.Error())
+	}
+	return nil
+}
+
+// extractCacheArchive unpacks a cache archive into dest, rejecting any entry
+// outside the npm and remote caches or that isn't a plain file or directory
+func extractCacheArchive(r io.Reader, dest string) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return errors.Wrap(errors.ErrCacheArchive, err.Error())
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(errors.ErrCacheArchive, err.Error())
+		}
+
+		name := path.Clean(header.Name)
+		top, _, _ := strings.Cut(name, "/")
+		if path.IsAbs(name) || strings.HasPrefix(name, "../") || (top != npmCacheDir && top != remoteCacheDir) {
+			return errors.Wrap(errors.ErrCacheArchive, "unexpected entry "+header.Name)
+		}
+		target := filepath.Join(dest, filepath.FromSlash(name))
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return errors.Wrap(errors.ErrCacheDir, err.Error())
+			}
+		case tar.TypeReg:
+			if err := writeTarEntry(tr, target, header.FileInfo().Mode()); err != nil {
+				return err
+			}
+		default:
+			return errors.Wrap(errors.ErrCacheArchive, "unsupported entry type for "+header.Name)
+		}
+	}
+}
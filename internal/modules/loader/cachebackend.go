@@ -0,0 +1,123 @@
+package loader
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/katungi/edon/internal/errors"
+)
+
+// CacheBackend stores the cache of fetched remote modules, so it can live
+// somewhere other than the local disk, such as Redis or an object store.
+// Keys are hex digests, optionally with a suffix such as ".sha256", so they
+// are safe as file names and object keys. Implementations must be safe for
+// concurrent use; a Get racing a Put may see the old value or the new one,
+// but never part of either.
+type CacheBackend interface {
+	// Get returns the value stored under key, reporting whether there was one
+	Get(key string) ([]byte, bool)
+	// Put stores value under key, replacing any earlier value
+	Put(key string, value []byte) error
+	// Delete removes key; deleting a missing key is not an error
+	Delete(key string) error
+}
+
+// NewDiskCacheBackend returns a CacheBackend that keeps each entry in a file
+// under dir, which is created on the first Put. It is what the loader uses
+// by default, under the "remote" directory of the base cache directory.
+func NewDiskCacheBackend(dir string) CacheBackend {
+	return &fileBackend{dir: dir}
+}
+
+// NewMemoryCacheBackend returns a CacheBackend that keeps entries in memory,
+// so they last only as long as the process
+func NewMemoryCacheBackend() CacheBackend {
+	return &memoryBackend{entries: make(map[string][]byte)}
+}
+
+// fileBackend is the disk CacheBackend
+type fileBackend struct {
+	dir string
+}
+
+func (b *fileBackend) Get(key string) ([]byte, bool) {
+	data, err := os.ReadFile(filepath.Join(b.dir, key))
+	return data, err == nil
+}
+
+// Put writes value through a temporary file so readers never observe a
+// partial entry
+func (b *fileBackend) Put(key string, value []byte) error {
+	tmp, err := b.create()
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(value); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return errors.Wrap(errors.ErrCacheDir, err.Error())
+	}
+	return b.commit(tmp, key)
+}
+
+func (b *fileBackend) Delete(key string) error {
+	if err := os.Remove(filepath.Join(b.dir, key)); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(errors.ErrCacheDir, err.Error())
+	}
+	return nil
+}
+
+// create opens a temporary file in the backend's directory for an entry
+// that commit later moves into place
+func (b *fileBackend) create() (*os.File, error) {
+	if err := os.MkdirAll(b.dir, 0755); err != nil {
+		return nil, errors.Wrap(errors.ErrCacheDir, err.Error())
+	}
+	tmp, err := os.CreateTemp(b.dir, ".tmp-*")
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrCacheDir, err.Error())
+	}
+	return tmp, nil
+}
+
+// commit closes tmp and renames it to key's file
+func (b *fileBackend) commit(tmp *os.File, key string) error {
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return errors.Wrap(errors.ErrCacheDir, err.Error())
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(b.dir, key)); err != nil {
+		_ = os.Remove(tmp.Name())
+		return errors.Wrap(errors.ErrCacheDir, err.Error())
+	}
+	return nil
+}
+
+// memoryBackend is the in-memory CacheBackend
+type memoryBackend struct {
+	mu      sync.RWMutex
+	entries map[string][]byte
+}
+
+func (b *memoryBackend) Get(key string) ([]byte, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	value, ok := b.entries[key]
+	return value, ok
+}
+
+func (b *memoryBackend) Put(key string, value []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	// Callers may reuse value's memory
+	b.entries[key] = append([]byte(nil), value...)
+	return nil
+}
+
+func (b *memoryBackend) Delete(key string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.entries, key)
+	return nil
+}
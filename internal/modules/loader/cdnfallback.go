@@ -0,0 +1,78 @@
+package loader
+
+import (
+	"context"
+	"strings"
+
+	"github.com/katungi/edon/internal/errors"
+)
+
+// cdnScheme marks a specifier such as "cdn:react@18" that may be served by
+// any of the configured CDNs
+const cdnScheme = "cdn:"
+
+// defaultCDNs are the CDNs "cdn:" specifiers try, in order
+var defaultCDNs = []string{"https://esm.sh/", "https://unpkg.com/", "https://cdn.jsdelivr.net/npm/"}
+
+// isCDNFallback reports whether url is a "cdn:" specifier
+func isCDNFallback(url string) bool {
+	rest, ok := strings.CutPrefix(url, cdnScheme)
+	return ok && rest != ""
+}
+
+// cdnCandidates returns the URLs a "cdn:" specifier expands to, one per
+// configured CDN, in the order they are tried
+func (l *ModuleLoader) cdnCandidates(url string) []string {
+	rest := strings.TrimPrefix(strings.TrimPrefix(url, cdnScheme), "/")
+	candidates := make([]string, 0, len(l.config.cdns))
+	for _, base := range l.config.cdns {
+		candidates = append(candidates, strings.TrimSuffix(base, "/")+"/"+rest)
+	}
+	return candidates
+}
+
+// loadCDNFallback loads a "cdn:" specifier from the first CDN that serves
+// it. Each CDN's URL goes through the usual caches, so a later run is served
+// from disk by whichever CDN won. Any failure, a 404 or a 5xx alike, moves on
+// to the next CDN; only cancellation stops early. The module keeps the
+// specifier as its URL, with the winning CDN's URL in ResolvedURL so relative
+// imports resolve against it.
+func (l *ModuleLoader) loadCDNFallback(ctx context.Context, url string, reload bool) (*Module, error) {
+	var errs []error
+	for _, candidate := range l.cdnCandidates(url) {
+		module, err := l.load(ctx, candidate, 0, reload)
+		if err == nil {
+			served := *module
+			served.URL, served.ResolvedURL = url, module.resolvedURL()
+			return &served, nil
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		errs = append(errs, err)
+	}
+	return nil, errors.WrapWith(errors.ErrModuleNotFound, errors.Join(errs...), url+": no CDN served it")
+}
+
+// cdnFallbackExists reports whether any configured CDN serves a "cdn:"
+// specifier. It fails only if no CDN could give an answer.
+func (l *ModuleLoader) cdnFallbackExists(ctx context.Context, url string) (bool, error) {
+	var errs []error
+	for _, candidate := range l.cdnCandidates(url) {
+		ok, err := l.Exists(ctx, candidate)
+		switch {
+		case ok:
+			return true, nil
+		case err == nil:
+			// A definite "no"; another CDN may still have it
+		case ctx.Err() != nil:
+			return false, err
+		default:
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) == len(l.config.cdns) && len(errs) > 0 {
+		return false, errors.Join(errs...)
+	}
+	return false, nil
+}
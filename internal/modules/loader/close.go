@@ -0,0 +1,25 @@
+package loader
+
+import "net/http"
+
+// Close stops the loader: background prefetches are cancelled and waited
+// for, so nothing is left writing to the disk cache, and the HTTP client's
+// idle connections are closed. Loads after Close fail with
+// errors.ErrLoaderClosed. Closing twice is a no-op.
+func (l *ModuleLoader) Close() error {
+	if l.closed.Swap(true) {
+		return nil
+	}
+	l.prefetcher.close()
+	l.httpClient.CloseIdleConnections()
+	return nil
+}
+
+// closeIdleConnections forwards CloseIdleConnections to rt when it supports
+// it, so the transports wrapping the client's own still let it drop idle
+// connections
+func closeIdleConnections(rt http.RoundTripper) {
+	if c, ok := rt.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,62 @@
+package loader
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/katungi/edon/internal/errors"
+)
+
+// CredentialProvider returns the bearer token to send to host, or "" to send
+// none. It is called for every request, so it can fetch short-lived tokens
+// and refresh them as they expire; caching them is up to the provider.
+type CredentialProvider func(ctx context.Context, host string) (string, error)
+
+// TokenCredentials returns a CredentialProvider that sends each host its
+// token from tokens, keyed by host with its port if it has one, as an
+// .npmrc's "//host/:_authToken=" lines give them, and no token to others
+func TokenCredentials(tokens map[string]string) CredentialProvider {
+	return func(ctx context.Context, host string) (string, error) {
+		return tokens[host], nil
+	}
+}
+
+// withCredentials returns a copy of client that asks provider for a token
+// before every request, recording each in secrets so events never show it.
+// The caller's client is left untouched.
+func withCredentials(client *http.Client, provider CredentialProvider, secrets *secretSet) *http.Client {
+	if provider == nil {
+		return client
+	}
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	wrapped := *client
+	wrapped.Transport = &credentialTransport{base: base, provider: provider, secrets: secrets}
+	return &wrapped
+}
+
+// credentialTransport sets the Authorization header from a CredentialProvider
+type credentialTransport struct {
+	base     http.RoundTripper
+	provider CredentialProvider
+	secrets  *secretSet
+}
+
+func (t *credentialTransport) CloseIdleConnections() { closeIdleConnections(t.base) }
+
+func (t *credentialTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.provider(req.Context(), req.URL.Host)
+	if err != nil {
+		return nil, errors.WrapWith(errors.ErrRegistryAuth, err, "credentials for "+req.URL.Host)
+	}
+	if token == "" {
+		return t.base.RoundTrip(req)
+	}
+	t.secrets.add(token)
+	// RoundTrippers must not modify the caller's request
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token)
+	return t.base.RoundTrip(req)
+}
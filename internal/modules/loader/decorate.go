@@ -0,0 +1,33 @@
+package loader
+
+import "net/http"
+
+// withRequestDecorator returns a copy of client that passes every outgoing
+// request through decorate. The caller's client is left untouched.
+func withRequestDecorator(client *http.Client, decorate func(*http.Request)) *http.Client {
+	if decorate == nil {
+		return client
+	}
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	wrapped := *client
+	wrapped.Transport = &decoratorTransport{base: base, decorate: decorate}
+	return &wrapped
+}
+
+// decoratorTransport lets an embedder adjust requests just before they're sent
+type decoratorTransport struct {
+	base     http.RoundTripper
+	decorate func(*http.Request)
+}
+
+func (t *decoratorTransport) CloseIdleConnections() { closeIdleConnections(t.base) }
+
+func (t *decoratorTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// RoundTrippers must not modify the caller's request
+	req = req.Clone(req.Context())
+	t.decorate(req)
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,80 @@
+package loader
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// denoLandHost serves third-party modules under /x/ and the standard library
+// under /std
+const denoLandHost = "deno.land"
+
+// denoLandVersion parses a deno.land module URL such as
+// "https://deno.land/x/oak@v12.6.1/mod.ts" or "https://deno.land/std@0.200.0/path/mod.ts",
+// returning the version as tagged. ok is false for URLs that aren't deno.land
+// modules; version is empty for unversioned imports, which deno.land
+// redirects to the latest release.
+func denoLandVersion(rawURL string) (version string, ok bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host != denoLandHost {
+		return "", false
+	}
+	p := strings.TrimPrefix(u.Path, "/")
+	if rest, found := strings.CutPrefix(p, "x/"); found {
+		p = rest
+	} else if p != "std" && !strings.HasPrefix(p, "std/") && !strings.HasPrefix(p, "std@") {
+		return "", false
+	}
+	module, _, _ := strings.Cut(p, "/")
+	if module == "" {
+		return "", false
+	}
+	_, version, _ = strings.Cut(module, "@")
+	return version, true
+}
+
+// isUnversionedDenoLand reports whether url imports a deno.land module
+// without pinning a version
+func isUnversionedDenoLand(url string) bool {
+	version, ok := denoLandVersion(url)
+	return ok && version == ""
+}
+
+// withoutRedirects returns a copy of client that hands redirects back
+// instead of following them
+func withoutRedirects(client *http.Client) *http.Client {
+	wrapped := *client
+	wrapped.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	return &wrapped
+}
+
+// redirectTarget returns the absolute URL a redirect response points to
+func redirectTarget(resp *http.Response, from string) (string, bool) {
+	switch resp.StatusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		return "", false
+	}
+	base, err := url.Parse(from)
+	if err != nil {
+		return "", false
+	}
+	location, err := base.Parse(resp.Header.Get("Location"))
+	if err != nil || resp.Header.Get("Location") == "" {
+		return "", false
+	}
+	return location.String(), true
+}
+
+// warnUnversioned emits EventUnversionedImport for unversioned deno.land
+// modules. It runs whenever such a module is fetched or read from disk, so
+// each run warns once per module.
+func (l *ModuleLoader) warnUnversioned(module *Module) {
+	if module.Type == TypeCDN && isUnversionedDenoLand(module.URL) {
+		l.emit(LoadEvent{Kind: EventUnversionedImport, URL: module.URL, Type: TypeCDN, ResolvedURL: module.ResolvedURL})
+	}
+}
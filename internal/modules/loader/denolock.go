@@ -0,0 +1,294 @@
+package loader
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"sort"
+	"strings"
+
+	"github.com/katungi/edon/internal/errors"
+)
+
+// denoLockVersion is the deno.lock format DenoLock reads and writes
+const denoLockVersion = "3"
+
+// DenoLock is a deno.lock file in Deno's version 3 format, for sharing a
+// lockfile with Deno. Only remote module hashes and npm resolutions are
+// understood; other top-level keys, and other keys under "packages", are
+// kept as they were when the lock is encoded again.
+type DenoLock struct {
+	// Remote maps remote module URLs to the hex SHA-256 of their source,
+	// which is what Module.Hash holds
+	Remote map[string]string
+	// Specifiers maps npm specifiers such as "npm:chalk@^5" to the
+	// "npm:chalk@5.3.0" they resolved to
+	Specifiers map[string]string
+	// NPM maps "name@version" to the package's integrity and resolved
+	// dependencies
+	NPM map[string]DenoLockPackage
+
+	other    map[string]json.RawMessage
+	packages map[string]json.RawMessage
+}
+
+// DenoLockPackage is an npm package in a deno.lock
+type DenoLockPackage struct {
+	Integrity string `json:"integrity"`
+	// Dependencies maps each dependency's name to the "name@version" it
+	// resolved to
+	Dependencies map[string]string `json:"dependencies"`
+}
+
+// NewDenoLock returns an empty lock
+func NewDenoLock() *DenoLock {
+	return &DenoLock{
+		Remote:     make(map[string]string),
+		Specifiers: make(map[string]string),
+		NPM:        make(map[string]DenoLockPackage),
+		other:      make(map[string]json.RawMessage),
+		packages:   make(map[string]json.RawMessage),
+	}
+}
+
+// ParseDenoLock decodes a deno.lock. Lockfiles of other versions fail with
+// errors.ErrInvalidLockfile rather than being misread.
+func ParseDenoLock(data []byte) (*DenoLock, error) {
+	lock := NewDenoLock()
+	if err := json.Unmarshal(data, &lock.other); err != nil {
+		return nil, errors.Wrap(errors.ErrInvalidLockfile, err.Error())
+	}
+	var version string
+	if err := json.Unmarshal(lock.other["version"], &version); err != nil || version != denoLockVersion {
+		return nil, errors.Wrap(errors.ErrInvalidLockfile, fmt.Sprintf("deno.lock version %s, want %q", lock.other["version"], denoLockVersion))
+	}
+	delete(lock.other, "version")
+
+	if err := takeJSON(lock.other, "remote", &lock.Remote); err != nil {
+		return nil, err
+	}
+	if err := takeJSON(lock.other, "packages", &lock.packages); err != nil {
+		return nil, err
+	}
+	if err := takeJSON(lock.packages, "specifiers", &lock.Specifiers); err != nil {
+		return nil, err
+	}
+	if err := takeJSON(lock.packages, "npm", &lock.NPM); err != nil {
+		return nil, err
+	}
+	return lock, nil
+}
+
+// takeJSON decodes raw[key] into v, if present, and removes it from raw
+func takeJSON(raw map[string]json.RawMessage, key string, v any) error {
+	data, ok := raw[key]
+	if !ok {
+		return nil
+	}
+	delete(raw, key)
+	if err := json.Unmarshal(data, v); err != nil {
+		return errors.Wrap(errors.ErrInvalidLockfile, fmt.Sprintf("%s: %v", key, err))
+	}
+	return nil
+}
+
+// Encode returns the lock as deno.lock content, with keys sorted and two
+// space indentation as Deno writes it. Empty sections are left out.
+func (l *DenoLock) Encode() ([]byte, error) {
+	packages := make(map[string]any, len(l.packages)+2)
+	for key, value := range l.packages {
+		packages[key] = value
+	}
+	if len(l.Specifiers) > 0 {
+		packages["specifiers"] = l.Specifiers
+	}
+	if len(l.NPM) > 0 {
+		packages["npm"] = l.NPM
+	}
+
+	doc := make(map[string]any, len(l.other)+3)
+	for key, value := range l.other {
+		doc[key] = value
+	}
+	doc["version"] = denoLockVersion
+	if len(packages) > 0 {
+		doc["packages"] = packages
+	}
+	if len(l.Remote) > 0 {
+		doc["remote"] = l.Remote
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// AddModule records the hash of a remote module, reporting whether the
+// lock changed. Local, builtin and npm modules have no place in it.
+func (l *DenoLock) AddModule(module *Module) bool {
+	if !isRemote(module.Type) || isCDNFallback(module.URL) || module.Hash == "" || l.Remote[module.URL] == module.Hash {
+		return false
+	}
+	l.Remote[module.URL] = module.Hash
+	return true
+}
+
+// AddPackages records what each of roots, specifiers such as "chalk@^5",
+// resolved to in tree, and every package of tree with its integrity and
+// resolved dependencies, reporting whether the lock changed. Packages read
+// from the cache carry no integrity and keep the one already locked.
+func (l *DenoLock) AddPackages(roots []string, tree []*ResolvedPackage) bool {
+	pick := versionPicker(tree)
+	changed := false
+	for _, root := range roots {
+		name, spec := splitNameVersion(root)
+		if pkg := pick(name, spec); pkg != nil && pkg.Workspace == "" && l.Specifiers["npm:"+root] != "npm:"+pkg.String() {
+			l.Specifiers["npm:"+root] = "npm:" + pkg.String()
+			changed = true
+		}
+	}
+	for _, pkg := range tree {
+		// Workspaces aren't npm packages Deno could fetch
+		if pkg.Workspace != "" {
+			continue
+		}
+		entry := l.lockEntry(pkg, pick)
+		existing, locked := l.NPM[pkg.String()]
+		if !locked || existing.Integrity != entry.Integrity || !maps.Equal(existing.Dependencies, entry.Dependencies) {
+			l.NPM[pkg.String()] = entry
+			changed = true
+		}
+	}
+	return changed
+}
+
+// lockEntry returns what AddPackages records for pkg: its integrity, or the
+// one already locked when it has none, and what each dependency resolved to
+func (l *DenoLock) lockEntry(pkg *ResolvedPackage, pick func(name, spec string) *ResolvedPackage) DenoLockPackage {
+	entry := DenoLockPackage{Integrity: pkg.lockIntegrity(), Dependencies: make(map[string]string)}
+	if entry.Integrity == "" {
+		entry.Integrity = l.NPM[pkg.String()].Integrity
+	}
+	for dep, spec := range pkg.Dependencies {
+		if resolved := pick(dep, spec); resolved != nil {
+			entry.Dependencies[dep] = resolved.String()
+		}
+	}
+	return entry
+}
+
+// DenoLockChange is a difference between a lock and a resolution
+type DenoLockChange struct {
+	// Key is the "npm:name@range" specifier or "name@version" package
+	// that differs
+	Key string
+	// Field is what differs: "specifier" for what a specifier resolved
+	// to, "package" for a package the lock doesn't have, or "integrity"
+	// or "dependencies" for one it has
+	Field string
+	// Locked is the lock's value, empty when it has none, and Resolved the
+	// resolution's. Dependencies are listed as sorted "name@version"s.
+	Locked   string
+	Resolved string
+}
+
+// Diff lists the changes AddPackages(roots, tree) would make to the lock,
+// without making them: specifiers in the order of roots, then packages in
+// the order of tree. An empty diff means the lock already records the
+// resolution. Packages the lock has but tree doesn't aren't listed, since
+// AddPackages keeps them.
+func (l *DenoLock) Diff(roots []string, tree []*ResolvedPackage) []DenoLockChange {
+	pick := versionPicker(tree)
+	var changes []DenoLockChange
+	for _, root := range roots {
+		name, spec := splitNameVersion(root)
+		pkg := pick(name, spec)
+		if pkg == nil || pkg.Workspace != "" {
+			continue
+		}
+		if locked := l.Specifiers["npm:"+root]; locked != "npm:"+pkg.String() {
+			changes = append(changes, DenoLockChange{Key: "npm:" + root, Field: "specifier", Locked: locked, Resolved: "npm:" + pkg.String()})
+		}
+	}
+	for _, pkg := range tree {
+		if pkg.Workspace != "" {
+			continue
+		}
+		entry := l.lockEntry(pkg, pick)
+		existing, locked := l.NPM[pkg.String()]
+		switch {
+		case !locked:
+			changes = append(changes, DenoLockChange{Key: pkg.String(), Field: "package", Resolved: entry.Integrity})
+		case existing.Integrity != entry.Integrity:
+			changes = append(changes, DenoLockChange{Key: pkg.String(), Field: "integrity", Locked: existing.Integrity, Resolved: entry.Integrity})
+		case !maps.Equal(existing.Dependencies, entry.Dependencies):
+			changes = append(changes, DenoLockChange{Key: pkg.String(), Field: "dependencies", Locked: lockedDependencies(existing.Dependencies), Resolved: lockedDependencies(entry.Dependencies)})
+		}
+	}
+	return changes
+}
+
+// lockedDependencies lists a locked package's dependencies as sorted
+// "name@version"s, comma-separated
+func lockedDependencies(deps map[string]string) string {
+	list := make([]string, 0, len(deps))
+	for _, dep := range deps {
+		list = append(list, dep)
+	}
+	sort.Strings(list)
+	return strings.Join(list, ", ")
+}
+
+// RemoveSuperseded drops the locked versions of packages that tree resolved
+// to other versions, as after an update, reporting whether the lock changed.
+// Packages tree doesn't mention at all are kept, since an install that left
+// them out, such as a production one, says nothing about them.
+func (l *DenoLock) RemoveSuperseded(tree []*ResolvedPackage) bool {
+	current := make(map[string]map[string]bool)
+	for _, pkg := range tree {
+		if current[pkg.Name] == nil {
+			current[pkg.Name] = make(map[string]bool)
+		}
+		current[pkg.Name][pkg.Version] = true
+	}
+	changed := false
+	for key := range l.NPM {
+		name, version := splitNameVersion(key)
+		if versions, ok := current[name]; ok && !versions[version] {
+			delete(l.NPM, key)
+			changed = true
+		}
+	}
+	return changed
+}
+
+// Packages returns the "name@version" of every npm package in the lock,
+// sorted
+func (l *DenoLock) Packages() []string {
+	packages := make([]string, 0, len(l.NPM))
+	for pkg := range l.NPM {
+		packages = append(packages, pkg)
+	}
+	sort.Strings(packages)
+	return packages
+}
+
+// lockIntegrity returns the package's integrity in SRI form, converting a
+// legacy hex SHA-1 shasum when the registry gave nothing better
+func (p *ResolvedPackage) lockIntegrity() string {
+	if p.Integrity != "" {
+		return p.Integrity
+	}
+	if sum, err := hex.DecodeString(p.Shasum); err == nil && len(sum) > 0 {
+		return "sha1-" + base64.StdEncoding.EncodeToString(sum)
+	}
+	return ""
+}
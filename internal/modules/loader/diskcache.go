@@ -0,0 +1,191 @@
+package loader
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/katungi/edon/internal/errors"
+)
+
+// diskCache persists fetched remote modules so they survive across runs,
+// in a CacheBackend that is the local disk unless WithCacheBackend says
+// otherwise. Entries are stored under the SHA-256 of their URL; only remote
+// modules are stored and each remote type has its own scheme, so the URL
+// alone can't collide across package types.
+type diskCache struct {
+	backend CacheBackend
+	// compress gzips the content of new entries; see WithCompressedCache
+	compress bool
+	// accept is the WithCDNAccept header, which keys entries along with
+	// their URL
+	accept string
+}
+
+// newDiskCache returns a cache in the configured backend, or one rooted at
+// <base>/remote; it is nil when no base cache directory can be resolved
+func newDiskCache(cfg *config) *diskCache {
+	if cfg.cacheBackend != nil {
+		return &diskCache{backend: cfg.cacheBackend, compress: cfg.compressCache, accept: cfg.cdnAccept}
+	}
+	base, err := cfg.cacheBase()
+	if err != nil {
+		return nil
+	}
+	return &diskCache{backend: NewDiskCacheBackend(filepath.Join(base, remoteCacheDir)), compress: cfg.compressCache, accept: cfg.cdnAccept}
+}
+
+// key returns the backend key that stores url. A WithCDNAccept header is
+// hashed in too, since the same URL may serve something else for it.
+func (d *diskCache) key(url string) string {
+	key := diskCacheKey(url)
+	if d.accept != "" {
+		key += "\x00Accept: " + d.accept
+	}
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// diskCacheKey normalizes url for the disk cache. The query stays part of
+// the key, as CDNs build different output for "?target=es2020" and the
+// like, but its parameters are sorted so their order doesn't matter. The
+// fragment is dropped since it never reaches the server. Parameters that
+// repeat keep their relative order, which servers may rely on.
+func diskCacheKey(rawURL string) string {
+	// Plain URLs hash as they always have, keeping existing entries valid
+	if !strings.ContainsAny(rawURL, "?#") {
+		return rawURL
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	u.Fragment, u.RawFragment = "", ""
+	u.ForceQuery = false
+	if u.RawQuery != "" {
+		params := strings.Split(u.RawQuery, "&")
+		sort.SliceStable(params, func(i, j int) bool {
+			ki, _, _ := strings.Cut(params[i], "=")
+			kj, _, _ := strings.Cut(params[j], "=")
+			return ki < kj
+		})
+		u.RawQuery = strings.Join(params, "&")
+	}
+	return u.String()
+}
+
+// hashKey returns the key that stores the hashes of url's entry: the hash
+// of the source and, after a space, the hash of the stored content
+func (d *diskCache) hashKey(url string) string {
+	return d.key(url) + ".sha256"
+}
+
+// get returns the stored content for url and the hash of the source it was
+// produced from. Entries written before hashes were recorded are hashed as
+// they are read. An entry whose content no longer matches its recorded hash,
+// as after an interrupted write, is deleted and reported with
+// errors.ErrCacheCorrupt so the module is fetched again.
+func (d *diskCache) get(url string) (string, string, bool, error) {
+	content, hash, ok, corrupt := d.read(url)
+	if corrupt {
+		// A concurrent set may have replaced one entry but not yet the other
+		content, hash, ok, corrupt = d.read(url)
+	}
+	if corrupt {
+		d.remove(url)
+		return "", "", false, errors.Wrap(errors.ErrCacheCorrupt, url)
+	}
+	return content, hash, ok, nil
+}
+
+// read reads url's entry, reporting whether its content fails its checksum
+func (d *diskCache) read(url string) (content, hash string, ok, corrupt bool) {
+	data, found := d.backend.Get(d.key(url))
+	if !found {
+		return "", "", false, false
+	}
+	data, err := decompressEntry(data)
+	if err != nil {
+		return "", "", false, true
+	}
+	content = string(data)
+	sidecar, found := d.backend.Get(d.hashKey(url))
+	if !found {
+		return content, hashContent(content), true, false
+	}
+
+	hashes := strings.Fields(string(sidecar))
+	switch {
+	case len(hashes) == 1:
+		// Written before content hashes were recorded, so there's nothing to check
+		return content, hashes[0], true, false
+	case len(hashes) != 2 || hashContent(content) != hashes[1]:
+		return "", "", false, true
+	}
+	return content, hashes[0], true, false
+}
+
+// set stores content for url along with the hash of its source. The hash is
+// kept separately because transpiled content no longer hashes to it; a hash
+// of the content itself is stored beside it so get can detect damage.
+func (d *diskCache) set(url, content, hash string) error {
+	// The hash goes first so a visible entry always has the right one
+	if err := d.backend.Put(d.hashKey(url), []byte(hash+" "+hashContent(content))); err != nil {
+		return err
+	}
+	data := []byte(content)
+	if d.compress {
+		var err error
+		if data, err = compressEntry(data); err != nil {
+			return err
+		}
+	}
+	return d.backend.Put(d.key(url), data)
+}
+
+// remove deletes the stored entry for url, reporting whether one existed
+func (d *diskCache) remove(url string) bool {
+	_, existed := d.backend.Get(d.key(url))
+	_ = d.backend.Delete(d.hashKey(url))
+	_ = d.backend.Delete(d.redirectKey(url))
+	_ = d.backend.Delete(d.fetchedKey(url))
+	_ = d.backend.Delete(d.expiryKey(url))
+	return d.backend.Delete(d.key(url)) == nil && existed
+}
+
+// gzipMagic starts every gzip stream. No JavaScript, TypeScript or JSON
+// module starts with it, so compressed and raw entries can share a cache.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// compressEntry gzips the content of a cache entry
+func compressEntry(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(data); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decompressEntry returns the content of a cache entry, gunzipping it if it
+// was stored compressed
+func decompressEntry(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, gzipMagic) {
+		return data, nil
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	return io.ReadAll(gz)
+}
@@ -0,0 +1,78 @@
+package loader
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/katungi/edon/internal/errors"
+)
+
+// defaultEngines are the engine versions checked against a package's
+// "engines" field when none are configured. edon's node: builtins follow the
+// Node.js 18 APIs.
+var defaultEngines = map[string]string{"node": "18.0.0"}
+
+// finishInstall marks a cached package as used and fills in what callers
+// need from its package.json: its bins, any engines it needs that the
+// runtime lacks and the install scripts it would have run
+func (pm *NPMPackageManager) finishInstall(installed *InstalledPackage) (*InstalledPackage, error) {
+	if installed.FromCache {
+		markUsed(installed.Path)
+	}
+	installed, err := withBins(installed)
+	if err != nil {
+		return nil, err
+	}
+	if installed, err = pm.checkEngines(installed); err != nil {
+		return nil, err
+	}
+	return checkScripts(installed)
+}
+
+// checkEngines compares the "engines" field of installed's package.json with
+// the engine versions the runtime provides, recording each requirement it
+// misses in installed.EngineWarnings. Engines the runtime doesn't know about,
+// like npm or yarn, and ranges edon can't parse are ignored. With strict
+// engines a mismatch fails the install with errors.ErrEngineMismatch.
+func (pm *NPMPackageManager) checkEngines(installed *InstalledPackage) (*InstalledPackage, error) {
+	manifest, err := readPackageManifest(installed.Path)
+	if brokenManifest(err) {
+		return installed, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Some old packages list engines as an array of strings; npm ignores those too
+	var required map[string]string
+	if json.Unmarshal(manifest.Engines, &required) != nil {
+		return installed, nil
+	}
+
+	names := make([]string, 0, len(required))
+	for name := range required {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		provided, ok := pm.engines[name]
+		if !ok {
+			continue
+		}
+		have, ok := parseVersion(provided)
+		if !ok {
+			continue
+		}
+		want, ok := parseRange(required[name])
+		if !ok || want.matches(have) {
+			continue
+		}
+		installed.EngineWarnings = append(installed.EngineWarnings,
+			fmt.Sprintf("%s@%s needs %s %s, but edon provides %s", installed.Name, installed.Version, name, required[name], provided))
+	}
+
+	if pm.strictEngines && len(installed.EngineWarnings) > 0 {
+		return nil, errors.Wrap(errors.ErrEngineMismatch, installed.EngineWarnings[0])
+	}
+	return installed, nil
+}
@@ -0,0 +1,318 @@
+package loader
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/katungi/edon/internal/errors"
+)
+
+// defaultConditions are the export conditions matched when resolving a
+// package's "exports" field, in order of preference; see WithConditions
+var defaultConditions = []string{"import", "default"}
+
+// entryFallbacks are the files tried, in order, for a package whose "main"
+// is missing or points nowhere. Older packages often ship one of these
+// without saying so in their manifest.
+var entryFallbacks = []string{"index.js", "index.mjs", "main.js", "lib/index.js", "dist/index.js"}
+
+// defaultManifestFallbacks are the entry files tried for a package whose
+// package.json can't be parsed; see WithManifestFallbacks
+var defaultManifestFallbacks = []string{"index.js", "index.mjs"}
+
+// packageManifest holds the package.json fields used for entry resolution
+type packageManifest struct {
+	Name                 string            `json:"name"`
+	Version              string            `json:"version"`
+	Main                 string            `json:"main"`
+	Type                 string            `json:"type"`
+	Exports              json.RawMessage   `json:"exports"`
+	Browser              json.RawMessage   `json:"browser"`
+	Bin                  json.RawMessage   `json:"bin"`
+	Dependencies         map[string]string `json:"dependencies"`
+	OptionalDependencies map[string]string `json:"optionalDependencies"`
+	Engines              json.RawMessage   `json:"engines"`
+	Scripts              map[string]string `json:"scripts"`
+	peerFields
+}
+
+// readPackageManifest reads package.json from a package directory.
+// A missing manifest is not an error and yields an empty manifest.
+func readPackageManifest(packagePath string) (*packageManifest, error) {
+	data, err := os.ReadFile(filepath.Join(packagePath, "package.json"))
+	if os.IsNotExist(err) {
+		return &packageManifest{}, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrFileRead, err.Error())
+	}
+
+	var manifest packageManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, errors.Wrap(errors.ErrInvalidScript, fmt.Sprintf("parse %s/package.json: %v", packagePath, err))
+	}
+	return &manifest, nil
+}
+
+// brokenManifest reports whether err is readPackageManifest failing to
+// parse a package.json that exists
+func brokenManifest(err error) bool {
+	return errors.Is(err, errors.ErrInvalidScript)
+}
+
+// ResolveEntry resolves a subpath within the package installed at
+// packagePath to a file on disk, as the loader does for npm: and jsr:
+// specifiers. "exports" wins when the package has it, matching conditions in
+// the order given, or the default "import" and "default" when conditions is
+// nil. Without it, an empty subpath resolves "main" and then the usual index
+// files, and any other subpath is probed with ".js" and "/index.js". A
+// missing file fails with errors.ErrModuleNotFound.
+//
+// When conditions include "browser", so does the package's "browser" field:
+// its string form replaces "main" for a package without "exports", and its
+// map form swaps the resolved file for another, or excludes it with
+// errors.ErrModuleExcluded when mapped to false.
+func ResolveEntry(packagePath string, conditions []string, subpath string) (string, error) {
+	if conditions == nil {
+		conditions = defaultConditions
+	}
+	manifest, err := readPackageManifest(packagePath)
+	if err != nil {
+		return "", err
+	}
+	browser := slices.Contains(conditions, browserCondition)
+	if main, ok := browserMain(manifest); ok && browser {
+		manifest.Main = main
+	}
+
+	file, err := resolvePackageFile(packagePath, manifest, conditions, subpath)
+	if err != nil || !browser {
+		return file, err
+	}
+	return remapBrowserFile(packagePath, manifest, file)
+}
+
+// resolvePackageFile is ResolveEntry without the "browser" field
+func resolvePackageFile(packagePath string, manifest *packageManifest, conditions []string, subpath string) (string, error) {
+	// "exports" takes precedence over the file layout when present
+	if len(manifest.Exports) > 0 {
+		key := "."
+		if subpath != "" {
+			key = "./" + subpath
+		}
+		target, ok := resolveExports(manifest.Exports, key, conditions)
+		if !ok {
+			return "", exportNotFound(manifest, subpath)
+		}
+		file := filepath.Join(packagePath, filepath.FromSlash(target))
+		if !isFile(file) {
+			return "", exportNotFound(manifest, subpath)
+		}
+		return file, nil
+	}
+
+	if subpath == "" {
+		return resolveMainEntry(packagePath, manifest)
+	}
+
+	if file, ok := probeFile(filepath.Join(packagePath, filepath.FromSlash(subpath))); ok {
+		return file, nil
+	}
+	return "", exportNotFound(manifest, subpath)
+}
+
+// resolveEntry is ResolveEntry for a package loaded as url, coping with a
+// missing or unparseable package.json. Without one, the entry is a guess:
+// ResolveEntry tries entryFallbacks when there's no manifest, and a broken
+// one gets the WithManifestFallbacks files instead. A guess that finds a
+// file emits EventManifestFallback; one that doesn't fails with an error
+// that says what was wrong with package.json.
+func (l *ModuleLoader) resolveEntry(url, packagePath, subpath string) (string, error) {
+	manifest := filepath.Join(packagePath, "package.json")
+	file, err := ResolveEntry(packagePath, l.config.conditions, subpath)
+
+	var problem error
+	switch {
+	case brokenManifest(err):
+		problem = err
+		file, err = guessEntry(packagePath, subpath, l.config.manifestFallbacks)
+	case !isFile(manifest):
+		problem = errors.Wrap(errors.ErrFileNotFound, manifest)
+	default:
+		return file, err
+	}
+	if err != nil {
+		return "", errors.Wrap(err, fmt.Sprintf("%s: %v", url, problem))
+	}
+	l.emit(LoadEvent{Kind: EventManifestFallback, URL: url, ResolvedURL: file, Err: problem})
+	return file, nil
+}
+
+// guessEntry finds subpath in a package without a usable manifest, or when
+// subpath is empty, the first of fallbacks that exists
+func guessEntry(packagePath, subpath string, fallbacks []string) (string, error) {
+	if subpath != "" {
+		if file, ok := probeFile(filepath.Join(packagePath, filepath.FromSlash(subpath))); ok {
+			return file, nil
+		}
+		return "", errors.Wrap(errors.ErrModuleNotFound, "no file "+subpath)
+	}
+	for _, fallback := range fallbacks {
+		if file := filepath.Join(packagePath, filepath.FromSlash(fallback)); isFile(file) {
+			return file, nil
+		}
+	}
+	return "", errors.Wrap(errors.ErrModuleNotFound, "no entry point (tried "+strings.Join(fallbacks, ", ")+")")
+}
+
+// resolveMainEntry resolves a package's "main" field, then tries
+// entryFallbacks. When nothing exists the error lists every path tried.
+func resolveMainEntry(packagePath string, manifest *packageManifest) (string, error) {
+	var tried []string
+	if manifest.Main != "" {
+		if file, ok := probeFile(filepath.Join(packagePath, filepath.FromSlash(manifest.Main))); ok {
+			return file, nil
+		}
+		tried = append(tried, manifest.Main)
+	}
+	for _, fallback := range entryFallbacks {
+		if file := filepath.Join(packagePath, filepath.FromSlash(fallback)); isFile(file) {
+			return file, nil
+		}
+		tried = append(tried, fallback)
+	}
+	return "", errors.Wrap(errors.ErrModuleNotFound,
+		fmt.Sprintf("no entry point for %s (tried %s)", packageName(manifest), strings.Join(tried, ", ")))
+}
+
+// resolveExports looks up a key such as "." or "./fp" in an "exports" value
+func resolveExports(raw json.RawMessage, key string, conditions []string) (string, bool) {
+	// "exports": "./index.js" is shorthand for {".": "./index.js"}
+	var target string
+	if err := json.Unmarshal(raw, &target); err == nil {
+		if key == "." {
+			return strings.TrimPrefix(target, "./"), true
+		}
+		return "", false
+	}
+
+	var entries map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &entries); err != nil {
+		return "", false
+	}
+
+	// An object without "./" keys is a set of conditions for "."
+	if !hasSubpathKeys(entries) {
+		if key != "." {
+			return "", false
+		}
+		return resolveConditions(raw, conditions)
+	}
+
+	if value, ok := entries[key]; ok {
+		return resolveConditions(value, conditions)
+	}
+
+	// Fall back to the longest matching "./prefix/*" pattern
+	best := ""
+	for pattern := range entries {
+		prefix, suffix, found := strings.Cut(pattern, "*")
+		if !found || !strings.HasPrefix(key, prefix) || !strings.HasSuffix(key, suffix) {
+			continue
+		}
+		if len(pattern) > len(best) {
+			best = pattern
+		}
+	}
+	if best == "" {
+		return "", false
+	}
+
+	prefix, suffix, _ := strings.Cut(best, "*")
+	match := strings.TrimSuffix(strings.TrimPrefix(key, prefix), suffix)
+	resolved, ok := resolveConditions(entries[best], conditions)
+	if !ok {
+		return "", false
+	}
+	return strings.ReplaceAll(resolved, "*", match), true
+}
+
+// resolveConditions picks a target path from a conditional exports value
+func resolveConditions(raw json.RawMessage, conditions []string) (string, bool) {
+	var target string
+	if err := json.Unmarshal(raw, &target); err == nil {
+		return strings.TrimPrefix(target, "./"), true
+	}
+
+	var alternatives []json.RawMessage
+	if err := json.Unmarshal(raw, &alternatives); err == nil {
+		for _, alt := range alternatives {
+			if resolved, ok := resolveConditions(alt, conditions); ok {
+				return resolved, true
+			}
+		}
+		return "", false
+	}
+
+	var branches map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &branches); err != nil {
+		return "", false
+	}
+	for _, condition := range conditions {
+		if value, ok := branches[condition]; ok {
+			if resolved, ok := resolveConditions(value, conditions); ok {
+				return resolved, true
+			}
+		}
+	}
+	return "", false
+}
+
+func hasSubpathKeys(entries map[string]json.RawMessage) bool {
+	for key := range entries {
+		if strings.HasPrefix(key, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+// probeFile returns the first existing candidate for an extensionless path,
+// trying the path itself, then ".js", then "/index.js"
+func probeFile(path string) (string, bool) {
+	candidates := []string{path}
+	if filepath.Ext(path) == "" {
+		candidates = append(candidates, path+".js", filepath.Join(path, "index.js"))
+	}
+	for _, candidate := range candidates {
+		if isFile(candidate) {
+			return candidate, true
+		}
+	}
+	return "", false
+}
+
+func isFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+// packageName names a package in errors, even when its manifest doesn't
+func packageName(manifest *packageManifest) string {
+	if manifest.Name == "" {
+		return "package"
+	}
+	return manifest.Name
+}
+
+func exportNotFound(manifest *packageManifest, subpath string) error {
+	name := packageName(manifest)
+	if subpath == "" {
+		return errors.Wrap(errors.ErrModuleNotFound, fmt.Sprintf("no entry point for %s", name))
+	}
+	return errors.Wrap(errors.ErrModuleNotFound, fmt.Sprintf("subpath %q not found in %s", subpath, name))
+}
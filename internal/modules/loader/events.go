@@ -0,0 +1,86 @@
+package loader
+
+import "time"
+
+// LoadEventKind identifies what happened during a load
+type LoadEventKind string
+
+const (
+	EventCacheHit   LoadEventKind = "cache-hit"
+	EventCacheMiss  LoadEventKind = "cache-miss"
+	EventFetchStart LoadEventKind = "fetch-start"
+	EventFetchEnd   LoadEventKind = "fetch-end"
+	// EventPrefetchFailed reports a background prefetch that failed; see
+	// WithPrefetch
+	EventPrefetchFailed LoadEventKind = "prefetch-failed"
+	// EventCacheCorrupt reports a damaged disk cache entry, which is deleted
+	// and fetched again
+	EventCacheCorrupt LoadEventKind = "cache-corrupt"
+	// EventUnversionedImport warns about a deno.land import that doesn't pin
+	// a version, so it changes whenever a new release is published
+	EventUnversionedImport LoadEventKind = "unversioned-import"
+	// EventRetry reports a rate-limited request about to be retried within
+	// a LoadGraph, LoadModules or Warm call, with the budget it leaves
+	EventRetry LoadEventKind = "retry"
+	// EventRetryBudgetExhausted reports, once per call, that the retry
+	// budget ran out and further rate-limited requests fail without retrying
+	EventRetryBudgetExhausted LoadEventKind = "retry-budget-exhausted"
+	// EventManifestFallback warns that a package's package.json was missing
+	// or broken, so its entry was guessed; Err says what was wrong and
+	// ResolvedURL is the file used
+	EventManifestFallback LoadEventKind = "manifest-fallback"
+	// EventRevalidateFailed reports that a stale module couldn't be fetched
+	// again in the background, so the stale copy stays; see
+	// WithStaleWhileRevalidate
+	EventRevalidateFailed LoadEventKind = "revalidate-failed"
+)
+
+// Cache layers reported by EventCacheHit
+const (
+	CacheMemory   = "memory"
+	CacheDisk     = "disk"
+	CacheNegative = "negative"
+)
+
+// LoadEvent describes a step of LoadModule for WithLogger
+type LoadEvent struct {
+	Kind LoadEventKind
+	// Specifier is what the caller asked for; URL is what it resolved to
+	// after the import map
+	Specifier string
+	URL       string
+	Type      PackageType
+	// Cache names the layer that served an EventCacheHit
+	Cache string
+	// Duration is set on EventFetchEnd; Err on EventFetchEnd,
+	// EventPrefetchFailed, EventCacheCorrupt, EventManifestFallback and
+	// EventRevalidateFailed
+	Duration time.Duration
+	Err      error
+	// ResolvedURL is the versioned URL an EventUnversionedImport redirected
+	// to, when it was fetched rather than served from the cache, or the file
+	// an EventManifestFallback guessed
+	ResolvedURL string
+	// RetriesLeft is what an EventRetry leaves of the call's retry budget
+	RetriesLeft int
+}
+
+// LoadLogger receives load events, with tokens and other secrets redacted;
+// see WithRedactPatterns
+type LoadLogger func(event LoadEvent)
+
+// emit sends event to the configured logger and metrics, if any
+func (l *ModuleLoader) emit(event LoadEvent) {
+	if l.config.metrics != nil {
+		l.config.metrics.observe(event)
+	}
+	if l.config.logger != nil {
+		l.config.logger(l.config.redactEvent(event))
+	}
+}
+
+// observed reports whether anything receives events, so callers can skip
+// building ones nobody would see
+func (l *ModuleLoader) observed() bool {
+	return l.config.logger != nil || l.config.metrics != nil
+}
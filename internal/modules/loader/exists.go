@@ -0,0 +1,196 @@
+package loader
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/katungi/edon/internal/errors"
+)
+
+// Exists reports whether a module can be loaded without fetching its body.
+// Local files are stat'ed, CDN URLs get a HEAD request and npm and jsr
+// specifiers are checked against their registry. (false, nil) means the
+// module definitely doesn't exist; (false, err) means existence couldn't be
+// determined.
+func (l *ModuleLoader) Exists(ctx context.Context, urlStr string) (bool, error) {
+	urlStr = l.normalize(urlStr)
+
+	validation := l.validate(urlStr)
+	if !validation.IsValid {
+		return false, validation.Error
+	}
+
+	if l.getFromCache(newCacheKey(validation.PackageType, urlStr)) != nil {
+		return true, nil
+	}
+	if l.disk != nil && isRemote(validation.PackageType) && !isCDNFallback(urlStr) {
+		if _, _, ok, _ := l.disk.get(urlStr); ok {
+			return true, nil
+		}
+	}
+	if l.negative.has(urlStr) {
+		return false, nil
+	}
+	if l.config.offline && isRemote(validation.PackageType) && !isCDNFallback(urlStr) {
+		return false, errors.Wrap(errors.ErrOffline, urlStr)
+	}
+
+	switch validation.PackageType {
+	case TypeCustom:
+		source, _ := l.sources.find(urlStr)
+		if source == nil {
+			return false, errors.ErrUnsupportedModule
+		}
+		return l.customExists(ctx, source, urlStr)
+	case TypeLocal:
+		return l.localExists(urlStr)
+	case TypeCDN:
+		if isCDNFallback(urlStr) {
+			return l.cdnFallbackExists(ctx, urlStr)
+		}
+		return l.cdnExists(ctx, urlStr)
+	case TypeNPM:
+		return l.npmExists(ctx, urlStr)
+	case TypeJSR:
+		return l.jsrExists(ctx, urlStr)
+	case TypeGit:
+		return l.gitExists(ctx, urlStr)
+	case TypeTarball:
+		return l.tarballExists(ctx, urlStr)
+	case TypeBuiltin:
+		_, ok := l.builtins.get(urlStr)
+		return ok, nil
+	case TypeVirtual:
+		_, ok := l.virtuals.get(urlStr)
+		return ok, nil
+	default:
+		return false, errors.ErrUnsupportedModule
+	}
+}
+
+// localExists stats a local module, subject to the same sandbox and
+// permissions as loading it
+func (l *ModuleLoader) localExists(path string) (bool, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return false, errors.Wrap(errors.ErrModuleNotFound, err.Error())
+	}
+
+	info, err := os.Stat(absPath)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Wrap(errors.ErrFileRead, err.Error())
+	}
+
+	if err := checkAllowedPath(absPath, l.config.allowedRoots); err != nil {
+		return false, err
+	}
+	if err := l.config.permissions.checkRead(absPath); err != nil {
+		return false, err
+	}
+
+	return !info.IsDir(), nil
+}
+
+// cdnExists issues a HEAD request for a CDN module
+func (l *ModuleLoader) cdnExists(ctx context.Context, url string) (bool, error) {
+	if err := l.config.permissions.checkNet(url); err != nil {
+		return false, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, l.config.timeouts.CDN)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return false, errors.Wrap(errors.ErrModuleFetch, err.Error())
+	}
+	l.config.setCDNAccept(req)
+
+	resp, err := l.httpClient.Do(req)
+	if err != nil {
+		return false, errors.Wrap(errors.ErrModuleFetch, err.Error())
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		return true, nil
+	case resp.StatusCode == http.StatusNotFound:
+		l.negative.add(url)
+		return false, nil
+	}
+	return false, errors.Wrap(errors.ErrModuleFetch, fmt.Sprintf("HEAD %s: %s", url, resp.Status))
+}
+
+// npmExists checks whether an npm specifier's package and version exist. A
+// subpath is only checked when the package is already installed.
+func (l *ModuleLoader) npmExists(ctx context.Context, url string) (bool, error) {
+	spec := ValidateURL(url)
+
+	pm, err := newNPMPackageManager(l.config)
+	if err != nil {
+		return false, errors.Wrap(errors.ErrPackageInstall, err.Error())
+	}
+
+	return l.packageExists(ctx, pm, url, spec.Name, spec.Version, spec.Subpath)
+}
+
+// packageExists checks name@version against pm's cache and registry
+func (l *ModuleLoader) packageExists(ctx context.Context, pm *NPMPackageManager, url, name, version, subpath string) (bool, error) {
+	if path, ok := pm.cachedPath(name, version); ok {
+		if _, err := l.resolveEntry(url, path, subpath); err != nil {
+			if errors.Is(err, errors.ErrModuleNotFound) {
+				return false, nil
+			}
+			return false, err
+		}
+		return true, nil
+	}
+
+	if pm.offline {
+		return false, errors.Wrap(errors.ErrOffline, url)
+	}
+
+	doc, err := pm.fetchPackument(ctx, name)
+	if errors.Is(err, errors.ErrPackageNotFound) {
+		l.negative.add(url)
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if _, err := doc.resolve(version); err != nil {
+		if errors.Is(err, errors.ErrVersionNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// gitExists clones a git specifier's repository, if it isn't cached yet, and
+// checks for the file it names. There is no cheaper way to ask a git server
+// about a file.
+func (l *ModuleLoader) gitExists(ctx context.Context, url string) (bool, error) {
+	repo, ref, subpath, err := parseGitSpecifier(url)
+	if err != nil {
+		return false, err
+	}
+	dir, err := l.gitClone(ctx, repo, ref, false)
+	if err != nil {
+		return false, err
+	}
+	if _, err := l.resolveEntry(url, dir, subpath); err != nil {
+		if errors.Is(err, errors.ErrModuleNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,63 @@
+package loader
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// defaultExtensions are tried, in order, for extensionless local imports;
+// see WithExtensions
+var defaultExtensions = []string{".js", ".mjs", ".cjs", ".json"}
+
+// typeScriptExtensions are tried ahead of defaultExtensions when a
+// transpiler is configured
+var typeScriptExtensions = []string{".ts", ".tsx"}
+
+// WithExtensions sets the extensions tried, in order, for a local import
+// such as "./utils" that has no extension and isn't a file as written:
+// first "./utils" plus each extension, then, for a directory import,
+// "./utils/index" plus each. The default is .js, .mjs, .cjs and .json, with
+// .ts and .tsx tried first when WithTranspiler is set.
+func WithExtensions(extensions []string) Option {
+	return func(c *config) {
+		c.extensions = extensions
+	}
+}
+
+// extensionOrder returns the extensions tried for extensionless imports
+func (c *config) extensionOrder() []string {
+	switch {
+	case c.extensions != nil:
+		return c.extensions
+	case c.transpiler != nil:
+		return append(slices.Clone(typeScriptExtensions), defaultExtensions...)
+	}
+	return defaultExtensions
+}
+
+// resolveLocalFile returns the file an import of path refers to: path
+// itself when it is a file, otherwise, for a path without an extension, the
+// first of path plus each extension that is a file, and for a directory
+// the first of path/index plus each. It reports false when nothing matched.
+func resolveLocalFile(path string, extensions []string) (string, bool) {
+	info, err := os.Stat(path)
+	if err == nil && !info.IsDir() {
+		return path, true
+	}
+	if filepath.Ext(path) == "" {
+		for _, ext := range extensions {
+			if isFile(path + ext) {
+				return path + ext, true
+			}
+		}
+	}
+	if err == nil {
+		for _, ext := range extensions {
+			if index := filepath.Join(path, "index"+ext); isFile(index) {
+				return index, true
+			}
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,250 @@
+package loader
+
+import (
+	"bytes"
+	"context"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/katungi/edon/internal/errors"
+)
+
+// gitCacheDir holds one shallow clone per repository and ref
+const gitCacheDir = "git-cache"
+
+// gitSchemes maps the schemes of git specifiers, as npm writes them, to the
+// URL scheme git itself is given
+var gitSchemes = map[string]string{
+	"git+ssh://":   "ssh://",
+	"git+https://": "https://",
+	"git+http://":  "http://",
+	"git+file://":  "file://",
+	"git://":       "git://",
+}
+
+// isGitSpecifier reports whether url names a git repository, such as
+// "git+ssh://git@github.com/org/repo.git#v1.2.0"
+func isGitSpecifier(url string) bool {
+	for prefix := range gitSchemes {
+		if strings.HasPrefix(url, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseGitSpecifier splits a git specifier into the URL git clones, the ref
+// after "#" and the file after a ":" in the fragment, as in
+// "git+https://host/repo.git#v1.0.0:lib/util.js". Git refs can't contain a
+// colon, so the split is unambiguous. An empty ref means the default branch.
+func parseGitSpecifier(specifier string) (repo, ref, subpath string, err error) {
+	repo, fragment, _ := strings.Cut(specifier, "#")
+	for prefix, scheme := range gitSchemes {
+		if rest, ok := strings.CutPrefix(repo, prefix); ok {
+			repo = scheme + rest
+			break
+		}
+	}
+	ref, subpath, _ = strings.Cut(fragment, ":")
+	subpath = strings.Trim(subpath, "/")
+	// npm also accepts scp-style paths, "git+ssh://git@github.com:org/repo.git"
+	if rest, ok := strings.CutPrefix(repo, "ssh://"); ok {
+		host, p, found := strings.Cut(rest, ":")
+		if found && !strings.Contains(host, "/") && p != "" && (p[0] < '0' || p[0] > '9') {
+			repo = "ssh://" + host + "/" + p
+		}
+	}
+
+	u, parseErr := url.Parse(repo)
+	switch {
+	case parseErr != nil:
+		return "", "", "", errors.Wrap(errors.ErrInvalidURL, parseErr.Error())
+	case u.Scheme != "file" && u.Host == "", u.Path == "" || u.Path == "/":
+		return "", "", "", errors.Wrap(errors.ErrInvalidURL, "git specifier needs a host and repository: "+specifier)
+	// Refs are passed to git as arguments, so they must not look like options
+	case strings.HasPrefix(ref, "-"), strings.ContainsAny(ref, " \t\n~^?*[\\"):
+		return "", "", "", errors.Wrap(errors.ErrInvalidURL, "invalid git ref "+ref)
+	case subpath != "" && !filepath.IsLocal(filepath.FromSlash(subpath)):
+		return "", "", "", errors.Wrap(errors.ErrInvalidURL, "git subpath escapes the repository: "+subpath)
+	}
+	return repo, ref, subpath, nil
+}
+
+// loadGitModule clones a git specifier's repository at its ref, unless an
+// earlier load already did, and loads the requested file, or the package's
+// entry point, from the clone like an npm package
+func (l *ModuleLoader) loadGitModule(ctx context.Context, specifier string, reload bool) (*Module, error) {
+	repo, ref, subpath, err := parseGitSpecifier(specifier)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := l.gitClone(ctx, repo, ref, reload)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := l.resolveEntry(specifier, dir, subpath)
+	if err != nil {
+		return nil, err
+	}
+	content, err := readModuleFile(file, l.config.maxModuleSize)
+	if err != nil {
+		return nil, err
+	}
+
+	module := &Module{
+		URL:       specifier,
+		Content:   string(content),
+		Type:      TypeGit,
+		MediaType: mediaTypeFromPath(file),
+	}
+	module.Format, err = packageModuleFormat(dir, file, TypeGit)
+	if err != nil {
+		return nil, err
+	}
+	module.SourceMapURL, module.SourceMap = resolveSourceMap(module.Content, file)
+	return module, nil
+}
+
+// gitClone returns the directory holding a shallow clone of repo at ref,
+// cloning it with the system git if the cache doesn't have it yet. Clones
+// are keyed by repository and ref, so a branch stays at the commit first
+// cloned until it is reloaded.
+func (l *ModuleLoader) gitClone(ctx context.Context, repo, ref string, reload bool) (string, error) {
+	// As for remote modules, plaintext transports are only used with hosts
+	// WithAllowInsecureHosts trusts
+	if u, err := url.Parse(repo); err == nil && (u.Scheme == "http" || u.Scheme == "git") && !l.config.insecureHostTrusted(u) {
+		return "", errors.Wrap(errors.ErrInsecureURL, repo)
+	}
+	base, err := l.config.cacheBase()
+	if err != nil {
+		return "", err
+	}
+	parent := filepath.Join(base, gitCacheDir)
+	dir := filepath.Join(parent, hashContent(repo + "#" + ref)[:16])
+	reclone := reload || l.config.cacheMode == CacheBypassRead || l.config.noCache
+	if _, err := os.Stat(dir); err == nil && !reclone {
+		return dir, nil
+	}
+
+	if l.config.offline {
+		return "", errors.Wrap(errors.ErrOffline, repo)
+	}
+	if strings.HasPrefix(repo, "file://") {
+		err = l.config.permissions.checkRead(strings.TrimPrefix(repo, "file://"))
+	} else {
+		err = l.config.permissions.checkNet(repo)
+	}
+	if err != nil {
+		return "", err
+	}
+	gitPath, err := exec.LookPath("git")
+	if err != nil {
+		return "", errors.Wrap(errors.ErrGitUnavailable, err.Error())
+	}
+
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return "", errors.Wrap(errors.ErrCacheDir, err.Error())
+	}
+	staging, err := os.MkdirTemp(parent, ".clone-*")
+	if err != nil {
+		return "", errors.Wrap(errors.ErrCacheDir, err.Error())
+	}
+	// A no-op once the rename has succeeded
+	defer os.RemoveAll(staging)
+
+	if err := shallowClone(ctx, gitPath, repo, ref, staging); err != nil {
+		return "", err
+	}
+
+	if err := os.Rename(staging, dir); err != nil {
+		_, statErr := os.Stat(dir)
+		switch {
+		case statErr != nil:
+			return "", errors.Wrap(errors.ErrCacheDir, err.Error())
+		case reclone:
+			if err := replaceDir(staging, dir); err != nil {
+				return "", err
+			}
+		}
+		// Otherwise another load cloned it first; its copy is just as good
+	}
+	return dir, nil
+}
+
+// shallowClone checks out repo at ref into dir, fetching only that commit
+// when the server allows it. Servers that won't serve a bare commit by its
+// hash get a full fetch instead.
+func shallowClone(ctx context.Context, gitPath, repo, ref, dir string) error {
+	git := func(args ...string) error {
+		cmd := exec.CommandContext(ctx, gitPath, append([]string{"-C", dir}, args...)...)
+		// Never stop to ask for credentials; ssh keys and credential helpers still apply
+		cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			msg := strings.TrimSpace(stderr.String())
+			if msg == "" {
+				msg = err.Error()
+			}
+			return errors.Wrap(errors.ErrGitClone, path.Base(repo)+": "+msg)
+		}
+		return nil
+	}
+
+	if err := git("init", "-q"); err != nil {
+		return err
+	}
+	target := ref
+	if target == "" {
+		target = "HEAD"
+	}
+	err := git("fetch", "-q", "--depth", "1", "--", repo, target)
+	if err != nil && isCommitHash(ref) {
+		if git("fetch", "-q", "--tags", "--", repo, "+refs/heads/*:refs/remotes/origin/*") != nil {
+			return err
+		}
+		return git("checkout", "-q", "--detach", ref)
+	}
+	if err != nil {
+		return err
+	}
+	return git("checkout", "-q", "--detach", "FETCH_HEAD")
+}
+
+// isCommitHash reports whether ref looks like an abbreviated or full commit
+// hash rather than a branch or tag name
+func isCommitHash(ref string) bool {
+	if len(ref) < 7 || len(ref) > 40 {
+		return false
+	}
+	for _, c := range ref {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// resolveGitRelative resolves specifier against the file a git specifier
+// names, keeping the repository and ref as the importer wrote them
+func resolveGitRelative(importer, specifier string) (string, error) {
+	repo, fragment, _ := strings.Cut(importer, "#")
+	ref, subpath, _ := strings.Cut(fragment, ":")
+
+	resolved := path.Join(path.Dir(subpath), specifier)
+	if resolved == ".." || strings.HasPrefix(resolved, "../") {
+		return "", errors.Wrap(errors.ErrInvalidURL, "relative import "+specifier+" escapes repository "+repo)
+	}
+	if resolved == "." {
+		return repo + "#" + ref, nil
+	}
+	return repo + "#" + ref + ":" + resolved, nil
+}
@@ -0,0 +1,110 @@
+package loader
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/katungi/edon/internal/errors"
+)
+
+// LoadGraph loads entry and everything it imports, directly or not, and
+// returns the modules that loaded keyed by resolved URL. Each module is loaded
+// once however many modules import it, which also breaks import cycles, and
+// loads share the WithMaxConcurrency limit and one WithRetryBudget budget.
+// Failures don't stop the walk unless WithFailFast is set; they are
+// aggregated into a single error naming each failed specifier and the
+// module that imported it. Local modules are told apart by their real path,
+// so symlink cycles don't make the walk loop. Each returned module's
+// Dependencies lists what it imports, so the graph's edges can be followed
+// through the map.
+func (l *ModuleLoader) LoadGraph(ctx context.Context, entry string) (map[string]*Module, error) {
+	ctx = l.withRetryBudget(ctx)
+	ctx, failures := l.newFailures(ctx)
+	defer failures.cancel()
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		modules = make(map[string]*Module)
+		// seen maps the graph key of each module visited to the
+		// specifier it was visited and stored under
+		seen = make(map[string]string)
+	)
+
+	// fail records err against specifier
+	fail := func(specifier, importer string, err error) {
+		if importer != "" {
+			specifier = fmt.Sprintf("%s (imported from %s)", specifier, importer)
+		}
+		failures.add(errors.Wrap(err, specifier))
+	}
+
+	var visit func(specifier, importer string)
+	visit = func(specifier, importer string) {
+		defer wg.Done()
+
+		release, err := l.config.acquire(ctx)
+		if err != nil {
+			fail(specifier, importer, err)
+			return
+		}
+		module, err := l.LoadModule(ctx, specifier)
+		var imports []string
+		if err == nil {
+			imports, err = l.Imports(module)
+		}
+		release()
+
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			if module != nil {
+				modules[specifier] = module
+			}
+			fail(specifier, importer, err)
+			return
+		}
+
+		// A copy, since the cached module is shared with LoadModule's callers
+		graphed := *module
+		graphed.Dependencies = make([]string, 0, len(imports))
+		modules[specifier] = &graphed
+		for _, imp := range imports {
+			resolved, err := l.ResolveImport(module, imp)
+			if err != nil {
+				fail(imp, specifier, err)
+				continue
+			}
+			key, err := graphKey(resolved)
+			if err != nil {
+				fail(imp, specifier, err)
+				continue
+			}
+			// A module reached by another path, such as through a
+			// symlink, is listed under the specifier it was stored by
+			if visited, ok := seen[key]; ok {
+				if !slices.Contains(graphed.Dependencies, visited) {
+					graphed.Dependencies = append(graphed.Dependencies, visited)
+				}
+				continue
+			}
+			seen[key] = resolved
+			graphed.Dependencies = append(graphed.Dependencies, resolved)
+			wg.Add(1)
+			go visit(resolved, specifier)
+		}
+	}
+
+	entry = l.normalize(entry)
+	key, err := graphKey(entry)
+	if err != nil {
+		return nil, err
+	}
+	seen[key] = entry
+	wg.Add(1)
+	go visit(entry, "")
+	wg.Wait()
+
+	return modules, failures.err()
+}
@@ -0,0 +1,100 @@
+package loader
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// httpExpiry is when a CDN module goes stale by its response's caching
+// headers
+type httpExpiry struct {
+	// at is when the response's max-age or Expires runs out; zero when it
+	// set neither
+	at time.Time
+	// immutable is set by Cache-Control: immutable, as CDNs send for
+	// versioned URLs; such a module never goes stale
+	immutable bool
+}
+
+// parseExpiry reads the Cache-Control, Age and Expires headers of a response
+// received at now. no-cache and no-store make it stale straight away, and
+// max-age outranks Expires, as HTTP caches do.
+func parseExpiry(header http.Header, now time.Time) httpExpiry {
+	var (
+		expiry    httpExpiry
+		noCache   bool
+		maxAge    int
+		hasMaxAge bool
+	)
+	for _, directive := range strings.Split(header.Get("Cache-Control"), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch strings.ToLower(name) {
+		case "immutable":
+			expiry.immutable = true
+		case "no-cache", "no-store":
+			noCache = true
+		case "max-age":
+			if n, err := strconv.Atoi(strings.Trim(value, `"`)); err == nil {
+				maxAge, hasMaxAge = n, true
+			}
+		}
+	}
+
+	switch {
+	case noCache:
+		return httpExpiry{at: now}
+	case expiry.immutable:
+		return expiry
+	case hasMaxAge:
+		// The response may have waited in a shared cache for Age seconds
+		age, _ := strconv.Atoi(header.Get("Age"))
+		expiry.at = now.Add(time.Duration(max(maxAge-max(age, 0), 0)) * time.Second)
+	case header.Get("Expires") != "":
+		expires, err := http.ParseTime(header.Get("Expires"))
+		if err != nil {
+			// An invalid date, such as "0", means already expired
+			return httpExpiry{at: now}
+		}
+		// Measured from the server's Date, so the clocks needn't agree
+		if date, err := http.ParseTime(header.Get("Date")); err == nil {
+			expires = now.Add(expires.Sub(date))
+		}
+		expiry.at = expires
+	}
+	return expiry
+}
+
+// expiryKey returns the key that stores when url's entry goes stale
+func (d *diskCache) expiryKey(url string) string {
+	return d.key(url) + ".expires"
+}
+
+// expiry returns when url's entry goes stale by its caching headers
+func (d *diskCache) expiry(url string) httpExpiry {
+	data, ok := d.backend.Get(d.expiryKey(url))
+	if !ok {
+		return httpExpiry{}
+	}
+	if string(data) == "immutable" {
+		return httpExpiry{immutable: true}
+	}
+	unix, err := strconv.ParseInt(string(data), 10, 64)
+	if err != nil {
+		return httpExpiry{}
+	}
+	return httpExpiry{at: time.Unix(unix, 0)}
+}
+
+// setExpiry records when url's entry goes stale, dropping any earlier
+// record when the response had no caching headers
+func (d *diskCache) setExpiry(url string, expiry httpExpiry) error {
+	switch {
+	case expiry.immutable:
+		return d.backend.Put(d.expiryKey(url), []byte("immutable"))
+	case !expiry.at.IsZero():
+		return d.backend.Put(d.expiryKey(url), []byte(strconv.FormatInt(expiry.at.Unix(), 10)))
+	}
+	return d.backend.Delete(d.expiryKey(url))
+}
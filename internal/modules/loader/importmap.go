@@ -0,0 +1,130 @@
+package loader
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/katungi/edon/internal/errors"
+)
+
+// ImportMap rewrites bare or prefixed specifiers before they are loaded.
+// Keys ending in "/" map every specifier with that prefix.
+//
+// Scopes apply their own mappings to the modules whose URL they match: a
+// scope key ending in "/" matches every module under it, any other only
+// that module. Following the import maps spec, the most specific matching
+// scope is tried first, then less specific ones, then Imports.
+type ImportMap struct {
+	Imports map[string]string            `json:"imports"`
+	Scopes  map[string]map[string]string `json:"scopes"`
+}
+
+// LoadImportMap reads an import map file. Relative targets and scope keys
+// resolve against the file's directory.
+func LoadImportMap(path string) (*ImportMap, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrFileRead, err.Error())
+	}
+
+	var m ImportMap
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, errors.WrapWith(errors.ErrInvalidImportMap, err, path)
+	}
+
+	dir := filepath.Dir(path)
+	resolveTargets(m.Imports, dir)
+	scopes := make(map[string]map[string]string, len(m.Scopes))
+	for scope, imports := range m.Scopes {
+		resolveTargets(imports, dir)
+		scopes[resolveMapPath(scope, dir)] = imports
+	}
+	m.Scopes = scopes
+
+	return &m, nil
+}
+
+// resolveTargets resolves the relative targets of imports against dir
+func resolveTargets(imports map[string]string, dir string) {
+	for key, target := range imports {
+		imports[key] = resolveMapPath(target, dir)
+	}
+}
+
+// resolveMapPath resolves a "./" or "../" path in an import map against dir,
+// leaving anything else as written
+func resolveMapPath(target, dir string) string {
+	if !isRelativeSpecifier(target) {
+		return target
+	}
+	resolved := filepath.Join(dir, filepath.FromSlash(target))
+	// filepath.Join drops the trailing slash prefix mappings rely on
+	if strings.HasSuffix(target, "/") {
+		resolved += string(filepath.Separator)
+	}
+	return resolved
+}
+
+// Resolve applies the top-level imports to a specifier. An exact match wins
+// over the longest matching prefix; unmatched specifiers are returned
+// unchanged.
+func (m *ImportMap) Resolve(specifier string) string {
+	return m.ResolveFrom(specifier, "")
+}
+
+// ResolveFrom applies the map to a specifier imported by the module at
+// importer, trying the scopes that match importer before the top-level
+// imports. An empty importer only uses the top-level imports.
+func (m *ImportMap) ResolveFrom(specifier, importer string) string {
+	if m == nil {
+		return specifier
+	}
+	if importer != "" {
+		for _, scope := range m.matchingScopes(importer) {
+			if target, ok := resolveImports(m.Scopes[scope], specifier); ok {
+				return target
+			}
+		}
+	}
+	if target, ok := resolveImports(m.Imports, specifier); ok {
+		return target
+	}
+	return specifier
+}
+
+// matchingScopes returns the scopes that apply to importer, most specific
+// first
+func (m *ImportMap) matchingScopes(importer string) []string {
+	var scopes []string
+	for scope := range m.Scopes {
+		// Scopes resolved from the map's directory end in a path separator
+		prefix := strings.HasSuffix(scope, "/") || strings.HasSuffix(scope, string(filepath.Separator))
+		if scope == importer || prefix && strings.HasPrefix(importer, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	sort.Slice(scopes, func(i, j int) bool { return len(scopes[i]) > len(scopes[j]) })
+	return scopes
+}
+
+// resolveImports looks specifier up in one set of mappings, reporting
+// whether any matched
+func resolveImports(imports map[string]string, specifier string) (string, bool) {
+	if target, ok := imports[specifier]; ok {
+		return target, true
+	}
+
+	best := ""
+	for key := range imports {
+		if strings.HasSuffix(key, "/") && strings.HasPrefix(specifier, key) && len(key) > len(best) {
+			best = key
+		}
+	}
+	if best == "" {
+		return "", false
+	}
+	return imports[best] + strings.TrimPrefix(specifier, best), true
+}
@@ -0,0 +1,371 @@
+package loader
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/katungi/edon/internal/errors"
+)
+
+// Imports returns the specifiers a module imports directly, in order of first
+// appearance: static imports and re-exports (`import x from "y"`,
+// `export * from "y"`), dynamic `import("y")` and `require("y")`. It is a
+// lexical scan rather than a parse, so specifiers built at runtime (template
+// literals with substitutions, variables) are skipped, as is anything inside
+// comments, strings or regular expressions.
+func (l *ModuleLoader) Imports(m *Module) ([]string, error) {
+	if m == nil {
+		return nil, errors.Wrap(errors.ErrInvalidScript, "nil module")
+	}
+	if m.MediaType == MediaJSON || m.MediaType == MediaWasm {
+		return nil, nil
+	}
+
+	tokens, err := tokenize(m.Content)
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInvalidScript, fmt.Sprintf("%s: %v", m.URL, err))
+	}
+
+	var specifiers []string
+	seen := make(map[string]bool)
+	for _, i := range importTokens(tokens) {
+		if s := tokens[i].value; !seen[s] {
+			seen[s] = true
+			specifiers = append(specifiers, s)
+		}
+	}
+	return specifiers, nil
+}
+
+// importTokens returns the indexes of the string tokens that are import
+// specifiers, in order
+func importTokens(tokens []token) []int {
+	var found []int
+	// at returns the token at i, or an EOF token past the end
+	at := func(i int) token {
+		if i < 0 || i >= len(tokens) {
+			return token{kind: tokEOF}
+		}
+		return tokens[i]
+	}
+	// call matches `(` string `)` or `(` string `,` starting at i
+	call := func(i int) bool {
+		if !at(i).is("(") || at(i+1).kind != tokString {
+			return false
+		}
+		closing := at(i + 2)
+		return closing.is(")") || closing.is(",")
+	}
+
+	inStatement := false
+	for i, t := range tokens {
+		// Property accesses such as obj.import or module.require aren't imports
+		if at(i - 1).is(".") {
+			continue
+		}
+
+		switch {
+		case t.isIdent("import"):
+			next := at(i + 1)
+			switch {
+			case next.kind == tokString:
+				found = append(found, i+1)
+			case next.is("("):
+				if call(i + 1) {
+					found = append(found, i+2)
+				}
+			case !next.is("."): // import.meta
+				inStatement = true
+			}
+		case t.isIdent("export"):
+			inStatement = true
+		case t.isIdent("from") && inStatement:
+			if next := at(i + 1); next.kind == tokString {
+				found = append(found, i+1)
+				inStatement = false
+			}
+		case t.isIdent("require"):
+			if call(i + 1) {
+				found = append(found, i+2)
+			}
+		case t.is(";"):
+			inStatement = false
+		}
+	}
+	return found
+}
+
+// RewriteImports returns m's source with each import specifier Imports finds
+// replaced by what rewrite returns for it. The rest of the source, comments
+// and formatting included, is left as it was.
+func (l *ModuleLoader) RewriteImports(m *Module, rewrite func(specifier string) string) (string, error) {
+	if m == nil {
+		return "", errors.Wrap(errors.ErrInvalidScript, "nil module")
+	}
+	if m.MediaType == MediaJSON || m.MediaType == MediaWasm {
+		return m.Content, nil
+	}
+
+	tokens, err := tokenize(m.Content)
+	if err != nil {
+		return "", errors.Wrap(errors.ErrInvalidScript, fmt.Sprintf("%s: %v", m.URL, err))
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, i := range importTokens(tokens) {
+		t := tokens[i]
+		replacement := rewrite(t.value)
+		if replacement == t.value {
+			continue
+		}
+		b.WriteString(m.Content[last:t.start])
+		b.WriteString(strconv.Quote(replacement))
+		last = t.end
+	}
+	b.WriteString(m.Content[last:])
+	return b.String(), nil
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokString   // a quoted string or a template literal without substitutions
+	tokTemplate // part of a template literal with substitutions
+	tokRegexp
+	tokPunct
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+	// start and end are the token's byte offsets in the source
+	start, end int
+}
+
+func (t token) is(punct string) bool {
+	return t.kind == tokPunct && t.value == punct
+}
+
+func (t token) isIdent(name string) bool {
+	return t.kind == tokIdent && t.value == name
+}
+
+// regexpPrecedingKeywords are keywords after which a "/" starts a regular
+// expression rather than a division
+var regexpPrecedingKeywords = map[string]bool{
+	"return": true, "typeof": true, "instanceof": true, "in": true, "of": true,
+	"new": true, "delete": true, "void": true, "throw": true, "case": true,
+	"do": true, "else": true, "yield": true, "await": true,
+}
+
+// lexer splits JavaScript source into just enough tokens to find import
+// specifiers, keeping track of template literal substitutions so braces
+// inside them don't confuse the scan
+type lexer struct {
+	src  string
+	pos  int
+	prev token
+	// braces records, for each open brace, whether it opened a template
+	// substitution ("${") rather than a block or object
+	braces []bool
+}
+
+func tokenize(src string) ([]token, error) {
+	lx := &lexer{src: src}
+	var tokens []token
+	for {
+		t, err := lx.next()
+		if err != nil {
+			return nil, err
+		}
+		if t.kind == tokEOF {
+			return tokens, nil
+		}
+		tokens = append(tokens, t)
+		lx.prev = t
+	}
+}
+
+func (lx *lexer) next() (token, error) {
+	if err := lx.skipSpaceAndComments(); err != nil {
+		return token{}, err
+	}
+	start := lx.pos
+	t, err := lx.scan()
+	t.start, t.end = start, lx.pos
+	return t, err
+}
+
+// scan reads the token at the current position, which isn't whitespace or
+// a comment
+func (lx *lexer) scan() (token, error) {
+	if lx.pos >= len(lx.src) {
+		return token{kind: tokEOF}, nil
+	}
+
+	c := lx.src[lx.pos]
+	switch {
+	case isIdentByte(c):
+		start := lx.pos
+		for lx.pos < len(lx.src) && isIdentByte(lx.src[lx.pos]) {
+			lx.pos++
+		}
+		return token{kind: tokIdent, value: lx.src[start:lx.pos]}, nil
+	case c == '"' || c == '\'':
+		return lx.readString(c)
+	case c == '`':
+		lx.pos++
+		return lx.readTemplate()
+	case c == '/' && lx.regexpAllowed():
+		return lx.readRegexp()
+	case c == '{':
+		lx.braces = append(lx.braces, false)
+	case c == '}':
+		if n := len(lx.braces); n > 0 {
+			substitution := lx.braces[n-1]
+			lx.braces = lx.braces[:n-1]
+			if substitution {
+				lx.pos++
+				return lx.readTemplate()
+			}
+		}
+	}
+
+	lx.pos++
+	return token{kind: tokPunct, value: string(c)}, nil
+}
+
+// skipSpaceAndComments advances past whitespace, line and block comments
+func (lx *lexer) skipSpaceAndComments() error {
+	for lx.pos < len(lx.src) {
+		switch rest := lx.src[lx.pos:]; {
+		case strings.HasPrefix(rest, "//"):
+			end := strings.IndexByte(rest, '\n')
+			if end == -1 {
+				lx.pos = len(lx.src)
+				return nil
+			}
+			lx.pos += end + 1
+		case strings.HasPrefix(rest, "/*"):
+			end := strings.Index(rest[2:], "*/")
+			if end == -1 {
+				return fmt.Errorf("unterminated comment at offset %d", lx.pos)
+			}
+			lx.pos += end + 4
+		case rest[0] == ' ' || rest[0] == '\t' || rest[0] == '\n' || rest[0] == '\r':
+			lx.pos++
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+// readString reads a single- or double-quoted string literal
+func (lx *lexer) readString(quote byte) (token, error) {
+	start := lx.pos
+	lx.pos++
+	var b strings.Builder
+	for lx.pos < len(lx.src) {
+		c := lx.src[lx.pos]
+		switch {
+		case c == '\\' && lx.pos+1 < len(lx.src):
+			b.WriteByte(lx.src[lx.pos+1])
+			lx.pos += 2
+		case c == quote:
+			lx.pos++
+			return token{kind: tokString, value: b.String()}, nil
+		case c == '\n':
+			return token{}, fmt.Errorf("unterminated string at offset %d", start)
+		default:
+			b.WriteByte(c)
+			lx.pos++
+		}
+	}
+	return token{}, fmt.Errorf("unterminated string at offset %d", start)
+}
+
+// readTemplate reads template literal text up to the closing backtick or the
+// next substitution. Only a template with no substitutions is a plain string.
+func (lx *lexer) readTemplate() (token, error) {
+	start := lx.pos
+	// A template continuing after "}" can never be a plain string
+	continued := start > 0 && lx.src[start-1] == '}'
+	var b strings.Builder
+	for lx.pos < len(lx.src) {
+		c := lx.src[lx.pos]
+		switch {
+		case c == '\\' && lx.pos+1 < len(lx.src):
+			b.WriteByte(lx.src[lx.pos+1])
+			lx.pos += 2
+		case c == '`':
+			lx.pos++
+			if continued {
+				return token{kind: tokTemplate}, nil
+			}
+			return token{kind: tokString, value: b.String()}, nil
+		case c == '$' && strings.HasPrefix(lx.src[lx.pos:], "${"):
+			lx.pos += 2
+			lx.braces = append(lx.braces, true)
+			return token{kind: tokTemplate}, nil
+		default:
+			b.WriteByte(c)
+			lx.pos++
+		}
+	}
+	return token{}, fmt.Errorf("unterminated template literal at offset %d", start)
+}
+
+// regexpAllowed reports whether a "/" at the current position starts a
+// regular expression, judging by the previous token
+func (lx *lexer) regexpAllowed() bool {
+	switch lx.prev.kind {
+	case tokEOF, tokTemplate:
+		return true
+	case tokIdent:
+		return regexpPrecedingKeywords[lx.prev.value]
+	case tokPunct:
+		return lx.prev.value != ")" && lx.prev.value != "]" && lx.prev.value != "}"
+	}
+	return false
+}
+
+// readRegexp skips a regular expression literal, including its flags
+func (lx *lexer) readRegexp() (token, error) {
+	start := lx.pos
+	lx.pos++
+	inClass := false
+	for lx.pos < len(lx.src) {
+		c := lx.src[lx.pos]
+		switch {
+		case c == '\\':
+			lx.pos += 2
+			continue
+		case c == '\n':
+			return token{}, fmt.Errorf("unterminated regular expression at offset %d", start)
+		case c == '[':
+			inClass = true
+		case c == ']':
+			inClass = false
+		case c == '/' && !inClass:
+			lx.pos++
+			for lx.pos < len(lx.src) && isIdentByte(lx.src[lx.pos]) {
+				lx.pos++
+			}
+			return token{kind: tokRegexp}, nil
+		}
+		lx.pos++
+	}
+	return token{}, fmt.Errorf("unterminated regular expression at offset %d", start)
+}
+
+// isIdentByte reports whether c can appear in an identifier or number.
+// Non-ASCII bytes are treated as identifier characters.
+func isIdentByte(c byte) bool {
+	return c == '_' || c == '$' || c >= 0x80 ||
+		('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+}
@@ -0,0 +1,125 @@
+package loader
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+
+	"github.com/katungi/edon/internal/errors"
+)
+
+// PackageInfo is what the registry says about a package and one of its
+// versions, as edon info prints it
+type PackageInfo struct {
+	Name        string
+	Description string
+	License     string
+	// Latest is the version the registry tags "latest"
+	Latest   string
+	DistTags map[string]string
+	// Versions lists every published version, lowest first
+	Versions []string
+	// Version is the version Info was asked about, or Latest when it was
+	// given no spec; Dependencies, Tarball and Integrity are that version's
+	Version      string
+	Dependencies map[string]string
+	Tarball      string
+	Integrity    string
+	// Raw is the registry's own metadata: the version's entry when Info was
+	// given a spec, and the whole document listing every version otherwise
+	Raw json.RawMessage
+}
+
+// infoDocument holds the fields of a registry document that only
+// PackageInfo needs, which fetchPackument doesn't decode
+type infoDocument struct {
+	Description string                     `json:"description"`
+	License     json.RawMessage            `json:"license"`
+	Versions    map[string]json.RawMessage `json:"versions"`
+}
+
+// Info fetches name's registry metadata and describes the version spec
+// resolves to, which may be a version, a range or a dist-tag. An empty spec
+// describes the latest version.
+func (pm *NPMPackageManager) Info(ctx context.Context, name, spec string) (*PackageInfo, error) {
+	if err := ValidatePackageName(name); err != nil {
+		return nil, err
+	}
+	doc, err := pm.fetchPackument(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	var extra infoDocument
+	if err := json.Unmarshal(doc.raw, &extra); err != nil {
+		return nil, errors.Wrap(errors.ErrPackageFetch, err.Error())
+	}
+	info := &PackageInfo{
+		Name:        doc.Name,
+		Description: extra.Description,
+		License:     licenseName(extra.License),
+		Latest:      doc.DistTags["latest"],
+		DistTags:    doc.DistTags,
+		Raw:         doc.raw,
+	}
+	for v := range doc.Versions {
+		if _, ok := parseVersion(v); ok {
+			info.Versions = append(info.Versions, v)
+		}
+	}
+	sort.Slice(info.Versions, func(i, j int) bool {
+		a, _ := parseVersion(info.Versions[i])
+		b, _ := parseVersion(info.Versions[j])
+		return compareVersions(a, b) < 0
+	})
+	if info.Latest == "" {
+		info.Latest, _ = maxSatisfying(info.Versions, anyRelease)
+	}
+
+	resolveSpec := spec
+	if resolveSpec == "" {
+		resolveSpec = info.Latest
+	}
+	if resolveSpec == "" {
+		// Nothing published, or only prereleases without a latest tag
+		return info, nil
+	}
+	meta, err := doc.resolve(resolveSpec)
+	if err != nil {
+		return nil, err
+	}
+	info.Version, info.Dependencies = meta.Version, meta.Dependencies
+	info.Tarball, info.Integrity = meta.Dist.Tarball, meta.Dist.Integrity
+
+	// A version's own description and license win over the document's,
+	// which describe the latest
+	var own infoDocument
+	if err := json.Unmarshal(extra.Versions[meta.Version], &own); err == nil {
+		if own.Description != "" {
+			info.Description = own.Description
+		}
+		if license := licenseName(own.License); license != "" {
+			info.License = license
+		}
+	}
+	if spec != "" {
+		info.Raw = extra.Versions[meta.Version]
+	}
+	return info, nil
+}
+
+// licenseName reads a package.json "license", which is an SPDX expression
+// or, in older packages, an object with a "type"
+func licenseName(raw json.RawMessage) string {
+	var name string
+	if err := json.Unmarshal(raw, &name); err == nil {
+		return name
+	}
+	var object struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(raw, &object); err == nil {
+		return object.Type
+	}
+	return ""
+}
@@ -0,0 +1,99 @@
+package loader
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/katungi/edon/internal/errors"
+)
+
+// PackageInstaller installs packages into, and removes them from, a package
+// cache. NPMPackageManager is the real one; loadertest.FakePackageManager
+// serves packages from memory so code depending on one runs hermetically.
+type PackageInstaller interface {
+	// InstallPackage installs "name", "name@version", "name@range" or
+	// "name@tag" and reports the version it resolved to
+	InstallPackage(ctx context.Context, packageName string) (*InstalledPackage, error)
+	// UninstallPackage removes "name@version", or every version of a bare
+	// "name". An error wrapping errors.ErrPackageNotFound means nothing
+	// matching was installed.
+	UninstallPackage(ctx context.Context, packageName string) error
+	// ListInstalled returns every installed package, sorted by name then
+	// version
+	ListInstalled() ([]*InstalledPackage, error)
+}
+
+var _ PackageInstaller = (*NPMPackageManager)(nil)
+
+// UninstallPackage removes "name@version" from the package cache, or every
+// cached version of a bare "name". Each version is removed under its install
+// lock, so an install in progress finishes first.
+func (pm *NPMPackageManager) UninstallPackage(ctx context.Context, packageName string) error {
+	name, version := packageName, ""
+	if at := strings.LastIndex(packageName, "@"); at > 0 {
+		name, version = packageName[:at], packageName[at+1:]
+		if !isExactVersion(version) {
+			return errors.Wrap(errors.ErrInvalidVersion, fmt.Sprintf("%s: uninstall takes an exact version", packageName))
+		}
+	}
+	if err := ValidatePackageName(name); err != nil {
+		return err
+	}
+
+	installed, err := pm.ListInstalled()
+	if err != nil {
+		return err
+	}
+	removed := false
+	for _, pkg := range installed {
+		if pkg.Name != name || version != "" && pkg.Version != version {
+			continue
+		}
+		unlock, err := pm.lockInstall(ctx, pkg.Name, pkg.Version)
+		if err != nil {
+			return err
+		}
+		err = removePackageDir(pm.cacheDir, pkg.Path, pkg.Name)
+		unlock()
+		if err != nil {
+			return err
+		}
+		removed = true
+	}
+	if !removed {
+		return errors.Wrap(errors.ErrPackageNotFound, fmt.Sprintf("%s is not installed", packageName))
+	}
+	return nil
+}
+
+// ListInstalled returns every package in the cache, sorted by name then
+// version. Their Bins and warnings are left empty.
+func (pm *NPMPackageManager) ListInstalled() ([]*InstalledPackage, error) {
+	dirs, err := listPackageDirs(pm.cacheDir)
+	if err != nil {
+		return nil, err
+	}
+	installed := make([]*InstalledPackage, 0, len(dirs))
+	for _, dir := range dirs {
+		// Directories are listed as "name/version"
+		installed = append(installed, &InstalledPackage{
+			Name:      path.Dir(dir),
+			Version:   path.Base(dir),
+			Path:      filepath.Join(pm.cacheDir, filepath.FromSlash(dir)),
+			FromCache: true,
+		})
+	}
+	sort.Slice(installed, func(i, j int) bool {
+		if installed[i].Name != installed[j].Name {
+			return installed[i].Name < installed[j].Name
+		}
+		a, _ := parseVersion(installed[i].Version)
+		b, _ := parseVersion(installed[j].Version)
+		return compareVersions(a, b) < 0
+	})
+	return installed, nil
+}
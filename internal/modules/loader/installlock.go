@@ -0,0 +1,58 @@
+package loader
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/katungi/edon/internal/errors"
+)
+
+// installLockDir, beside the npm cache, holds one lock file per package
+// version that has been installed. It starts with a dot so cache listings
+// skip it.
+const installLockDir = ".locks"
+
+// installLockPoll is how often a waiting installer retries a held lock
+const installLockPoll = 50 * time.Millisecond
+
+// lockInstall takes the cross-process lock on installing name@version,
+// waiting while another installer, in this process or another, holds it.
+// The returned function releases it; so does the holder exiting, so a
+// crashed install never leaves the package locked. Lock files stay behind,
+// empty, since removing one could split waiters across two files.
+func (pm *NPMPackageManager) lockInstall(ctx context.Context, name, version string) (unlock func(), err error) {
+	dir := filepath.Join(pm.baseDir(), installLockDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Wrap(errors.ErrCacheDir, err.Error())
+	}
+	path := filepath.Join(dir, strings.ReplaceAll(name, "/", "+")+"@"+version+".lock")
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrCacheDir, err.Error())
+	}
+
+	ticker := time.NewTicker(installLockPoll)
+	defer ticker.Stop()
+	for {
+		locked, err := tryLockFile(f)
+		if err != nil {
+			f.Close()
+			return nil, errors.Wrap(errors.ErrCacheDir, err.Error())
+		}
+		if locked {
+			return func() {
+				unlockFile(f)
+				f.Close()
+			}, nil
+		}
+		select {
+		case <-ctx.Done():
+			f.Close()
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
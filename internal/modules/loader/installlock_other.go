@@ -0,0 +1,14 @@
+//go:build !unix
+
+package loader
+
+import "os"
+
+// tryLockFile always succeeds where flock isn't available. Installs stay
+// safe, as each is renamed into place whole, but concurrent installers may
+// both download the package.
+func tryLockFile(f *os.File) (bool, error) {
+	return true, nil
+}
+
+func unlockFile(f *os.File) {}
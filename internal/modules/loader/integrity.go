@@ -0,0 +1,155 @@
+package loader
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/katungi/edon/internal/errors"
+)
+
+// integrityHashes maps SRI algorithm prefixes to their hash constructors
+var integrityHashes = map[string]func() hash.Hash{
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha384": sha512.New384,
+	"sha512": sha512.New,
+}
+
+// integrityStrength lists the SRI algorithms from weakest to strongest.
+// sha1 is only ever verified, for packages published before npm had SRI.
+var integrityStrength = []string{"sha1", "sha256", "sha384", "sha512"}
+
+// defaultIntegrityAlgorithm is what new digests use, as npm's lockfiles do
+const defaultIntegrityAlgorithm = "sha512"
+
+// WithIntegrityAlgorithm sets the SRI algorithm, "sha256", "sha384" or
+// "sha512", that Integrity computes new digests with; the default is
+// sha512, which is what the npm registry publishes. Verification is
+// unaffected: it uses whichever algorithm the registry or lockfile gives.
+// NewNPMPackageManager returns errors.ErrIntegrityAlgorithm for any other.
+func WithIntegrityAlgorithm(algorithm string) Option {
+	return func(c *config) {
+		c.integrityAlgorithm = algorithm
+	}
+}
+
+// generatedIntegrityAlgorithm checks an algorithm WithIntegrityAlgorithm
+// asked for, defaulting an empty one
+func generatedIntegrityAlgorithm(algorithm string) (string, error) {
+	switch algorithm {
+	case "":
+		return defaultIntegrityAlgorithm, nil
+	case "sha256", "sha384", "sha512":
+		return algorithm, nil
+	}
+	return "", errors.Wrap(errors.ErrIntegrityAlgorithm, fmt.Sprintf("%q: use sha256, sha384 or sha512", algorithm))
+}
+
+// verifyIntegrity checks a downloaded file against the registry's advertised
+// digests. As SRI specifies, only the strongest supported algorithm in the
+// integrity string ("sha512-<base64> sha256-<base64>") is checked, and the
+// file passes if it matches any digest given for it. The legacy hex SHA-1
+// shasum is used when no supported SRI digest is present, and a file whose
+// integrity names only unsupported algorithms fails rather than going
+// unchecked.
+func verifyIntegrity(path, integrity, shasum string) error {
+	algo, wants := strongestIntegrity(integrity)
+	if algo == "" && shasum == "" && strings.TrimSpace(integrity) != "" {
+		return errors.Wrap(errors.ErrIntegrityMismatch, fmt.Sprintf("no supported algorithm in %q", integrity))
+	}
+	if algo != "" {
+		sum, err := hashFile(path, integrityHashes[algo]())
+		if err != nil {
+			return err
+		}
+		got := base64.StdEncoding.EncodeToString(sum)
+		if !slices.Contains(wants, got) {
+			return errors.Wrap(errors.ErrIntegrityMismatch, fmt.Sprintf("expected %s-%s, got %s-%s", algo, wants[0], algo, got))
+		}
+		return nil
+	}
+
+	if shasum != "" {
+		sum, err := hashFile(path, sha1.New())
+		if err != nil {
+			return err
+		}
+		if got := hex.EncodeToString(sum); !strings.EqualFold(got, shasum) {
+			return errors.Wrap(errors.ErrIntegrityMismatch, fmt.Sprintf("expected shasum %s, got %s", shasum, got))
+		}
+	}
+
+	return nil
+}
+
+// strongestIntegrity returns the strongest supported algorithm in an SRI
+// integrity string and the digests it gives for it, ignoring any "?options"
+func strongestIntegrity(integrity string) (string, []string) {
+	best, rank := "", -1
+	var digests []string
+	for _, entry := range strings.Fields(integrity) {
+		entry, _, _ = strings.Cut(entry, "?")
+		algo, digest, ok := strings.Cut(entry, "-")
+		r := slices.Index(integrityStrength, algo)
+		switch {
+		case !ok || r < 0 || r < rank:
+			continue
+		case r > rank:
+			best, rank, digests = algo, r, nil
+		}
+		digests = append(digests, digest)
+	}
+	return best, digests
+}
+
+// hashFile returns the digest of a file's contents
+func hashFile(path string, h hash.Hash) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrFileRead, err.Error())
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, errors.Wrap(errors.ErrFileRead, err.Error())
+	}
+	return h.Sum(nil), nil
+}
+
+// Integrity downloads pkg's tarball, checks it against the registry's digests
+// and returns its SHA-512 in SRI form ("sha512-<base64>"), as npm lockfiles
+// record it, or its digest with the algorithm WithIntegrityAlgorithm sets.
+// The tarball is discarded afterwards, so nothing is installed.
+// Packages ResolveTree read from the cache carry no tarball URL and are
+// resolved again from the registry.
+func (pm *NPMPackageManager) Integrity(ctx context.Context, pkg *ResolvedPackage) (string, error) {
+	if pkg.Tarball == "" {
+		var err error
+		if pkg, err = pm.Resolve(ctx, pkg.String()); err != nil {
+			return "", err
+		}
+	}
+
+	// Not resumable, since nothing stops an install of the same version
+	// from writing to the partial download meanwhile
+	tarball, _, err := pm.fetchTarball(ctx, pkg, false)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tarball)
+	sum, err := hashFile(tarball, integrityHashes[pm.integrityAlgorithm]())
+	if err != nil {
+		return "", err
+	}
+	return pm.integrityAlgorithm + "-" + base64.StdEncoding.EncodeToString(sum), nil
+}
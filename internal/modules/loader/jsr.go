@@ -0,0 +1,232 @@
+package loader
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/katungi/edon/internal/errors"
+)
+
+const (
+	// jsrRegistry serves package metadata and source files directly
+	jsrRegistry = "https://jsr.io"
+	// jsrNPMRegistry serves JSR packages as npm tarballs under the @jsr scope
+	jsrNPMRegistry = "https://npm.jsr.io"
+)
+
+// jsrMeta is a package's meta.json, listing its versions
+type jsrMeta struct {
+	Latest   string `json:"latest"`
+	Versions map[string]struct {
+		Yanked bool `json:"yanked"`
+	} `json:"versions"`
+}
+
+// jsrVersionMeta is a version's <version>_meta.json, mapping export
+// subpaths ("." or "./sub") to files in the package
+type jsrVersionMeta struct {
+	Exports map[string]string `json:"exports"`
+}
+
+// parseJSRSpecifier splits "jsr:@scope/name@version/subpath" into the package
+// name ("@scope/name"), version and subpath. JSR packages are always scoped.
+func parseJSRSpecifier(spec string) (name, version, subpath string, err error) {
+	name, version, subpath = ParseNPMSpecifier(strings.TrimPrefix(spec, "jsr:"))
+	scope, pkg, ok := strings.Cut(strings.TrimPrefix(name, "@"), "/")
+	if !strings.HasPrefix(name, "@") || !ok || scope == "" || pkg == "" {
+		return "", "", "", errors.Wrap(errors.ErrInvalidURL, fmt.Sprintf("jsr packages must be scoped: %s", spec))
+	}
+	return name, version, subpath, nil
+}
+
+// jsrNPMName maps a JSR package to its npm compatibility name, e.g.
+// "@std/path" to "@jsr/std__path"
+func jsrNPMName(name string) string {
+	scope, pkg, _ := strings.Cut(strings.TrimPrefix(name, "@"), "/")
+	return "@jsr/" + scope + "__" + pkg
+}
+
+// jsrNPMPackageManager returns a package manager that installs from JSR's npm
+// compatibility registry, sharing everything else with the loader's config
+func (l *ModuleLoader) jsrNPMPackageManager() (*NPMPackageManager, error) {
+	cfg := *l.config
+	cfg.registry = jsrNPMRegistry
+	// npm mirrors don't carry the @jsr scope
+	cfg.fallbacks = nil
+	return newNPMPackageManager(&cfg)
+}
+
+// loadJSRModule loads a module from the JSR registry. With WithJSRNpmCompat
+// the package is installed as an npm tarball from npm.jsr.io; otherwise the
+// file is resolved through the package's meta.json and fetched from jsr.io.
+func (l *ModuleLoader) loadJSRModule(ctx context.Context, url string, reinstall bool) (*Module, error) {
+	name, version, subpath, err := parseJSRSpecifier(url)
+	if err != nil {
+		return nil, err
+	}
+
+	if l.config.jsrNPMCompat {
+		pm, err := l.jsrNPMPackageManager()
+		if err != nil {
+			return nil, errors.Wrap(errors.ErrPackageInstall, err.Error())
+		}
+		pm.reinstall = pm.reinstall || reinstall
+		// load has already applied the reload matcher to url
+		pm.reload = nil
+		return l.loadPackageModule(ctx, pm, url, jsrNPMName(name), version, subpath, TypeJSR)
+	}
+
+	fileURL, resolved, err := l.resolveJSRFile(ctx, name, version, subpath)
+	if err != nil {
+		if errors.Is(err, errors.ErrModuleNotFound) {
+			l.negative.add(url)
+		}
+		return nil, err
+	}
+
+	content, err := l.fetchJSR(ctx, fileURL, l.config.timeouts.CDN)
+	if err != nil {
+		return nil, err
+	}
+
+	module := &Module{
+		URL:       url,
+		Content:   string(content),
+		Type:      TypeJSR,
+		MediaType: mediaTypeFromPath(fileURL),
+		// JSR only publishes ES modules
+		Format:          FormatESM,
+		ResolvedVersion: resolved,
+	}
+	module.SourceMapURL, module.SourceMap = resolveSourceMap(module.Content, fileURL)
+	return module, nil
+}
+
+// resolveJSRFile resolves a JSR package version and export subpath to the
+// URL of the file that implements it and the concrete version it belongs to
+func (l *ModuleLoader) resolveJSRFile(ctx context.Context, name, version, subpath string) (fileURL, resolved string, err error) {
+	base := jsrRegistry + "/" + name
+
+	var meta jsrMeta
+	if err := l.fetchJSRJSON(ctx, base+"/meta.json", &meta); err != nil {
+		return "", "", err
+	}
+	resolved, err = meta.resolve(name, version)
+	if err != nil {
+		return "", "", err
+	}
+
+	var versionMeta jsrVersionMeta
+	if err := l.fetchJSRJSON(ctx, fmt.Sprintf("%s/%s_meta.json", base, resolved), &versionMeta); err != nil {
+		return "", "", err
+	}
+
+	key := "."
+	if subpath != "" {
+		key = "./" + subpath
+	}
+	file, ok := versionMeta.Exports[key]
+	if !ok {
+		return "", "", errors.Wrap(errors.ErrModuleNotFound, fmt.Sprintf("%s@%s does not export %q", name, resolved, key))
+	}
+
+	return fmt.Sprintf("%s/%s/%s", base, resolved, strings.TrimPrefix(file, "./")), resolved, nil
+}
+
+// resolve picks the version of a JSR package that spec selects: "latest", an
+// exact version or a range. Yanked versions are only used when named exactly.
+func (m *jsrMeta) resolve(name, spec string) (string, error) {
+	if spec == "latest" && m.Latest != "" {
+		return m.Latest, nil
+	}
+	if _, ok := m.Versions[spec]; ok {
+		return spec, nil
+	}
+
+	if r, ok := parseRange(spec); ok {
+		available := make([]string, 0, len(m.Versions))
+		for v, info := range m.Versions {
+			if !info.Yanked {
+				available = append(available, v)
+			}
+		}
+		if version, ok := maxSatisfying(available, r); ok {
+			return version, nil
+		}
+	}
+	return "", errors.Wrap(errors.ErrVersionNotFound, fmt.Sprintf("no version of %s satisfies %q", name, spec))
+}
+
+// fetchJSRJSON fetches and decodes a JSR metadata document
+func (l *ModuleLoader) fetchJSRJSON(ctx context.Context, url string, v any) error {
+	data, err := l.fetchJSR(ctx, url, l.config.timeouts.Metadata)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return errors.Wrap(errors.ErrModuleFetch, fmt.Sprintf("failed to parse %s: %v", url, err))
+	}
+	return nil
+}
+
+// fetchJSR GETs a file from the JSR registry. A 404 is reported as
+// errors.ErrModuleNotFound.
+func (l *ModuleLoader) fetchJSR(ctx context.Context, url string, timeout time.Duration) ([]byte, error) {
+	if err := l.config.permissions.checkNet(url); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrModuleFetch, err.Error())
+	}
+
+	resp, err := l.httpClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrModuleFetch, err.Error())
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, errors.Wrap(errors.ErrModuleNotFound, url)
+	case resp.StatusCode != http.StatusOK:
+		return nil, errors.Wrap(errors.ErrModuleFetch, fmt.Sprintf("GET %s: %s", url, resp.Status))
+	}
+
+	return readModuleBody(resp, l.config.maxModuleSize)
+}
+
+// jsrExists checks whether a JSR package, version and export exist
+func (l *ModuleLoader) jsrExists(ctx context.Context, url string) (bool, error) {
+	name, version, subpath, err := parseJSRSpecifier(url)
+	if err != nil {
+		return false, err
+	}
+
+	if l.config.jsrNPMCompat {
+		pm, err := l.jsrNPMPackageManager()
+		if err != nil {
+			return false, errors.Wrap(errors.ErrPackageInstall, err.Error())
+		}
+		return l.packageExists(ctx, pm, url, jsrNPMName(name), version, subpath)
+	}
+
+	_, _, err = l.resolveJSRFile(ctx, name, version, subpath)
+	switch {
+	case errors.Is(err, errors.ErrModuleNotFound):
+		l.negative.add(url)
+		return false, nil
+	case errors.Is(err, errors.ErrVersionNotFound):
+		return false, nil
+	case err != nil:
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,86 @@
+package loader
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// defaultMaxConcurrency is how many module loads batch, graph and prefetch
+// operations run at once between them
+const defaultMaxConcurrency = 8
+
+// acquire takes one of the slots shared by the loader's fan-out operations,
+// waiting until one is free or ctx is done. The returned func gives it back.
+func (c *config) acquire(ctx context.Context) (release func(), err error) {
+	select {
+	case c.slots <- struct{}{}:
+		return func() { <-c.slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// withHostLimit returns a copy of client that has at most perHost requests
+// in flight to any one host. A request holds its slot until its response
+// body is closed. The caller's client is left untouched.
+func withHostLimit(client *http.Client, perHost int) *http.Client {
+	if perHost <= 0 {
+		return client
+	}
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	wrapped := *client
+	wrapped.Transport = &hostLimitTransport{base: base, perHost: perHost, hosts: make(map[string]chan struct{})}
+	return &wrapped
+}
+
+// hostLimitTransport bounds the requests in flight to each host
+type hostLimitTransport struct {
+	base    http.RoundTripper
+	perHost int
+
+	mu    sync.Mutex
+	hosts map[string]chan struct{}
+}
+
+func (t *hostLimitTransport) CloseIdleConnections() { closeIdleConnections(t.base) }
+
+func (t *hostLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	slots, ok := t.hosts[req.URL.Host]
+	if !ok {
+		slots = make(chan struct{}, t.perHost)
+		t.hosts[req.URL.Host] = slots
+	}
+	t.mu.Unlock()
+
+	select {
+	case slots <- struct{}{}:
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	}
+	release := sync.OnceFunc(func() { <-slots })
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
+
+// releasingBody gives back a host slot once the response body is closed
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releasingBody) Close() error {
+	defer b.release()
+	return b.ReadCloser.Close()
+}
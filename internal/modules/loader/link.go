@@ -0,0 +1,73 @@
+package loader
+
+import (
+	"context"
+	"strings"
+)
+
+// LinkedModule is a module ready for a runtime that resolves nothing itself:
+// each of its import specifiers is rewritten to the URL of another
+// LinkedModule
+type LinkedModule struct {
+	URL    string
+	Source string
+}
+
+// Link loads entry and everything it imports, directly or not, as LoadGraph
+// does, so permissions, WithAllowedRoots, the import map and locked hashes
+// apply to every import. It returns the modules with their imports rewritten
+// to the URLs they resolved to, entry first. JSON modules become ES modules
+// exporting the document as their default; WebAssembly modules are left out,
+// since they can't be evaluated as JavaScript.
+func (l *ModuleLoader) Link(ctx context.Context, entry string) ([]LinkedModule, error) {
+	entry = l.normalize(entry)
+	graph, err := l.LoadGraph(ctx, entry)
+	if err != nil {
+		return nil, err
+	}
+
+	// A module reached through a symlink is linked to the copy the graph
+	// stored, as LoadGraph records in Dependencies
+	stored := make(map[string]string, len(graph))
+	for url := range graph {
+		if key, err := graphKey(url); err == nil {
+			stored[key] = url
+		}
+	}
+
+	linked := make([]LinkedModule, 0, len(graph))
+	add := func(url string, module *Module) error {
+		if module.MediaType == MediaJSON {
+			linked = append(linked, LinkedModule{URL: url, Source: "export default " + strings.TrimSpace(module.Content) + ";\n"})
+			return nil
+		}
+		source, err := l.RewriteImports(module, func(specifier string) string {
+			resolved, err := l.ResolveImport(module, specifier)
+			if err != nil {
+				return specifier
+			}
+			if key, err := graphKey(resolved); err == nil && stored[key] != "" {
+				return stored[key]
+			}
+			return resolved
+		})
+		if err != nil {
+			return err
+		}
+		linked = append(linked, LinkedModule{URL: url, Source: source})
+		return nil
+	}
+
+	if err := add(entry, graph[entry]); err != nil {
+		return nil, err
+	}
+	for url, module := range graph {
+		if url == entry || module.MediaType == MediaWasm {
+			continue
+		}
+		if err := add(url, module); err != nil {
+			return nil, err
+		}
+	}
+	return linked, nil
+}
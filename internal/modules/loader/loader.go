@@ -2,21 +2,78 @@ package loader
 
 import (
 	"context"
-	"io"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/katungi/edon/internal/errors"
 )
 
-// ModuleCache represents a thread-safe cache for loaded modules
+// cacheKey identifies a module in the in-memory cache. Keying on the package
+// type as well as the URL keeps specifiers that happen to share a string
+// (e.g. "npm:foo" and a local file of that name) from sharing an entry.
+type cacheKey struct {
+	packageType PackageType
+	url         string
+}
+
+// newCacheKey builds the cache key for a normalized specifier. Local paths
+// are made absolute and cleaned so "./a.js" and its absolute path share an
+// entry.
+func newCacheKey(packageType PackageType, url string) cacheKey {
+	if packageType == TypeLocal {
+		if abs, err := filepath.Abs(url); err == nil {
+			url = abs
+		}
+	}
+	return cacheKey{packageType: packageType, url: url}
+}
+
+// ModuleCache represents a thread-safe cache for loaded modules. A nil
+// cache, as used with WithNoCache, stores nothing.
 type ModuleCache struct {
 	mu      sync.RWMutex
-	modules map[string]*Module
+	modules map[cacheKey]*Module
+}
+
+// get returns the cached module for key, or nil
+func (c *ModuleCache) get(key cacheKey) *Module {
+	if c == nil {
+		return nil
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.modules[key]
+}
+
+// set stores a module under key
+func (c *ModuleCache) set(key cacheKey, module *Module) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.modules[key] = module
+}
+
+// remove deletes the module stored under key, reporting whether it was present
+func (c *ModuleCache) remove(key cacheKey) bool {
+	if c == nil {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.modules[key]
+	delete(c.modules, key)
+	return ok
 }
 
 // Module represents a loaded module with its content and metadata
@@ -24,153 +81,718 @@ type Module struct {
 	URL     string
 	Content string
 	Type    PackageType
+	// MediaType records whether Content is JavaScript, TypeScript, JSON or WASM
+	MediaType MediaType
+	// RawBytes holds the binary of WASM modules, for runtimes that compile
+	// it; Content carries the same bytes. It is nil for other media types.
+	RawBytes []byte
+	// Format records whether the module is an ES module or CommonJS, when its
+	// extension or package settles it
+	Format ModuleFormat
+	// ResolvedVersion is the concrete version an npm: or jsr: specifier
+	// resolved to, or the tag of a deno.land module. It is empty for other
+	// local and CDN modules, and for unversioned JSR and deno.land modules
+	// served from the disk cache.
+	ResolvedVersion string
+	// ResolvedURL is the versioned URL an unversioned deno.land import was
+	// redirected to, for pinning it, the URL of the CDN that served a
+	// "cdn:" specifier, or the file an extensionless local import resolved
+	// to. deno.land redirects aren't kept in the disk cache.
+	ResolvedURL string
+
+	// SourceMapURL is the resolved location of the module's external source
+	// map, taken from its trailing sourceMappingURL comment
+	SourceMapURL string
+	// SourceMap holds the decoded JSON of an inline data: source map
+	SourceMap string
+
+	// Hash is the hex SHA-256 of the module's source as fetched, taken before
+	// any transpilation so it identifies the source of record
+	Hash string
+
+	// Dependencies lists the resolved URLs of the modules this one imports,
+	// in the order it imports them, each a key of the map LoadGraph returns
+	// when it loaded. Only LoadGraph fills it in; LoadModule leaves it nil
+	// rather than extract the imports of every module it loads.
+	Dependencies []string
+
+	// LoadedAt is when the module was fetched from its source or read from
+	// the disk cache
+	LoadedAt time.Time
+	// FromCache is set when LoadModule served the module from the in-memory
+	// or disk cache instead of its source
+	FromCache bool
+
+	// fetchedAt is when the module was fetched from its source, which
+	// WithCacheTTL measures its age from; zero when that isn't known
+	fetchedAt time.Time
+	// expiry is when a CDN module goes stale by its response's headers
+	expiry httpExpiry
+}
+
+// Integrity returns the module's hash in Subresource Integrity form
+// ("sha256-<base64>"), as used in lockfiles
+func (m *Module) Integrity() string {
+	sum, err := hex.DecodeString(m.Hash)
+	if err != nil || len(sum) == 0 {
+		return ""
+	}
+	return "sha256-" + base64.StdEncoding.EncodeToString(sum)
+}
+
+// resolvedURL returns the URL the module's content was actually served from
+func (m *Module) resolvedURL() string {
+	if m.ResolvedURL != "" {
+		return m.ResolvedURL
+	}
+	return m.URL
+}
+
+// hashContent returns the hex SHA-256 of content
+func hashContent(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
 }
 
 // ModuleLoader handles the loading of modules from various sources
 type ModuleLoader struct {
 	cache      *ModuleCache
+	disk       *diskCache
+	negative   *negativeCache
+	redirects  *redirectCache
+	builtins   *builtinRegistry
+	virtuals   *virtualRegistry
+	sources    *sourceRegistry
+	prefetcher *prefetcher
+	// reloaded holds the URLs WithReloadMatcher has already refreshed
+	reloaded   sync.Map
+	closed     atomic.Bool
+	config     *config
 	httpClient *http.Client
+	// revalidating holds the URLs WithStaleWhileRevalidate is fetching
+	// again in the background
+	revalidating sync.Map
 }
 
 // NewModuleLoader creates a new instance of ModuleLoader
-func NewModuleLoader() *ModuleLoader {
-	// #81: Don't use default HTTP client - configure timeouts
-	return &ModuleLoader{
+func NewModuleLoader(opts ...Option) *ModuleLoader {
+	cfg := newConfig(opts)
+
+	l := &ModuleLoader{
+		config:     cfg,
+		disk:       newDiskCache(cfg),
+		negative:   newNegativeCache(cfg.negativeTTL),
+		builtins:   newBuiltinRegistry(),
+		virtuals:   newVirtualRegistry(),
+		prefetcher: newPrefetcher(),
 		cache: &ModuleCache{
-			modules: make(map[string]*Module),
-		},
-		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
+			modules: make(map[cacheKey]*Module),
 		},
+		httpClient: cfg.httpClient,
+	}
+	l.redirects = newRedirectCache(l.disk)
+	if cfg.noCache {
+		l.cache, l.disk, l.negative, l.redirects = nil, nil, nil, nil
 	}
+	l.sources = newSourceRegistry(l)
+	return l
 }
 
 // LoadModule loads a module from the given URL, using cache if available
 func (l *ModuleLoader) LoadModule(ctx context.Context, urlStr string) (*Module, error) {
+	return l.load(ctx, urlStr, l.config.prefetchDepth, false)
+}
+
+// Reload fetches a module afresh, ignoring the in-memory and disk caches,
+// and replaces both with the result; npm and JSR packages are reinstalled.
+// Unlike Invalidate followed by LoadModule, the cached copy stays in place
+// until the new one is ready, so concurrent loads never refetch it and a
+// failed reload leaves it untouched.
+func (l *ModuleLoader) Reload(ctx context.Context, urlStr string) (*Module, error) {
+	return l.load(ctx, urlStr, l.config.prefetchDepth, true)
+}
+
+// load is LoadModule with the number of import levels still to prefetch.
+// reload skips the caches for this module only, as Reload does.
+func (l *ModuleLoader) load(ctx context.Context, urlStr string, prefetchDepth int, reload bool) (*Module, error) {
+	if l.closed.Load() {
+		return nil, errors.ErrLoaderClosed
+	}
+	specifier := urlStr
+	urlStr = l.normalize(urlStr)
+
 	// Validate the URL first
-	validation := ValidateURL(urlStr)
+	validation := l.validate(urlStr)
 	if !validation.IsValid {
 		return nil, validation.Error
 	}
 
-	// Check cache first
-	if module := l.getFromCache(urlStr); module != nil {
-		return module, nil
+	event := func(kind LoadEventKind) LoadEvent {
+		return LoadEvent{Kind: kind, Specifier: specifier, URL: urlStr, Type: validation.PackageType}
+	}
+	hit := func(cache string) {
+		if l.observed() {
+			e := event(EventCacheHit)
+			e.Cache = cache
+			l.emit(e)
+		}
 	}
 
-	// Load module based on its type
-	var module *Module
-	var err error
+	key := newCacheKey(validation.PackageType, urlStr)
+	reload = reload || l.reloading(urlStr)
+	// Set when the cached copy is past WithCacheTTL, so it's fetched again
+	expired := false
 
-	switch validation.PackageType {
-	case TypeLocal:
-		module, err = l.loadLocalModule(urlStr)
-	case TypeCDN:
-		module, err = l.loadCDNModule(ctx, urlStr)
-	case TypeNPM:
-		module, err = l.loadNPMModule(ctx, urlStr)
-	case TypeJSR:
-		module, err = l.loadJSRModule(ctx, urlStr)
+	switch {
+	case reload:
+		// Offline reloads of remote modules fail below, like any other fetch.
+		// The redirect is walked again in case it now points elsewhere.
+		l.redirects.remove(urlStr)
+	case l.config.cacheMode == CacheBypassRead:
+		// A bypass can never be satisfied without the network, so say so
+		// up front rather than failing on the first remote import
+		if l.config.offline {
+			return nil, errors.Wrap(errors.ErrOffline, "cache bypass requires network access")
+		}
 	default:
+		// Check cache first
+		if module := l.getFromCache(key); module != nil {
+			if l.servable(module, urlStr) {
+				hit(CacheMemory)
+				return module, nil
+			}
+			expired = true
+		}
+
+		// Remote modules may have been fetched by an earlier run
+		module := l.getFromDisk(urlStr, validation.PackageType)
+		if module != nil && !l.servable(module, urlStr) {
+			module, expired = nil, true
+		}
+		if module != nil && l.checkModule(module) != nil {
+			l.disk.remove(urlStr)
+			module = nil
+		}
+		if module != nil {
+			if err := l.checkLocked(module); err != nil {
+				return nil, err
+			}
+			hit(CacheDisk)
+			module.LoadedAt, module.FromCache = time.Now(), true
+			l.warnUnversioned(module)
+			l.cache.set(key, module)
+			l.prefetch(ctx, module, prefetchDepth)
+			return module, nil
+		}
+
+		// Skip the network for modules that just came back 404
+		if l.negative.has(urlStr) {
+			hit(CacheNegative)
+			return nil, errors.Wrap(errors.ErrModuleNotFound, urlStr)
+		}
+	}
+	if expired {
+		// Refreshed as a reload, so a redirect it followed is walked again
+		reload = true
+		l.redirects.remove(urlStr)
+	}
+	l.emit(event(EventCacheMiss))
+
+	// An in-memory loader has nothing to fall back on
+	if l.config.memoryOnly && validation.PackageType != TypeBuiltin && validation.PackageType != TypeVirtual {
+		return nil, errors.Wrap(errors.ErrNotSeeded, urlStr)
+	}
+
+	// Offline mode only serves remote modules that are already cached. Each
+	// CDN a "cdn:" specifier expands to is checked on its own.
+	if l.config.offline && isRemote(validation.PackageType) && !isCDNFallback(urlStr) {
+		return nil, errors.Wrap(errors.ErrOffline, urlStr)
+	}
+
+	// Load module from the first source that handles it
+	source, packageType := l.sources.find(urlStr)
+	if source == nil {
 		return nil, errors.ErrUnsupportedModule
 	}
 
+	l.emit(event(EventFetchStart))
+	start := time.Now()
+
+	module, err := l.fetch(ctx, source, packageType, urlStr, reload)
+
+	if l.observed() {
+		e := event(EventFetchEnd)
+		e.Duration, e.Err = time.Since(start), err
+		l.emit(e)
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	// Cache the loaded module
-	l.cache.mu.Lock()
-	l.cache.modules[urlStr] = module
-	l.cache.mu.Unlock()
+	// A "cdn:" specifier's module keeps the time and cache status of the CDN
+	// URL that served it
+	if module.LoadedAt.IsZero() {
+		module.LoadedAt = time.Now()
+	}
+	if module.fetchedAt.IsZero() {
+		module.fetchedAt = module.LoadedAt
+	}
+	l.warnUnversioned(module)
+	if err := checkJSON(module); err != nil {
+		return nil, err
+	}
+	if err := checkWasm(module); err != nil {
+		return nil, err
+	}
+	module.Hash = hashContent(module.Content)
+	if err := l.checkLocked(module); err != nil {
+		return nil, err
+	}
+	if err := l.transpile(module); err != nil {
+		return nil, err
+	}
+	if module, err = l.transform(ctx, module); err != nil {
+		return nil, err
+	}
+	if err := l.checkModule(module); err != nil {
+		return nil, err
+	}
 
+	// Cache the loaded module, as a copy so later hits report FromCache
+	// while this caller's module doesn't. A failed disk write only costs a
+	// refetch on the next run, so it doesn't fail the load.
+	cached := *module
+	cached.FromCache = true
+	l.cache.set(key, &cached)
+	if l.disk != nil && isRemote(module.Type) && !isCDNFallback(urlStr) {
+		if l.disk.set(urlStr, module.Content, module.Hash) == nil {
+			_ = l.disk.setFetched(urlStr, module.fetchedAt)
+			_ = l.disk.setExpiry(urlStr, module.expiry)
+		}
+	}
+	if reload {
+		l.negative.remove(urlStr)
+		l.reloaded.Store(urlStr, struct{}{})
+	}
+
+	l.prefetch(ctx, module, prefetchDepth)
 	return module, nil
 }
 
+// checkLocked fails with errors.ErrIntegrityMismatch when the module's
+// source doesn't match the hash WithLockedHashes pinned it to
+func (l *ModuleLoader) checkLocked(module *Module) error {
+	want, ok := l.config.lockedHashes[module.URL]
+	if !ok || want == module.Hash {
+		return nil
+	}
+	return errors.Wrap(errors.ErrIntegrityMismatch, fmt.Sprintf("%s: locked sha256 %s, got %s", module.URL, want, module.Hash))
+}
+
+// fetch loads url from source within the operation timeout, if one is set.
+// Only the fetch is bounded: cache hits are immediate, and prefetches started
+// afterwards get a timeout of their own.
+func (l *ModuleLoader) fetch(ctx context.Context, source Source, packageType PackageType, url string, reload bool) (*Module, error) {
+	if l.config.opTimeout <= 0 {
+		return l.loadFrom(ctx, source, packageType, url, reload)
+	}
+
+	opCtx, cancel := context.WithTimeout(ctx, l.config.opTimeout)
+	defer cancel()
+	module, err := l.loadFrom(opCtx, source, packageType, url, reload)
+	// The caller's own deadline or cancellation is reported as it is
+	if err != nil && ctx.Err() == nil && errors.Is(opCtx.Err(), context.DeadlineExceeded) {
+		return nil, errors.Wrap(errors.ErrModuleTimeout, fmt.Sprintf("%s took longer than %s", url, l.config.opTimeout))
+	}
+	return module, err
+}
+
+// reloading reports whether url matches WithReloadMatcher and hasn't been
+// refreshed by this loader yet, so its cached copies count as misses
+func (l *ModuleLoader) reloading(url string) bool {
+	if l.config.reloadMatcher == nil || !l.config.reloadMatcher(url) {
+		return false
+	}
+	_, done := l.reloaded.Load(url)
+	return !done
+}
+
+// normalize applies the import map, expands CDN shorthands and gives bare
+// builtins their node: prefix, producing the
+// URL a specifier is loaded and cached under
+func (l *ModuleLoader) normalize(specifier string) string {
+	return l.normalizeFrom(specifier, "")
+}
+
+// normalizeFrom is normalize for a specifier imported by the module at
+// importer, so the import map's scopes for importer apply
+func (l *ModuleLoader) normalizeFrom(specifier, importer string) string {
+	// The import map comes first so it can map to shorthands too
+	specifier = l.config.importMap.ResolveFrom(specifier, importer)
+	specifier, _ = expandCDNShorthand(specifier)
+	specifier = l.config.withCDNTarget(specifier)
+	return canonicalBuiltin(specifier)
+}
+
+// ResolveImport resolves an import of base's, as ResolveRelative does, then
+// applies the import map with the scopes that match base, returning the
+// specifier to load it by. Local imports without an extension, or of a
+// directory, resolve to a file as WithExtensions describes. With
+// WithNodeModules, a bare import of a local module left alone by the import
+// map resolves from node_modules.
+func (l *ModuleLoader) ResolveImport(base *Module, specifier string) (string, error) {
+	resolved, err := ResolveRelative(base, specifier)
+	if err != nil {
+		return "", err
+	}
+	importer := base.URL
+	// Local scopes are matched as absolute paths, as LoadImportMap writes them
+	if base.Type == TypeLocal {
+		if abs, err := filepath.Abs(importer); err == nil {
+			importer = abs
+		}
+	}
+	resolved = l.normalizeFrom(resolved, importer)
+	if base.Type == TypeLocal && isLocalPath(resolved) {
+		if file, ok := resolveLocalFile(resolved, l.config.extensionOrder()); ok {
+			return file, nil
+		}
+	}
+	if name, subpath, ok := splitBareSpecifier(resolved); ok && l.config.nodeModules && base.Type == TypeLocal {
+		if packagePath, ok := findNodeModule(filepath.Dir(importer), name); ok {
+			return nodeModuleFile(packagePath, l.config.conditions, subpath)
+		}
+	}
+	return resolved, nil
+}
+
 // getFromCache retrieves a module from the cache if it exists
-func (l *ModuleLoader) getFromCache(url string) *Module {
-	l.cache.mu.RLock()
-	defer l.cache.mu.RUnlock()
-	return l.cache.modules[url]
+func (l *ModuleLoader) getFromCache(key cacheKey) *Module {
+	return l.cache.get(key)
+}
+
+// getFromDisk retrieves a remote module from the disk cache if it exists
+func (l *ModuleLoader) getFromDisk(url string, packageType PackageType) *Module {
+	// "cdn:" specifiers are cached on disk under the URL of the CDN that won,
+	// which their own entry couldn't record
+	if l.disk == nil || !isRemote(packageType) || isCDNFallback(url) {
+		return nil
+	}
+	content, hash, ok, err := l.disk.get(url)
+	if err != nil {
+		l.emit(LoadEvent{Kind: EventCacheCorrupt, URL: url, Type: packageType, Err: err})
+	}
+	if !ok {
+		return nil
+	}
+	module := &Module{
+		URL:     url,
+		Content: content,
+		Type:    packageType,
+		Hash:    hash,
+		// Response headers aren't cached, so only the URL is left to go on
+		MediaType: mediaTypeFromPath(url),
+		Format:    formatFromPath(url),
+	}
+	if l.config.cacheTTL > 0 {
+		module.fetchedAt = l.disk.fetched(url)
+	}
+	if packageType == TypeCDN {
+		module.expiry = l.disk.expiry(url)
+		module.ResolvedVersion, _ = denoLandVersion(url)
+	}
+	if packageType == TypeJSR {
+		module.Format = FormatESM
+		// The cache doesn't record resolutions, but an exact version is its own
+		if version := ValidateURL(url).Version; version != "" {
+			if _, ok := parseVersion(version); ok {
+				module.ResolvedVersion = version
+			}
+		}
+	}
+	// Modules are cached after transpiling, so TypeScript is already JavaScript
+	if module.MediaType == MediaTypeScript && l.config.transpiler != nil {
+		module.MediaType = MediaJavaScript
+	}
+	if module.MediaType == MediaWasm {
+		module.RawBytes = []byte(content)
+	}
+	module.SourceMapURL, module.SourceMap = resolveSourceMap(content, url)
+	return module
+}
+
+// transpile replaces the content of TypeScript modules with the configured
+// transpiler's output and marks them as JavaScript
+func (l *ModuleLoader) transpile(module *Module) error {
+	if l.config.transpiler == nil || module.MediaType != MediaTypeScript {
+		return nil
+	}
+
+	content, err := l.config.transpiler(module.Content, string(module.MediaType))
+	if err != nil {
+		return errors.WrapWith(errors.ErrTranspile, err, module.URL)
+	}
+	module.Content = content
+	module.MediaType = MediaJavaScript
+	return nil
+}
+
+// isRemote reports whether modules of this type are fetched over the network
+// and therefore kept in the disk cache
+func isRemote(packageType PackageType) bool {
+	return packageType == TypeCDN || packageType == TypeJSR
+}
+
+// Invalidate drops a single module from the in-memory, disk and negative
+// caches so the next load fetches it again. It reports whether an entry was
+// present and removed.
+func (l *ModuleLoader) Invalidate(url string) bool {
+	url = l.normalize(url)
+	removed := l.cache.remove(newCacheKey(l.validate(url).PackageType, url))
+	if l.disk != nil && l.disk.remove(url) {
+		removed = true
+	}
+	if l.negative.remove(url) {
+		removed = true
+	}
+	l.redirects.remove(url)
+	return removed
 }
 
 // loadLocalModule loads a module from the local filesystem
-func (l *ModuleLoader) loadLocalModule(path string) (*Module, error) {
+func (l *ModuleLoader) loadLocalModule(ctx context.Context, path string) (*Module, error) {
 	absPath, err := filepath.Abs(path)
 	if err != nil {
 		return nil, errors.Wrap(errors.ErrModuleNotFound, err.Error())
 	}
 
-	content, err := os.ReadFile(absPath)
+	// An extensionless or directory import is read from the file it
+	// resolves to, which goes through the same checks
+	resolved := ""
+	if file, ok := resolveLocalFile(absPath, l.config.extensionOrder()); ok && file != absPath {
+		absPath, resolved = file, file
+	}
+	if err := checkSymlinkLoop(absPath); err != nil {
+		return nil, err
+	}
+
+	if err := checkAllowedPath(absPath, l.config.allowedRoots); err != nil {
+		return nil, err
+	}
+	if err := l.config.permissions.checkRead(absPath); err != nil {
+		return nil, err
+	}
+
+	content, err := readWithin(ctx, l.config.timeouts.Local, absPath, func() ([]byte, error) {
+		return readModuleFile(absPath, l.config.maxModuleSize)
+	})
 	if err != nil {
-		return nil, errors.Wrap(errors.ErrFileRead, err.Error())
+		return nil, err
 	}
 
-	return &Module{
-		URL:     path,
-		Content: string(content),
-		Type:    TypeLocal,
-	}, nil
+	module := &Module{
+		URL:         path,
+		Content:     string(content),
+		Type:        TypeLocal,
+		MediaType:   mediaTypeFromPath(absPath),
+		Format:      formatFromPath(absPath),
+		ResolvedURL: resolved,
+	}
+	module.SourceMapURL, module.SourceMap = resolveSourceMap(module.Content, absPath)
+	return module, nil
 }
 
 // loadCDNModule loads a module from a CDN
 func (l *ModuleLoader) loadCDNModule(ctx context.Context, url string) (*Module, error) {
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err := l.config.permissions.checkNet(url); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, l.config.timeouts.CDN)
+	defer cancel()
+
+	// A URL that redirected before is fetched from where it ended up. The
+	// target is checked again since the trusted hosts may have changed.
+	fetchURL := url
+	if target, ok := l.redirects.get(url); ok && l.config.cacheMode != CacheBypassRead {
+		if err := l.config.checkRedirect(url, target); err != nil {
+			return nil, err
+		}
+		if err := l.config.permissions.checkNet(target); err != nil {
+			return nil, err
+		}
+		fetchURL = target
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", fetchURL, nil)
 	if err != nil {
 		return nil, errors.Wrap(errors.ErrModuleNotFound, err.Error())
 	}
+	l.config.setCDNAccept(req)
 
-	resp, err := l.httpClient.Do(req)
+	// deno.land redirects unversioned imports to the latest release; the
+	// redirect is followed here so the versioned URL can be recorded
+	finalURL := fetchURL
+	secure := recordRedirects(l.config.secureRedirects(l.httpClient), &finalURL)
+	client := secure
+	if isUnversionedDenoLand(fetchURL) {
+		client = withoutRedirects(l.httpClient)
+	}
+	resp, err := client.Do(req)
 	if err != nil {
+		if errors.Is(err, errors.ErrInsecureURL) {
+			return nil, err
+		}
 		return nil, errors.Wrap(errors.ErrModuleNotFound, err.Error())
 	}
+	if target, ok := redirectTarget(resp, fetchURL); ok && client != secure {
+		resp.Body.Close()
+		if err := l.config.checkRedirect(url, target); err != nil {
+			return nil, err
+		}
+		if err := l.config.permissions.checkNet(target); err != nil {
+			return nil, err
+		}
+		if req, err = http.NewRequestWithContext(ctx, "GET", target, nil); err != nil {
+			return nil, errors.Wrap(errors.ErrModuleNotFound, err.Error())
+		}
+		l.config.setCDNAccept(req)
+		finalURL = target
+		if resp, err = secure.Do(req); err != nil {
+			if errors.Is(err, errors.ErrInsecureURL) {
+				return nil, err
+			}
+			return nil, errors.Wrap(errors.ErrModuleNotFound, err.Error())
+		}
+	}
 	defer resp.Body.Close()
 
-	content, err := io.ReadAll(resp.Body)
+	// A remembered target that stopped working may have moved, so the
+	// original URL gets a chance to redirect somewhere else
+	if fetchURL != url && resp.StatusCode != http.StatusOK {
+		l.redirects.remove(url)
+		return l.loadCDNModule(ctx, url)
+	}
+
+	// Only a definitive 404 is remembered; server errors may be transient
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		l.negative.add(url)
+		return nil, errors.Wrap(errors.ErrModuleNotFound, url)
+	case resp.StatusCode != http.StatusOK:
+		return nil, errors.Wrap(errors.ErrModuleFetch, fmt.Sprintf("GET %s: %s", url, resp.Status))
+	}
+
+	content, err := readModuleBody(resp, l.config.maxModuleSize)
 	if err != nil {
-		return nil, errors.Wrap(errors.ErrFileRead, err.Error())
+		return nil, err
+	}
+	if err := l.config.checkHTML(resp, url, content); err != nil {
+		return nil, err
 	}
 
-	return &Module{
-		URL:     url,
-		Content: string(content),
-		Type:    TypeCDN,
-	}, nil
+	resolvedURL := ""
+	if finalURL != url {
+		resolvedURL = finalURL
+		l.redirects.set(url, finalURL)
+	}
+	module := &Module{
+		URL:         url,
+		Content:     string(content),
+		Type:        TypeCDN,
+		MediaType:   detectMediaType(resp.Header.Get("Content-Type"), url),
+		Format:      formatFromPath(url),
+		ResolvedURL: resolvedURL,
+		expiry:      parseExpiry(resp.Header, time.Now()),
+	}
+	module.ResolvedVersion, _ = denoLandVersion(module.resolvedURL())
+	module.SourceMapURL, module.SourceMap = resolveSourceMap(module.Content, module.resolvedURL())
+	return module, nil
 }
 
-// loadNPMModule loads a module from NPM registry
-func (l *ModuleLoader) loadNPMModule(ctx context.Context, url string) (*Module, error) {
-	// Extract package name from npm: URL
-	packageName := strings.TrimPrefix(url, "npm:")
+// loadNPMModule loads a module from NPM registry. Specifiers may name a file
+// inside the package, e.g. "npm:lodash/fp" or "npm:@scope/pkg@1.0.0/sub.js".
+func (l *ModuleLoader) loadNPMModule(ctx context.Context, url string, reinstall bool) (*Module, error) {
+	spec := ValidateURL(url)
 
 	// Initialize NPM package manager
-	pm, err := NewNPMPackageManager()
+	pm, err := newNPMPackageManager(l.config)
 	if err != nil {
 		return nil, errors.Wrap(errors.ErrPackageInstall, err.Error())
 	}
+	pm.reinstall = pm.reinstall || reinstall
+	// load has already applied the reload matcher to url
+	pm.reload = nil
+
+	return l.loadPackageModule(ctx, pm, url, spec.Name, spec.Version, spec.Subpath, TypeNPM)
+}
 
+// packageModuleFormat returns the format of file inside the package installed
+// at packagePath. As in Node, the nearest package.json's "type" field decides,
+// so dual packages can mark a subdirectory as ESM. JSR only publishes ES
+// modules, whatever its npm compatibility tarballs say.
+func packageModuleFormat(packagePath, file string, packageType PackageType) (ModuleFormat, error) {
+	if packageType == TypeJSR {
+		return FormatESM, nil
+	}
+	dir := filepath.Dir(file)
+	for ; dir != packagePath; dir = filepath.Dir(dir) {
+		if !strings.HasPrefix(dir, packagePath) {
+			dir = packagePath
+			break
+		}
+		if _, err := os.Stat(filepath.Join(dir, "package.json")); err == nil {
+			break
+		}
+	}
+	manifest, err := readPackageManifest(dir)
+	if brokenManifest(err) {
+		// resolveEntry has already warned; the extension still says something
+		return packageFormat(file, ""), nil
+	}
+	if err != nil {
+		return FormatUnknown, err
+	}
+	return packageFormat(file, manifest.Type), nil
+}
+
+// loadPackageModule installs name@version with pm and loads subpath from it
+func (l *ModuleLoader) loadPackageModule(ctx context.Context, pm *NPMPackageManager, url, name, version, subpath string, packageType PackageType) (*Module, error) {
 	// Install the package
-	packagePath, err := pm.InstallPackage(ctx, packageName)
+	installed, err := pm.InstallPackage(ctx, name+"@"+version)
 	if err != nil {
-		return nil, errors.Wrap(errors.ErrPackageInstall, err.Error())
+		// The registry only reports a missing package with a 404
+		if errors.Is(err, errors.ErrPackageNotFound) {
+			l.negative.add(url)
+		}
+		return nil, errors.WrapWith(errors.ErrPackageInstall, err, "")
 	}
 
-	// Read the package's main file
-	mainFile := filepath.Join(packagePath, "index.js")
-	content, err := os.ReadFile(mainFile)
+	// Resolve the requested file relative to the package root
+	file, err := l.resolveEntry(url, installed.Path, subpath)
+	if errors.Is(err, errors.ErrModuleExcluded) {
+		return excludedModule(url, packageType, installed.Version), nil
+	}
 	if err != nil {
-		return nil, errors.Wrap(errors.ErrFileRead, err.Error())
+		return nil, err
 	}
 
-	return &Module{
-		URL:     url,
-		Content: string(content),
-		Type:    TypeNPM,
-	}, nil
-}
+	content, err := readModuleFile(file, l.config.maxModuleSize)
+	if err != nil {
+		return nil, err
+	}
 
-// loadJSRModule loads a module from JSR registry
-func (l *ModuleLoader) loadJSRModule(ctx context.Context, url string) (*Module, error) {
-	// TODO: Implement JSR module loading
-	return nil, errors.ErrJSRNotImplemented
+	module := &Module{
+		URL:             url,
+		Content:         string(content),
+		Type:            packageType,
+		MediaType:       mediaTypeFromPath(file),
+		ResolvedVersion: installed.Version,
+	}
+	module.Format, err = packageModuleFormat(installed.Path, file, packageType)
+	if err != nil {
+		return nil, err
+	}
+	// Maps shipped inside a package sit next to the resolved file, not the specifier
+	module.SourceMapURL, module.SourceMap = resolveSourceMap(module.Content, file)
+	return module, nil
 }
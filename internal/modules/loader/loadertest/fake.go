@@ -0,0 +1,210 @@
+// Package loadertest provides a fake loader.PackageInstaller for tests of
+// code that installs npm packages, so they run without a registry.
+package loadertest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/katungi/edon/internal/errors"
+	"github.com/katungi/edon/internal/modules/loader"
+)
+
+// Package is a package FakePackageManager can install: its package.json and
+// the rest of its files, by slash-separated path
+type Package struct {
+	Name        string
+	Version     string
+	PackageJSON string
+	Files       map[string]string
+}
+
+// NewPackage assembles a package from its package.json, which must name it
+// and give an exact version, and its other files
+func NewPackage(packageJSON string, files map[string]string) (*Package, error) {
+	var manifest struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	}
+	if err := json.Unmarshal([]byte(packageJSON), &manifest); err != nil {
+		return nil, errors.Wrap(errors.ErrInvalidPackage, err.Error())
+	}
+	if err := loader.ValidatePackageName(manifest.Name); err != nil {
+		return nil, err
+	}
+	if err := loader.ValidateVersion(manifest.Version); err != nil {
+		return nil, err
+	}
+	return &Package{Name: manifest.Name, Version: manifest.Version, PackageJSON: packageJSON, Files: files}, nil
+}
+
+// Call is one call made to a FakePackageManager, with its string arguments
+type Call struct {
+	Method string
+	Args   []string
+}
+
+// FakePackageManager is a loader.PackageInstaller that installs packages
+// registered with Add, resolving versions, ranges and "latest" among them as
+// the registry would. Installed packages are written under its directory so
+// their Paths are real. It records every call and is safe for concurrent use.
+type FakePackageManager struct {
+	dir string
+
+	mu        sync.Mutex
+	available map[string][]*Package
+	installed map[string]*loader.InstalledPackage
+	calls     []Call
+}
+
+var _ loader.PackageInstaller = (*FakePackageManager)(nil)
+
+// NewFakePackageManager returns a FakePackageManager that installs into dir,
+// typically a t.TempDir(), with packages available to install
+func NewFakePackageManager(dir string, packages ...*Package) *FakePackageManager {
+	fake := &FakePackageManager{
+		dir:       dir,
+		available: make(map[string][]*Package),
+		installed: make(map[string]*loader.InstalledPackage),
+	}
+	fake.Add(packages...)
+	return fake
+}
+
+// Add makes packages available to install, replacing any registered at the
+// same name and version
+func (f *FakePackageManager) Add(packages ...*Package) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, pkg := range packages {
+		versions := slices.DeleteFunc(f.available[pkg.Name], func(p *Package) bool {
+			return p.Version == pkg.Version
+		})
+		f.available[pkg.Name] = append(versions, pkg)
+	}
+}
+
+// Calls returns the calls made so far, oldest first
+func (f *FakePackageManager) Calls() []Call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.calls)
+}
+
+// record notes a call; f.mu must be held
+func (f *FakePackageManager) record(method string, args ...string) {
+	f.calls = append(f.calls, Call{Method: method, Args: args})
+}
+
+// InstallPackage writes the registered package packageName resolves to
+// under the fake's directory. An unregistered name or a version none of its
+// packages satisfy is errors.ErrPackageNotFound or errors.ErrVersionNotFound,
+// as from the registry.
+func (f *FakePackageManager) InstallPackage(ctx context.Context, packageName string) (*loader.InstalledPackage, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("InstallPackage", packageName)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	name, spec, _ := loader.ParseNPMSpecifier(packageName)
+	if err := loader.ValidatePackageName(name); err != nil {
+		return nil, err
+	}
+	packages, ok := f.available[name]
+	if !ok {
+		return nil, errors.Wrap(errors.ErrPackageNotFound, name)
+	}
+	versions := make([]string, 0, len(packages))
+	for _, pkg := range packages {
+		versions = append(versions, pkg.Version)
+	}
+	version, ok := loader.MaxSatisfying(versions, spec)
+	if !ok {
+		return nil, errors.Wrap(errors.ErrVersionNotFound, fmt.Sprintf("%s@%s", name, spec))
+	}
+
+	key := name + "@" + version
+	if installed, ok := f.installed[key]; ok {
+		cached := *installed
+		cached.FromCache = true
+		return &cached, nil
+	}
+	pkg := packages[slices.IndexFunc(packages, func(p *Package) bool { return p.Version == version })]
+	dir := filepath.Join(f.dir, filepath.FromSlash(name), version)
+	files := map[string]string{"package.json": pkg.PackageJSON}
+	var size int64
+	for file, content := range pkg.Files {
+		files[file] = content
+	}
+	for file, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(file))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, errors.Wrap(errors.ErrCacheDir, err.Error())
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			return nil, errors.Wrap(errors.ErrPackageInstall, err.Error())
+		}
+		size += int64(len(content))
+	}
+
+	installed := &loader.InstalledPackage{Name: name, Version: version, Path: dir, Bytes: size}
+	f.installed[key] = installed
+	result := *installed
+	return &result, nil
+}
+
+// UninstallPackage removes "name@version", or every installed version of a
+// bare "name", returning errors.ErrPackageNotFound if none was installed
+func (f *FakePackageManager) UninstallPackage(ctx context.Context, packageName string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("UninstallPackage", packageName)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	removed := false
+	for key, pkg := range f.installed {
+		if key != packageName && pkg.Name != packageName {
+			continue
+		}
+		if err := os.RemoveAll(pkg.Path); err != nil {
+			return errors.Wrap(errors.ErrCacheDir, err.Error())
+		}
+		delete(f.installed, key)
+		removed = true
+	}
+	if !removed {
+		return errors.Wrap(errors.ErrPackageNotFound, fmt.Sprintf("%s is not installed", packageName))
+	}
+	return nil
+}
+
+// ListInstalled returns the installed packages, sorted by name then version
+func (f *FakePackageManager) ListInstalled() ([]*loader.InstalledPackage, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("ListInstalled")
+
+	installed := make([]*loader.InstalledPackage, 0, len(f.installed))
+	for _, pkg := range f.installed {
+		listed := *pkg
+		listed.FromCache = true
+		installed = append(installed, &listed)
+	}
+	slices.SortFunc(installed, func(a, b *loader.InstalledPackage) int {
+		if c := strings.Compare(a.Name, b.Name); c != 0 {
+			return c
+		}
+		return loader.CompareVersions(a.Version, b.Version)
+	})
+	return installed, nil
+}
@@ -0,0 +1,113 @@
+package loader
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/katungi/edon/internal/errors"
+)
+
+// IsLocalPackage reports whether spec names a package on disk, either a
+// directory given as a path or a .tgz tarball, rather than one in the registry
+func IsLocalPackage(spec string) bool {
+	return isLocalPath(spec) || strings.HasSuffix(spec, ".tgz") || strings.HasSuffix(spec, ".tar.gz")
+}
+
+// InstallLocal installs an unpublished package from a directory or an npm
+// tarball without contacting the registry. It is cached under the name and
+// version from its package.json, replacing any earlier copy, since a local
+// build can change without a version bump. Directories are copied without
+// their node_modules and .git.
+func (pm *NPMPackageManager) InstallLocal(path string) (*InstalledPackage, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrPackageNotFound, err.Error())
+	}
+	if err := pm.permissions.checkRead(absPath); err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(absPath)
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrPackageNotFound, err.Error())
+	}
+
+	staging, err := os.MkdirTemp(pm.cacheDir, ".local-*")
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrCacheDir, err.Error())
+	}
+	// A no-op once the rename has succeeded
+	defer os.RemoveAll(staging)
+	if err := os.Chmod(staging, 0755); err != nil {
+		return nil, errors.Wrap(errors.ErrCacheDir, err.Error())
+	}
+
+	if info.IsDir() {
+		err = copyPackageDir(absPath, staging)
+	} else {
+		err = extractTarball(context.Background(), absPath, staging)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, err := readPackageManifest(staging)
+	if err != nil {
+		return nil, err
+	}
+	if manifest.Name == "" || !isExactVersion(manifest.Version) {
+		return nil, errors.Wrap(errors.ErrInvalidPackage, path+": package.json must declare a name and a version")
+	}
+
+	cachePath := filepath.Join(pm.cacheDir, manifest.Name, manifest.Version)
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err != nil {
+		return nil, errors.Wrap(errors.ErrCacheDir, err.Error())
+	}
+	if err := os.Rename(staging, cachePath); err != nil {
+		if _, statErr := os.Stat(cachePath); statErr != nil {
+			return nil, errors.Wrap(errors.ErrCacheDir, err.Error())
+		}
+		if err := replaceDir(staging, cachePath); err != nil {
+			return nil, err
+		}
+	}
+
+	return pm.finishInstall(&InstalledPackage{Name: manifest.Name, Version: manifest.Version, Path: cachePath})
+}
+
+// copyPackageDir copies the regular files of a package directory into dest,
+// skipping installed dependencies, version control data and symlinks
+func copyPackageDir(src, dest string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return errors.Wrap(errors.ErrFileRead, err.Error())
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return errors.Wrap(errors.ErrFileRead, err.Error())
+		}
+		if d.IsDir() {
+			// dest may sit inside src when the cache lives in the project
+			if path == dest || d.Name() == "node_modules" || d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return errors.Wrap(errors.ErrFileRead, err.Error())
+		}
+		in, err := os.Open(path)
+		if err != nil {
+			return errors.Wrap(errors.ErrFileRead, err.Error())
+		}
+		defer in.Close()
+		return writeTarEntry(in, filepath.Join(dest, rel), info.Mode())
+	})
+}
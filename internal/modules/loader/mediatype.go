@@ -0,0 +1,164 @@
+package loader
+
+import (
+	"encoding/json"
+	"mime"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/katungi/edon/internal/errors"
+)
+
+// MediaType identifies the language of a module's content so the runtime can
+// decide whether it needs transpiling or special handling
+type MediaType string
+
+const (
+	MediaUnknown    MediaType = ""
+	MediaJavaScript MediaType = "js"
+	MediaTypeScript MediaType = "ts"
+	MediaJSON       MediaType = "json"
+	MediaWasm       MediaType = "wasm"
+)
+
+// contentTypes maps normalized Content-Type values to media types
+var contentTypes = map[string]MediaType{
+	"application/javascript":   MediaJavaScript,
+	"application/x-javascript": MediaJavaScript,
+	"application/ecmascript":   MediaJavaScript,
+	"text/javascript":          MediaJavaScript,
+	"text/ecmascript":          MediaJavaScript,
+	"text/jsx":                 MediaJavaScript,
+	"application/typescript":   MediaTypeScript,
+	"application/x-typescript": MediaTypeScript,
+	"text/typescript":          MediaTypeScript,
+	"text/tsx":                 MediaTypeScript,
+	"application/json":         MediaJSON,
+	"text/json":                MediaJSON,
+	"application/wasm":         MediaWasm,
+}
+
+// extensionTypes maps file extensions to media types
+var extensionTypes = map[string]MediaType{
+	".js":   MediaJavaScript,
+	".mjs":  MediaJavaScript,
+	".cjs":  MediaJavaScript,
+	".jsx":  MediaJavaScript,
+	".ts":   MediaTypeScript,
+	".mts":  MediaTypeScript,
+	".cts":  MediaTypeScript,
+	".tsx":  MediaTypeScript,
+	".json": MediaJSON,
+	".wasm": MediaWasm,
+}
+
+// ModuleFormat identifies the module system a JavaScript module is written
+// for, which decides how the runtime wraps its content
+type ModuleFormat string
+
+const (
+	// FormatUnknown modules give no sign either way, such as a plain .js
+	// file outside a package
+	FormatUnknown  ModuleFormat = ""
+	FormatESM      ModuleFormat = "esm"
+	FormatCommonJS ModuleFormat = "commonjs"
+)
+
+// formatFromPath returns the module format implied by the extension of a
+// file path or URL. Only .mjs and .cjs (and their TypeScript counterparts)
+// settle it; everything else is FormatUnknown.
+func formatFromPath(location string) ModuleFormat {
+	switch extensionOf(location) {
+	case ".mjs", ".mts":
+		return FormatESM
+	case ".cjs", ".cts":
+		return FormatCommonJS
+	}
+	return FormatUnknown
+}
+
+// packageFormat returns the format of a file inside an npm package whose
+// package.json has the given "type" field. As in Node, ambiguous JavaScript
+// and TypeScript files are ES modules under "type": "module" and CommonJS
+// otherwise.
+func packageFormat(location, packageType string) ModuleFormat {
+	if format := formatFromPath(location); format != FormatUnknown {
+		return format
+	}
+	switch mediaTypeFromPath(location) {
+	case MediaJavaScript, MediaTypeScript:
+		if packageType == "module" {
+			return FormatESM
+		}
+		return FormatCommonJS
+	}
+	return FormatUnknown
+}
+
+// detectMediaType determines a module's media type from its Content-Type
+// header, falling back to the extension of location when the header is
+// missing or too generic to trust
+func detectMediaType(contentType, location string) MediaType {
+	if contentType != "" {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err == nil {
+			if t, ok := contentTypes[mediaType]; ok {
+				return t
+			}
+			// Structured syntax suffixes such as application/manifest+json
+			if strings.HasSuffix(mediaType, "+json") {
+				return MediaJSON
+			}
+			// Servers without TypeScript registered map .ts to MPEG
+			// transport streams (video/mp2t), plain text or octet-stream;
+			// the extension is a better signal for all of those
+		}
+	}
+	return mediaTypeFromPath(location)
+}
+
+// mediaTypeFromPath returns the media type implied by the extension of a file
+// path or URL, ignoring any query string or fragment
+func mediaTypeFromPath(location string) MediaType {
+	return extensionTypes[extensionOf(location)]
+}
+
+// extensionOf returns the lowercased extension of a file path or URL,
+// ignoring any query string or fragment
+func extensionOf(location string) string {
+	p := location
+	if u, err := url.Parse(location); err == nil && u.Scheme != "" && len(u.Scheme) > 1 {
+		p = u.Path
+	}
+	return strings.ToLower(path.Ext(strings.ReplaceAll(p, "\\", "/")))
+}
+
+// checkJSON rejects JSON modules whose content doesn't parse, so the runtime
+// can safely expose them as a default export
+func checkJSON(module *Module) error {
+	if module.MediaType != MediaJSON {
+		return nil
+	}
+	var raw json.RawMessage
+	if err := json.Unmarshal([]byte(module.Content), &raw); err != nil {
+		return errors.WrapWith(errors.ErrInvalidJSON, err, module.URL)
+	}
+	return nil
+}
+
+// wasmMagic opens every WebAssembly binary
+const wasmMagic = "\x00asm"
+
+// checkWasm rejects WASM modules that don't start with the WebAssembly magic
+// number and exposes the bytes of those that do as RawBytes
+func checkWasm(module *Module) error {
+	if module.MediaType != MediaWasm {
+		return nil
+	}
+	if !strings.HasPrefix(module.Content, wasmMagic) {
+		return errors.Wrap(errors.ErrInvalidWasm, module.URL)
+	}
+	module.RawBytes = []byte(module.Content)
+	return nil
+}
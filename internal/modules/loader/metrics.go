@@ -0,0 +1,268 @@
+package loader
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/katungi/edon/internal/errors"
+)
+
+// fetchBuckets are the upper bounds of the fetch duration histogram, the
+// same as the Prometheus client's defaults
+var fetchBuckets = []time.Duration{
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// Metrics is a snapshot of the counters kept by a loader created
+// WithMetrics. Counters only ever grow for the life of the loader.
+type Metrics struct {
+	// CacheHits counts loads served from each cache layer, keyed by
+	// CacheMemory, CacheDisk and CacheNegative
+	CacheHits   map[string]int64
+	CacheMisses int64
+	// Fetches times the loads that missed the caches, by package type
+	Fetches map[PackageType]Histogram
+	// Retries counts rate-limited requests that were sent again
+	Retries int64
+	// BytesDownloaded counts response body bytes read, from registries,
+	// CDNs and tarball hosts alike
+	BytesDownloaded int64
+	// Errors counts failed fetches by errors.Code
+	Errors map[string]int64
+}
+
+// Histogram is a distribution of durations
+type Histogram struct {
+	Count int64
+	Sum   time.Duration
+	// Buckets are cumulative: each counts the observations at or below its
+	// bound, and the last bound is the largest finite one
+	Buckets []Bucket
+}
+
+// Bucket is one bound of a Histogram
+type Bucket struct {
+	UpperBound time.Duration
+	Count      int64
+}
+
+// WithMetrics makes the loader count cache hits and misses, fetch durations,
+// retries, bytes downloaded and errors. Read them with Metrics, or serve them
+// to Prometheus with MetricsHandler. Without it nothing is counted.
+func WithMetrics() Option {
+	return func(c *config) {
+		c.metrics = newMetricsCollector()
+	}
+}
+
+// metricsCollector accumulates the counters behind Metrics
+type metricsCollector struct {
+	bytes   atomic.Int64
+	retries atomic.Int64
+
+	mu      sync.Mutex
+	hits    map[string]int64
+	misses  int64
+	fetches map[PackageType]*Histogram
+	errors  map[string]int64
+}
+
+func newMetricsCollector() *metricsCollector {
+	return &metricsCollector{
+		hits:    make(map[string]int64),
+		fetches: make(map[PackageType]*Histogram),
+		errors:  make(map[string]int64),
+	}
+}
+
+// observe counts what event says about a load
+func (m *metricsCollector) observe(event LoadEvent) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch event.Kind {
+	case EventCacheHit:
+		m.hits[event.Cache]++
+	case EventCacheMiss:
+		m.misses++
+	case EventFetchEnd:
+		h, ok := m.fetches[event.Type]
+		if !ok {
+			h = &Histogram{Buckets: make([]Bucket, len(fetchBuckets))}
+			for i, bound := range fetchBuckets {
+				h.Buckets[i].UpperBound = bound
+			}
+			m.fetches[event.Type] = h
+		}
+		h.Count++
+		h.Sum += event.Duration
+		for i := range h.Buckets {
+			if event.Duration <= h.Buckets[i].UpperBound {
+				h.Buckets[i].Count++
+			}
+		}
+		if event.Err != nil {
+			m.errors[errors.Code(event.Err)]++
+		}
+	}
+}
+
+// snapshot copies the counters so the caller can read them unlocked
+func (m *metricsCollector) snapshot() *Metrics {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	snap := &Metrics{
+		CacheHits:       make(map[string]int64, len(m.hits)),
+		CacheMisses:     m.misses,
+		Fetches:         make(map[PackageType]Histogram, len(m.fetches)),
+		Retries:         m.retries.Load(),
+		BytesDownloaded: m.bytes.Load(),
+		Errors:          make(map[string]int64, len(m.errors)),
+	}
+	for layer, n := range m.hits {
+		snap.CacheHits[layer] = n
+	}
+	for packageType, h := range m.fetches {
+		copied := *h
+		copied.Buckets = slices.Clone(h.Buckets)
+		snap.Fetches[packageType] = copied
+	}
+	for code, n := range m.errors {
+		snap.Errors[code] = n
+	}
+	return snap
+}
+
+// Metrics returns the loader's counters so far, or nil when it wasn't
+// created WithMetrics
+func (l *ModuleLoader) Metrics() *Metrics {
+	if l.config.metrics == nil {
+		return nil
+	}
+	return l.config.metrics.snapshot()
+}
+
+// MetricsHandler serves the loader's counters in the Prometheus text
+// exposition format, for mounting at a scrape path such as "/metrics". It
+// answers 404 Not Found when the loader wasn't created WithMetrics.
+func (l *ModuleLoader) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		metrics := l.Metrics()
+		if metrics == nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		metrics.WritePrometheus(w)
+	})
+}
+
+// WritePrometheus writes the snapshot in the Prometheus text exposition
+// format. Labels are sorted, so the same counters always read the same.
+func (m *Metrics) WritePrometheus(w io.Writer) {
+	header := func(name, kind, help string) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	}
+
+	header("edon_cache_hits_total", "counter", "Module loads served from a cache, by layer.")
+	for _, layer := range sortedKeys(m.CacheHits) {
+		fmt.Fprintf(w, "edon_cache_hits_total{cache=%q} %d\n", layer, m.CacheHits[layer])
+	}
+	header("edon_cache_misses_total", "counter", "Module loads that missed every cache.")
+	fmt.Fprintf(w, "edon_cache_misses_total %d\n", m.CacheMisses)
+
+	header("edon_fetch_duration_seconds", "histogram", "Time taken to fetch modules that missed the caches, by package type.")
+	for _, packageType := range sortedKeys(m.Fetches) {
+		h := m.Fetches[packageType]
+		for _, b := range h.Buckets {
+			fmt.Fprintf(w, "edon_fetch_duration_seconds_bucket{type=%q,le=%q} %d\n", packageType, formatSeconds(b.UpperBound), b.Count)
+		}
+		fmt.Fprintf(w, "edon_fetch_duration_seconds_bucket{type=%q,le=\"+Inf\"} %d\n", packageType, h.Count)
+		fmt.Fprintf(w, "edon_fetch_duration_seconds_sum{type=%q} %s\n", packageType, formatSeconds(h.Sum))
+		fmt.Fprintf(w, "edon_fetch_duration_seconds_count{type=%q} %d\n", packageType, h.Count)
+	}
+
+	header("edon_retries_total", "counter", "Rate-limited requests that were retried.")
+	fmt.Fprintf(w, "edon_retries_total %d\n", m.Retries)
+	header("edon_downloaded_bytes_total", "counter", "Response body bytes read from the network.")
+	fmt.Fprintf(w, "edon_downloaded_bytes_total %d\n", m.BytesDownloaded)
+
+	header("edon_errors_total", "counter", "Failed fetches, by error code.")
+	for _, code := range sortedKeys(m.Errors) {
+		fmt.Fprintf(w, "edon_errors_total{code=%q} %d\n", code, m.Errors[code])
+	}
+}
+
+// formatSeconds writes d as Prometheus expects durations, in seconds
+func formatSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'g', -1, 64)
+}
+
+// sortedKeys returns the keys of m in order
+func sortedKeys[K ~string, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// withMetrics returns a copy of client that counts the response body bytes
+// it reads into m. The caller's client is left untouched.
+func withMetrics(client *http.Client, m *metricsCollector) *http.Client {
+	if m == nil {
+		return client
+	}
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	wrapped := *client
+	wrapped.Transport = &metricsTransport{base: base, metrics: m}
+	return &wrapped
+}
+
+// metricsTransport counts downloaded bytes as bodies are read
+type metricsTransport struct {
+	base    http.RoundTripper
+	metrics *metricsCollector
+}
+
+func (t *metricsTransport) CloseIdleConnections() { closeIdleConnections(t.base) }
+
+func (t *metricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = &countingBody{ReadCloser: resp.Body, bytes: &t.metrics.bytes}
+	return resp, nil
+}
+
+// countingBody adds the bytes read through it to bytes
+type countingBody struct {
+	io.ReadCloser
+	bytes *atomic.Int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.bytes.Add(int64(n))
+	return n, err
+}
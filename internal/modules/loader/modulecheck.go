@@ -0,0 +1,65 @@
+package loader
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/katungi/edon/internal/errors"
+)
+
+// WithValidation has LoadModule run Module.Validate on every module it
+// loads other than builtins, after WithTransforms, so a module that can't
+// run fails its load with a clear error rather than in the runtime. A
+// module from the disk cache that fails is fetched again.
+func WithValidation() Option {
+	return func(c *config) {
+		c.validate = true
+	}
+}
+
+// Validate makes cheap checks, suited to the module's media type, that its
+// content can be handed to a runtime: there is some, JavaScript and
+// TypeScript are valid UTF-8, JSON parses and WASM starts with the
+// WebAssembly magic number. The error names the module and what failed,
+// wrapping errors.ErrInvalidJSON or errors.ErrInvalidWasm for those media
+// types and errors.ErrInvalidModule otherwise.
+func (m *Module) Validate() error {
+	if m.Content == "" {
+		return errors.Wrap(errors.ErrInvalidModule, m.URL+": empty content")
+	}
+	switch m.MediaType {
+	case MediaJavaScript, MediaTypeScript:
+		if !utf8.ValidString(m.Content) {
+			return errors.Wrap(errors.ErrInvalidModule, fmt.Sprintf("%s: invalid UTF-8 at byte %d", m.URL, invalidUTF8(m.Content)))
+		}
+	case MediaJSON:
+		return checkJSON(m)
+	case MediaWasm:
+		if !strings.HasPrefix(m.Content, wasmMagic) {
+			return errors.Wrap(errors.ErrInvalidWasm, m.URL)
+		}
+	}
+	return nil
+}
+
+// invalidUTF8 returns the offset of the first byte of s that isn't part of
+// a valid UTF-8 sequence
+func invalidUTF8(s string) int {
+	for i, r := range s {
+		if r == utf8.RuneError {
+			if _, size := utf8.DecodeRuneInString(s[i:]); size <= 1 {
+				return i
+			}
+		}
+	}
+	return len(s)
+}
+
+// checkModule runs Module.Validate on module when WithValidation is set
+func (l *ModuleLoader) checkModule(module *Module) error {
+	if !l.config.validate || module.Type == TypeBuiltin {
+		return nil
+	}
+	return module.Validate()
+}
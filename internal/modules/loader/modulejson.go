@@ -0,0 +1,100 @@
+package loader
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+	"unicode/utf8"
+
+	"github.com/katungi/edon/internal/errors"
+)
+
+// moduleSchema is the version of the JSON form of a Module. Fields may be
+// added without changing it; it goes up when existing fields change meaning,
+// and modules encoded under a newer schema are refused rather than misread.
+const moduleSchema = 1
+
+// moduleJSON is the JSON form of a Module. Text content is stored as is;
+// WASM and any content that isn't valid UTF-8 is stored base64 encoded in
+// Binary instead, since JSON strings can't carry arbitrary bytes.
+type moduleJSON struct {
+	Schema          int          `json:"schema"`
+	URL             string       `json:"url"`
+	Type            PackageType  `json:"type"`
+	MediaType       MediaType    `json:"mediaType,omitempty"`
+	Format          ModuleFormat `json:"format,omitempty"`
+	ResolvedVersion string       `json:"resolvedVersion,omitempty"`
+	ResolvedURL     string       `json:"resolvedURL,omitempty"`
+	SourceMapURL    string       `json:"sourceMapURL,omitempty"`
+	SourceMap       string       `json:"sourceMap,omitempty"`
+	Hash            string       `json:"hash,omitempty"`
+	LoadedAt        time.Time    `json:"loadedAt,omitzero"`
+	FromCache       bool         `json:"fromCache,omitempty"`
+	Content         *string      `json:"content,omitempty"`
+	Binary          []byte       `json:"binary,omitempty"`
+}
+
+// MarshalJSON encodes the module for handing to another process, such as a
+// worker passing loaded modules back to a coordinator. Everything but
+// RawBytes, which UnmarshalJSON rebuilds for WASM modules, is kept.
+func (m *Module) MarshalJSON() ([]byte, error) {
+	encoded := moduleJSON{
+		Schema:          moduleSchema,
+		URL:             m.URL,
+		Type:            m.Type,
+		MediaType:       m.MediaType,
+		Format:          m.Format,
+		ResolvedVersion: m.ResolvedVersion,
+		ResolvedURL:     m.ResolvedURL,
+		SourceMapURL:    m.SourceMapURL,
+		SourceMap:       m.SourceMap,
+		Hash:            m.Hash,
+		LoadedAt:        m.LoadedAt,
+		FromCache:       m.FromCache,
+	}
+	if m.MediaType == MediaWasm || !utf8.ValidString(m.Content) {
+		encoded.Binary = []byte(m.Content)
+	} else {
+		encoded.Content = &m.Content
+	}
+	return json.Marshal(encoded)
+}
+
+// UnmarshalJSON decodes a module encoded by MarshalJSON. It fails with
+// errors.ErrModuleEncoding for modules from a newer schema, or with
+// neither or both forms of content.
+func (m *Module) UnmarshalJSON(data []byte) error {
+	var decoded moduleJSON
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return errors.Wrap(errors.ErrModuleEncoding, err.Error())
+	}
+	switch {
+	case decoded.Schema < 1 || decoded.Schema > moduleSchema:
+		return errors.Wrap(errors.ErrModuleEncoding, fmt.Sprintf("%s: schema %d, want 1 to %d", decoded.URL, decoded.Schema, moduleSchema))
+	case (decoded.Content == nil) == (decoded.Binary == nil):
+		return errors.Wrap(errors.ErrModuleEncoding, decoded.URL+": want one of content and binary")
+	}
+
+	*m = Module{
+		URL:             decoded.URL,
+		Type:            decoded.Type,
+		MediaType:       decoded.MediaType,
+		Format:          decoded.Format,
+		ResolvedVersion: decoded.ResolvedVersion,
+		ResolvedURL:     decoded.ResolvedURL,
+		SourceMapURL:    decoded.SourceMapURL,
+		SourceMap:       decoded.SourceMap,
+		Hash:            decoded.Hash,
+		LoadedAt:        decoded.LoadedAt,
+		FromCache:       decoded.FromCache,
+	}
+	if decoded.Content != nil {
+		m.Content = *decoded.Content
+	} else {
+		m.Content = string(decoded.Binary)
+	}
+	if m.MediaType == MediaWasm {
+		m.RawBytes = []byte(m.Content)
+	}
+	return nil
+}
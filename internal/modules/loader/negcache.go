@@ -0,0 +1,66 @@
+package loader
+
+import (
+	"sync"
+	"time"
+)
+
+// negativeCache remembers URLs that recently returned a definitive 404 so
+// repeated lookups don't go back to the network until the entry expires
+type negativeCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	expires map[string]time.Time
+}
+
+// newNegativeCache returns a negative cache, or nil when ttl disables it
+func newNegativeCache(ttl time.Duration) *negativeCache {
+	if ttl <= 0 {
+		return nil
+	}
+	return &negativeCache{
+		ttl:     ttl,
+		expires: make(map[string]time.Time),
+	}
+}
+
+// has reports whether url is a live not-found entry. A nil cache has no entries.
+func (c *negativeCache) has(url string) bool {
+	if c == nil {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expiry, ok := c.expires[url]
+	if !ok {
+		return false
+	}
+	if time.Now().After(expiry) {
+		delete(c.expires, url)
+		return false
+	}
+	return true
+}
+
+// add records url as not found for the cache's TTL
+func (c *negativeCache) add(url string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.expires[url] = time.Now().Add(c.ttl)
+}
+
+// remove forgets url, reporting whether it was present
+func (c *negativeCache) remove(url string) bool {
+	if c == nil {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.expires[url]
+	delete(c.expires, url)
+	return ok
+}
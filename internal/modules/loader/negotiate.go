@@ -0,0 +1,59 @@
+package loader
+
+import (
+	"net/http"
+	"net/url"
+)
+
+// targetCDNHost builds modules for the JavaScript version a "target" query
+// parameter names. Other CDNs serve files as they were published, so their
+// URLs are left alone.
+const targetCDNHost = "esm.sh"
+
+// WithCDNTarget asks esm.sh to build modules for target, such as "es2020" or
+// "esnext", by adding "?target=" to its URLs. A URL that already names a
+// target keeps it. The parameter is part of the module's URL, so modules
+// built for different targets are cached apart.
+func WithCDNTarget(target string) Option {
+	return func(c *config) {
+		c.cdnTarget = target
+	}
+}
+
+// WithCDNAccept sends accept as the Accept header of CDN requests, for CDNs
+// that vary what they serve by it. Remote modules cached while it is set are
+// kept apart from those fetched with another Accept, or none.
+func WithCDNAccept(accept string) Option {
+	return func(c *config) {
+		c.cdnAccept = accept
+	}
+}
+
+// withCDNTarget adds the WithCDNTarget parameter to an esm.sh URL
+func (c *config) withCDNTarget(specifier string) string {
+	if c.cdnTarget == "" {
+		return specifier
+	}
+	u, err := url.Parse(specifier)
+	if err != nil || u.Scheme != "https" || u.Host != targetCDNHost {
+		return specifier
+	}
+	if u.Query().Has("target") {
+		return specifier
+	}
+	// Appended rather than re-encoded, so the rest of the URL stays as written
+	param := "target=" + url.QueryEscape(c.cdnTarget)
+	if u.RawQuery == "" {
+		u.RawQuery = param
+	} else {
+		u.RawQuery += "&" + param
+	}
+	return u.String()
+}
+
+// setCDNAccept sets the WithCDNAccept header on a CDN request
+func (c *config) setCDNAccept(req *http.Request) {
+	if c.cdnAccept != "" {
+		req.Header.Set("Accept", c.cdnAccept)
+	}
+}
@@ -0,0 +1,97 @@
+package loader
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/katungi/edon/internal/errors"
+)
+
+// ResolveNodeModules resolves a bare specifier such as "lodash/fp" or
+// "@scope/pkg" the way Node does for a module in fromDir: it looks for
+// node_modules/<package> in fromDir and each of its parents, nearest first,
+// and resolves the rest of the specifier in the first package found with
+// ResolveEntry and the default conditions. The file is returned with
+// symlinks resolved, as Node does, so the dependencies of packages pnpm
+// links in from its store are found beside them.
+func ResolveNodeModules(fromDir, specifier string) (string, error) {
+	name, subpath, ok := splitBareSpecifier(specifier)
+	if !ok {
+		return "", errors.Wrap(errors.ErrInvalidURL, "not a bare specifier: "+specifier)
+	}
+	packagePath, ok := findNodeModule(fromDir, name)
+	if !ok {
+		return "", errors.Wrap(errors.ErrModuleNotFound, "no node_modules/"+name+" above "+fromDir)
+	}
+	return nodeModuleFile(packagePath, nil, subpath)
+}
+
+// findNodeModule returns the directory of the package called name in the
+// nearest node_modules directory of fromDir or its parents
+func findNodeModule(fromDir, name string) (string, bool) {
+	dir, err := filepath.Abs(fromDir)
+	if err != nil {
+		return "", false
+	}
+	for {
+		// Packages are never looked up in node_modules/node_modules
+		if filepath.Base(dir) != "node_modules" {
+			packagePath := filepath.Join(dir, "node_modules", filepath.FromSlash(name))
+			if info, err := os.Stat(packagePath); err == nil && info.IsDir() {
+				return packagePath, true
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+// nodeModuleFile resolves subpath in a package found by findNodeModule
+func nodeModuleFile(packagePath string, conditions []string, subpath string) (string, error) {
+	file, err := ResolveEntry(packagePath, conditions, subpath)
+	if err != nil {
+		return "", err
+	}
+	if real, err := filepath.EvalSymlinks(file); err == nil {
+		file = real
+	}
+	return file, nil
+}
+
+// splitBareSpecifier splits a bare specifier into its package name, keeping
+// a scoped package's "@scope/", and the path inside the package. Relative
+// and absolute paths, URLs and prefixed specifiers such as "npm:" or "node:"
+// aren't bare.
+func splitBareSpecifier(specifier string) (name, subpath string, ok bool) {
+	if specifier == "" || isLocalPath(specifier) || strings.Contains(specifier, ":") {
+		return "", "", false
+	}
+	scope := ""
+	rest := specifier
+	if strings.HasPrefix(specifier, "@") {
+		var found bool
+		if scope, rest, found = strings.Cut(specifier, "/"); !found {
+			return "", "", false
+		}
+		scope += "/"
+	}
+	pkg, subpath, _ := strings.Cut(rest, "/")
+	if pkg == "" || ValidatePackageName(scope+pkg) != nil {
+		return "", "", false
+	}
+	return scope + pkg, subpath, true
+}
+
+// WithNodeModules makes ResolveImport resolve bare imports of local modules
+// that the import map leaves alone through node_modules directories, as
+// ResolveNodeModules does, so projects installed by npm or pnpm run without
+// reinstalling. Imports no node_modules directory has are left as they were.
+func WithNodeModules(enabled bool) Option {
+	return func(c *config) {
+		c.nodeModules = enabled
+	}
+}
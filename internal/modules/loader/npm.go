@@ -2,88 +2,642 @@ package loader
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
-	"time"
 
 	"github.com/katungi/edon/internal/errors"
 )
 
 // NPMPackageManager handles NPM package installation and caching
 type NPMPackageManager struct {
-	cacheDir   string
-	httpClient *http.Client
+	cacheDir string
+	// registries lists the primary registry followed by any fallbacks
+	registries  []string
+	offline     bool
+	httpClient  *http.Client
+	permissions *Permissions
+	// reinstall ignores installed packages and replaces them with fresh copies
+	reinstall bool
+	// reload picks out packages to reinstall by their "npm:name@version"
+	reload func(url string) bool
+	// maxDepth bounds ResolveTree; negative means no limit
+	maxDepth int
+	// overrides forces versions in ResolveTree
+	overrides *Overrides
+	// workspaces maps the names of linked workspace packages to them
+	workspaces map[string]*Workspace
+	// locked maps package names to the versions WithLockedVersions pins
+	locked map[string][]version
+	// engines maps engine names to the versions the runtime provides
+	engines       map[string]string
+	strictEngines bool
+	// timeouts bound metadata requests and tarball downloads
+	timeouts TimeoutConfig
+	// packuments caches registry documents for revalidation; nil when
+	// caching is off
+	packuments *packumentCache
+	// noOptional leaves optionalDependencies out of ResolveTree
+	noOptional bool
+	// integrityAlgorithm is the SRI algorithm Integrity computes
+	integrityAlgorithm string
+	// scopes maps scopes such as "@myorg" to the registry serving them
+	scopes map[string]string
+	// maxPackumentSize bounds registry documents as WithMaxModuleSize
+	// bounds modules; zero or less means no limit
+	maxPackumentSize int64
+}
+
+// packageVersion is the registry metadata for a single package version
+type packageVersion struct {
+	Name                 string            `json:"name"`
+	Version              string            `json:"version"`
+	Dependencies         map[string]string `json:"dependencies"`
+	OptionalDependencies map[string]string `json:"optionalDependencies"`
+	peerFields
+	Dist struct {
+		Tarball   string `json:"tarball"`
+		Shasum    string `json:"shasum"`
+		Integrity string `json:"integrity"`
+	} `json:"dist"`
+}
+
+// packument is the registry document listing every version of a package
+type packument struct {
+	Name     string                     `json:"name"`
+	DistTags map[string]string          `json:"dist-tags"`
+	Versions map[string]*packageVersion `json:"versions"`
+
+	// registry is the registry the document was fetched from
+	registry string
+	// raw is the document as the registry sent it
+	raw json.RawMessage
 }
 
 // NewNPMPackageManager creates a new instance of NPMPackageManager
-func NewNPMPackageManager() (*NPMPackageManager, error) {
-	homeDir, err := os.UserHomeDir()
+func NewNPMPackageManager(opts ...Option) (*NPMPackageManager, error) {
+	return newNPMPackageManager(newConfig(opts))
+}
+
+// newNPMPackageManager creates a package manager from an existing config so
+// the loader can share its settings
+func newNPMPackageManager(cfg *config) (*NPMPackageManager, error) {
+	if cfg.tlsErr != nil {
+		return nil, cfg.tlsErr
+	}
+	algorithm, err := generatedIntegrityAlgorithm(cfg.integrityAlgorithm)
 	if err != nil {
-		return nil, errors.Wrap(errors.ErrCacheDir, err.Error())
+		return nil, err
+	}
+	base, err := cfg.cacheBase()
+	if err != nil {
+		return nil, err
 	}
 
-	cacheDir := filepath.Join(homeDir, ".edon", "npm-cache")
-	if err := os.MkdirAll(cacheDir, 0755); err != nil {
-		return nil, errors.Wrap(errors.ErrCacheDir, err.Error())
+	cacheDir := filepath.Join(base, npmCacheDir)
+	if !cfg.resolveOnly {
+		if err := ensureWritableDir(cacheDir); err != nil {
+			return nil, err
+		}
+	}
+
+	workspaces := make(map[string]*Workspace, len(cfg.workspaces))
+	for _, ws := range cfg.workspaces {
+		workspaces[ws.Name] = ws
+	}
+
+	locked := make(map[string][]version)
+	for _, pkg := range cfg.lockedVersions {
+		name, spec := splitNameVersion(pkg)
+		if v, ok := parseVersion(spec); ok {
+			locked[name] = append(locked[name], v)
+		}
 	}
 
-	// #81: Don't use default HTTP client - configure timeouts
 	return &NPMPackageManager{
-		cacheDir: cacheDir,
-		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
-		},
+		cacheDir:           cacheDir,
+		registries:         append([]string{cfg.registry}, cfg.fallbacks...),
+		offline:            cfg.offline,
+		httpClient:         cfg.httpClient,
+		permissions:        cfg.permissions,
+		reinstall:          cfg.cacheMode == CacheBypassRead || cfg.noCache,
+		reload:             cfg.reloadMatcher,
+		maxDepth:           cfg.maxDepth,
+		overrides:          cfg.overrides,
+		workspaces:         workspaces,
+		locked:             locked,
+		engines:            cfg.engines,
+		strictEngines:      cfg.strictEngines,
+		timeouts:           cfg.timeouts,
+		packuments:         newPackumentCache(base, cfg),
+		noOptional:         cfg.noOptional,
+		integrityAlgorithm: algorithm,
+		scopes:             cfg.scopedRegistries,
+		maxPackumentSize:   cfg.maxModuleSize,
 	}, nil
 }
 
-// InstallPackage installs an NPM package and returns its local path
-func (pm *NPMPackageManager) InstallPackage(ctx context.Context, packageName string) (string, error) {
+// reinstalling reports whether name@version should be replaced with a fresh
+// copy even if it is installed
+func (pm *NPMPackageManager) reinstalling(name, version string) bool {
+	return pm.reinstall || (pm.reload != nil && pm.reload("npm:"+name+"@"+version))
+}
+
+// InstallPackage installs an NPM package and reports the concrete version
+// it resolved to and where it was installed. The version may be a concrete
+// version, a dist-tag such as "latest" or "next", or a range such as
+// "^1.2.0". Paths to a directory or tarball are installed with InstallLocal.
+func (pm *NPMPackageManager) InstallPackage(ctx context.Context, packageName string) (*InstalledPackage, error) {
+	if IsLocalPackage(packageName) {
+		return pm.InstallLocal(packageName)
+	}
+
 	// Parse package name and version
-	parts := strings.Split(packageName, "@")
-	name := parts[0]
-	version := "latest"
-	if len(parts) > 1 {
-		version = parts[1]
+	name, version := splitNameVersion(packageName)
+	if err := ValidatePackageName(name); err != nil {
+		return nil, err
+	}
+
+	// Concrete versions can be served from the cache without asking the registry
+	if cachePath, ok := pm.cachedPath(name, version); ok {
+		return pm.finishInstall(&InstalledPackage{Name: name, Version: version, Path: cachePath, FromCache: true})
+	}
+
+	pkg, err := pm.Resolve(ctx, packageName)
+	if err != nil {
+		return nil, err
+	}
+	return pm.Install(ctx, pkg)
+}
+
+// InstalledPackage describes a package after Install has placed it in the cache
+type InstalledPackage struct {
+	Name    string
+	Version string
+	Path    string
+	// FromCache is set when the package was already installed and nothing
+	// was downloaded
+	FromCache bool
+	// Bytes is the size of the downloaded tarball
+	Bytes int64
+	// Registry is the registry the package was downloaded from; it is empty
+	// for cached and local packages
+	Registry string
+	// Bins maps the commands in the package's "bin" field to the files they
+	// run, as absolute paths inside Path
+	Bins map[string]string
+	// EngineWarnings describes each requirement in the package's "engines"
+	// field that the runtime doesn't meet
+	EngineWarnings []string
+	// ScriptWarnings names each preinstall, install or postinstall script in
+	// the package's package.json; edon installs packages without running them
+	ScriptWarnings []string
+	// Workspace is the directory Path links to when the package is a
+	// workspace; see WithWorkspaces
+	Workspace string
+}
+
+// Install downloads, verifies and extracts a package returned by Resolve or
+// ResolveTree into the cache
+func (pm *NPMPackageManager) Install(ctx context.Context, pkg *ResolvedPackage) (*InstalledPackage, error) {
+	// The cache is keyed by the concrete version, never by a tag
+	if pkg.Workspace != "" {
+		return pm.linkWorkspace(pkg)
+	}
+	cachePath := filepath.Join(pm.cacheDir, pkg.Name, pkg.Version)
+	installed := &InstalledPackage{Name: pkg.Name, Version: pkg.Version, Path: cachePath}
+	reinstall := pm.reinstalling(pkg.Name, pkg.Version)
+	if _, err := os.Stat(cachePath); err == nil && !reinstall {
+		installed.FromCache = true
+		return pm.finishInstall(installed)
+	}
+
+	// Only one installer downloads a version at a time; the others wait and
+	// reuse its result
+	unlock, err := pm.lockInstall(ctx, pkg.Name, pkg.Version)
+	if err != nil {
+		return nil, err
 	}
+	defer unlock()
+	if _, err := os.Stat(cachePath); err == nil && !reinstall {
+		installed.FromCache = true
+		return pm.finishInstall(installed)
+	}
+
+	// Download the tarball and verify it before anything touches the cache.
+	// An interrupted download picks up where it left off next time.
+	tarball, size, err := pm.fetchTarball(ctx, pkg, true)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tarball)
+	installed.Bytes, installed.Registry = size, pkg.Registry
+
+	// Extract into a staging directory next to the final path and rename it
+	// into place, so nobody ever sees a half-extracted package and the
+	// existence check above stays reliable across processes
+	parent := filepath.Dir(cachePath)
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return nil, errors.Wrap(errors.ErrCacheDir, err.Error())
+	}
+	staging, err := os.MkdirTemp(parent, ".extract-"+pkg.Version+"-*")
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrCacheDir, err.Error())
+	}
+	// A no-op once the rename has succeeded
+	defer os.RemoveAll(staging)
+	if err := os.Chmod(staging, 0755); err != nil {
+		return nil, errors.Wrap(errors.ErrCacheDir, err.Error())
+	}
+
+	if err := extractTarball(ctx, tarball, staging); err != nil {
+		return nil, err
+	}
+
+	if err := os.Rename(staging, cachePath); err != nil {
+		_, statErr := os.Stat(cachePath)
+		switch {
+		case statErr != nil:
+			return nil, errors.Wrap(errors.ErrCacheDir, err.Error())
+		case reinstall:
+			if err := replaceDir(staging, cachePath); err != nil {
+				return nil, err
+			}
+		}
+		// Otherwise another installer got there first; its copy is just as good
+	}
+
+	return pm.finishInstall(installed)
+}
 
-	// Check if package is already cached
+// replaceDir swaps dir for the freshly extracted src. The old copy is moved
+// aside before src is renamed in, so dir is only briefly missing and never
+// half-written.
+func replaceDir(src, dir string) error {
+	trash, err := os.MkdirTemp(filepath.Dir(dir), ".replaced-*")
+	if err != nil {
+		return errors.Wrap(errors.ErrCacheDir, err.Error())
+	}
+	defer os.RemoveAll(trash)
+
+	if err := os.Rename(dir, filepath.Join(trash, "old")); err != nil {
+		return errors.Wrap(errors.ErrCacheDir, err.Error())
+	}
+	if err := os.Rename(src, dir); err != nil {
+		return errors.Wrap(errors.ErrCacheDir, err.Error())
+	}
+	return nil
+}
+
+// cachedPath returns the install directory for name@version if that exact
+// version is already in the cache. Tags and ranges always need the registry,
+// as does everything when reinstalling.
+func (pm *NPMPackageManager) cachedPath(name, version string) (string, bool) {
+	if !isExactVersion(version) || pm.reinstalling(name, version) {
+		return "", false
+	}
 	cachePath := filepath.Join(pm.cacheDir, name, version)
-	if _, err := os.Stat(cachePath); err == nil {
-		return cachePath, nil
+	if _, err := os.Stat(cachePath); err != nil {
+		return "", false
 	}
+	return cachePath, true
+}
+
+// fetchPackument fetches the registry document listing all versions of a
+// package, trying each configured registry in turn until one has it
+func (pm *NPMPackageManager) fetchPackument(ctx context.Context, name string) (*packument, error) {
+	var firstErr error
+	for _, registry := range pm.registriesFor(name) {
+		doc, fallback, err := pm.fetchPackumentFrom(ctx, registry, name)
+		if err == nil {
+			return doc, nil
+		}
+		if !fallback || ctx.Err() != nil {
+			return nil, err
+		}
+		// A 404 only counts if every registry agrees; any other failure
+		// is the more useful error to report
+		if firstErr == nil || errors.Is(firstErr, errors.ErrPackageNotFound) && !errors.Is(err, errors.ErrPackageNotFound) {
+			firstErr = err
+		}
+	}
+	return nil, firstErr
+}
 
-	// Fetch package metadata from NPM registry
-	registryURL := fmt.Sprintf("https://registry.npmjs.org/%s/%s", name, version)
+// registriesFor returns the registries name is fetched from: the one
+// WithScopedRegistries maps its scope to, alone, or the primary registry and
+// its fallbacks
+func (pm *NPMPackageManager) registriesFor(name string) []string {
+	if scope, _, ok := strings.Cut(name, "/"); ok && strings.HasPrefix(scope, "@") {
+		if registry, ok := pm.scopes[scope]; ok {
+			return []string{registry}
+		}
+	}
+	return pm.registries
+}
+
+// fetchPackumentFrom fetches a package's registry document from one
+// registry. fallback reports whether the failure is one another registry
+// might not have: a connection failure, a 404 or a server error.
+func (pm *NPMPackageManager) fetchPackumentFrom(ctx context.Context, registry, name string) (doc *packument, fallback bool, err error) {
+	registryURL := fmt.Sprintf("%s/%s", registry, url.PathEscape(name))
+	if err := pm.permissions.checkNet(registryURL); err != nil {
+		return nil, false, err
+	}
+
+	// A copy fetched within the packument TTL is used as it is; an older one
+	// is revalidated with its ETag
+	cached := pm.cachedPackument(registry, name)
+	if cached != nil && pm.packuments.fresh(cached) {
+		if doc, err := decodePackument(registry, name, cached.raw); err == nil {
+			return doc, false, nil
+		}
+		cached = nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, pm.timeouts.Metadata)
+	defer cancel()
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, registryURL, nil)
 	if err != nil {
-		return "", errors.Wrap(errors.ErrPackageFetch, err.Error())
+		return nil, false, errors.Wrap(errors.ErrPackageFetch, err.Error())
+	}
+	if cached != nil && cached.etag != "" {
+		req.Header.Set("If-None-Match", cached.etag)
 	}
 
 	resp, err := pm.httpClient.Do(req)
+	if errors.Is(err, errors.ErrRegistryAuth) {
+		return nil, false, err
+	}
 	if err != nil {
-		return "", errors.Wrap(errors.ErrPackageFetch, err.Error())
+		return nil, true, errors.Wrap(errors.ErrPackageFetch, err.Error())
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return "", errors.ErrPackageNotFound
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cached != nil:
+		if doc, err := decodePackument(registry, name, cached.raw); err == nil {
+			pm.packuments.touch(registry, name)
+			return doc, false, nil
+		}
+		// The cached copy turned out to be broken, so it is fetched in full
+		pm.packuments.remove(registry, name)
+		return pm.fetchPackumentFrom(ctx, registry, name)
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, true, errors.Wrap(errors.ErrPackageNotFound, name)
+	case resp.StatusCode == http.StatusUnauthorized:
+		// How registries answer for a private package without credentials
+		return nil, false, errors.Wrap(errors.ErrRegistryAuth,
+			fmt.Sprintf("%s is private or %s needs credentials: %s", name, registry, resp.Status))
+	case resp.StatusCode != http.StatusOK:
+		return nil, resp.StatusCode >= 500, errors.Wrap(errors.ErrPackageFetch, fmt.Sprintf("GET %s: %s", registryURL, resp.Status))
+	}
+
+	body := io.Reader(resp.Body)
+	if pm.maxPackumentSize > 0 {
+		// One byte over the limit is enough to know it was exceeded
+		body = io.LimitReader(body, pm.maxPackumentSize+1)
+	}
+	raw, err := io.ReadAll(body)
+	if err != nil {
+		return nil, true, errors.Wrap(errors.ErrPackageFetch, err.Error())
+	}
+	if pm.maxPackumentSize > 0 && int64(len(raw)) > pm.maxPackumentSize {
+		return nil, false, errors.Wrap(errors.ErrModuleTooLarge, fmt.Sprintf("%s is over %d bytes", registryURL, pm.maxPackumentSize))
+	}
+	if doc, err = decodePackument(registry, name, raw); err != nil {
+		return nil, false, err
+	}
+	pm.packuments.put(registry, name, raw, resp.Header.Get("ETag"))
+	return doc, false, nil
+}
+
+// decodePackument parses the registry document raw for name
+func decodePackument(registry, name string, raw []byte) (*packument, error) {
+	doc := &packument{registry: registry, raw: raw}
+	if err := json.Unmarshal(raw, doc); err != nil {
+		return nil, errors.Wrap(errors.ErrPackageFetch, err.Error())
+	}
+	if doc.Name == "" {
+		doc.Name = name
+	}
+	return doc, nil
+}
+
+// resolve finds the metadata for a concrete version, a dist-tag, or the
+// highest version satisfying a range
+func (p *packument) resolve(spec string) (*packageVersion, error) {
+	version := spec
+	if !isExactVersion(spec) {
+		if tagged, ok := p.DistTags[spec]; ok {
+			version = tagged
+		} else if r, ok := parseRange(spec); ok {
+			available := make([]string, 0, len(p.Versions))
+			for v := range p.Versions {
+				available = append(available, v)
+			}
+			if version, ok = maxSatisfying(available, r); !ok {
+				return nil, errors.Wrap(errors.ErrVersionNotFound, fmt.Sprintf("no version of %s satisfies %q", p.Name, spec))
+			}
+		} else {
+			return nil, errors.Wrap(errors.ErrVersionNotFound, fmt.Sprintf("%s has no dist-tag %q", p.Name, spec))
+		}
 	}
 
-	// Create cache directory for package
-	if err := os.MkdirAll(cachePath, 0755); err != nil {
-		return "", errors.Wrap(errors.ErrCacheDir, err.Error())
+	meta, ok := p.Versions[version]
+	if !ok {
+		return nil, errors.Wrap(errors.ErrVersionNotFound, fmt.Sprintf("%s@%s", p.Name, version))
+	}
+	if meta.Dist.Tarball == "" {
+		return nil, errors.Wrap(errors.ErrPackageFetch, fmt.Sprintf("%s@%s has no tarball", p.Name, version))
+	}
+	if meta.Version == "" {
+		meta.Version = version
 	}
 
-	// Download and extract package
-	// TODO: Implement package download and extraction
-	// For now, just create a placeholder file
-	placeholder := filepath.Join(cachePath, "index.js")
-	if err := os.WriteFile(placeholder, []byte("// TODO: Implement package content"), 0644); err != nil {
-		return "", errors.Wrap(errors.ErrPackageInstall, err.Error())
+	return meta, nil
+}
+
+// partialSuffix ends the names of tarball downloads kept in the cache
+// directory to be resumed
+const partialSuffix = ".partial"
+
+// fetchTarball downloads pkg's tarball and checks it against the registry's
+// digests, returning its path and size. The caller removes the file. A
+// resumed download that fails the check may have been pieced together from
+// another copy's bytes, so it is thrown away and downloaded once more from
+// the start; a tarball that fails anyway is removed.
+func (pm *NPMPackageManager) fetchTarball(ctx context.Context, pkg *ResolvedPackage, resume bool) (string, int64, error) {
+	tarball, size, resumed, err := pm.downloadTarball(ctx, pkg.Tarball, resume)
+	if err != nil {
+		return "", 0, err
+	}
+	err = verifyIntegrity(tarball, pkg.Integrity, pkg.Shasum)
+	if err != nil && resumed {
+		_ = os.Remove(tarball)
+		if tarball, size, _, err = pm.downloadTarball(ctx, pkg.Tarball, resume); err != nil {
+			return "", 0, err
+		}
+		err = verifyIntegrity(tarball, pkg.Integrity, pkg.Shasum)
+	}
+	if err != nil {
+		_ = os.Remove(tarball)
+		return "", 0, errors.Wrap(err, pkg.String())
+	}
+	return tarball, size, nil
+}
+
+// downloadTarball downloads a package tarball into the cache directory and
+// returns its path and size, and whether it carried on from an earlier
+// download. The caller removes the file.
+//
+// With resume the file is named after the URL, and when a download breaks
+// off from a server that accepts byte ranges what arrived is kept, so the
+// next download asks for only the rest with a Range request. A server that
+// answers with the whole file instead starts it over, as does one that
+// can't satisfy the range. Only one installer downloads a version at a
+// time, so nothing else writes to the file meanwhile.
+func (pm *NPMPackageManager) downloadTarball(ctx context.Context, tarballURL string, resume bool) (string, int64, bool, error) {
+	// Registries may serve tarballs from another host, which needs its own grant
+	if err := pm.permissions.checkNet(tarballURL); err != nil {
+		return "", 0, false, err
 	}
 
-	return cachePath, nil
+	// A partial download is resumed from where it stopped
+	var partial string
+	var offset int64
+	if resume {
+		partial = pm.partialPath(tarballURL)
+		if info, err := os.Stat(partial); err == nil {
+			offset = info.Size()
+		}
+	}
+	// startOver discards what was downloaded and tries again from the start
+	startOver := func() (string, int64, bool, error) {
+		if err := os.Remove(partial); err != nil {
+			return "", 0, false, errors.Wrap(errors.ErrCacheDir, err.Error())
+		}
+		return pm.downloadTarball(ctx, tarballURL, resume)
+	}
+
+	// A restart gets a deadline of its own
+	reqCtx, cancel := context.WithTimeout(ctx, pm.timeouts.Tarball)
+	defer cancel()
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, tarballURL, nil)
+	if err != nil {
+		return "", 0, false, errors.Wrap(errors.ErrPackageFetch, err.Error())
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := pm.httpClient.Do(req)
+	if errors.Is(err, errors.ErrRegistryAuth) {
+		return "", 0, false, err
+	}
+	if err != nil {
+		return "", 0, false, errors.Wrap(errors.ErrPackageFetch, err.Error())
+	}
+	defer resp.Body.Close()
+
+	resumed := false
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		if rangeStart(resp.Header.Get("Content-Range")) != offset {
+			return startOver()
+		}
+		resumed = true
+	case resp.StatusCode == http.StatusOK:
+		// The server ignored the range, so the body is the whole tarball
+		offset = 0
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		// What was kept is no prefix of the tarball
+		return startOver()
+	default:
+		return "", 0, false, errors.Wrap(errors.ErrPackageFetch, fmt.Sprintf("GET %s: %s", tarballURL, resp.Status))
+	}
+
+	// Nothing is written until there is a body to write
+	var file *os.File
+	switch {
+	case resumed:
+		file, err = os.OpenFile(partial, os.O_WRONLY|os.O_APPEND, 0644)
+	case resume:
+		file, err = os.OpenFile(partial, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	default:
+		file, err = os.CreateTemp(pm.cacheDir, "download-*.tgz")
+	}
+	if err != nil {
+		return "", 0, false, errors.Wrap(errors.ErrCacheDir, err.Error())
+	}
+	defer file.Close()
+
+	n, err := io.Copy(file, resp.Body)
+	if err != nil {
+		// Without ranges a retry starts from scratch, so nothing is kept
+		ranges := resp.StatusCode == http.StatusPartialContent || resp.Header.Get("Accept-Ranges") == "bytes"
+		if !resume || !ranges {
+			file.Close()
+			_ = os.Remove(file.Name())
+		}
+		return "", 0, false, errors.Wrap(errors.ErrPackageFetch, err.Error())
+	}
+	return file.Name(), offset + n, resumed, nil
+}
+
+// partialPath returns where a resumable download of tarballURL is kept
+func (pm *NPMPackageManager) partialPath(tarballURL string) string {
+	return filepath.Join(pm.cacheDir, "download-"+hashContent(tarballURL)[:16]+partialSuffix)
+}
+
+// rangeStart returns the first byte a Content-Range header such as
+// "bytes 100-199/200" covers, or -1 when it can't be read
+func rangeStart(contentRange string) int64 {
+	spec, ok := strings.CutPrefix(contentRange, "bytes ")
+	if !ok {
+		return -1
+	}
+	first, _, ok := strings.Cut(spec, "-")
+	if !ok {
+		return -1
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil {
+		return -1
+	}
+	return start
+}
+
+// ParseNPMSpecifier splits a specifier such as "@scope/pkg@1.2.3/sub/path"
+// into its package name, version and subpath. The version defaults to "latest".
+func ParseNPMSpecifier(spec string) (name, version, subpath string) {
+	spec = strings.TrimPrefix(spec, "npm:")
+
+	// Scoped packages keep their "@scope/" prefix as part of the name
+	scope := ""
+	if strings.HasPrefix(spec, "@") {
+		if idx := strings.Index(spec, "/"); idx != -1 {
+			scope, spec = spec[:idx+1], spec[idx+1:]
+		}
+	}
+
+	pkg, subpath, _ := strings.Cut(spec, "/")
+	name, version = splitNameVersion(scope + pkg)
+	return name, version, subpath
+}
+
+// splitNameVersion splits "name@version" (or "@scope/name@version"),
+// defaulting the version to "latest"
+func splitNameVersion(packageName string) (string, string) {
+	idx := strings.LastIndex(packageName, "@")
+	if idx <= 0 {
+		return packageName, "latest"
+	}
+	return packageName[:idx], packageName[idx+1:]
 }
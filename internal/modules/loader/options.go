@@ -0,0 +1,800 @@
+package loader
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/katungi/edon/internal/errors"
+)
+
+// defaultRegistry is the NPM registry used when none is configured
+const defaultRegistry = "https://registry.npmjs.org"
+
+// defaultMaxIdleConnsPerHost is how many idle connections the built-in client
+// keeps open to each host; net/http's own default of 2 is too few for the
+// loader's fan-out
+const defaultMaxIdleConnsPerHost = 16
+
+// defaultIdleConnTimeout is how long an idle connection stays in the pool
+const defaultIdleConnTimeout = 90 * time.Second
+
+// defaultUserAgent identifies edon to registries and CDNs; the CLI replaces it
+// with one that carries the release version
+const defaultUserAgent = "edon"
+
+// CacheDirEnv overrides the base cache directory when set
+const CacheDirEnv = "EDON_CACHE_DIR"
+
+// NoCacheEnv turns caching off, as WithNoCache does, when set to a true value
+// such as "1"
+const NoCacheEnv = "EDON_NO_CACHE"
+
+// Option configures a ModuleLoader or NPMPackageManager
+type Option func(*config)
+
+// config holds the settings shared by the loader and the package manager it
+// creates for npm: specifiers
+type config struct {
+	registry      string
+	fallbacks     []string
+	cacheDir      string
+	proxy         *url.URL
+	httpClient    *http.Client
+	importMap     *ImportMap
+	offline       bool
+	allowedRoots  []string
+	transpiler    Transpiler
+	permissions   *Permissions
+	negativeTTL   time.Duration
+	logger        LoadLogger
+	cacheBackend  CacheBackend
+	compressCache bool
+	// insecureHosts may serve modules over plain HTTP
+	insecureHosts []string
+	jsrNPMCompat  bool
+	userAgent     string
+	maxRetries    int
+	retryBudget   int
+	cacheMode     CacheMode
+	reloadMatcher func(url string) bool
+	prefetchDepth int
+	maxModuleSize int64
+	opTimeout     time.Duration
+	timeouts      TimeoutConfig
+	// maxConcurrency sizes slots, which every fan-out operation shares
+	maxConcurrency int
+	maxPerHost     int
+	slots          chan struct{}
+	// Connection pool tuning for the built-in client
+	maxIdlePerHost  int
+	maxConnsPerHost int
+	idleConnTimeout time.Duration
+	decorate        func(*http.Request)
+	credentials     CredentialProvider
+	lockedHashes    map[string]string
+	// lockedVersions are the "name@version"s ResolveTree keeps
+	lockedVersions []string
+	// maxDepth limits ResolveTree; negative means no limit
+	maxDepth int
+	// overrides forces versions during ResolveTree
+	overrides *Overrides
+	// workspaces are linked rather than fetched during ResolveTree
+	workspaces []*Workspace
+	// rateLimit is requests per second to each host; zero means no limit
+	rateLimit float64
+	rateBurst int
+	noCache   bool
+	// memoryOnly loads nothing but seeded modules and builtins
+	memoryOnly bool
+	// extensions are tried for extensionless local imports; nil means
+	// the default for whether a transpiler is set
+	extensions []string
+	// failFast cancels a batch of loads at its first failure
+	failFast bool
+	// metrics counts load events and downloaded bytes when set
+	metrics *metricsCollector
+	// nodeModules resolves bare imports of local modules from node_modules
+	nodeModules bool
+	// conditions are the "exports" conditions matched, in order
+	conditions []string
+	// manifestFallbacks are the entries tried when package.json is broken
+	manifestFallbacks []string
+	// engines maps engine names to the versions the runtime provides
+	engines       map[string]string
+	strictEngines bool
+	// cdns are the base URLs "cdn:" specifiers try, in order
+	cdns []string
+	// cdnTarget and cdnAccept negotiate what CDNs build and serve
+	cdnTarget  string
+	cdnAccept  string
+	tlsConfig  *tls.Config
+	caCertFile string
+	// tlsErr records a TLS setup that couldn't be built; every request fails
+	// with it
+	tlsErr error
+	// cacheTTL is how long cached remote modules stay fresh, and
+	// staleWhileRevalidate serves them past it while they're refetched
+	cacheTTL             time.Duration
+	staleWhileRevalidate bool
+	// allowHTML turns off the check for HTML pages served as modules
+	allowHTML bool
+	// redactPatterns extend what is redacted from events, and secrets holds
+	// the tokens sent with requests, which always are
+	redactPatterns []*regexp.Regexp
+	secrets        *secretSet
+	// transforms run in order over every freshly loaded module
+	transforms []Transform
+	// packumentTTL is how long cached registry documents are used without
+	// revalidating them
+	packumentTTL time.Duration
+	// noOptional leaves optionalDependencies out of resolution
+	noOptional bool
+	// integrityAlgorithm is the SRI algorithm new digests are computed
+	// with; empty means sha512
+	integrityAlgorithm string
+	// scopedRegistries maps scopes such as "@myorg" to their registries
+	scopedRegistries map[string]string
+	// validate runs Module.Validate on every loaded module
+	validate bool
+	// resolveOnly leaves the npm cache directory alone
+	resolveOnly bool
+}
+
+// newConfig applies opts on top of the defaults
+func newConfig(opts []Option) *config {
+	cfg := &config{
+		registry:          defaultRegistry,
+		userAgent:         defaultUserAgent,
+		maxRetries:        defaultMaxRetries,
+		retryBudget:       defaultRetryBudget,
+		maxModuleSize:     defaultMaxModuleSize,
+		maxConcurrency:    defaultMaxConcurrency,
+		maxIdlePerHost:    defaultMaxIdleConnsPerHost,
+		idleConnTimeout:   defaultIdleConnTimeout,
+		maxDepth:          -1,
+		rateLimit:         defaultRateLimit,
+		rateBurst:         defaultRateBurst,
+		noCache:           envBool(NoCacheEnv),
+		conditions:        defaultConditions,
+		manifestFallbacks: defaultManifestFallbacks,
+		engines:           defaultEngines,
+		cdns:              defaultCDNs,
+		secrets:           newSecretSet(),
+		packumentTTL:      defaultPackumentTTL,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	cfg.slots = make(chan struct{}, max(cfg.maxConcurrency, 1))
+	cfg.timeouts = cfg.timeouts.withDefaults()
+	if cfg.httpClient == nil {
+		cfg.httpClient = newHTTPClient(cfg)
+	}
+	// Inside the User-Agent, so the decorator sees and can override it
+	cfg.httpClient = withRequestDecorator(cfg.httpClient, cfg.decorate)
+	// Outside the decorator, which can still replace the token
+	cfg.httpClient = withCredentials(cfg.httpClient, cfg.credentials, cfg.secrets)
+	cfg.httpClient = withUserAgent(cfg.httpClient, cfg.userAgent)
+	// Inside the retries, so a request waiting out Retry-After frees its slot
+	cfg.httpClient = withHostLimit(cfg.httpClient, cfg.maxPerHost)
+	// Outside the host limit, so waiting for a token doesn't hold a slot
+	cfg.httpClient = withRateLimit(cfg.httpClient, cfg.rateLimit, cfg.rateBurst)
+	cfg.httpClient = withRetry(cfg.httpClient, cfg.maxRetries, cfg.metrics)
+	// Outermost, so it counts only the bodies callers actually read
+	cfg.httpClient = withMetrics(cfg.httpClient, cfg.metrics)
+	return cfg
+}
+
+// withUserAgent returns a copy of client that sets the User-Agent header on
+// every request that doesn't already have one. The caller's client is left
+// untouched.
+func withUserAgent(client *http.Client, userAgent string) *http.Client {
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	wrapped := *client
+	wrapped.Transport = &userAgentTransport{base: base, userAgent: userAgent}
+	return &wrapped
+}
+
+// userAgentTransport adds a User-Agent header to outgoing requests
+type userAgentTransport struct {
+	base      http.RoundTripper
+	userAgent string
+}
+
+func (t *userAgentTransport) CloseIdleConnections() { closeIdleConnections(t.base) }
+
+func (t *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("User-Agent") != "" {
+		return t.base.RoundTrip(req)
+	}
+	// RoundTrippers must not modify the caller's request
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", t.userAgent)
+	return t.base.RoundTrip(req)
+}
+
+// newHTTPClient builds the client shared by every fetch the loader and the
+// package manager make, so proxy settings apply consistently
+func newHTTPClient(cfg *config) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyFromEnvironment
+	if cfg.proxy != nil {
+		transport.Proxy = http.ProxyURL(cfg.proxy)
+	}
+	// Module graphs are many small files from a handful of hosts, so keep
+	// enough connections warm to serve a whole fan-out without redialing
+	transport.ForceAttemptHTTP2 = true
+	transport.MaxIdleConnsPerHost = cfg.maxIdlePerHost
+	transport.MaxConnsPerHost = cfg.maxConnsPerHost
+	transport.IdleConnTimeout = cfg.idleConnTimeout
+	tlsConfig, err := cfg.clientTLSConfig()
+	if err != nil {
+		cfg.tlsErr = err
+		return &http.Client{Transport: failingTransport{err: err}}
+	}
+	transport.TLSClientConfig = tlsConfig
+
+	// #81: Don't use default HTTP client - configure timeouts. Each request
+	// also gets the shorter deadline WithTimeouts sets for its kind.
+	return &http.Client{
+		Transport: transport,
+		Timeout:   cfg.timeouts.longest(),
+	}
+}
+
+// WithRegistry sets the NPM registry used for package metadata and tarballs
+func WithRegistry(registry string) Option {
+	return func(c *config) {
+		c.registry = strings.TrimSuffix(registry, "/")
+	}
+}
+
+// WithFallbackRegistries adds registries to try, in order, when the primary
+// registry can't be reached, doesn't have a package or fails with a server
+// error. Tarballs are downloaded from whichever registry served the metadata.
+func WithFallbackRegistries(registries ...string) Option {
+	return func(c *config) {
+		c.fallbacks = nil
+		for _, registry := range registries {
+			c.fallbacks = append(c.fallbacks, strings.TrimSuffix(registry, "/"))
+		}
+	}
+}
+
+// WithScopedRegistries fetches the packages of each scope, given as
+// "@myorg", from its own registry, as "@myorg:registry=" does in .npmrc.
+// Scoped packages are fetched from their registry alone, never the fallback
+// registries, and their tarballs from wherever it says they are. Tokens are
+// matched to the registry's host by WithCredentialProvider as for any other.
+func WithScopedRegistries(registries map[string]string) Option {
+	return func(c *config) {
+		c.scopedRegistries = make(map[string]string, len(registries))
+		for scope, registry := range registries {
+			if !strings.HasPrefix(scope, "@") {
+				scope = "@" + scope
+			}
+			c.scopedRegistries[scope] = strings.TrimSuffix(registry, "/")
+		}
+	}
+}
+
+// WithProxy routes all requests through proxy instead of the proxy given by
+// the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables
+func WithProxy(proxy *url.URL) Option {
+	return func(c *config) {
+		c.proxy = proxy
+	}
+}
+
+// WithHTTPClient replaces the client used for all registry and CDN requests.
+// It is still wrapped as the default one is, for WithUserAgent, WithRetries,
+// WithMaxConcurrencyPerHost, WithRateLimit, WithRequestDecorator,
+// WithCredentialProvider and WithMetrics, but its transport is used as-is, so
+// WithProxy, WithTLSConfig, WithCACertFile and the connection pool options
+// don't apply.
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *config) {
+		c.httpClient = client
+	}
+}
+
+// WithCacheDir sets the base cache directory, taking precedence over
+// EDON_CACHE_DIR and the ~/.edon default
+func WithCacheDir(dir string) Option {
+	return func(c *config) {
+		c.cacheDir = dir
+	}
+}
+
+// cacheBase resolves the base cache directory: the configured directory,
+// then $EDON_CACHE_DIR, then ~/.edon
+func (c *config) cacheBase() (string, error) {
+	if c.cacheDir != "" {
+		return c.cacheDir, nil
+	}
+	if dir := os.Getenv(CacheDirEnv); dir != "" {
+		return dir, nil
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", errors.Wrap(errors.ErrCacheDir, err.Error())
+	}
+	return filepath.Join(homeDir, ".edon"), nil
+}
+
+// envBool reports whether the environment variable name is set to a true
+// value such as "1" or "true"
+func envBool(name string) bool {
+	value, err := strconv.ParseBool(os.Getenv(name))
+	return err == nil && value
+}
+
+// ensureWritableDir creates dir if needed and checks that files can be
+// written to it
+func ensureWritableDir(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errors.Wrap(errors.ErrCacheDir, err.Error())
+	}
+	probe, err := os.CreateTemp(dir, ".write-check-*")
+	if err != nil {
+		return errors.Wrap(errors.ErrCacheDir, err.Error())
+	}
+	_ = probe.Close()
+	_ = os.Remove(probe.Name())
+	return nil
+}
+
+// WithImportMap rewrites specifiers through m before they are loaded
+func WithImportMap(m *ImportMap) Option {
+	return func(c *config) {
+		c.importMap = m
+	}
+}
+
+// WithOffline disables network access. Remote modules and packages are only
+// served when already cached; anything else fails with errors.ErrOffline.
+func WithOffline(offline bool) Option {
+	return func(c *config) {
+		c.offline = offline
+	}
+}
+
+// WithAllowedRoots restricts local module reads to files inside roots, after
+// resolving symlinks. Reads elsewhere fail with errors.ErrPathEscape. With no
+// roots configured every local path may be read.
+func WithAllowedRoots(roots []string) Option {
+	return func(c *config) {
+		c.allowedRoots = roots
+	}
+}
+
+// Transpiler turns module source of the given media type into JavaScript
+type Transpiler func(src string, mediaType string) (string, error)
+
+// WithTranspiler runs TypeScript modules through t after they are fetched and
+// before they are cached, so the cache holds the transpiled JavaScript.
+// Without a transpiler, TypeScript is returned untouched.
+func WithTranspiler(t Transpiler) Option {
+	return func(c *config) {
+		c.transpiler = t
+	}
+}
+
+// WithPermissions restricts network fetches and local reads to what p grants;
+// denied operations fail with errors.ErrPermissionDenied. Without this option
+// the loader is unrestricted.
+func WithPermissions(p Permissions) Option {
+	return func(c *config) {
+		c.permissions = &p
+	}
+}
+
+// WithNegativeCache remembers modules and packages that returned a 404 for
+// ttl, failing repeat loads with errors.ErrModuleNotFound without a network
+// round-trip. Timeouts and server errors are never cached.
+func WithNegativeCache(ttl time.Duration) Option {
+	return func(c *config) {
+		c.negativeTTL = ttl
+	}
+}
+
+// WithCacheBackend stores fetched remote modules in backend instead of the
+// "remote" directory of the cache directory, so they can be shared through
+// Redis, an object store or the like. The in-memory module cache still sits
+// in front of it. Installed npm packages stay on disk, and edon cache export
+// and import only see the disk backend.
+func WithCacheBackend(backend CacheBackend) Option {
+	return func(c *config) {
+		c.cacheBackend = backend
+	}
+}
+
+// WithCompressedCache gzips module content in the disk cache, or whatever
+// backend WithCacheBackend sets, decompressing it transparently on read.
+// Recorded hashes stay those of the uncompressed content, so integrity
+// checks are unaffected, and entries written either way can be read either
+// way. CDN bundles compress well: the 885 modules of npm's own dependencies
+// take 4.3 MB stored raw and 1.3 MB compressed one by one, about 70% less.
+func WithCompressedCache(compress bool) Option {
+	return func(c *config) {
+		c.compressCache = compress
+	}
+}
+
+// WithAllowInsecureHosts lets the listed hosts serve modules over plain
+// HTTP, such as a mirror on an internal network. Any URL on them loads as a
+// remote module, CDN or not. A host without a port, like "localhost",
+// matches every port. Everywhere else only HTTPS is accepted, and a
+// trusted HTTPS URL redirecting to an untrusted HTTP one fails with
+// errors.ErrInsecureURL. Git repositories are only cloned over git+http://
+// or git:// from these hosts too.
+func WithAllowInsecureHosts(hosts []string) Option {
+	return func(c *config) {
+		c.insecureHosts = append(c.insecureHosts, hosts...)
+	}
+}
+
+// WithLogger reports cache hits and misses and the start and end of each
+// fetch to logger. The default is a no-op.
+func WithLogger(logger LoadLogger) Option {
+	return func(c *config) {
+		c.logger = logger
+	}
+}
+
+// WithJSRNpmCompat loads jsr: specifiers through JSR's npm compatibility
+// registry (npm.jsr.io) using the npm package manager, so JSR packages are
+// installed and resolved like npm packages. By default files are fetched
+// directly from jsr.io.
+func WithJSRNpmCompat(enabled bool) Option {
+	return func(c *config) {
+		c.jsrNPMCompat = enabled
+	}
+}
+
+// WithUserAgent sets the User-Agent header sent with every registry and CDN
+// request
+func WithUserAgent(userAgent string) Option {
+	return func(c *config) {
+		c.userAgent = userAgent
+	}
+}
+
+// WithRetries sets how many times a request answered with 429 Too Many
+// Requests is retried, waiting as long as its Retry-After header asks but
+// never past the context deadline. Zero disables retries; the default is 3.
+func WithRetries(n int) Option {
+	return func(c *config) {
+		c.maxRetries = n
+	}
+}
+
+// WithRetryBudget caps the retries one LoadGraph, LoadModules or Warm call
+// makes across all of its requests, so a rate-limiting server can't turn a
+// large graph into thousands of retries. Once it is spent, rate-limited
+// requests fail straight away; WithLogger sees each retry as EventRetry and
+// the budget running out as EventRetryBudgetExhausted. Zero or less removes
+// the cap; the default is 20.
+func WithRetryBudget(n int) Option {
+	return func(c *config) {
+		c.retryBudget = n
+	}
+}
+
+// CacheMode controls whether loads may be served from the caches
+type CacheMode int
+
+const (
+	// CacheDefault serves modules and packages from the caches when present
+	CacheDefault CacheMode = iota
+	// CacheBypassRead ignores the memory, disk and negative caches and
+	// reinstalls npm packages, while still writing fresh results back
+	CacheBypassRead
+)
+
+// WithCacheMode sets how the loader uses its caches. CacheBypassRead can't
+// serve remote modules in offline mode, so combining it with WithOffline
+// fails every load with errors.ErrOffline.
+func WithCacheMode(mode CacheMode) Option {
+	return func(c *config) {
+		c.cacheMode = mode
+	}
+}
+
+// WithReloadMatcher makes the loader fetch modules whose URL matches afresh,
+// as Reload does, the first time each is loaded; later loads are served from
+// the memory cache as usual. npm packages are matched as "npm:name@version"
+// and reinstalled, including by a package manager built with this option.
+func WithReloadMatcher(match func(url string) bool) Option {
+	return func(c *config) {
+		c.reloadMatcher = match
+	}
+}
+
+// WithMaxModuleSize limits how many bytes a remote or local module may be.
+// Larger modules fail with errors.ErrModuleTooLarge, before any of the body
+// is read when the server declares its Content-Length, and before any of a
+// local file is read. The same limit applies to npm registry documents.
+// Zero or less removes the limit; the default is 64 MiB.
+func WithMaxModuleSize(n int64) Option {
+	return func(c *config) {
+		c.maxModuleSize = n
+	}
+}
+
+// WithOperationTimeout bounds how long a single module may take to fetch or
+// install, across every request involved: retries, redirects and, for npm
+// packages, metadata, tarball and extraction. Exceeding it fails the load
+// with errors.ErrModuleTimeout. The WithTimeouts deadline of each request
+// still applies. Zero, the default, sets no bound.
+func WithOperationTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.opTimeout = d
+	}
+}
+
+// WithPrefetch makes the loader fetch a module's imports in the background
+// after loading it, so they are likely cached by the time they are needed.
+// depth limits how many levels of imports are followed. Prefetches are
+// speculative: failures are reported to the logger as EventPrefetchFailed
+// and never fail a load.
+func WithPrefetch(depth int) Option {
+	return func(c *config) {
+		c.prefetchDepth = depth
+	}
+}
+
+// WithMaxConcurrency limits how many modules are loaded at once by LoadModules,
+// LoadGraph and prefetching together, so they can't flood a registry or CDN
+// between them. Values below one are treated as one; the default is 8.
+func WithMaxConcurrency(n int) Option {
+	return func(c *config) {
+		c.maxConcurrency = n
+	}
+}
+
+// WithMaxConcurrencyPerHost limits how many requests the loader and package
+// manager have in flight to any one host, so a slow host can't tie up every
+// slot. A request holds its slot until its response body is closed. Zero, the
+// default, sets no per-host limit.
+func WithMaxConcurrencyPerHost(n int) Option {
+	return func(c *config) {
+		c.maxPerHost = n
+	}
+}
+
+// WithMaxIdleConnsPerHost sets how many idle connections the built-in client
+// keeps open to each host for reuse. The default is 16. Like the other
+// connection options it has no effect with WithHTTPClient.
+func WithMaxIdleConnsPerHost(n int) Option {
+	return func(c *config) {
+		c.maxIdlePerHost = n
+	}
+}
+
+// WithMaxConnsPerHost caps the connections the built-in client opens to each
+// host, counting those dialing, active and idle. Requests over the cap wait
+// for a connection. Zero, the default, sets no cap.
+func WithMaxConnsPerHost(n int) Option {
+	return func(c *config) {
+		c.maxConnsPerHost = n
+	}
+}
+
+// WithIdleConnTimeout sets how long the built-in client keeps an idle
+// connection before closing it. The default is 90 seconds; zero keeps idle
+// connections until Close.
+func WithIdleConnTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.idleConnTimeout = d
+	}
+}
+
+// WithRequestDecorator calls decorate on every request the loader and package
+// manager send, CDN, JSR and npm alike, after edon has set its own headers, so
+// headers decorate sets win. The request's context is the one passed to the
+// load, which lets hosts copy trace IDs from it into headers. Retried requests
+// are decorated again. Unlike the connection options it also applies with
+// WithHTTPClient.
+func WithRequestDecorator(decorate func(*http.Request)) Option {
+	return func(c *config) {
+		c.decorate = decorate
+	}
+}
+
+// WithLockedHashes pins remote modules to the hex SHA-256 of their source,
+// keyed by URL, as the "remote" section of a deno.lock records them. A
+// module whose source hashes differently, fetched or read from the disk
+// cache, fails to load with errors.ErrIntegrityMismatch. Modules not in
+// hashes load as usual.
+func WithLockedHashes(hashes map[string]string) Option {
+	return func(c *config) {
+		c.lockedHashes = hashes
+	}
+}
+
+// WithLockedVersions makes ResolveTree keep the versions a lockfile pinned,
+// given as "name@version" like DenoLock.Packages returns them. A range that
+// a pinned version of the package satisfies resolves to the highest such
+// version rather than the newest release; ranges no pin satisfies resolve
+// as usual.
+func WithLockedVersions(packages []string) Option {
+	return func(c *config) {
+		c.lockedVersions = packages
+	}
+}
+
+// WithCredentialProvider asks provider for a bearer token before every
+// request the loader and package manager send, retries included, so tokens
+// from OIDC or cloud IAM can be fetched and refreshed as they expire. It is
+// given the request's host, and returns "" for hosts that need no token. A
+// token replaces any Authorization header already set, though
+// WithRequestDecorator runs after it and has the last word. When the provider
+// fails, the request isn't sent and fails with errors.ErrRegistryAuth.
+func WithCredentialProvider(provider CredentialProvider) Option {
+	return func(c *config) {
+		c.credentials = provider
+	}
+}
+
+// WithOptionalDependencies sets whether ResolveTree follows packages'
+// optionalDependencies, which it does by default, leaving out those that
+// can't be resolved. With false they, and the optional packages given to
+// ResolveOptionalTree, are skipped entirely, as npm's --omit=optional does.
+func WithOptionalDependencies(enabled bool) Option {
+	return func(c *config) {
+		c.noOptional = !enabled
+	}
+}
+
+// WithMaxDepth limits how many levels of dependencies ResolveTree follows
+// below the requested packages. Zero resolves only the requested packages;
+// packages whose dependencies were cut off are marked Truncated. Negative
+// values, the default, set no limit.
+func WithMaxDepth(n int) Option {
+	return func(c *config) {
+		c.maxDepth = n
+	}
+}
+
+// WithRateLimit limits the loader and package manager to perSecond requests
+// a second to each host, with bursts of up to burst. Hosts are limited
+// independently, and a request waiting for its turn gives up when its context
+// is done. The default is 50 a second with bursts of 50; zero or less turns
+// the limit off.
+func WithRateLimit(perSecond float64, burst int) Option {
+	return func(c *config) {
+		c.rateLimit = perSecond
+		c.rateBurst = burst
+	}
+}
+
+// WithNoCache turns off the memory, disk and negative module caches, so
+// every load fetches afresh and no remote module is written to disk. npm
+// packages are reinstalled on every load, since they can only be loaded from
+// their extracted files. Setting EDON_NO_CACHE=1 has the same effect.
+func WithNoCache() Option {
+	return func(c *config) {
+		c.noCache = true
+	}
+}
+
+// WithResolveOnly builds a package manager that only resolves, for callers
+// such as a lockfile check that must not write anything: its cache directory
+// is neither created nor checked for writing, so installing with it fails
+// unless the directory already exists.
+func WithResolveOnly() Option {
+	return func(c *config) {
+		c.resolveOnly = true
+	}
+}
+
+// WithManifestFallbacks sets the files, relative to the package root, tried
+// in order as the entry of a package whose package.json can't be parsed.
+// The default is index.js then index.mjs. The load warns with an
+// EventManifestFallback when one is used.
+func WithManifestFallbacks(files ...string) Option {
+	return func(c *config) {
+		c.manifestFallbacks = files
+	}
+}
+
+// WithConditions sets the conditions matched against the "exports" field of
+// npm and JSR packages, such as "node", "browser" or "require", tried in the
+// order given. "default" is always matched last, as in Node. The default is
+// "import", "default", which suits an ES module runtime. Including "browser"
+// also honors the "browser" field of packages, for browser-targeted
+// libraries; see ResolveEntry.
+//
+// Conditions only pick files inside packages. Builtins are always imported
+// through the node: scheme, so adding "node" doesn't change how "node:fs" or
+// a bare "fs" resolve; it only selects a package's Node-specific files, which
+// may import builtins edon doesn't provide.
+func WithConditions(conditions ...string) Option {
+	return func(c *config) {
+		c.conditions = nil
+		for _, condition := range conditions {
+			condition = strings.TrimSpace(condition)
+			if condition != "" && condition != "default" && !slices.Contains(c.conditions, condition) {
+				c.conditions = append(c.conditions, condition)
+			}
+		}
+		c.conditions = append(c.conditions, "default")
+	}
+}
+
+// WithTLSConfig sets the TLS configuration the built-in client uses for
+// registry, CDN and JSR requests, for example to require a minimum version or
+// to trust only an internal CA through RootCAs. The loader and the package
+// managers it creates share the client, so they share the policy. The
+// config is cloned; by default the system roots apply. Like the connection
+// options it has no effect with WithHTTPClient.
+func WithTLSConfig(tlsConfig *tls.Config) Option {
+	return func(c *config) {
+		c.tlsConfig = tlsConfig
+	}
+}
+
+// WithCACertFile trusts the PEM certificates in path in addition to the
+// system roots, or to the RootCAs of WithTLSConfig when set, so mirrors
+// signed by an internal CA verify. A file that can't be read or holds no
+// certificates fails NewNPMPackageManager and every request with
+// errors.ErrTLSConfig. It has no effect with WithHTTPClient.
+func WithCACertFile(path string) Option {
+	return func(c *config) {
+		c.caCertFile = path
+	}
+}
+
+// WithEngines sets the engine versions installs check packages' "engines"
+// fields against, such as {"node": "20.0.0"}. Packages needing a newer or
+// older version of a listed engine install with an EngineWarnings entry;
+// engines missing from the map aren't checked. The default checks node
+// against 18.0.0.
+func WithEngines(engines map[string]string) Option {
+	return func(c *config) {
+		c.engines = engines
+	}
+}
+
+// WithStrictEngines makes an "engines" mismatch fail the install with
+// errors.ErrEngineMismatch instead of only being reported. The package stays
+// in the cache.
+func WithStrictEngines(strict bool) Option {
+	return func(c *config) {
+		c.strictEngines = strict
+	}
+}
+
+// WithCDNs sets the CDNs a "cdn:" specifier such as "cdn:react@18" tries,
+// in order, as base URLs like "https://esm.sh/". The specifier is appended
+// to each base and the first CDN to serve it wins. The bases must be CDN
+// hosts the loader accepts. The default is esm.sh, then unpkg, then
+// jsDelivr.
+func WithCDNs(bases ...string) Option {
+	return func(c *config) {
+		c.cdns = bases
+	}
+}
+
+// WithFailFast sets what LoadModules, Warm and LoadGraph do when a load
+// fails. With fail fast the first failure cancels the loads still running
+// and is the only error returned, which suits interactive use. By default
+// every load is attempted and the failures are joined into one error whose
+// Unwrap() []error lists each of them, so CI sees everything that's wrong.
+func WithFailFast(enabled bool) Option {
+	return func(c *config) {
+		c.failFast = enabled
+	}
+}
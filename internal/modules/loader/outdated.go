@@ -0,0 +1,83 @@
+package loader
+
+import (
+	"context"
+	"path/filepath"
+)
+
+// anyRelease matches every version except prereleases
+var anyRelease = rangeSet{{}}
+
+// OutdatedPackage compares a declared dependency with what the registry has
+type OutdatedPackage struct {
+	Name string
+	// Range is the version, range or dist-tag the dependency declares
+	Range string
+	// Current is the highest installed version that satisfies Range, or
+	// empty when none is installed
+	Current string
+	// Wanted is the highest published version that satisfies Range
+	Wanted string
+	// Latest is the version the registry tags "latest"
+	Latest string
+}
+
+// IsOutdated reports whether a newer version than the one installed is
+// available, within Range or not
+func (p *OutdatedPackage) IsOutdated() bool {
+	return p.Current != p.Wanted || p.Current != p.Latest
+}
+
+// Outdated looks up the versions of name the registry has and compares them
+// with spec, as package.json declares it, and the versions in the cache
+func (pm *NPMPackageManager) Outdated(ctx context.Context, name, spec string) (*OutdatedPackage, error) {
+	if err := ValidatePackageName(name); err != nil {
+		return nil, err
+	}
+	doc, err := pm.fetchPackument(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	wanted, err := doc.resolve(spec)
+	if err != nil {
+		return nil, err
+	}
+	result := &OutdatedPackage{
+		Name:    name,
+		Range:   spec,
+		Current: pm.installedVersion(name, spec),
+		Wanted:  wanted.Version,
+		Latest:  doc.DistTags["latest"],
+	}
+	if result.Latest == "" {
+		// Registries without a latest tag still list every version
+		available := make([]string, 0, len(doc.Versions))
+		for v := range doc.Versions {
+			available = append(available, v)
+		}
+		result.Latest, _ = maxSatisfying(available, anyRelease)
+	}
+	return result, nil
+}
+
+// installedVersion returns the highest cached version of name that
+// satisfies spec; a dist-tag, which the cache can't check, takes the highest
+func (pm *NPMPackageManager) installedVersion(name, spec string) string {
+	entries, err := readDirIfExists(filepath.Join(pm.cacheDir, filepath.FromSlash(name)))
+	if err != nil {
+		return ""
+	}
+	var installed []string
+	for _, e := range entries {
+		if e.IsDir() && isExactVersion(e.Name()) {
+			installed = append(installed, e.Name())
+		}
+	}
+	r, ok := parseRange(spec)
+	if !ok {
+		r = anyRelease
+	}
+	version, _ := maxSatisfying(installed, r)
+	return version
+}
@@ -0,0 +1,188 @@
+package loader
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/katungi/edon/internal/errors"
+)
+
+// Overrides forces the versions ResolveTree picks for packages, whatever
+// their dependents ask for, as the "overrides" field of npm's package.json
+// does. Build one with ParseOverrides.
+type Overrides struct {
+	root *overrideNode
+}
+
+// overrideNode is one level of an overrides block. version replaces the
+// package's requested version; children apply to the packages below it.
+type overrideNode struct {
+	// path names the node, such as "express > debug", so resolutions under
+	// different nodes are told apart
+	path     string
+	version  string
+	children []*overrideNode
+	// name and selector are the package the node applies to and, when the
+	// key was "name@range", the versions it applies to
+	name     string
+	selector string
+}
+
+// ParseOverrides reads an npm-style "overrides" block:
+//
+//	{
+//	  "left-pad": "1.3.0",
+//	  "express": {"debug": "2.6.9"},
+//	  "body-parser@1": {".": "1.20.2", "qs": "$qs"}
+//	}
+//
+// A string forces that version everywhere in the tree. An object scopes its
+// entries to the packages below the named one, with "." overriding the
+// package itself. Keys may select versions as "name@range". A value of
+// "$name" stands for the range the root project declares for name.
+func ParseOverrides(block map[string]any) (*Overrides, error) {
+	root, err := parseOverrideNode("", "", block)
+	if err != nil {
+		return nil, err
+	}
+	return &Overrides{root: root}, nil
+}
+
+func parseOverrideNode(path, key string, block map[string]any) (*overrideNode, error) {
+	node := &overrideNode{path: path}
+	if key != "" {
+		node.name, node.selector = splitOverrideKey(key)
+	}
+	for key, value := range block {
+		if key == "." {
+			version, ok := value.(string)
+			if !ok {
+				return nil, errors.Wrap(errors.ErrInvalidOverride, fmt.Sprintf(`%q: "." must be a version`, path))
+			}
+			node.version = version
+			continue
+		}
+
+		childPath := key
+		if path != "" {
+			childPath = path + " > " + key
+		}
+		name, _ := splitOverrideKey(key)
+		if err := ValidatePackageName(name); err != nil {
+			return nil, errors.Wrap(errors.ErrInvalidOverride, fmt.Sprintf("%q: %v", childPath, err))
+		}
+		switch value := value.(type) {
+		case string:
+			child := &overrideNode{path: childPath, version: value}
+			child.name, child.selector = splitOverrideKey(key)
+			node.children = append(node.children, child)
+		case map[string]any:
+			child, err := parseOverrideNode(childPath, key, value)
+			if err != nil {
+				return nil, err
+			}
+			node.children = append(node.children, child)
+		default:
+			return nil, errors.Wrap(errors.ErrInvalidOverride, fmt.Sprintf("%q must be a version or an object", childPath))
+		}
+	}
+	return node, nil
+}
+
+// splitOverrideKey splits "name@range" into its parts; the range is empty
+// for a bare name
+func splitOverrideKey(key string) (name, selector string) {
+	if i := strings.LastIndex(key, "@"); i > 0 {
+		return key[:i], key[i+1:]
+	}
+	return key, ""
+}
+
+// WithOverrides forces the versions ResolveTree picks, as ParseOverrides
+// describes. Install then caches the overridden versions.
+func WithOverrides(overrides *Overrides) Option {
+	return func(c *config) {
+		c.overrides = overrides
+	}
+}
+
+// match returns the child of n that applies to a dependency called name.
+// version gives the version the dependency would otherwise resolve to; it
+// is only called for "name@range" keys.
+func (n *overrideNode) match(name string, version func() (string, error)) (*overrideNode, error) {
+	for _, child := range n.children {
+		if child.name != name {
+			continue
+		}
+		if child.selector != "" {
+			resolved, err := version()
+			if err != nil {
+				return nil, err
+			}
+			r, ok := parseRange(child.selector)
+			v, valid := parseVersion(resolved)
+			if !ok || !valid || !r.matches(v) {
+				continue
+			}
+		}
+		return child, nil
+	}
+	return nil, nil
+}
+
+// overrideScope is the chain of override nodes that apply below a package,
+// outermost first
+type overrideScope []*overrideNode
+
+// key identifies the scope, telling apart resolutions of the same spec
+// under different override nodes
+func (s overrideScope) key() string {
+	if len(s) == 0 {
+		return ""
+	}
+	return s[len(s)-1].path
+}
+
+// apply returns the version to resolve for a dependency called name that
+// asked for version, and the scope that applies below it. The innermost
+// matching node wins. resolve gives the version that was asked for resolves
+// to, and roots maps the root project's dependencies to their ranges for
+// "$name" values.
+func (s overrideScope) apply(name, version string, roots map[string]string, resolve func() (string, error)) (string, overrideScope, error) {
+	// Version selectors are checked against what would be resolved anyway,
+	// which only needs looking up once
+	var resolved string
+	var resolveErr error
+	once := func() (string, error) {
+		if resolved == "" && resolveErr == nil {
+			resolved, resolveErr = resolve()
+		}
+		return resolved, resolveErr
+	}
+
+	for i := len(s) - 1; i >= 0; i-- {
+		node, err := s[i].match(name, once)
+		if err != nil {
+			return "", nil, err
+		}
+		if node == nil {
+			continue
+		}
+
+		below := s
+		if len(node.children) > 0 {
+			below = append(s[:len(s):len(s)], node)
+		}
+		if node.version == "" {
+			return version, below, nil
+		}
+		forced := node.version
+		if ref, ok := strings.CutPrefix(forced, "$"); ok {
+			if forced, ok = roots[ref]; !ok {
+				return "", nil, errors.Wrap(errors.ErrInvalidOverride, fmt.Sprintf("%q refers to %s, which the project doesn't depend on", node.path, ref))
+			}
+		}
+		return forced, below, nil
+	}
+	return version, s, nil
+}
@@ -0,0 +1,127 @@
+package loader
+
+import (
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// packumentCacheDir holds registry documents with their ETags, under the
+// base cache directory, so resolving a package again can revalidate them
+const packumentCacheDir = "packuments"
+
+// defaultPackumentTTL is how long a cached registry document is used before
+// the registry is asked whether it changed
+const defaultPackumentTTL = 5 * time.Minute
+
+// WithPackumentTTL sets how long a package's cached registry document is
+// used without asking the registry about it, so versions published in the
+// meantime are seen once it has passed. An older document is revalidated
+// with If-None-Match, and a 304 keeps using it for another ttl rather than
+// downloading every version's metadata again. Zero revalidates every time.
+// The default is 5 minutes.
+func WithPackumentTTL(ttl time.Duration) Option {
+	return func(c *config) {
+		c.packumentTTL = ttl
+	}
+}
+
+// packumentCache keeps registry documents on disk with their ETags and when
+// they were last fetched or revalidated
+type packumentCache struct {
+	backend CacheBackend
+	ttl     time.Duration
+	// bypass skips reading cached documents, which are still written
+	bypass bool
+}
+
+// cachedPackument is a registry document read back from the cache
+type cachedPackument struct {
+	raw       []byte
+	etag      string
+	fetchedAt time.Time
+}
+
+// newPackumentCache returns the packument cache under base, or nil when
+// caching is off
+func newPackumentCache(base string, cfg *config) *packumentCache {
+	if cfg.noCache {
+		return nil
+	}
+	return &packumentCache{
+		backend: NewDiskCacheBackend(filepath.Join(base, packumentCacheDir)),
+		ttl:     cfg.packumentTTL,
+		bypass:  cfg.cacheMode == CacheBypassRead,
+	}
+}
+
+// cachedPackument returns name's cached document from registry, or nil
+func (pm *NPMPackageManager) cachedPackument(registry, name string) *cachedPackument {
+	c := pm.packuments
+	if c == nil || c.bypass {
+		return nil
+	}
+	key := c.key(registry, name)
+	raw, ok := c.backend.Get(key)
+	if !ok {
+		return nil
+	}
+	entry := &cachedPackument{raw: raw}
+	if etag, ok := c.backend.Get(key + ".etag"); ok {
+		entry.etag = string(etag)
+	}
+	if fetched, ok := c.backend.Get(key + ".fetched"); ok {
+		if unix, err := strconv.ParseInt(string(fetched), 10, 64); err == nil {
+			entry.fetchedAt = time.Unix(unix, 0)
+		}
+	}
+	return entry
+}
+
+// key returns the key name's document from registry is stored under
+func (c *packumentCache) key(registry, name string) string {
+	return hashContent(registry + "/" + name)
+}
+
+// fresh reports whether entry was fetched or revalidated within the TTL
+func (c *packumentCache) fresh(entry *cachedPackument) bool {
+	return !entry.fetchedAt.IsZero() && time.Since(entry.fetchedAt) < c.ttl
+}
+
+// put stores a document the registry sent, with its ETag. A failed write
+// only costs a full fetch next time, so it isn't reported.
+func (c *packumentCache) put(registry, name string, raw []byte, etag string) {
+	if c == nil {
+		return
+	}
+	key := c.key(registry, name)
+	if c.backend.Put(key, raw) != nil {
+		return
+	}
+	if etag == "" {
+		_ = c.backend.Delete(key + ".etag")
+	} else {
+		_ = c.backend.Put(key+".etag", []byte(etag))
+	}
+	c.touch(registry, name)
+}
+
+// touch records that name's document from registry was just fetched or
+// confirmed unchanged
+func (c *packumentCache) touch(registry, name string) {
+	if c == nil {
+		return
+	}
+	_ = c.backend.Put(c.key(registry, name)+".fetched", []byte(strconv.FormatInt(time.Now().Unix(), 10)))
+}
+
+// remove deletes name's cached document from registry
+func (c *packumentCache) remove(registry, name string) {
+	if c == nil {
+		return
+	}
+	key := c.key(registry, name)
+	for _, k := range []string{key, key + ".etag", key + ".fetched"} {
+		_ = c.backend.Delete(k)
+	}
+}
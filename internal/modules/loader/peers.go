@@ -0,0 +1,70 @@
+package loader
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// peerFields are the peer dependency fields of a package.json, shared by
+// registry metadata and installed manifests
+type peerFields struct {
+	PeerDependencies     map[string]string `json:"peerDependencies"`
+	PeerDependenciesMeta map[string]struct {
+		Optional bool `json:"optional"`
+	} `json:"peerDependenciesMeta"`
+}
+
+// optionalPeers returns the peers peerDependenciesMeta marks optional
+func (p peerFields) optionalPeers() map[string]bool {
+	var optional map[string]bool
+	for name, meta := range p.PeerDependenciesMeta {
+		if meta.Optional {
+			if optional == nil {
+				optional = make(map[string]bool)
+			}
+			optional[name] = true
+		}
+	}
+	return optional
+}
+
+// PeerWarnings checks the peerDependencies of each package in tree against
+// the versions tree resolved, as ResolveTree returns it. A peer is met when
+// some version of it in tree satisfies the range. Each unmet peer gets a
+// warning, except optional peers that are missing altogether: those are
+// only wrong when present at a version outside their range. Warnings are
+// sorted.
+func PeerWarnings(tree []*ResolvedPackage) []string {
+	versions := make(map[string][]string)
+	for _, pkg := range tree {
+		versions[pkg.Name] = append(versions[pkg.Name], pkg.Version)
+	}
+
+	var warnings []string
+	for _, pkg := range tree {
+		for peer, spec := range pkg.PeerDependencies {
+			present := versions[peer]
+			if len(present) == 0 {
+				if !pkg.OptionalPeers[peer] {
+					warnings = append(warnings, fmt.Sprintf("%s needs peer %s@%s, which isn't installed", pkg, peer, spec))
+				}
+				continue
+			}
+			r, ok := parseRange(spec)
+			if !ok {
+				// Tags and other non-ranges can't be checked
+				continue
+			}
+			if _, ok := maxSatisfying(present, r); !ok {
+				installed := make([]string, len(present))
+				for i, version := range present {
+					installed[i] = peer + "@" + version
+				}
+				warnings = append(warnings, fmt.Sprintf("%s needs peer %s@%s, but %s is installed", pkg, peer, spec, strings.Join(installed, ", ")))
+			}
+		}
+	}
+	sort.Strings(warnings)
+	return warnings
+}
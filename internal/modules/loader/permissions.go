@@ -0,0 +1,83 @@
+package loader
+
+import (
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/katungi/edon/internal/errors"
+)
+
+// Grant is a single permission: either everything, or only the listed
+// entries. The zero Grant denies everything.
+type Grant struct {
+	All   bool
+	Allow []string
+}
+
+// Permissions limits what the loader may reach on behalf of the code it runs.
+// Net entries are hosts, optionally with a port ("example.com",
+// "localhost:8080"); Read entries are paths whose whole subtree is granted.
+type Permissions struct {
+	Net  Grant
+	Read Grant
+}
+
+// checkNet verifies that rawURL's host may be contacted. A nil Permissions
+// allows everything.
+func (p *Permissions) checkNet(rawURL string) error {
+	if p == nil || p.Net.All {
+		return nil
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return errors.Wrap(errors.ErrInvalidURL, err.Error())
+	}
+
+	for _, allowed := range p.Net.Allow {
+		if hostMatches(u, allowed) {
+			return nil
+		}
+	}
+	return errors.Wrap(errors.ErrPermissionDenied, "net access to "+u.Host)
+}
+
+// hostMatches reports whether u's host is granted by allowed. An entry
+// without a port grants every port on that host.
+func hostMatches(u *url.URL, allowed string) bool {
+	host, port, err := net.SplitHostPort(allowed)
+	if err != nil {
+		return strings.EqualFold(u.Hostname(), allowed)
+	}
+	if !strings.EqualFold(u.Hostname(), host) {
+		return false
+	}
+	want := u.Port()
+	if want == "" {
+		switch u.Scheme {
+		case "https":
+			want = "443"
+		case "http":
+			want = "80"
+		}
+	}
+	return want == port
+}
+
+// checkRead verifies that path may be read. A nil Permissions allows
+// everything.
+func (p *Permissions) checkRead(path string) error {
+	if p == nil || p.Read.All {
+		return nil
+	}
+	if len(p.Read.Allow) == 0 {
+		return errors.Wrap(errors.ErrPermissionDenied, "read access to "+path)
+	}
+
+	err := checkAllowedPath(path, p.Read.Allow)
+	if errors.Is(err, errors.ErrPathEscape) {
+		return errors.Wrap(errors.ErrPermissionDenied, "read access to "+path)
+	}
+	return err
+}
@@ -0,0 +1,52 @@
+package loader
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/katungi/edon/internal/errors"
+)
+
+// CacheDir returns the directory installed packages are kept in
+func (pm *NPMPackageManager) CacheDir() string {
+	return pm.cacheDir
+}
+
+// Registry returns the primary registry URL
+func (pm *NPMPackageManager) Registry() string {
+	return pm.registries[0]
+}
+
+// Ping checks that the primary registry answers a HEAD request for its
+// root, using the same client, proxy and timeouts as installs. Any response
+// short of a server error counts as reachable.
+func (pm *NPMPackageManager) Ping(ctx context.Context) error {
+	registry := pm.Registry()
+	if pm.offline {
+		return errors.Wrap(errors.ErrOffline, registry)
+	}
+	if err := pm.permissions.checkNet(registry); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, pm.timeouts.Metadata)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, registry+"/", nil)
+	if err != nil {
+		return errors.Wrap(errors.ErrPackageFetch, err.Error())
+	}
+	resp, err := pm.httpClient.Do(req)
+	if errors.Is(err, errors.ErrRegistryAuth) {
+		return err
+	}
+	if err != nil {
+		return errors.Wrap(errors.ErrPackageFetch, err.Error())
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 500 {
+		return errors.Wrap(errors.ErrPackageFetch, fmt.Sprintf("HEAD %s/: %s", registry, resp.Status))
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package loader
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/katungi/edon/internal/errors"
+)
+
+// maxPackageNameLength is the longest name the npm registry accepts
+const maxPackageNameLength = 214
+
+// ValidatePackageName checks name, optionally scoped as "@scope/name",
+// against npm's rules for new packages: at most 214 characters, lowercase
+// letters, digits, "-", "." and "_" only, and no part starting with "." or
+// "_". Names are used in registry URLs and cache paths, so anything that
+// fails is rejected with errors.ErrInvalidPackageName before either is built.
+func ValidatePackageName(name string) error {
+	invalid := func(reason string) error {
+		return errors.Wrap(errors.ErrInvalidPackageName, fmt.Sprintf("%q %s", name, reason))
+	}
+
+	switch {
+	case name == "":
+		return errors.ErrPackageRequired
+	case len(name) > maxPackageNameLength:
+		return invalid(fmt.Sprintf("is longer than %d characters", maxPackageNameLength))
+	case name == "node_modules" || name == "favicon.ico":
+		return invalid("is reserved")
+	}
+
+	parts := []string{name}
+	if strings.HasPrefix(name, "@") {
+		scope, pkg, ok := strings.Cut(name[1:], "/")
+		if !ok {
+			return invalid(`must be "@scope/name"`)
+		}
+		parts = []string{scope, pkg}
+	}
+	for _, part := range parts {
+		if part == "" {
+			return invalid("has an empty scope or name")
+		}
+		if part[0] == '.' || part[0] == '_' {
+			return invalid(`can't start with "." or "_"`)
+		}
+		for _, r := range part {
+			if !isPackageNameChar(r) {
+				return invalid(fmt.Sprintf("can't contain %q", r))
+			}
+		}
+	}
+	return nil
+}
+
+// isPackageNameChar reports whether r may appear in a package or scope name
+func isPackageNameChar(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '.' || r == '_'
+}
@@ -0,0 +1,101 @@
+package loader
+
+import (
+	"context"
+	"sync"
+)
+
+// prefetcher tracks the background loads started by WithPrefetch
+type prefetcher struct {
+	// inflight holds the URLs currently being prefetched, so a module
+	// imported from several places is only fetched once
+	inflight sync.Map
+
+	// mu orders starting prefetches against Close waiting for them
+	mu      sync.Mutex
+	running sync.WaitGroup
+	stopped bool
+	// stop is cancelled by Close to abandon prefetches still running
+	stop   context.Context
+	cancel context.CancelFunc
+}
+
+func newPrefetcher() *prefetcher {
+	p := &prefetcher{}
+	p.stop, p.cancel = context.WithCancel(context.Background())
+	return p
+}
+
+// start registers a prefetch about to run, reporting false once the
+// loader is closed
+func (p *prefetcher) start() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stopped {
+		return false
+	}
+	p.running.Add(1)
+	return true
+}
+
+// close cancels the prefetches still running and waits for them to return
+func (p *prefetcher) close() {
+	p.mu.Lock()
+	p.stopped = true
+	p.mu.Unlock()
+	p.cancel()
+	p.running.Wait()
+}
+
+// prefetch starts background loads of module's direct imports, each of which
+// prefetches its own imports until depth runs out. It returns immediately.
+func (l *ModuleLoader) prefetch(ctx context.Context, module *Module, depth int) {
+	if depth <= 0 {
+		return
+	}
+	imports, err := l.Imports(module)
+	if err != nil {
+		l.emit(LoadEvent{Kind: EventPrefetchFailed, URL: module.URL, Type: module.Type, Err: err})
+		return
+	}
+
+	for _, specifier := range imports {
+		resolved, err := l.ResolveImport(module, specifier)
+		if err != nil {
+			continue
+		}
+		validation := l.validate(resolved)
+		// Bare package names and the like need resolution the loader
+		// doesn't do, so they aren't worth a failed prefetch
+		if !validation.IsValid || l.getFromCache(newCacheKey(validation.PackageType, resolved)) != nil {
+			continue
+		}
+		if _, busy := l.prefetcher.inflight.LoadOrStore(resolved, struct{}{}); busy {
+			continue
+		}
+		if !l.prefetcher.start() {
+			l.prefetcher.inflight.Delete(resolved)
+			return
+		}
+
+		go func(specifier string) {
+			defer l.prefetcher.running.Done()
+			defer l.prefetcher.inflight.Delete(specifier)
+
+			ctx, cancel := context.WithCancel(ctx)
+			defer cancel()
+			defer context.AfterFunc(l.prefetcher.stop, cancel)()
+
+			release, err := l.config.acquire(ctx)
+			if err != nil {
+				return
+			}
+			defer release()
+
+			// Speculative: the real import will report any error
+			if _, err := l.load(ctx, specifier, depth-1, false); err != nil && ctx.Err() == nil {
+				l.emit(LoadEvent{Kind: EventPrefetchFailed, Specifier: specifier, URL: specifier, Err: err})
+			}
+		}(resolved)
+	}
+}
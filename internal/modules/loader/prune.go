@@ -0,0 +1,126 @@
+package loader
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/katungi/edon/internal/errors"
+)
+
+// CacheSize returns the bytes the package cache takes up on disk
+func (pm *NPMPackageManager) CacheSize() (int64, error) {
+	return dirSize(pm.cacheDir)
+}
+
+// PruneCache removes the least recently used packages until the package
+// cache takes up at most maxBytes, returning how many bytes it freed. A
+// package is used whenever it is installed or served from the cache, which
+// sets its directory's modification time. Packages named in keep as
+// "name@version", such as those a lockfile pins, are never removed, even if
+// that leaves the cache over budget.
+func (pm *NPMPackageManager) PruneCache(maxBytes int64, keep ...string) (int64, error) {
+	total, err := pm.CacheSize()
+	if err != nil {
+		return 0, err
+	}
+	dirs, err := listPackageDirs(pm.cacheDir)
+	if err != nil {
+		return 0, err
+	}
+
+	type cached struct {
+		dir, name string
+		size      int64
+		usedAt    time.Time
+	}
+	var packages []cached
+	for _, dir := range dirs {
+		// Directories are listed as "name/version"
+		name, version := path.Dir(dir), path.Base(dir)
+		if slices.Contains(keep, name+"@"+version) {
+			continue
+		}
+		full := filepath.Join(pm.cacheDir, filepath.FromSlash(dir))
+		info, err := os.Stat(full)
+		if err != nil {
+			continue
+		}
+		size, err := dirSize(full)
+		if err != nil {
+			return 0, err
+		}
+		packages = append(packages, cached{dir: full, size: size, usedAt: info.ModTime(), name: name})
+	}
+	sort.Slice(packages, func(i, j int) bool { return packages[i].usedAt.Before(packages[j].usedAt) })
+
+	var freed int64
+	for _, pkg := range packages {
+		if total-freed <= maxBytes {
+			break
+		}
+		if err := removePackageDir(pm.cacheDir, pkg.dir, pkg.name); err != nil {
+			return freed, err
+		}
+		freed += pkg.size
+	}
+	return freed, nil
+}
+
+// removePackageDir deletes one installed version, moving it aside first so
+// the package never appears half-deleted, then drops the package's directory
+// if no versions are left
+func removePackageDir(cacheDir, dir, name string) error {
+	trash, err := os.MkdirTemp(cacheDir, ".pruned-*")
+	if err != nil {
+		return errors.Wrap(errors.ErrCacheDir, err.Error())
+	}
+	defer os.RemoveAll(trash)
+	if err := os.Rename(dir, filepath.Join(trash, "old")); err != nil {
+		return errors.Wrap(errors.ErrCacheDir, err.Error())
+	}
+
+	// Remove only succeeds on empty directories, which is all that's wanted
+	parent := filepath.Join(cacheDir, filepath.FromSlash(name))
+	_ = os.Remove(parent)
+	if scope := filepath.Dir(parent); scope != cacheDir {
+		_ = os.Remove(scope)
+	}
+	return nil
+}
+
+// markUsed records that the package at dir was just used, for PruneCache
+func markUsed(dir string) {
+	now := time.Now()
+	_ = os.Chtimes(dir, now, now)
+}
+
+// dirSize sums the sizes of the regular files under dir
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Files removed mid-walk, as by a concurrent prune, don't count
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return nil
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, errors.Wrap(errors.ErrFileRead, err.Error())
+	}
+	return size, nil
+}
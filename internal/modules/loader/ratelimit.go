@@ -0,0 +1,103 @@
+package loader
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// defaultRateLimit and defaultRateBurst bound requests to any one host.
+// They're well above what a normal install needs, and only stop runaway
+// fan-out from getting edon banned by a registry.
+const (
+	defaultRateLimit = 50
+	defaultRateBurst = 50
+)
+
+// withRateLimit returns a copy of client that sends at most perSecond
+// requests a second to each host, allowing bursts of up to burst. The caller's
+// client is left untouched.
+func withRateLimit(client *http.Client, perSecond float64, burst int) *http.Client {
+	if perSecond <= 0 {
+		return client
+	}
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	wrapped := *client
+	wrapped.Transport = &rateLimitTransport{
+		base:      base,
+		perSecond: perSecond,
+		burst:     float64(max(burst, 1)),
+		buckets:   make(map[string]*tokenBucket),
+	}
+	return &wrapped
+}
+
+// rateLimitTransport keeps a token bucket per host, so a busy CDN doesn't
+// slow down registry requests
+type rateLimitTransport struct {
+	base      http.RoundTripper
+	perSecond float64
+	burst     float64
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+// tokenBucket holds the tokens left for one host as of last. Tokens go
+// negative when requests are waiting for them.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func (t *rateLimitTransport) CloseIdleConnections() { closeIdleConnections(t.base) }
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	wait := t.reserve(req.URL.Host)
+	if wait <= 0 {
+		return t.base.RoundTrip(req)
+	}
+
+	timer := time.NewTimer(wait)
+	select {
+	case <-req.Context().Done():
+		timer.Stop()
+		t.cancel(req.URL.Host)
+		return nil, req.Context().Err()
+	case <-timer.C:
+	}
+	return t.base.RoundTrip(req)
+}
+
+// reserve takes a token from host's bucket and returns how long to wait
+// before the request may be sent
+func (t *rateLimitTransport) reserve(host string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	bucket, ok := t.buckets[host]
+	if !ok {
+		bucket = &tokenBucket{tokens: t.burst, last: now}
+		t.buckets[host] = bucket
+	}
+	bucket.tokens = min(t.burst, bucket.tokens+now.Sub(bucket.last).Seconds()*t.perSecond)
+	bucket.last = now
+	bucket.tokens--
+	if bucket.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-bucket.tokens / t.perSecond * float64(time.Second))
+}
+
+// cancel returns the token of a request that gave up waiting
+func (t *rateLimitTransport) cancel(host string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if bucket, ok := t.buckets[host]; ok {
+		bucket.tokens = min(t.burst, bucket.tokens+1)
+	}
+}
@@ -0,0 +1,97 @@
+package loader
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/katungi/edon/internal/errors"
+)
+
+// redirectCache remembers the URL each remote URL finally redirected to, so
+// fetching it again, as on a reload or from another loader, goes straight
+// there instead of walking the redirect chain. Mappings are kept in memory
+// and, when there is one, in the disk cache beside the module's entry.
+type redirectCache struct {
+	mu      sync.RWMutex
+	targets map[string]string
+	disk    *diskCache
+}
+
+// newRedirectCache returns a redirect cache persisted to disk, if not nil
+func newRedirectCache(disk *diskCache) *redirectCache {
+	return &redirectCache{targets: make(map[string]string), disk: disk}
+}
+
+// get returns where url last redirected to. A nil cache has no entries.
+func (c *redirectCache) get(url string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	c.mu.RLock()
+	target, ok := c.targets[url]
+	c.mu.RUnlock()
+	if ok || c.disk == nil {
+		return target, ok
+	}
+
+	data, ok := c.disk.backend.Get(c.disk.redirectKey(url))
+	if !ok {
+		return "", false
+	}
+	target = string(data)
+	c.mu.Lock()
+	c.targets[url] = target
+	c.mu.Unlock()
+	return target, true
+}
+
+// set records that url redirected to target. A failed disk write only costs
+// a redirect on the next run.
+func (c *redirectCache) set(url, target string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.targets[url] = target
+	c.mu.Unlock()
+	if c.disk != nil {
+		_ = c.disk.backend.Put(c.disk.redirectKey(url), []byte(target))
+	}
+}
+
+// remove forgets where url redirected to
+func (c *redirectCache) remove(url string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	delete(c.targets, url)
+	c.mu.Unlock()
+	if c.disk != nil {
+		_ = c.disk.backend.Delete(c.disk.redirectKey(url))
+	}
+}
+
+// redirectKey returns the key that stores where url redirected to
+func (d *diskCache) redirectKey(url string) string {
+	return d.key(url) + ".redirect"
+}
+
+// recordRedirects returns a copy of client that sets *final to the URL of
+// each redirect it follows, so after a request it holds the last one
+func recordRedirects(client *http.Client, final *string) *http.Client {
+	wrapped := *client
+	next := client.CheckRedirect
+	wrapped.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if next != nil {
+			if err := next(req, via); err != nil {
+				return err
+			}
+		} else if len(via) >= 10 {
+			return errors.Wrap(errors.ErrModuleFetch, "stopped after 10 redirects")
+		}
+		*final = req.URL.String()
+		return nil
+	}
+	return &wrapped
+}
@@ -0,0 +1,85 @@
+package loader
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/katungi/edon/internal/errors"
+)
+
+// isRelativeSpecifier reports whether specifier is a "./" or "../" import
+func isRelativeSpecifier(specifier string) bool {
+	return strings.HasPrefix(specifier, "./") || strings.HasPrefix(specifier, "../")
+}
+
+// ResolveRelative resolves a relative import such as "./c.js" against the URL
+// of the module importing it, returning a specifier LoadModule accepts. Bare
+// specifiers and URLs are returned unchanged.
+//
+// Local imports resolve against the importer's directory and CDN imports
+// against its URL, or the versioned URL a deno.land import redirected to.
+// Inside npm and jsr packages they resolve against the importer's subpath,
+// so "./c.js" from "npm:pkg@1.0.0/lib/a.js" is "npm:pkg@1.0.0/lib/c.js"; a
+// package's entry module resolves from the package root. Imports can't
+// climb out of their package. Git imports work the same way on the file
+// after the ref, so "./c.js" from "git+https://host/repo.git#v1:lib/a.js" is
+// "git+https://host/repo.git#v1:lib/c.js", and tarball imports on the file
+// after "#", so "./c.js" from "https://host/pkg.tgz#lib/a.js" is
+// "https://host/pkg.tgz#lib/c.js". Virtual imports resolve against the
+// virtual module's URL.
+func ResolveRelative(base *Module, specifier string) (string, error) {
+	if !isRelativeSpecifier(specifier) {
+		return specifier, nil
+	}
+
+	switch base.Type {
+	case TypeLocal:
+		// A directory import's index.js resolves from inside the directory
+		return filepath.Join(filepath.Dir(base.resolvedURL()), filepath.FromSlash(specifier)), nil
+	case TypeCDN:
+		// Imports inside a redirected deno.land module stay on its version
+		baseURL, err := url.Parse(base.resolvedURL())
+		if err != nil {
+			return "", errors.Wrap(errors.ErrInvalidURL, err.Error())
+		}
+		ref, err := url.Parse(specifier)
+		if err != nil {
+			return "", errors.Wrap(errors.ErrInvalidURL, err.Error())
+		}
+		return baseURL.ResolveReference(ref).String(), nil
+	case TypeNPM, TypeJSR:
+		return resolvePackageRelative(base.URL, specifier)
+	case TypeGit:
+		return resolveGitRelative(base.URL, specifier)
+	case TypeTarball:
+		return resolveTarballRelative(base.URL, specifier)
+	case TypeVirtual:
+		return resolveVirtualRelative(base.URL, specifier)
+	}
+	return "", errors.Wrap(errors.ErrUnsupportedModule,
+		fmt.Sprintf("relative import %s from %s module %s", specifier, base.Type, base.URL))
+}
+
+// resolvePackageRelative resolves specifier against the subpath of a package
+// specifier such as "npm:pkg@1.0.0/lib/a.js", keeping the package and version
+// as the importer wrote them
+func resolvePackageRelative(importer, specifier string) (string, error) {
+	_, _, subpath := ParseNPMSpecifier(strings.TrimPrefix(importer, "jsr:"))
+	pkg := importer
+	if subpath != "" {
+		pkg = strings.TrimSuffix(importer, "/"+subpath)
+	}
+
+	resolved := path.Join(path.Dir(subpath), specifier)
+	if resolved == ".." || strings.HasPrefix(resolved, "../") {
+		return "", errors.Wrap(errors.ErrInvalidURL,
+			fmt.Sprintf("relative import %s escapes package %s", specifier, pkg))
+	}
+	if resolved == "." {
+		return pkg, nil
+	}
+	return pkg + "/" + resolved, nil
+}
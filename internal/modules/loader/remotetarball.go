@@ -0,0 +1,212 @@
+package loader
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/katungi/edon/internal/errors"
+)
+
+// tarballCacheDir holds one extracted package per tarball URL
+const tarballCacheDir = "tarball-cache"
+
+// isTarballURL reports whether rawURL is an HTTP(S) URL of an npm-style
+// package tarball, such as "https://dist.example.com/pkg-1.0.0.tgz". A
+// fragment names a file inside the package, as in "pkg-1.0.0.tgz#lib/a.js".
+func isTarballURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return false
+	}
+	return strings.HasSuffix(u.Path, ".tgz") || strings.HasSuffix(u.Path, ".tar.gz")
+}
+
+// parseTarballURL splits a tarball URL into the URL downloaded and the file
+// inside the package after "#"
+func parseTarballURL(specifier string) (tarballURL, subpath string, err error) {
+	tarballURL, subpath, _ = strings.Cut(specifier, "#")
+	subpath = strings.Trim(subpath, "/")
+	if subpath != "" && !filepath.IsLocal(filepath.FromSlash(subpath)) {
+		return "", "", errors.Wrap(errors.ErrInvalidURL, "tarball subpath escapes the package: "+subpath)
+	}
+	return tarballURL, subpath, nil
+}
+
+// loadTarballModule downloads and extracts a package tarball, unless an
+// earlier load already did, and loads the requested file, or the package's
+// entry point, from it like an npm package
+func (l *ModuleLoader) loadTarballModule(ctx context.Context, specifier string, reload bool) (*Module, error) {
+	tarballURL, subpath, err := parseTarballURL(specifier)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := l.tarballPackage(ctx, tarballURL, reload)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := l.resolveEntry(specifier, dir, subpath)
+	if err != nil {
+		return nil, err
+	}
+	content, err := readModuleFile(file, l.config.maxModuleSize)
+	if err != nil {
+		return nil, err
+	}
+
+	module := &Module{
+		URL:       specifier,
+		Content:   string(content),
+		Type:      TypeTarball,
+		MediaType: mediaTypeFromPath(file),
+	}
+	module.Format, err = packageModuleFormat(dir, file, TypeTarball)
+	if err != nil {
+		return nil, err
+	}
+	module.SourceMapURL, module.SourceMap = resolveSourceMap(module.Content, file)
+	return module, nil
+}
+
+// tarballPackage returns the directory holding the package extracted from
+// tarballURL, downloading it if the cache doesn't have it yet. Packages are
+// keyed by URL, so a URL that is republished keeps its first contents until
+// it is reloaded.
+func (l *ModuleLoader) tarballPackage(ctx context.Context, tarballURL string, reload bool) (string, error) {
+	base, err := l.config.cacheBase()
+	if err != nil {
+		return "", err
+	}
+	parent := filepath.Join(base, tarballCacheDir)
+	dir := filepath.Join(parent, hashContent(tarballURL)[:16])
+	refetch := reload || l.config.cacheMode == CacheBypassRead || l.config.noCache
+	if _, err := os.Stat(dir); err == nil && !refetch {
+		return dir, nil
+	}
+
+	if l.config.offline {
+		return "", errors.Wrap(errors.ErrOffline, tarballURL)
+	}
+	if err := l.config.permissions.checkNet(tarballURL); err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return "", errors.Wrap(errors.ErrCacheDir, err.Error())
+	}
+	tarball, err := l.downloadTarball(ctx, tarballURL, parent)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tarball)
+
+	staging, err := os.MkdirTemp(parent, ".extract-*")
+	if err != nil {
+		return "", errors.Wrap(errors.ErrCacheDir, err.Error())
+	}
+	// A no-op once the rename has succeeded
+	defer os.RemoveAll(staging)
+	if err := os.Chmod(staging, 0755); err != nil {
+		return "", errors.Wrap(errors.ErrCacheDir, err.Error())
+	}
+	if err := extractTarball(ctx, tarball, staging); err != nil {
+		return "", err
+	}
+	if !isFile(filepath.Join(staging, "package.json")) {
+		return "", errors.Wrap(errors.ErrInvalidPackage, tarballURL+": the archive has no package/package.json")
+	}
+
+	if err := os.Rename(staging, dir); err != nil {
+		_, statErr := os.Stat(dir)
+		switch {
+		case statErr != nil:
+			return "", errors.Wrap(errors.ErrCacheDir, err.Error())
+		case refetch:
+			if err := replaceDir(staging, dir); err != nil {
+				return "", err
+			}
+		}
+		// Otherwise another load extracted it first; its copy is just as good
+	}
+	return dir, nil
+}
+
+// downloadTarball saves the tarball at tarballURL to a temporary file in dir
+// and returns its path
+func (l *ModuleLoader) downloadTarball(ctx context.Context, tarballURL, dir string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, l.config.timeouts.Tarball)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, tarballURL, nil)
+	if err != nil {
+		return "", errors.Wrap(errors.ErrInvalidURL, err.Error())
+	}
+	resp, err := l.config.secureRedirects(l.httpClient).Do(req)
+	if err != nil {
+		if errors.Is(err, errors.ErrInsecureURL) {
+			return "", err
+		}
+		return "", errors.Wrap(errors.ErrModuleFetch, err.Error())
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return "", errors.Wrap(errors.ErrModuleNotFound, tarballURL)
+	case resp.StatusCode != http.StatusOK:
+		return "", errors.Wrap(errors.ErrModuleFetch, fmt.Sprintf("GET %s: %s", tarballURL, resp.Status))
+	}
+
+	tmp, err := os.CreateTemp(dir, "download-*.tgz")
+	if err != nil {
+		return "", errors.Wrap(errors.ErrCacheDir, err.Error())
+	}
+	defer tmp.Close()
+	if _, err := io.Copy(tmp, resp.Body); err != nil {
+		os.Remove(tmp.Name())
+		return "", errors.Wrap(errors.ErrModuleFetch, err.Error())
+	}
+	return tmp.Name(), nil
+}
+
+// tarballExists downloads the tarball, if it isn't cached, and checks for
+// the file the URL names
+func (l *ModuleLoader) tarballExists(ctx context.Context, specifier string) (bool, error) {
+	tarballURL, subpath, err := parseTarballURL(specifier)
+	if err != nil {
+		return false, err
+	}
+	dir, err := l.tarballPackage(ctx, tarballURL, false)
+	if errors.Is(err, errors.ErrModuleNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if _, err := l.resolveEntry(specifier, dir, subpath); err != nil {
+		if errors.Is(err, errors.ErrModuleNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// resolveTarballRelative resolves specifier against the file a tarball URL
+// names, as resolveGitRelative does for git specifiers
+func resolveTarballRelative(importer, specifier string) (string, error) {
+	tarballURL, subpath, _ := strings.Cut(importer, "#")
+	resolved := path.Join(path.Dir(subpath), specifier)
+	if resolved == ".." || strings.HasPrefix(resolved, "../") {
+		return "", errors.Wrap(errors.ErrInvalidURL, "relative import "+specifier+" escapes package "+tarballURL)
+	}
+	if resolved == "." {
+		return tarballURL, nil
+	}
+	return tarballURL + "#" + resolved, nil
+}
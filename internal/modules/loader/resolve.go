@@ -0,0 +1,330 @@
+package loader
+
+import (
+	"context"
+	"slices"
+	"sort"
+
+	"github.com/katungi/edon/internal/errors"
+)
+
+// ResolvedPackage is a concrete package version chosen from registry
+// metadata, before anything is downloaded
+type ResolvedPackage struct {
+	Name         string
+	Version      string
+	Tarball      string
+	Integrity    string
+	Shasum       string
+	Dependencies map[string]string
+	// OptionalDependencies are dependencies the package works without, such
+	// as platform-specific native builds, so failing to resolve or install
+	// them isn't fatal
+	OptionalDependencies map[string]string
+	// Optional is set by ResolveTree when only optional dependencies lead to
+	// the package, so it may be left out if it fails to install
+	Optional bool
+	// Registry is the registry whose metadata the package was resolved
+	// from; it is empty for packages resolved from the cache
+	Registry string
+	// Truncated is set by ResolveTree when WithMaxDepth stopped it from
+	// resolving the package's dependencies
+	Truncated bool
+	// PeerDependencies are the packages the package expects its dependents
+	// to provide, and OptionalPeers those of them it can do without
+	PeerDependencies map[string]string
+	OptionalPeers    map[string]bool
+	// Workspace is the directory of the workspace package the dependency
+	// links to; it is empty for registry packages
+	Workspace string
+}
+
+// String returns "name@version"
+func (p *ResolvedPackage) String() string {
+	return p.Name + "@" + p.Version
+}
+
+// Resolve picks the version of a package that a specifier such as
+// "lodash@^4" selects, using only registry metadata
+func (pm *NPMPackageManager) Resolve(ctx context.Context, packageName string) (*ResolvedPackage, error) {
+	name, version := splitNameVersion(packageName)
+	if err := ValidatePackageName(name); err != nil {
+		return nil, err
+	}
+
+	if pm.offline {
+		return nil, errors.Wrap(errors.ErrOffline, packageName)
+	}
+
+	doc, err := pm.fetchPackument(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return resolveFromPackument(doc, name, version)
+}
+
+// resolveFromPackument resolves version against an already fetched packument
+func resolveFromPackument(doc *packument, name, version string) (*ResolvedPackage, error) {
+	meta, err := doc.resolve(version)
+	if err != nil {
+		return nil, err
+	}
+	return &ResolvedPackage{
+		Name:                 name,
+		Version:              meta.Version,
+		Tarball:              meta.Dist.Tarball,
+		Integrity:            meta.Dist.Integrity,
+		Shasum:               meta.Dist.Shasum,
+		Dependencies:         meta.Dependencies,
+		OptionalDependencies: meta.OptionalDependencies,
+		Registry:             doc.registry,
+		PeerDependencies:     meta.PeerDependencies,
+		OptionalPeers:        meta.optionalPeers(),
+	}, nil
+}
+
+// SkippedOptional is an optional dependency ResolveOptionalTree left out
+// because it couldn't be resolved
+type SkippedOptional struct {
+	// Spec is the dependency as declared, "name@range"
+	Spec string
+	// Dependent is the "name@version" that declared it, or empty for one of
+	// the optional packages ResolveOptionalTree was given
+	Dependent string
+	Err       error
+}
+
+// ResolveTree resolves packages and all of their transitive dependencies
+// without downloading anything. Each name@version appears once, sorted by
+// name then version. Exact versions already in the cache are resolved from
+// their cached package.json, so a fully cached tree resolves offline. With
+// WithMaxDepth, dependencies deeper than the limit are left out, and with
+// WithOverrides, overridden packages resolve to their forced versions.
+// optionalDependencies are followed unless WithOptionalDependencies turns
+// them off, and left out when they can't be resolved; ResolveOptionalTree
+// reports which were.
+func (pm *NPMPackageManager) ResolveTree(ctx context.Context, packages []string) ([]*ResolvedPackage, error) {
+	tree, _, err := pm.ResolveOptionalTree(ctx, packages, nil)
+	return tree, err
+}
+
+// ResolveOptionalTree is ResolveTree for packages along with optional
+// packages, such as a package.json's optionalDependencies. Optional packages,
+// and everything only they lead to, are marked Optional; those that can't be
+// resolved are left out and returned as skipped rather than failing the
+// resolution, as are any optional dependencies of the packages resolved.
+func (pm *NPMPackageManager) ResolveOptionalTree(ctx context.Context, packages, optional []string) ([]*ResolvedPackage, []SkippedOptional, error) {
+	// queued is a spec waiting to be resolved, depth levels below the
+	// request, with the overrides that apply to it. optional marks specs
+	// only optional dependencies lead to, and dependent names the package
+	// that declared one.
+	type queued struct {
+		spec      string
+		depth     int
+		scope     overrideScope
+		optional  bool
+		dependent string
+	}
+	var scope overrideScope
+	if pm.overrides != nil {
+		scope = overrideScope{pm.overrides.root}
+	}
+	if pm.noOptional {
+		optional = nil
+	}
+	// "$name" overrides refer to the ranges the requested packages have
+	roots := make(map[string]string, len(packages)+len(optional))
+	for _, spec := range slices.Concat(packages, optional) {
+		name, version := splitNameVersion(spec)
+		roots[name] = version
+	}
+
+	packuments := make(map[string]*packument)
+	resolved := make(map[string]*ResolvedPackage)
+	queue := make([]queued, 0, len(packages)+len(optional))
+	for _, spec := range packages {
+		queue = append(queue, queued{spec: spec, scope: scope})
+	}
+	for _, spec := range optional {
+		queue = append(queue, queued{spec: spec, scope: scope, optional: true})
+	}
+	seen := make(map[string]bool)
+	walked := make(map[string]bool)
+	var skipped []SkippedOptional
+	// skip leaves out an optional spec that failed, or fails the resolution
+	// for any other
+	skip := func(next queued, spec string, err error) error {
+		if !next.optional || ctx.Err() != nil {
+			return errors.Wrap(err, spec)
+		}
+		skipped = append(skipped, SkippedOptional{Spec: next.spec, Dependent: next.dependent, Err: err})
+		return nil
+	}
+
+	// The queue is breadth-first, so each spec is met at its shallowest depth
+	for len(queue) > 0 {
+		next := queue[0]
+		queue = queue[1:]
+		// The same spec may resolve differently under different overrides.
+		// One met as optional is passed over once it's been met as required,
+		// and met again when it turns out to be required.
+		seenKey := next.spec + "\x00" + next.scope.key()
+		if seen[seenKey] || next.optional && seen[seenKey+"\x00optional"] {
+			continue
+		}
+		if next.optional {
+			seen[seenKey+"\x00optional"] = true
+		} else {
+			seen[seenKey] = true
+		}
+
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+
+		spec := next.spec
+		below := next.scope
+		if len(next.scope) > 0 {
+			name, version := splitNameVersion(spec)
+			forced, scope, err := next.scope.apply(name, version, roots, func() (string, error) {
+				pkg, err := pm.resolveCached(ctx, spec, packuments)
+				if err != nil {
+					return "", err
+				}
+				return pkg.Version, nil
+			})
+			if err != nil {
+				if err := skip(next, spec, err); err != nil {
+					return nil, nil, err
+				}
+				continue
+			}
+			spec, below = name+"@"+forced, scope
+		}
+
+		pkg, err := pm.resolveCached(ctx, spec, packuments)
+		if err != nil {
+			if err := skip(next, spec, err); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+		// A package is walked again only under overrides it hasn't been
+		// walked under yet, or when it turns out to be required
+		walkKey := pkg.String() + "\x00" + below.key()
+		if walked[walkKey] || next.optional && walked[walkKey+"\x00optional"] {
+			continue
+		}
+		if next.optional {
+			walked[walkKey+"\x00optional"] = true
+		} else {
+			walked[walkKey] = true
+		}
+		if existing, ok := resolved[pkg.String()]; ok {
+			pkg = existing
+			pkg.Optional = pkg.Optional && next.optional
+		} else {
+			pkg.Optional = next.optional
+			resolved[pkg.String()] = pkg
+		}
+
+		if pm.maxDepth >= 0 && next.depth >= pm.maxDepth {
+			pkg.Truncated = len(pkg.Dependencies) > 0 || !pm.noOptional && len(pkg.OptionalDependencies) > 0
+			continue
+		}
+		// Only dependencies are followed. As in npm, a package's
+		// devDependencies are for working on it and never come with it, and
+		// a dependency also listed as optional is optional.
+		for dep, version := range pkg.Dependencies {
+			if _, ok := pkg.OptionalDependencies[dep]; ok && !pm.noOptional {
+				continue
+			}
+			queue = append(queue, queued{spec: dep + "@" + version, depth: next.depth + 1, scope: below, optional: next.optional})
+		}
+		if pm.noOptional {
+			continue
+		}
+		for dep, version := range pkg.OptionalDependencies {
+			queue = append(queue, queued{spec: dep + "@" + version, depth: next.depth + 1, scope: below, optional: true, dependent: pkg.String()})
+		}
+	}
+
+	tree := make([]*ResolvedPackage, 0, len(resolved))
+	for _, pkg := range resolved {
+		tree = append(tree, pkg)
+	}
+	sort.Slice(tree, func(i, j int) bool {
+		if tree[i].Name != tree[j].Name {
+			return tree[i].Name < tree[j].Name
+		}
+		a, _ := parseVersion(tree[i].Version)
+		b, _ := parseVersion(tree[j].Version)
+		return compareVersions(a, b) < 0
+	})
+	return tree, skipped, nil
+}
+
+// lockedVersion returns the highest version WithLockedVersions pinned name
+// to that spec allows, or "" when none does
+func (pm *NPMPackageManager) lockedVersion(name, spec string) string {
+	r, ok := parseRange(spec)
+	if !ok {
+		return ""
+	}
+	var best *version
+	for i, v := range pm.locked[name] {
+		if r.matches(v) && (best == nil || compareVersions(v, *best) > 0) {
+			best = &pm.locked[name][i]
+		}
+	}
+	if best == nil {
+		return ""
+	}
+	return best.String()
+}
+
+// resolveCached resolves spec from the cache when it names an installed
+// exact version, or a range a locked version satisfies, and otherwise from
+// the registry, fetching each packument at most once per call
+func (pm *NPMPackageManager) resolveCached(ctx context.Context, spec string, packuments map[string]*packument) (*ResolvedPackage, error) {
+	name, version := splitNameVersion(spec)
+	// Dependency names come from registry metadata, so they are checked too
+	if err := ValidatePackageName(name); err != nil {
+		return nil, err
+	}
+
+	if ws := pm.workspace(name, version); ws != nil {
+		return ws.resolved(), nil
+	}
+	if pinned := pm.lockedVersion(name, version); pinned != "" {
+		version, spec = pinned, name+"@"+pinned
+	}
+	if cachePath, ok := pm.cachedPath(name, version); ok {
+		manifest, err := readPackageManifest(cachePath)
+		if err != nil {
+			return nil, err
+		}
+		return &ResolvedPackage{
+			Name:                 name,
+			Version:              version,
+			Dependencies:         manifest.Dependencies,
+			OptionalDependencies: manifest.OptionalDependencies,
+			PeerDependencies:     manifest.PeerDependencies,
+			OptionalPeers:        manifest.optionalPeers(),
+		}, nil
+	}
+
+	if pm.offline {
+		return nil, errors.Wrap(errors.ErrOffline, spec)
+	}
+
+	doc, ok := packuments[name]
+	if !ok {
+		var err error
+		if doc, err = pm.fetchPackument(ctx, name); err != nil {
+			return nil, err
+		}
+		packuments[name] = doc
+	}
+	return resolveFromPackument(doc, name, version)
+}
@@ -0,0 +1,156 @@
+package loader
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultMaxRetries is how many times a rate-limited request is retried
+// before the 429 response is handed back to the caller
+const defaultMaxRetries = 3
+
+// defaultRetryBudget is how many retries one LoadGraph, LoadModules or Warm
+// call may spend across all of its requests
+const defaultRetryBudget = 20
+
+// withRetry returns a copy of client that retries requests answered with
+// 429 Too Many Requests, waiting as long as the server's Retry-After header
+// asks. Each retry is counted in m, when set. The caller's client is left
+// untouched.
+func withRetry(client *http.Client, maxRetries int, m *metricsCollector) *http.Client {
+	if maxRetries <= 0 {
+		return client
+	}
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	wrapped := *client
+	wrapped.Transport = &retryTransport{base: base, maxRetries: maxRetries, metrics: m}
+	return &wrapped
+}
+
+// retryTransport retries rate-limited requests after the delay the server
+// gives in Retry-After
+type retryTransport struct {
+	base       http.RoundTripper
+	maxRetries int
+	metrics    *metricsCollector
+}
+
+func (t *retryTransport) CloseIdleConnections() { closeIdleConnections(t.base) }
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := t.base.RoundTrip(req)
+		if err != nil || resp.StatusCode != http.StatusTooManyRequests || attempt >= t.maxRetries {
+			return resp, err
+		}
+		// Once the operation's budget is spent, failures come straight back
+		if !takeRetry(req.Context(), req.URL.String()) {
+			return resp, nil
+		}
+		// A consumed body can't be sent again
+		if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+			return resp, nil
+		}
+
+		wait, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		if !ok {
+			return resp, nil
+		}
+		// Waiting past the deadline would only trade the 429 for a timeout
+		if deadline, has := req.Context().Deadline(); has && time.Now().Add(wait).After(deadline) {
+			return resp, nil
+		}
+
+		resp.Body.Close()
+		if t.metrics != nil {
+			t.metrics.retries.Add(1)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+	}
+}
+
+// retryBudgetKey is the context key of the budget of a running operation
+type retryBudgetKey struct{}
+
+// retryBudget counts down the retries an operation has left, shared by every
+// request it makes however many modules and packages those are
+type retryBudget struct {
+	remaining atomic.Int64
+	exhausted sync.Once
+	emit      func(LoadEvent)
+}
+
+// withRetryBudget returns ctx carrying a fresh WithRetryBudget budget. An
+// operation nested in another, such as Warm calling LoadModules, spends the
+// outer one's budget.
+func (l *ModuleLoader) withRetryBudget(ctx context.Context) context.Context {
+	if l.config.retryBudget <= 0 || ctx.Value(retryBudgetKey{}) != nil {
+		return ctx
+	}
+	budget := &retryBudget{emit: l.emit}
+	budget.remaining.Store(int64(l.config.retryBudget))
+	return context.WithValue(ctx, retryBudgetKey{}, budget)
+}
+
+// takeRetry spends one retry of ctx's budget on url, reporting whether there
+// was one left. Requests made outside a budgeted operation may always retry.
+func takeRetry(ctx context.Context, url string) bool {
+	budget, ok := ctx.Value(retryBudgetKey{}).(*retryBudget)
+	if !ok {
+		return true
+	}
+	left := budget.remaining.Add(-1)
+	if left < 0 {
+		budget.exhausted.Do(func() {
+			budget.emit(LoadEvent{Kind: EventRetryBudgetExhausted, URL: url})
+		})
+		return false
+	}
+	budget.emit(LoadEvent{Kind: EventRetry, URL: url, RetriesLeft: int(left)})
+	return true
+}
+
+// parseRetryAfter reads a Retry-After header in either delta-seconds
+// ("120") or HTTP-date ("Wed, 21 Oct 2015 07:28:00 GMT") form, returning how
+// long to wait from now. Dates in the past mean retry immediately.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	at, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	return max(at.Sub(now), 0), true
+}
@@ -0,0 +1,56 @@
+package loader
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/katungi/edon/internal/errors"
+)
+
+// checkAllowedPath verifies that path lies inside one of roots once symlinks
+// are resolved, so neither ".." segments nor links can escape the sandbox.
+// An empty root list allows every path.
+func checkAllowedPath(path string, roots []string) error {
+	if len(roots) == 0 {
+		return nil
+	}
+
+	real, err := canonicalPath(path)
+	if err != nil {
+		return err
+	}
+
+	for _, root := range roots {
+		realRoot, err := canonicalPath(root)
+		if err != nil {
+			continue
+		}
+		if isWithin(real, realRoot) {
+			return nil
+		}
+	}
+
+	return errors.Wrap(errors.ErrPathEscape, path)
+}
+
+// canonicalPath returns the absolute path with all symlinks resolved
+func canonicalPath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", errors.Wrap(errors.ErrModuleNotFound, err.Error())
+	}
+	real, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return "", errors.Wrap(errors.ErrFileRead, err.Error())
+	}
+	return real, nil
+}
+
+// isWithin reports whether path is root or a descendant of it
+func isWithin(path, root string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
@@ -0,0 +1,27 @@
+package loader
+
+import "fmt"
+
+// lifecycleScripts are the package.json scripts npm runs when a package is
+// installed, in the order it runs them. edon never runs them.
+var lifecycleScripts = []string{"preinstall", "install", "postinstall"}
+
+// checkScripts records in installed.ScriptWarnings each install script the
+// package declares, so callers can say what didn't run. A broken manifest
+// has already been dealt with by checkEngines.
+func checkScripts(installed *InstalledPackage) (*InstalledPackage, error) {
+	manifest, err := readPackageManifest(installed.Path)
+	if brokenManifest(err) {
+		return installed, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range lifecycleScripts {
+		if script, ok := manifest.Scripts[name]; ok {
+			installed.ScriptWarnings = append(installed.ScriptWarnings,
+				fmt.Sprintf("%s@%s has a %s script that edon did not run: %s", installed.Name, installed.Version, name, script))
+		}
+	}
+	return installed, nil
+}
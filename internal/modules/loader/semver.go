@@ -0,0 +1,457 @@
+package loader
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/katungi/edon/internal/errors"
+)
+
+// version is a parsed semantic version (MAJOR.MINOR.PATCH[-PRERELEASE][+BUILD])
+type version struct {
+	major, minor, patch int
+	prerelease          string
+}
+
+// parseVersion parses a concrete semantic version. A leading "v" or "=" is
+// accepted, build metadata is ignored.
+func parseVersion(s string) (version, bool) {
+	s = strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(s), "="), "v")
+	s, _, _ = strings.Cut(s, "+")
+	core, prerelease, _ := strings.Cut(s, "-")
+
+	parts := strings.Split(core, ".")
+	if len(parts) != 3 {
+		return version{}, false
+	}
+
+	var nums [3]int
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 || (len(part) > 1 && part[0] == '0') {
+			return version{}, false
+		}
+		nums[i] = n
+	}
+
+	return version{major: nums[0], minor: nums[1], patch: nums[2], prerelease: prerelease}, true
+}
+
+// String formats v without build metadata, e.g. "1.2.3-beta.1"
+func (v version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.major, v.minor, v.patch)
+	if v.prerelease != "" {
+		s += "-" + v.prerelease
+	}
+	return s
+}
+
+// PinVersion returns the range to save in package.json for an installed
+// version: the version alone for prefix "", or a "^" or "~" range starting at
+// it. A leading "v" or "=" and build metadata are dropped. Prereleases keep
+// their tag, so "^1.2.3-beta.1" allows later 1.2.3 prereleases as well as
+// releases below 2.0.0, and "^0.1.2" stays within 0.1.x as caret ranges do
+// for 0.x versions.
+func PinVersion(v, prefix string) (string, error) {
+	if prefix != "" && prefix != "^" && prefix != "~" {
+		return "", errors.Wrap(errors.ErrInvalidSavePrefix, prefix)
+	}
+	parsed, ok := parseVersion(v)
+	if !ok {
+		return "", errors.Wrap(errors.ErrInvalidVersion, v)
+	}
+	return prefix + parsed.String(), nil
+}
+
+// ValidateVersion checks that v is a concrete semantic version, as the
+// version field of package.json must be, returning errors.ErrInvalidVersion
+// if it isn't
+func ValidateVersion(v string) error {
+	if _, ok := parseVersion(v); !ok {
+		return errors.Wrap(errors.ErrInvalidVersion, fmt.Sprintf("%q", v))
+	}
+	return nil
+}
+
+// isExactVersion reports whether s names a single concrete version rather
+// than a dist-tag or range
+func isExactVersion(s string) bool {
+	_, ok := parseVersion(s)
+	return ok
+}
+
+// compareVersions returns -1, 0 or 1 as a is lower than, equal to or higher than b
+func compareVersions(a, b version) int {
+	for _, d := range [][2]int{{a.major, b.major}, {a.minor, b.minor}, {a.patch, b.patch}} {
+		if d[0] != d[1] {
+			if d[0] < d[1] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return comparePrerelease(a.prerelease, b.prerelease)
+}
+
+// CompareVersions returns -1, 0 or 1 as version a is lower than, equal to or
+// higher than b, by semver precedence. Invalid versions sort lowest.
+func CompareVersions(a, b string) int {
+	va, okA := parseVersion(a)
+	vb, okB := parseVersion(b)
+	switch {
+	case okA && okB:
+		return compareVersions(va, vb)
+	case okA:
+		return 1
+	case okB:
+		return -1
+	}
+	return 0
+}
+
+// comparePrerelease orders prerelease tags; a release sorts after any prerelease
+func comparePrerelease(a, b string) int {
+	switch {
+	case a == b:
+		return 0
+	case a == "":
+		return 1
+	case b == "":
+		return -1
+	}
+
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		if as[i] == bs[i] {
+			continue
+		}
+		an, aErr := strconv.Atoi(as[i])
+		bn, bErr := strconv.Atoi(bs[i])
+		switch {
+		case aErr == nil && bErr == nil:
+			if an < bn {
+				return -1
+			}
+			return 1
+		case aErr == nil:
+			// Numeric identifiers sort before alphanumeric ones
+			return -1
+		case bErr == nil:
+			return 1
+		case as[i] < bs[i]:
+			return -1
+		default:
+			return 1
+		}
+	}
+
+	switch {
+	case len(as) < len(bs):
+		return -1
+	case len(as) > len(bs):
+		return 1
+	}
+	return 0
+}
+
+// comparator is a single constraint such as ">=1.2.0"
+type comparator struct {
+	op string
+	v  version
+}
+
+func (c comparator) matches(v version) bool {
+	cmp := compareVersions(v, c.v)
+	switch c.op {
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	default:
+		return cmp == 0
+	}
+}
+
+// versionRange is a set of comparators that must all hold
+type versionRange []comparator
+
+// rangeSet is a union of ranges, at least one of which must hold
+type rangeSet []versionRange
+
+// matches reports whether v satisfies any range in the set
+func (rs rangeSet) matches(v version) bool {
+	for _, r := range rs {
+		if r.matches(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// rangeOperators are the prefixes a range term may separate from its
+// version with spaces, as in ">= 1.2.0"
+var rangeOperators = map[string]bool{
+	">=": true, "<=": true, ">": true, "<": true, "=": true, "^": true, "~": true, "~>": true,
+}
+
+// parseRange parses a full npm range: "||"-separated alternatives, each
+// either a hyphen range such as "1.2.3 - 2.3.4" or space-separated terms
+// that must all hold, like ">=1.2.0 <2.0.0". An empty alternative matches
+// any release.
+func parseRange(s string) (rangeSet, bool) {
+	var set rangeSet
+	for _, alt := range strings.Split(s, "||") {
+		fields := strings.Fields(alt)
+		if len(fields) == 3 && fields[1] == "-" {
+			r, ok := hyphenRange(fields[0], fields[2])
+			if !ok {
+				return nil, false
+			}
+			set = append(set, r)
+			continue
+		}
+
+		r := versionRange{}
+		if len(fields) == 0 {
+			fields = []string{"*"}
+		}
+		for i := 0; i < len(fields); i++ {
+			term := fields[i]
+			if rangeOperators[term] && i+1 < len(fields) {
+				i++
+				term += fields[i]
+			}
+			parsed, ok := parseTerm(term)
+			if !ok {
+				return nil, false
+			}
+			r = append(r, parsed...)
+		}
+		set = append(set, r)
+	}
+	return set, true
+}
+
+// hyphenRange parses "lo - hi", inclusive at both ends. A partial upper
+// bound covers everything it stands for, so "1.2.3 - 2.3" means <2.4.0.
+func hyphenRange(lo, hi string) (versionRange, bool) {
+	low, ok := parsePartial(lo)
+	if !ok {
+		return nil, false
+	}
+	high, ok := parsePartial(hi)
+	if !ok {
+		return nil, false
+	}
+
+	r := versionRange{{op: ">=", v: low.floor()}}
+	switch len(high.nums) {
+	case 0:
+		// No upper bound
+	case 3:
+		r = append(r, comparator{op: "<=", v: high.floor()})
+	default:
+		r = append(r, comparator{op: "<", v: high.bump(len(high.nums) - 1)})
+	}
+	return r, true
+}
+
+// parseTerm parses a single npm range term: an exact version, a caret or
+// tilde range, an x-range such as "1.x" or "*", or a comparator like ">=1.2"
+func parseTerm(s string) (versionRange, bool) {
+	s = strings.TrimSpace(s)
+	switch {
+	case strings.HasPrefix(s, "^"):
+		return caretRange(s[1:])
+	case strings.HasPrefix(s, "~"):
+		return tildeRange(strings.TrimPrefix(s[1:], ">"))
+	}
+
+	for _, op := range []string{">=", "<=", ">", "<", "="} {
+		if strings.HasPrefix(s, op) {
+			return comparatorRange(op, strings.TrimSpace(s[len(op):]))
+		}
+	}
+	return xRange(s)
+}
+
+// matches reports whether v satisfies every comparator. Prerelease versions
+// only match when a comparator names a prerelease of the same version tuple,
+// so "^1.0.0" never selects "2.0.0-beta.1".
+func (r versionRange) matches(v version) bool {
+	for _, c := range r {
+		if !c.matches(v) {
+			return false
+		}
+	}
+	if v.prerelease == "" {
+		return true
+	}
+	for _, c := range r {
+		if c.v.prerelease != "" && c.v.major == v.major && c.v.minor == v.minor && c.v.patch == v.patch {
+			return true
+		}
+	}
+	return false
+}
+
+// partial is a possibly incomplete version such as "1", "1.2" or "1.x"
+type partial struct {
+	nums       []int
+	prerelease string
+}
+
+// parsePartial parses a version whose trailing components may be missing or
+// wildcards ("x", "X", "*")
+func parsePartial(s string) (partial, bool) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "v")
+	s, _, _ = strings.Cut(s, "+")
+	core, prerelease, _ := strings.Cut(s, "-")
+
+	var p partial
+	if core == "" {
+		return p, true
+	}
+	parts := strings.Split(core, ".")
+	if len(parts) > 3 {
+		return p, false
+	}
+	for _, part := range parts {
+		if part == "x" || part == "X" || part == "*" {
+			break
+		}
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return p, false
+		}
+		p.nums = append(p.nums, n)
+	}
+	if len(p.nums) == 3 {
+		p.prerelease = prerelease
+	}
+	return p, true
+}
+
+// floor returns the lowest version matching the partial
+func (p partial) floor() version {
+	var nums [3]int
+	copy(nums[:], p.nums)
+	return version{major: nums[0], minor: nums[1], patch: nums[2], prerelease: p.prerelease}
+}
+
+// bump returns the lowest version above everything matching the partial,
+// incrementing the component at index
+func (p partial) bump(index int) version {
+	var nums [3]int
+	copy(nums[:], p.nums)
+	nums[index]++
+	for i := index + 1; i < 3; i++ {
+		nums[i] = 0
+	}
+	// "-0" is the lowest possible prerelease, so "<2.0.0-0" excludes 2.0.0 betas
+	return version{major: nums[0], minor: nums[1], patch: nums[2], prerelease: "0"}
+}
+
+func xRange(s string) (versionRange, bool) {
+	p, ok := parsePartial(s)
+	if !ok {
+		return nil, false
+	}
+	switch len(p.nums) {
+	case 0:
+		return versionRange{{op: ">=", v: version{}}}, true
+	case 3:
+		return versionRange{{op: "=", v: p.floor()}}, true
+	}
+	return versionRange{{op: ">=", v: p.floor()}, {op: "<", v: p.bump(len(p.nums) - 1)}}, true
+}
+
+func caretRange(s string) (versionRange, bool) {
+	p, ok := parsePartial(s)
+	if !ok {
+		return nil, false
+	}
+	if len(p.nums) == 0 {
+		return versionRange{{op: ">=", v: version{}}}, true
+	}
+
+	// The upper bound bumps the first non-zero component that was given
+	index := 0
+	for index < len(p.nums)-1 && p.nums[index] == 0 {
+		index++
+	}
+	return versionRange{{op: ">=", v: p.floor()}, {op: "<", v: p.bump(index)}}, true
+}
+
+func tildeRange(s string) (versionRange, bool) {
+	p, ok := parsePartial(s)
+	if !ok {
+		return nil, false
+	}
+	switch len(p.nums) {
+	case 0:
+		return versionRange{{op: ">=", v: version{}}}, true
+	case 1:
+		return versionRange{{op: ">=", v: p.floor()}, {op: "<", v: p.bump(0)}}, true
+	}
+	return versionRange{{op: ">=", v: p.floor()}, {op: "<", v: p.bump(1)}}, true
+}
+
+func comparatorRange(op, s string) (versionRange, bool) {
+	p, ok := parsePartial(s)
+	if !ok {
+		return nil, false
+	}
+	if len(p.nums) == 3 || len(p.nums) == 0 {
+		if len(p.nums) == 0 && (op == "<" || op == ">") {
+			// "<*" and ">*" can never match
+			return versionRange{{op: "<", v: version{}}}, true
+		}
+		return versionRange{{op: op, v: p.floor()}}, true
+	}
+
+	// Partial versions compare against the whole range they stand for
+	last := len(p.nums) - 1
+	switch op {
+	case ">":
+		return versionRange{{op: ">=", v: p.bump(last)}}, true
+	case "<=":
+		return versionRange{{op: "<", v: p.bump(last)}}, true
+	case "=":
+		return xRange(s)
+	}
+	return versionRange{{op: op, v: p.floor()}}, true
+}
+
+// MaxSatisfying returns the highest of versions that the npm range spec
+// allows, as the registry would resolve it. "latest" allows any release.
+func MaxSatisfying(versions []string, spec string) (string, bool) {
+	if spec == "latest" {
+		return maxSatisfying(versions, anyRelease)
+	}
+	r, ok := parseRange(spec)
+	if !ok {
+		return "", false
+	}
+	return maxSatisfying(versions, r)
+}
+
+// maxSatisfying returns the highest of versions that satisfies r
+func maxSatisfying(versions []string, r rangeSet) (string, bool) {
+	best, bestVersion, found := "", version{}, false
+	for _, s := range versions {
+		v, ok := parseVersion(s)
+		if !ok || !r.matches(v) {
+			continue
+		}
+		if !found || compareVersions(v, bestVersion) > 0 {
+			best, bestVersion, found = s, v, true
+		}
+	}
+	return best, found
+}
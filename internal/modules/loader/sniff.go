@@ -0,0 +1,52 @@
+package loader
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net/http"
+
+	"github.com/katungi/edon/internal/errors"
+)
+
+// htmlPrefixes open the HTML pages misconfigured hosts serve, with a 200,
+// in place of a missing module; they are compared lowercased
+var htmlPrefixes = [][]byte{[]byte("<!doctype html"), []byte("<html")}
+
+// WithAllowHTML turns off the check that rejects a CDN response which is an
+// HTML page rather than a module, for the rare import of HTML as text. By
+// default a response whose Content-Type doesn't name a module type, and
+// whose content starts like an HTML document, fails with
+// errors.ErrHTMLResponse instead of being cached as a broken module.
+func WithAllowHTML(enabled bool) Option {
+	return func(c *config) {
+		c.allowHTML = enabled
+	}
+}
+
+// checkHTML rejects content served for url that looks like an HTML page,
+// unless the server declared it a module type or WithAllowHTML is set
+func (c *config) checkHTML(resp *http.Response, url string, content []byte) error {
+	if c.allowHTML || !looksLikeHTML(content) {
+		return nil
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if _, ok := contentTypes[mediaType]; ok {
+		return nil
+	}
+	return errors.Wrap(errors.ErrHTMLResponse,
+		fmt.Sprintf("GET %s answered with a web page (Content-Type %q); check the URL and that the host serves the file", url, resp.Header.Get("Content-Type")))
+}
+
+// looksLikeHTML reports whether content starts like an HTML document,
+// after any byte order mark and leading whitespace
+func looksLikeHTML(content []byte) bool {
+	head := bytes.TrimLeft(bytes.TrimPrefix(content, []byte("\xef\xbb\xbf")), " \t\r\n")
+	head = bytes.ToLower(head[:min(len(head), 16)])
+	for _, prefix := range htmlPrefixes {
+		if bytes.HasPrefix(head, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,112 @@
+package loader
+
+import (
+	"encoding/base64"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// sourceMapScanLines bounds how many trailing non-blank lines are searched
+// for a sourceMappingURL comment
+const sourceMapScanLines = 3
+
+// sourceMapPrefixes are the comment forms bundlers emit; "//@" is the legacy
+// spelling still produced by some older tools
+var sourceMapPrefixes = []string{
+	"//# sourceMappingURL=",
+	"//@ sourceMappingURL=",
+	"/*# sourceMappingURL=",
+	"/*@ sourceMappingURL=",
+}
+
+// findSourceMapRef returns the sourceMappingURL named in the trailing lines of
+// content, or "" if there is none
+func findSourceMapRef(content string) string {
+	lines := strings.Split(strings.TrimRight(content, " \t\r\n"), "\n")
+
+	scanned := 0
+	for i := len(lines) - 1; i >= 0 && scanned < sourceMapScanLines; i-- {
+		line := strings.TrimSpace(lines[i])
+		if line == "" {
+			continue
+		}
+		scanned++
+
+		for _, prefix := range sourceMapPrefixes {
+			if ref, ok := strings.CutPrefix(line, prefix); ok {
+				ref = strings.TrimSpace(strings.TrimSuffix(ref, "*/"))
+				return ref
+			}
+		}
+	}
+	return ""
+}
+
+// resolveSourceMap inspects a module's trailing sourceMappingURL comment.
+// Inline data: maps are decoded and returned as inline; any other reference
+// is resolved against base, the module's URL or file path. A missing or
+// malformed reference yields empty results rather than failing the load.
+func resolveSourceMap(content, base string) (mapURL, inline string) {
+	ref := findSourceMapRef(content)
+	if ref == "" {
+		return "", ""
+	}
+
+	if strings.HasPrefix(ref, "data:") {
+		decoded, ok := decodeDataURI(ref)
+		if !ok {
+			return "", ""
+		}
+		return "", decoded
+	}
+
+	return resolveReference(base, ref), ""
+}
+
+// resolveReference resolves ref relative to base. Absolute URLs are returned
+// unchanged; remote bases resolve as URLs and everything else as file paths.
+func resolveReference(base, ref string) string {
+	if u, err := url.Parse(ref); err == nil && u.IsAbs() {
+		return ref
+	}
+
+	if strings.HasPrefix(base, "http://") || strings.HasPrefix(base, "https://") {
+		baseURL, err := url.Parse(base)
+		if err != nil {
+			return ref
+		}
+		refURL, err := url.Parse(ref)
+		if err != nil {
+			return ref
+		}
+		return baseURL.ResolveReference(refURL).String()
+	}
+
+	if filepath.IsAbs(ref) {
+		return ref
+	}
+	return filepath.Join(filepath.Dir(base), filepath.FromSlash(ref))
+}
+
+// decodeDataURI decodes the payload of a data: URI, base64 or percent-encoded
+func decodeDataURI(uri string) (string, bool) {
+	meta, payload, ok := strings.Cut(strings.TrimPrefix(uri, "data:"), ",")
+	if !ok {
+		return "", false
+	}
+
+	if strings.HasSuffix(meta, ";base64") {
+		data, err := base64.StdEncoding.DecodeString(payload)
+		if err != nil {
+			return "", false
+		}
+		return string(data), true
+	}
+
+	data, err := url.PathUnescape(payload)
+	if err != nil {
+		return "", false
+	}
+	return data, true
+}
@@ -0,0 +1,195 @@
+package loader
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/katungi/edon/internal/errors"
+)
+
+// Source loads modules from one kind of location, such as the filesystem, a
+// CDN or an embedder's database. LoadModule asks each source in turn whether
+// it handles a specifier, after the import map and CDN shorthands are
+// applied, and loads it from the first that does.
+type Source interface {
+	// CanHandle reports whether the source loads url
+	CanHandle(url string) bool
+	// Load returns the module at url. An error wrapping
+	// errors.ErrModuleNotFound means the module doesn't exist.
+	Load(ctx context.Context, url string) (*Module, error)
+}
+
+// builtinSource is one of the loader's own sources, each loading one
+// PackageType. load takes the reload flag that custom sources don't see.
+type builtinSource struct {
+	packageType PackageType
+	canHandle   func(url string) bool
+	load        func(ctx context.Context, url string, reload bool) (*Module, error)
+}
+
+func (s *builtinSource) CanHandle(url string) bool {
+	return s.canHandle(url)
+}
+
+func (s *builtinSource) Load(ctx context.Context, url string) (*Module, error) {
+	return s.load(ctx, url, false)
+}
+
+// sourceRegistry holds the loader's sources in the order they are consulted:
+// those registered ahead of the built-ins, the built-ins, then the rest
+type sourceRegistry struct {
+	mu       sync.RWMutex
+	first    []Source
+	builtins []Source
+	last     []Source
+}
+
+// newSourceRegistry returns the built-in sources for l, which load virtual
+// modules, registered builtins, local files, CDN URLs, npm and jsr packages and git
+// repositories
+func newSourceRegistry(l *ModuleLoader) *sourceRegistry {
+	ofType := func(packageType PackageType) func(string) bool {
+		return func(url string) bool {
+			return ValidateURL(url).PackageType == packageType
+		}
+	}
+	return &sourceRegistry{builtins: []Source{
+		&builtinSource{
+			packageType: TypeVirtual,
+			// The host's own modules shadow everything else
+			canHandle: func(url string) bool {
+				_, ok := l.virtuals.get(url)
+				return ok
+			},
+			load: func(_ context.Context, url string, _ bool) (*Module, error) {
+				return l.loadVirtualModule(url)
+			},
+		},
+		&builtinSource{
+			packageType: TypeBuiltin,
+			// Registered builtins may claim any specifier, so they come next
+			canHandle: func(url string) bool {
+				_, ok := l.builtins.get(url)
+				return ok || isBuiltin(url)
+			},
+			load: func(_ context.Context, url string, _ bool) (*Module, error) {
+				return l.loadBuiltinModule(url)
+			},
+		},
+		&builtinSource{
+			packageType: TypeLocal,
+			canHandle:   ofType(TypeLocal),
+			load: func(ctx context.Context, url string, _ bool) (*Module, error) {
+				return l.loadLocalModule(ctx, url)
+			},
+		},
+		&builtinSource{
+			packageType: TypeTarball,
+			canHandle: func(url string) bool {
+				return ofType(TypeTarball)(url) || isTarballURL(url) && l.config.insecureHostAllowed(url)
+			},
+			load: l.loadTarballModule,
+		},
+		&builtinSource{
+			packageType: TypeCDN,
+			canHandle: func(url string) bool {
+				return ofType(TypeCDN)(url) || l.config.insecureHostAllowed(url)
+			},
+			load: func(ctx context.Context, url string, reload bool) (*Module, error) {
+				if isCDNFallback(url) {
+					return l.loadCDNFallback(ctx, url, reload)
+				}
+				return l.loadCDNModule(ctx, url)
+			},
+		},
+		&builtinSource{packageType: TypeNPM, canHandle: ofType(TypeNPM), load: l.loadNPMModule},
+		&builtinSource{packageType: TypeJSR, canHandle: ofType(TypeJSR), load: l.loadJSRModule},
+		&builtinSource{packageType: TypeGit, canHandle: ofType(TypeGit), load: l.loadGitModule},
+	}}
+}
+
+// find returns the first source that handles url and the type of module it
+// loads, or nil if none does
+func (r *sourceRegistry) find(url string) (Source, PackageType) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, group := range [][]Source{r.first, r.builtins, r.last} {
+		for _, source := range group {
+			if !source.CanHandle(url) {
+				continue
+			}
+			if builtin, ok := source.(*builtinSource); ok {
+				return source, builtin.packageType
+			}
+			return source, TypeCustom
+		}
+	}
+	return nil, ""
+}
+
+// RegisterSource adds a custom module source. With beforeBuiltins it is
+// consulted ahead of the loader's own sources and can take over any
+// specifier, even "npm:" or local paths; otherwise it only sees specifiers
+// none of them handle, such as "s3://bucket/mod.js". Sources registered on
+// the same side are consulted in registration order. Modules from custom
+// sources are cached in memory only, and aren't subject to the sandbox or
+// permissions, which the source is responsible for.
+func (l *ModuleLoader) RegisterSource(source Source, beforeBuiltins bool) {
+	l.sources.mu.Lock()
+	defer l.sources.mu.Unlock()
+	if beforeBuiltins {
+		l.sources.first = append(l.sources.first, source)
+	} else {
+		l.sources.last = append(l.sources.last, source)
+	}
+}
+
+// UnregisterSource removes a source added with RegisterSource, reporting
+// whether it was registered. Modules it already loaded stay cached until
+// invalidated.
+func (l *ModuleLoader) UnregisterSource(source Source) bool {
+	l.sources.mu.Lock()
+	defer l.sources.mu.Unlock()
+	for _, group := range []*[]Source{&l.sources.first, &l.sources.last} {
+		if i := slices.Index(*group, source); i != -1 {
+			*group = slices.Delete(*group, i, i+1)
+			return true
+		}
+	}
+	return false
+}
+
+// loadFrom loads url from source, filling in what a custom source leaves out
+func (l *ModuleLoader) loadFrom(ctx context.Context, source Source, packageType PackageType, url string, reload bool) (*Module, error) {
+	if builtin, ok := source.(*builtinSource); ok {
+		return builtin.load(ctx, url, reload)
+	}
+
+	module, err := source.Load(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	if module == nil {
+		return nil, errors.Wrap(errors.ErrModuleNotFound, url)
+	}
+	if module.URL == "" {
+		module.URL = url
+	}
+	module.Type = packageType
+	if module.MediaType == MediaUnknown {
+		module.MediaType = mediaTypeFromPath(url)
+	}
+	return module, nil
+}
+
+// customExists reports whether a custom source can load url by loading it
+func (l *ModuleLoader) customExists(ctx context.Context, source Source, url string) (bool, error) {
+	if _, err := l.loadFrom(ctx, source, TypeCustom, url, false); err != nil {
+		if errors.Is(err, errors.ErrModuleNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
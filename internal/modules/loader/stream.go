@@ -0,0 +1,313 @@
+package loader
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/katungi/edon/internal/errors"
+)
+
+// ModuleMeta describes a module opened with Open
+type ModuleMeta struct {
+	URL       string
+	Type      PackageType
+	MediaType MediaType
+	Format    ModuleFormat
+	// Size is the length of the content in bytes, or -1 when a server
+	// streams it without declaring one
+	Size int64
+	// Cached is set when the content comes from the memory or disk cache
+	Cached bool
+}
+
+// Open returns a module's content as a stream instead of buffering it into
+// Module.Content, for callers that parse large bundles incrementally. The
+// caller must Close the reader. CDN modules are streamed from the network
+// and written to the disk cache as they're read, once the whole body has
+// arrived intact; local files are streamed from disk. Other modules are
+// loaded with LoadModule and their content streamed from memory. Streamed
+// content is never transpiled or transformed.
+func (l *ModuleLoader) Open(ctx context.Context, urlStr string) (io.ReadCloser, *ModuleMeta, error) {
+	if l.closed.Load() {
+		return nil, nil, errors.ErrLoaderClosed
+	}
+	urlStr = l.normalize(urlStr)
+	validation := l.validate(urlStr)
+	if !validation.IsValid {
+		return nil, nil, validation.Error
+	}
+
+	switch validation.PackageType {
+	case TypeLocal:
+		return l.openLocal(urlStr)
+	case TypeCDN:
+		if !isCDNFallback(urlStr) {
+			return l.openCDN(ctx, urlStr)
+		}
+	}
+
+	module, err := l.LoadModule(ctx, urlStr)
+	if err != nil {
+		return nil, nil, err
+	}
+	return openModule(module, true)
+}
+
+// openModule streams the content of an already loaded module
+func openModule(module *Module, cached bool) (io.ReadCloser, *ModuleMeta, error) {
+	meta := &ModuleMeta{
+		URL:       module.URL,
+		Type:      module.Type,
+		MediaType: module.MediaType,
+		Format:    module.Format,
+		Size:      int64(len(module.Content)),
+		Cached:    cached,
+	}
+	return io.NopCloser(strings.NewReader(module.Content)), meta, nil
+}
+
+// openLocal opens a local module file
+func (l *ModuleLoader) openLocal(path string) (io.ReadCloser, *ModuleMeta, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, nil, errors.Wrap(errors.ErrModuleNotFound, err.Error())
+	}
+	if err := checkAllowedPath(absPath, l.config.allowedRoots); err != nil {
+		return nil, nil, err
+	}
+	if err := l.config.permissions.checkRead(absPath); err != nil {
+		return nil, nil, err
+	}
+
+	file, err := os.Open(absPath)
+	if err != nil {
+		return nil, nil, errors.Wrap(errors.ErrFileRead, err.Error())
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, errors.Wrap(errors.ErrFileRead, err.Error())
+	}
+	if err := checkFileSize(absPath, info.Size(), l.config.maxModuleSize); err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	return file, &ModuleMeta{
+		URL:       path,
+		Type:      TypeLocal,
+		MediaType: mediaTypeFromPath(absPath),
+		Format:    formatFromPath(absPath),
+		Size:      info.Size(),
+	}, nil
+}
+
+// openCDN serves a CDN module from the caches if it can, and otherwise
+// streams it from the network
+func (l *ModuleLoader) openCDN(ctx context.Context, url string) (io.ReadCloser, *ModuleMeta, error) {
+	if l.config.cacheMode != CacheBypassRead && !l.reloading(url) {
+		if module := l.getFromCache(newCacheKey(TypeCDN, url)); module != nil {
+			return openModule(module, true)
+		}
+		if module := l.getFromDisk(url, TypeCDN); module != nil {
+			return openModule(module, true)
+		}
+		if l.negative.has(url) {
+			return nil, nil, errors.Wrap(errors.ErrModuleNotFound, url)
+		}
+	}
+	if l.config.offline {
+		return nil, nil, errors.Wrap(errors.ErrOffline, url)
+	}
+	if err := l.config.permissions.checkNet(url); err != nil {
+		return nil, nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, nil, errors.Wrap(errors.ErrModuleNotFound, err.Error())
+	}
+	l.config.setCDNAccept(req)
+	resp, err := l.httpClient.Do(req)
+	if err != nil {
+		return nil, nil, errors.Wrap(errors.ErrModuleNotFound, err.Error())
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		resp.Body.Close()
+		l.negative.add(url)
+		return nil, nil, errors.Wrap(errors.ErrModuleNotFound, url)
+	case resp.StatusCode != http.StatusOK:
+		resp.Body.Close()
+		return nil, nil, errors.Wrap(errors.ErrModuleFetch, fmt.Sprintf("GET %s: %s", url, resp.Status))
+	}
+	limit := l.config.maxModuleSize
+	if limit > 0 && resp.ContentLength > limit {
+		resp.Body.Close()
+		return nil, nil, errors.Wrap(errors.ErrModuleTooLarge, fmt.Sprintf("%s is %d bytes (limit %d)", url, resp.ContentLength, limit))
+	}
+
+	meta := &ModuleMeta{
+		URL:       url,
+		Type:      TypeCDN,
+		MediaType: detectMediaType(resp.Header.Get("Content-Type"), url),
+		Format:    formatFromPath(url),
+		Size:      resp.ContentLength,
+	}
+	stream := &moduleStream{body: resp.Body, url: url, limit: limit, declared: resp.ContentLength}
+	// The disk cache holds TypeScript transpiled and every module
+	// transformed, so raw content can't go in when either applies
+	if l.disk != nil && (meta.MediaType != MediaTypeScript || l.config.transpiler == nil) && len(l.config.transforms) == 0 {
+		if stream.cache, _ = l.disk.writer(url); stream.cache != nil {
+			stream.cache.expiry = parseExpiry(resp.Header, time.Now())
+		}
+	}
+	return stream, meta, nil
+}
+
+// moduleStream reads a CDN response body, enforcing the module size limit
+// and the declared length, and tees it into the disk cache
+type moduleStream struct {
+	body     io.ReadCloser
+	url      string
+	limit    int64
+	declared int64
+	n        int64
+	// cache is nil when nothing is being cached, or once the entry has been
+	// committed or abandoned
+	cache *cacheWriter
+}
+
+func (s *moduleStream) Read(p []byte) (int, error) {
+	n, err := s.body.Read(p)
+	s.n += int64(n)
+	if s.limit > 0 && s.n > s.limit {
+		s.abandon()
+		return n, errors.Wrap(errors.ErrModuleTooLarge, fmt.Sprintf("%s is over %d bytes", s.url, s.limit))
+	}
+	if n > 0 && s.cache != nil {
+		// A failed cache write only costs a refetch next time
+		if _, werr := s.cache.Write(p[:n]); werr != nil {
+			s.abandon()
+		}
+	}
+
+	switch {
+	case err == io.ErrUnexpectedEOF, err == io.EOF && s.declared >= 0 && s.n != s.declared:
+		s.abandon()
+		return n, errors.Wrap(errors.ErrTruncated, fmt.Sprintf("%s: got %d of %d bytes", s.url, s.n, s.declared))
+	case err == io.EOF, err == nil && s.n == s.declared:
+		// A reader that stops at the declared length never sees EOF
+		if s.cache != nil {
+			_ = s.cache.commit()
+			s.cache = nil
+		}
+	case err != nil:
+		s.abandon()
+	}
+	return n, err
+}
+
+// Close closes the response body. Content not read to the end isn't cached.
+func (s *moduleStream) Close() error {
+	s.abandon()
+	return s.body.Close()
+}
+
+func (s *moduleStream) abandon() {
+	if s.cache != nil {
+		s.cache.abort()
+		s.cache = nil
+	}
+}
+
+// cacheWriter streams a disk cache entry, hashing it on the way, and only
+// makes it visible on commit. The disk backend gets a temporary file that
+// commit renames into place; other backends get the content buffered and
+// stored on commit.
+type cacheWriter struct {
+	disk *diskCache
+	url  string
+	hash hash.Hash
+	// file is the disk backend's temporary file, or nil when buffering
+	file *os.File
+	buf  bytes.Buffer
+	// gz compresses what's written when the cache is compressed
+	gz *gzip.Writer
+	// expiry is when the entry goes stale by the response's headers
+	expiry httpExpiry
+}
+
+// writer starts a streamed disk cache entry for url
+func (d *diskCache) writer(url string) (*cacheWriter, error) {
+	w := &cacheWriter{disk: d, url: url, hash: sha256.New()}
+	if files, ok := d.backend.(*fileBackend); ok {
+		tmp, err := files.create()
+		if err != nil {
+			return nil, err
+		}
+		w.file = tmp
+	}
+	if d.compress {
+		w.gz = gzip.NewWriter(w.dest())
+	}
+	return w, nil
+}
+
+// dest is where the entry's stored bytes go
+func (w *cacheWriter) dest() io.Writer {
+	if w.file != nil {
+		return w.file
+	}
+	return &w.buf
+}
+
+func (w *cacheWriter) Write(p []byte) (int, error) {
+	w.hash.Write(p)
+	if w.gz != nil {
+		return w.gz.Write(p)
+	}
+	return w.dest().Write(p)
+}
+
+// commit moves the finished entry into place. Streamed content is stored as
+// fetched, so its source and content hashes are the same.
+func (w *cacheWriter) commit() error {
+	if w.gz != nil {
+		if err := w.gz.Close(); err != nil {
+			w.abort()
+			return err
+		}
+	}
+	sum := hex.EncodeToString(w.hash.Sum(nil))
+	// As in set, the hash goes first so a visible entry always has the right one
+	if err := w.disk.backend.Put(w.disk.hashKey(w.url), []byte(sum+" "+sum)); err != nil {
+		w.abort()
+		return err
+	}
+	_ = w.disk.setFetched(w.url, time.Now())
+	_ = w.disk.setExpiry(w.url, w.expiry)
+	if w.file != nil {
+		return w.disk.backend.(*fileBackend).commit(w.file, w.disk.key(w.url))
+	}
+	return w.disk.backend.Put(w.disk.key(w.url), w.buf.Bytes())
+}
+
+// abort discards the partial entry
+func (w *cacheWriter) abort() {
+	if w.file != nil {
+		_ = w.file.Close()
+		_ = os.Remove(w.file.Name())
+	}
+}
@@ -0,0 +1,37 @@
+package loader
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/katungi/edon/internal/errors"
+)
+
+// checkSymlinkLoop fails with errors.ErrSymlinkLoop when path goes through
+// symbolic links that point back at each other, so it can never be opened
+func checkSymlinkLoop(path string) error {
+	if _, err := os.Stat(path); errors.Is(err, syscall.ELOOP) {
+		return errors.Wrap(errors.ErrSymlinkLoop, path)
+	}
+	return nil
+}
+
+// graphKey returns what LoadGraph tells modules apart by. A local module is
+// known by its real path, so one reachable under many paths through
+// symlinks, such as a package in node_modules that links to itself, is
+// loaded once rather than under ever longer paths. Local paths that don't
+// resolve are left for the load to report, except for a symlink loop.
+func graphKey(specifier string) (string, error) {
+	if !isLocalPath(specifier) {
+		return specifier, nil
+	}
+	real, err := filepath.EvalSymlinks(specifier)
+	if err != nil {
+		if err := checkSymlinkLoop(specifier); err != nil {
+			return "", err
+		}
+		return specifier, nil
+	}
+	return real, nil
+}
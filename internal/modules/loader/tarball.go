@@ -0,0 +1,119 @@
+package loader
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/katungi/edon/internal/errors"
+)
+
+// extractTarball unpacks a gzipped npm tarball into dest. npm tarballs nest
+// their contents under a single top-level directory (usually "package/"),
+// which is stripped. Entries that would land outside dest, links pointing
+// outside it and device or FIFO entries abort the extraction with
+// errors.ErrMaliciousArchive. Links that stay inside are skipped, as npm
+// packages don't need them. ctx is checked between entries; a canceled
+// extraction stops early and leaves dest for the caller to remove.
+func extractTarball(ctx context.Context, path, dest string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.Wrap(errors.ErrFileRead, err.Error())
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return errors.Wrap(errors.ErrPackageInstall, err.Error())
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		if err := ctx.Err(); err != nil {
+			return errors.WrapWith(errors.ErrPackageInstall, err, "extraction canceled")
+		}
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(errors.ErrPackageInstall, err.Error())
+		}
+		malicious := func(reason string) error {
+			return errors.Wrap(errors.ErrMaliciousArchive, header.Name+": "+reason)
+		}
+
+		if strings.HasPrefix(header.Name, "/") || filepath.IsAbs(header.Name) {
+			return malicious("absolute path")
+		}
+		// Strip the top-level directory
+		_, name, found := strings.Cut(header.Name, "/")
+		if !found || name == "" {
+			continue
+		}
+		target, ok := containedPath(dest, name)
+		if !ok {
+			return malicious("path escapes the package")
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return errors.Wrap(errors.ErrPackageInstall, err.Error())
+			}
+		case tar.TypeReg:
+			if err := writeTarEntry(tr, target, header.FileInfo().Mode()); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if filepath.IsAbs(header.Linkname) || strings.HasPrefix(header.Linkname, "/") {
+				return malicious("symlink to an absolute path")
+			}
+			rel, err := filepath.Rel(dest, filepath.Join(filepath.Dir(target), filepath.FromSlash(header.Linkname)))
+			if err != nil || !filepath.IsLocal(rel) {
+				return malicious("symlink points outside the package")
+			}
+		case tar.TypeLink:
+			// Hard link targets are archive paths, top-level directory included
+			_, linked, _ := strings.Cut(header.Linkname, "/")
+			if _, ok := containedPath(dest, linked); !ok || linked == "" {
+				return malicious("hard link points outside the package")
+			}
+		case tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+			return malicious("device or FIFO entry")
+		}
+	}
+}
+
+// containedPath joins a slash-separated archive path onto dest, reporting
+// false if the result would fall outside dest
+func containedPath(dest, name string) (string, bool) {
+	name = filepath.FromSlash(name)
+	if !filepath.IsLocal(name) {
+		return "", false
+	}
+	return filepath.Join(dest, name), true
+}
+
+// writeTarEntry writes the current tar entry to target
+func writeTarEntry(r io.Reader, target string, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return errors.Wrap(errors.ErrPackageInstall, err.Error())
+	}
+
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode.Perm()|0600)
+	if err != nil {
+		return errors.Wrap(errors.ErrPackageInstall, err.Error())
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, r); err != nil {
+		return errors.Wrap(errors.ErrPackageInstall, err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package loader
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/katungi/edon/internal/errors"
+)
+
+// githubArchiveHost serves repository snapshots as gzipped tarballs
+const githubArchiveHost = "https://codeload.github.com"
+
+// FetchTemplate copies a project template into dest. The specifier may be a
+// local directory, a local .tgz archive, "github:owner/repo" with an
+// optional "#ref", or an http(s) URL of a gzipped tarball. Archives are
+// unpacked like npm tarballs, dropping their single top-level directory;
+// directories are copied without node_modules or .git. Downloads honour the
+// loader's offline mode, permissions and size limit.
+func (l *ModuleLoader) FetchTemplate(ctx context.Context, specifier, dest string) error {
+	if l.closed.Load() {
+		return errors.ErrLoaderClosed
+	}
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return errors.Wrap(errors.ErrFileRead, err.Error())
+	}
+
+	if repo, ok := strings.CutPrefix(specifier, "github:"); ok {
+		repo, ref, _ := strings.Cut(repo, "#")
+		owner, name, ok := strings.Cut(repo, "/")
+		if !ok || owner == "" || name == "" || strings.Contains(name, "/") {
+			return errors.Wrap(errors.ErrInvalidURL, "expected github:owner/repo: "+specifier)
+		}
+		if ref == "" {
+			ref = "HEAD"
+		}
+		specifier = fmt.Sprintf("%s/%s/%s/tar.gz/%s", githubArchiveHost, owner, name, ref)
+	}
+
+	if strings.HasPrefix(specifier, "https://") || strings.HasPrefix(specifier, "http://") {
+		return l.fetchTemplateArchive(ctx, specifier, dest)
+	}
+
+	path, err := filepath.Abs(specifier)
+	if err != nil {
+		return errors.Wrap(errors.ErrFileNotFound, err.Error())
+	}
+	if err := checkAllowedPath(path, l.config.allowedRoots); err != nil {
+		return err
+	}
+	if err := l.config.permissions.checkRead(path); err != nil {
+		return err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return errors.Wrap(errors.ErrFileNotFound, err.Error())
+	}
+	if info.IsDir() {
+		return copyPackageDir(path, dest)
+	}
+	return extractTarball(ctx, path, dest)
+}
+
+// fetchTemplateArchive downloads a gzipped tarball and unpacks it into dest
+func (l *ModuleLoader) fetchTemplateArchive(ctx context.Context, url, dest string) error {
+	if l.config.offline {
+		return errors.Wrap(errors.ErrOffline, url)
+	}
+	if err := l.config.permissions.checkNet(url); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, l.config.timeouts.Tarball)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return errors.Wrap(errors.ErrModuleFetch, err.Error())
+	}
+	resp, err := l.httpClient.Do(req)
+	if err != nil {
+		return errors.Wrap(errors.ErrModuleFetch, err.Error())
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return errors.Wrap(errors.ErrModuleNotFound, url)
+	case resp.StatusCode != http.StatusOK:
+		return errors.Wrap(errors.ErrModuleFetch, fmt.Sprintf("GET %s: %s", url, resp.Status))
+	}
+
+	data, err := readModuleBody(resp, l.config.maxModuleSize)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp("", "edon-template-*.tgz")
+	if err != nil {
+		return errors.Wrap(errors.ErrCacheDir, err.Error())
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errors.Wrap(errors.ErrCacheDir, err.Error())
+	}
+	return extractTarball(ctx, tmp.Name(), dest)
+}
@@ -0,0 +1,83 @@
+package loader
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/katungi/edon/internal/errors"
+)
+
+// defaultTimeout bounds each kind of request that WithTimeouts leaves unset
+const defaultTimeout = 30 * time.Second
+
+// TimeoutConfig bounds each kind of work the loader does, so a large tarball
+// isn't held to the deadline of a quick metadata request. A zero field keeps
+// its 30 second default.
+type TimeoutConfig struct {
+	// Metadata bounds a registry metadata request: an npm packument, a JSR
+	// meta.json or a registry ping
+	Metadata time.Duration
+	// CDN bounds fetching a module from a CDN, a URL or JSR, including any
+	// redirects it follows
+	CDN time.Duration
+	// Tarball bounds downloading a package, template or remote tarball
+	Tarball time.Duration
+	// Local bounds reading a local module, such as one on a network
+	// filesystem that stopped answering
+	Local time.Duration
+}
+
+// WithTimeouts sets how long each kind of request may take, each within the
+// caller's own context deadline and WithOperationTimeout. The built-in HTTP
+// client's overall timeout becomes the longest of them; a client given to
+// WithHTTPClient keeps its own.
+func WithTimeouts(timeouts TimeoutConfig) Option {
+	return func(c *config) {
+		c.timeouts = timeouts
+	}
+}
+
+// withDefaults fills the unset timeouts with defaultTimeout
+func (t TimeoutConfig) withDefaults() TimeoutConfig {
+	for _, d := range []*time.Duration{&t.Metadata, &t.CDN, &t.Tarball, &t.Local} {
+		if *d <= 0 {
+			*d = defaultTimeout
+		}
+	}
+	return t
+}
+
+// longest returns the largest of the network timeouts, which the built-in
+// client uses so that none of the shorter deadlines is cut off
+func (t TimeoutConfig) longest() time.Duration {
+	return max(t.Metadata, t.CDN, t.Tarball)
+}
+
+// readWithin runs read, a local read that can't be cancelled, giving up with
+// errors.ErrModuleTimeout once d has passed. The read is left to finish in
+// the background.
+func readWithin(ctx context.Context, d time.Duration, path string, read func() ([]byte, error)) ([]byte, error) {
+	readCtx, cancel := context.WithTimeout(ctx, d)
+	defer cancel()
+
+	type result struct {
+		data []byte
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		data, err := read()
+		done <- result{data, err}
+	}()
+	select {
+	case r := <-done:
+		return r.data, r.err
+	case <-readCtx.Done():
+		// The caller's own deadline or cancellation is reported as it is
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return nil, errors.Wrap(errors.ErrModuleTimeout, fmt.Sprintf("reading %s took longer than %s", path, d))
+	}
+}
@@ -0,0 +1,59 @@
+package loader
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"os"
+
+	"github.com/katungi/edon/internal/errors"
+)
+
+// clientTLSConfig builds the built-in client's TLS settings: a clone of the
+// configured tls.Config with the certificates of the CA file added to its
+// roots. With neither set it returns nil, leaving the system roots in charge.
+func (c *config) clientTLSConfig() (*tls.Config, error) {
+	if c.tlsConfig == nil && c.caCertFile == "" {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{}
+	if c.tlsConfig != nil {
+		tlsConfig = c.tlsConfig.Clone()
+	}
+	if c.caCertFile == "" {
+		return tlsConfig, nil
+	}
+
+	pem, err := os.ReadFile(c.caCertFile)
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrTLSConfig, err.Error())
+	}
+	// The CA file adds to the roots rather than replacing them, so public
+	// hosts keep working next to an internal mirror
+	roots := tlsConfig.RootCAs
+	if roots == nil {
+		if roots, err = x509.SystemCertPool(); err != nil {
+			roots = x509.NewCertPool()
+		}
+	} else {
+		roots = roots.Clone()
+	}
+	if !roots.AppendCertsFromPEM(pem) {
+		return nil, errors.Wrap(errors.ErrTLSConfig, "no PEM certificates in "+c.caCertFile)
+	}
+	tlsConfig.RootCAs = roots
+	return tlsConfig, nil
+}
+
+// failingTransport fails every request with err, so a loader built with a
+// broken TLS setup never falls back to an unintended policy
+type failingTransport struct {
+	err error
+}
+
+func (t failingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	return nil, t.err
+}
@@ -0,0 +1,47 @@
+package loader
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/katungi/edon/internal/errors"
+)
+
+// Transform rewrites a module after it is fetched and before it is cached,
+// such as to strip types, inject HMR shims or rewrite imports. It may modify
+// and return the module it is given or return a new one; returning nil
+// keeps the module as it was.
+type Transform func(ctx context.Context, module *Module) (*Module, error)
+
+// WithTransforms runs transforms, in order, over every module the loader
+// fetches other than builtins, after WithTranspiler and before the module is cached, so each
+// sees the output of the one before and the cache holds the last one's.
+// Modules served from the cache aren't transformed again, so changing the
+// transforms calls for clearing the disk cache. The disk cache keeps only
+// content: a copy read back from it takes its media type from its URL as
+// before, whatever a transform set. The first transform to fail stops the
+// rest, and the load fails with errors.ErrTransform saying which it was.
+// Repeated calls add to the pipeline.
+func WithTransforms(transforms ...Transform) Option {
+	return func(c *config) {
+		c.transforms = append(c.transforms, transforms...)
+	}
+}
+
+// transform runs the WithTransforms pipeline over module
+func (l *ModuleLoader) transform(ctx context.Context, module *Module) (*Module, error) {
+	if module.Type == TypeBuiltin {
+		return module, nil
+	}
+	for i, transform := range l.config.transforms {
+		out, err := transform(ctx, module)
+		if err != nil {
+			return nil, errors.WrapWith(errors.ErrTransform, err,
+				fmt.Sprintf("transform %d of %d on %s", i+1, len(l.config.transforms), module.URL))
+		}
+		if out != nil {
+			module = out
+		}
+	}
+	return module, nil
+}
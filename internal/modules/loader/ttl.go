@@ -0,0 +1,123 @@
+package loader
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+// WithCacheTTL makes cached remote modules, from CDNs, URLs and JSR, stale
+// once they were fetched more than ttl ago, so loading one fetches it again
+// as Reload does. Entries whose age isn't known, such as those cached by an
+// older edon or imported with ImportCache, count as stale. Offline loaders
+// keep serving stale modules, since they couldn't fetch new ones. Zero, the
+// default, keeps cached modules until they are invalidated.
+//
+// CDN modules also go stale when their response's Cache-Control max-age or
+// Expires header says so, whether or not a TTL is set; ttl caps how long
+// those headers keep a module. One sent with Cache-Control: immutable, as
+// versioned CDN URLs usually are, never goes stale.
+func WithCacheTTL(ttl time.Duration) Option {
+	return func(c *config) {
+		c.cacheTTL = ttl
+	}
+}
+
+// WithStaleWhileRevalidate serves a module WithCacheTTL considers stale from
+// the cache straight away, as HTTP's stale-while-revalidate does, and fetches
+// it again in the background so the next load gets the fresh copy. Only one
+// revalidation of a URL runs at a time. A failed one leaves the stale copy in
+// place and is reported with EventRevalidateFailed. Close cancels those
+// still running.
+func WithStaleWhileRevalidate(enabled bool) Option {
+	return func(c *config) {
+		c.staleWhileRevalidate = enabled
+	}
+}
+
+// expired reports whether a cached module is past its caching headers'
+// expiry or older than WithCacheTTL allows
+func (l *ModuleLoader) expired(module *Module) bool {
+	if !isRemote(module.Type) || module.expiry.immutable {
+		return false
+	}
+	// Seeded modules and offline loaders have nothing newer to turn to
+	if l.config.memoryOnly || l.config.offline {
+		return false
+	}
+	if !module.expiry.at.IsZero() && !time.Now().Before(module.expiry.at) {
+		return true
+	}
+	if l.config.cacheTTL <= 0 {
+		return false
+	}
+	return module.fetchedAt.IsZero() || time.Since(module.fetchedAt) > l.config.cacheTTL
+}
+
+// servable reports whether a cached module may be served: it hasn't
+// expired, or it has and WithStaleWhileRevalidate serves it while it is
+// fetched again in the background
+func (l *ModuleLoader) servable(module *Module, url string) bool {
+	if !l.expired(module) {
+		return true
+	}
+	if !l.config.staleWhileRevalidate {
+		return false
+	}
+	l.revalidate(url)
+	return true
+}
+
+// revalidate fetches url again in the background, replacing its cached
+// copies, unless a revalidation of it is already running. It returns
+// immediately.
+func (l *ModuleLoader) revalidate(url string) {
+	if _, busy := l.revalidating.LoadOrStore(url, struct{}{}); busy {
+		return
+	}
+	// Tracked with the prefetches, so Close cancels and waits for it too
+	if !l.prefetcher.start() {
+		l.revalidating.Delete(url)
+		return
+	}
+	go func() {
+		defer l.prefetcher.running.Done()
+		defer l.revalidating.Delete(url)
+
+		ctx, cancel := context.WithCancel(l.prefetcher.stop)
+		defer cancel()
+		release, err := l.config.acquire(ctx)
+		if err != nil {
+			return
+		}
+		defer release()
+
+		if _, err := l.load(ctx, url, 0, true); err != nil && ctx.Err() == nil {
+			l.emit(LoadEvent{Kind: EventRevalidateFailed, URL: url, Type: l.validate(url).PackageType, Err: err})
+		}
+	}()
+}
+
+// fetchedKey returns the key that stores when url's entry was fetched
+func (d *diskCache) fetchedKey(url string) string {
+	return d.key(url) + ".fetched"
+}
+
+// fetched returns when url's entry was fetched, or the zero time for an
+// entry written before that was recorded
+func (d *diskCache) fetched(url string) time.Time {
+	data, ok := d.backend.Get(d.fetchedKey(url))
+	if !ok {
+		return time.Time{}
+	}
+	unix, err := strconv.ParseInt(string(data), 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(unix, 0)
+}
+
+// setFetched records that url's entry was fetched at t
+func (d *diskCache) setFetched(url string, t time.Time) error {
+	return d.backend.Put(d.fetchedKey(url), []byte(strconv.FormatInt(t.Unix(), 10)))
+}
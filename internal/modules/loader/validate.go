@@ -1,6 +1,7 @@
 package loader
 
 import (
+	"net/http"
 	"net/url"
 	"path/filepath"
 	"strings"
@@ -15,12 +16,80 @@ const (
 	TypeNPM   PackageType = "NPM"
 	TypeCDN   PackageType = "CDN"
 	TypeLocal PackageType = "Local"
+	// TypeBuiltin modules are served from in-process shims, e.g. "node:path"
+	TypeBuiltin PackageType = "Builtin"
+	// TypeGit modules are loaded from a clone of a git repository
+	TypeGit PackageType = "Git"
+	// TypeTarball modules are loaded from an npm-style package tarball
+	// downloaded from a URL ending in .tgz or .tar.gz
+	TypeTarball PackageType = "Tarball"
+	// TypeVirtual modules are provided by the host with RegisterVirtual
+	TypeVirtual PackageType = "Virtual"
+	// TypeCustom modules come from sources added with RegisterSource
+	TypeCustom PackageType = "Custom"
 )
 
+// cdnShorthands maps shorthand prefixes such as "esm:react@18" to the CDN
+// base URL they expand to
+var cdnShorthands = map[string]string{
+	"unpkg:":    "https://unpkg.com/",
+	"esm:":      "https://esm.sh/",
+	"skypack:":  "https://cdn.skypack.dev/",
+	"jsdelivr:": "https://cdn.jsdelivr.net/npm/",
+}
+
+// expandCDNShorthand expands a CDN shorthand specifier into its full URL,
+// reporting whether specifier was a shorthand
+func expandCDNShorthand(specifier string) (string, bool) {
+	for prefix, base := range cdnShorthands {
+		if rest, ok := strings.CutPrefix(specifier, prefix); ok && rest != "" {
+			return base + strings.TrimPrefix(rest, "/"), true
+		}
+	}
+	return specifier, false
+}
+
+// ValidationResult classifies a specifier and carries the parts it was
+// parsed into, so loaders don't each split it again. Fields that don't
+// apply to a specifier's type are left empty.
 type ValidationResult struct {
 	IsValid     bool
 	PackageType PackageType
 	Error       error
+
+	// Scheme is the specifier's prefix without its colon, such as "npm",
+	// "jsr", "node", "cdn", "https" or "git+ssh"; empty for local paths
+	Scheme string
+	// Host is the server a URL or git repository is fetched from
+	Host string
+	// Scope is a scoped package's "@scope", and Name its full package name,
+	// "@scope/name"; for builtins Name is the module name, e.g. "path"
+	Scope string
+	Name  string
+	// Version is the requested version, range or tag ("latest" when an npm
+	// specifier gives none), or a git ref
+	Version string
+	// Subpath is the file inside the package or repository, without a
+	// leading slash
+	Subpath string
+}
+
+// setPackage fills in a package's name, version and subpath, taking the
+// scope from a scoped name
+func (r *ValidationResult) setPackage(name, version, subpath string) {
+	r.Name, r.Version, r.Subpath = name, version, subpath
+	if scope, _, ok := strings.Cut(name, "/"); ok && strings.HasPrefix(name, "@") {
+		r.Scope = scope
+	}
+}
+
+// npmCDNPaths maps the hosts of CDNs that serve npm packages to the path
+// prefix their package specifiers follow
+var npmCDNPaths = map[string]string{
+	"unpkg.com":        "/",
+	"esm.sh":           "/",
+	"cdn.skypack.dev":  "/",
+	"cdn.jsdelivr.net": "/npm/",
 }
 
 func ValidateURL(urlStr string) ValidationResult {
@@ -34,17 +103,63 @@ func ValidateURL(urlStr string) ValidationResult {
 
 	// Check for package prefixes
 	if strings.HasPrefix(urlStr, "npm:") {
-		return ValidationResult{
+		result := ValidationResult{
 			IsValid:     true,
 			PackageType: TypeNPM,
+			Scheme:      "npm",
 		}
+		result.setPackage(ParseNPMSpecifier(urlStr))
+		return result
 	}
 
-	if strings.HasPrefix(urlStr, "jsr:") {
+	if isCDNFallback(urlStr) {
+		result := ValidationResult{
+			IsValid:     true,
+			PackageType: TypeCDN,
+			Scheme:      "cdn",
+		}
+		result.setPackage(ParseNPMSpecifier(strings.TrimPrefix(strings.TrimPrefix(urlStr, cdnScheme), "/")))
+		return result
+	}
+
+	if expanded, ok := expandCDNShorthand(urlStr); ok {
+		return ValidateURL(expanded)
+	}
+
+	if isBuiltin(urlStr) {
 		return ValidationResult{
+			IsValid:     true,
+			PackageType: TypeBuiltin,
+			Scheme:      strings.TrimSuffix(nodeBuiltinPrefix, ":"),
+			Name:        strings.TrimPrefix(urlStr, nodeBuiltinPrefix),
+		}
+	}
+
+	if isGitSpecifier(urlStr) {
+		result := ValidationResult{
+			IsValid:     true,
+			PackageType: TypeGit,
+			Scheme:      urlStr[:strings.Index(urlStr, "://")],
+		}
+		// A malformed repository is still a git specifier; loading it says why
+		if repo, ref, subpath, err := parseGitSpecifier(urlStr); err == nil {
+			u, _ := url.Parse(repo)
+			result.Host, result.Version, result.Subpath = u.Hostname(), ref, subpath
+		}
+		return result
+	}
+
+	if strings.HasPrefix(urlStr, "jsr:") {
+		result := ValidationResult{
 			IsValid:     true,
 			PackageType: TypeJSR,
+			Scheme:      "jsr",
 		}
+		// Unscoped names are reported when the module is loaded
+		if name, version, subpath, err := parseJSRSpecifier(urlStr); err == nil {
+			result.setPackage(name, version, subpath)
+		}
+		return result
 	}
 
 	// Check if it's a local file path
@@ -64,12 +179,45 @@ func ValidateURL(urlStr string) ValidationResult {
 		}
 	}
 
+	// A tarball URL is a package wherever it is served from
+	if isTarballURL(urlStr) {
+		if parsedURL.Scheme == "http" {
+			return ValidationResult{
+				IsValid: false,
+				Error:   errors.Wrap(errors.ErrInsecureURL, urlStr),
+			}
+		}
+		return ValidationResult{
+			IsValid:     true,
+			PackageType: TypeTarball,
+			Scheme:      parsedURL.Scheme,
+			Host:        parsedURL.Host,
+		}
+	}
+
 	// Validate CDN URLs
 	if isCDNURL(parsedURL) {
-		return ValidationResult{
+		// Only hosts trusted with WithAllowInsecureHosts may use plain HTTP
+		if parsedURL.Scheme == "http" {
+			return ValidationResult{
+				IsValid: false,
+				Error:   errors.Wrap(errors.ErrInsecureURL, urlStr),
+			}
+		}
+		result := ValidationResult{
 			IsValid:     true,
 			PackageType: TypeCDN,
+			Scheme:      parsedURL.Scheme,
+			Host:        parsedURL.Host,
+		}
+		if prefix, ok := npmCDNPaths[parsedURL.Hostname()]; ok {
+			if spec, ok := strings.CutPrefix(parsedURL.Path, prefix); ok && spec != "" {
+				result.setPackage(ParseNPMSpecifier(spec))
+			}
+		} else if version, ok := denoLandVersion(urlStr); ok {
+			result.Version = version
 		}
+		return result
 	}
 
 	return ValidationResult{
@@ -97,16 +245,76 @@ func isLocalPath(path string) bool {
 	return false
 }
 
+// insecureHostAllowed reports whether rawURL is a plain HTTP URL on a host
+// WithAllowInsecureHosts trusts
+func (c *config) insecureHostAllowed(rawURL string) bool {
+	if len(c.insecureHosts) == 0 || !strings.HasPrefix(rawURL, "http://") {
+		return false
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	return c.insecureHostTrusted(u)
+}
+
+// insecureHostTrusted reports whether WithAllowInsecureHosts lists u's host,
+// with or without its port, whatever u's scheme
+func (c *config) insecureHostTrusted(u *url.URL) bool {
+	for _, host := range c.insecureHosts {
+		if strings.EqualFold(host, u.Host) || strings.EqualFold(host, u.Hostname()) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRedirect refuses a redirect from a module URL to plain HTTP on a host
+// WithAllowInsecureHosts doesn't trust
+func (c *config) checkRedirect(from, to string) error {
+	if strings.HasPrefix(to, "http://") && !c.insecureHostAllowed(to) {
+		return errors.Wrap(errors.ErrInsecureURL, from+" redirected to "+to)
+	}
+	return nil
+}
+
+// secureRedirects returns a copy of client that applies checkRedirect to
+// every redirect it follows, on top of the client's own policy
+func (c *config) secureRedirects(client *http.Client) *http.Client {
+	wrapped := *client
+	next := client.CheckRedirect
+	wrapped.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if err := c.checkRedirect(via[0].URL.String(), req.URL.String()); err != nil {
+			return err
+		}
+		if next != nil {
+			return next(req, via)
+		}
+		// The default policy
+		if len(via) >= 10 {
+			return errors.Wrap(errors.ErrModuleFetch, "stopped after 10 redirects")
+		}
+		return nil
+	}
+	return &wrapped
+}
+
 func isCDNURL(parsedURL *url.URL) bool {
 	// List of known CDN domains
 	cdnDomains := []string{
 		"cdn.jsdelivr.net",
 		"unpkg.com",
 		"cdnjs.cloudflare.com",
+		"esm.sh",
+		"cdn.skypack.dev",
+		denoLandHost,
 	}
 
+	// Subdomains count, but a host that merely contains a CDN's name, such
+	// as esm.sh.example.com, doesn't
+	host := strings.ToLower(parsedURL.Hostname())
 	for _, domain := range cdnDomains {
-		if strings.Contains(parsedURL.Host, domain) {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
 			return true
 		}
 	}
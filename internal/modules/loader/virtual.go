@@ -0,0 +1,118 @@
+package loader
+
+import (
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/katungi/edon/internal/errors"
+)
+
+// virtualModule is the source and media type of a module registered with
+// RegisterVirtual
+type virtualModule struct {
+	content   string
+	mediaType MediaType
+}
+
+// virtualRegistry holds the modules embedders registered with
+// RegisterVirtual, keyed by URL
+type virtualRegistry struct {
+	mu      sync.RWMutex
+	modules map[string]virtualModule
+}
+
+func newVirtualRegistry() *virtualRegistry {
+	return &virtualRegistry{modules: make(map[string]virtualModule)}
+}
+
+func (r *virtualRegistry) get(url string) (virtualModule, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	module, ok := r.modules[url]
+	return module, ok
+}
+
+// RegisterVirtual makes content loadable under url, such as
+// "virtual:config.js" or "/app/generated/routes.ts", for generated code and
+// other modules that live in the host application rather than on disk or
+// the network. Virtual modules are consulted before every other source, so
+// url may shadow a real file or package. An empty mediaType is taken from
+// url's extension, and is JavaScript when that says nothing. Virtual modules
+// are transpiled, cached in memory and imported like any other; their
+// relative imports resolve against url, so they can import one another.
+// Registering url again replaces its content and drops the cached copy.
+func (l *ModuleLoader) RegisterVirtual(url, content string, mediaType MediaType) error {
+	if url == "" {
+		return errors.ErrEmptyURL
+	}
+	if mediaType == MediaUnknown {
+		mediaType = mediaTypeFromPath(virtualPath(url))
+	}
+	if mediaType == MediaUnknown {
+		mediaType = MediaJavaScript
+	}
+
+	l.virtuals.mu.Lock()
+	defer l.virtuals.mu.Unlock()
+	l.virtuals.modules[url] = virtualModule{content: content, mediaType: mediaType}
+	l.cache.remove(newCacheKey(TypeVirtual, url))
+	return nil
+}
+
+// UnregisterVirtual removes the virtual module registered under url,
+// reporting whether it was present
+func (l *ModuleLoader) UnregisterVirtual(url string) bool {
+	l.virtuals.mu.Lock()
+	defer l.virtuals.mu.Unlock()
+	_, ok := l.virtuals.modules[url]
+	delete(l.virtuals.modules, url)
+	l.cache.remove(newCacheKey(TypeVirtual, url))
+	return ok
+}
+
+// loadVirtualModule returns the module registered under url
+func (l *ModuleLoader) loadVirtualModule(url string) (*Module, error) {
+	virtual, ok := l.virtuals.get(url)
+	if !ok {
+		// Unregistered between the source lookup and now
+		return nil, errors.Wrap(errors.ErrModuleNotFound, url)
+	}
+	return &Module{
+		URL:       url,
+		Content:   virtual.content,
+		Type:      TypeVirtual,
+		MediaType: virtual.mediaType,
+		Format:    formatFromPath(virtualPath(url)),
+	}, nil
+}
+
+// virtualPath returns the part of a virtual module's URL its extension is
+// read from: the opaque part of one like "virtual:config.json", which
+// extensionOf would take to have no path, and the URL itself otherwise
+func virtualPath(rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil && u.Opaque != "" {
+		return u.Opaque
+	}
+	return rawURL
+}
+
+// resolveVirtualRelative resolves specifier against a virtual module's URL:
+// as a URL reference when it is hierarchical, like "app://gen/a.js", and
+// against its path otherwise, so "./b.js" from "virtual:gen/a.js" is
+// "virtual:gen/b.js"
+func resolveVirtualRelative(importer, specifier string) (string, error) {
+	if u, err := url.Parse(importer); err == nil && u.Scheme != "" && u.Opaque == "" {
+		ref, err := url.Parse(specifier)
+		if err != nil {
+			return "", errors.Wrap(errors.ErrInvalidURL, err.Error())
+		}
+		return u.ResolveReference(ref).String(), nil
+	}
+	prefix, rest := "", importer
+	if scheme, opaque, ok := strings.Cut(importer, ":"); ok && !strings.Contains(scheme, "/") {
+		prefix, rest = scheme+":", opaque
+	}
+	return prefix + path.Join(path.Dir(rest), specifier), nil
+}
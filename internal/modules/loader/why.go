@@ -0,0 +1,118 @@
+package loader
+
+import (
+	"slices"
+	"strings"
+)
+
+// DependencyPaths returns every chain of dependencies from one of roots,
+// specifiers such as "express@^4", to a package called name. tree holds the
+// resolved packages with their dependencies, as ResolveTree returns them;
+// each dependency is taken to be the highest version in tree its range
+// allows. A chain starts at a root's package and ends at name, and never
+// passes through a package twice. Chains are sorted shortest first, and
+// there are none when name isn't in tree.
+func DependencyPaths(roots []string, tree []*ResolvedPackage, name string) [][]*ResolvedPackage {
+	versions := make(map[string][]*ResolvedPackage)
+	for _, pkg := range tree {
+		versions[pkg.Name] = append(versions[pkg.Name], pkg)
+	}
+	pick := versionPicker(tree)
+	dependencies := func(pkg *ResolvedPackage) []*ResolvedPackage {
+		var deps []*ResolvedPackage
+		for dep, spec := range pkg.Dependencies {
+			if resolved := pick(dep, spec); resolved != nil {
+				deps = append(deps, resolved)
+			}
+		}
+		return deps
+	}
+
+	// Only packages that can reach name are worth walking through, which
+	// keeps large trees from being explored branch by branch
+	leads := make(map[*ResolvedPackage]bool)
+	for _, pkg := range versions[name] {
+		leads[pkg] = true
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, pkg := range tree {
+			if leads[pkg] {
+				continue
+			}
+			if slices.ContainsFunc(dependencies(pkg), func(dep *ResolvedPackage) bool { return leads[dep] }) {
+				leads[pkg], changed = true, true
+			}
+		}
+	}
+
+	var paths [][]*ResolvedPackage
+	var walk func(path []*ResolvedPackage)
+	walk = func(path []*ResolvedPackage) {
+		pkg := path[len(path)-1]
+		if pkg.Name == name {
+			paths = append(paths, slices.Clone(path))
+			return
+		}
+		for _, dep := range dependencies(pkg) {
+			if leads[dep] && !slices.Contains(path, dep) {
+				walk(append(path, dep))
+			}
+		}
+	}
+	for _, root := range roots {
+		if pkg := pick(splitNameVersion(root)); pkg != nil && leads[pkg] {
+			walk([]*ResolvedPackage{pkg})
+		}
+	}
+
+	slices.SortFunc(paths, func(a, b []*ResolvedPackage) int {
+		if len(a) != len(b) {
+			return len(a) - len(b)
+		}
+		return strings.Compare(pathString(a), pathString(b))
+	})
+	return slices.CompactFunc(paths, func(a, b []*ResolvedPackage) bool {
+		return pathString(a) == pathString(b)
+	})
+}
+
+// pathString joins a dependency chain as "a@1.0.0 > b@2.0.0"
+func pathString(path []*ResolvedPackage) string {
+	parts := make([]string, len(path))
+	for i, pkg := range path {
+		parts[i] = pkg.String()
+	}
+	return strings.Join(parts, " > ")
+}
+
+// versionPicker returns a function that finds the package in tree that a
+// dependency on name at spec is taken to be: the highest version in tree the
+// range allows, or nil when there is none
+func versionPicker(tree []*ResolvedPackage) func(name, spec string) *ResolvedPackage {
+	versions := make(map[string][]*ResolvedPackage)
+	for _, pkg := range tree {
+		versions[pkg.Name] = append(versions[pkg.Name], pkg)
+	}
+	return func(name, spec string) *ResolvedPackage {
+		r, ok := parseRange(spec)
+		if !ok {
+			// Tags such as "latest" say nothing about the version
+			r = anyRelease
+		}
+		var candidates []string
+		for _, pkg := range versions[name] {
+			candidates = append(candidates, pkg.Version)
+		}
+		best, ok := maxSatisfying(candidates, r)
+		if !ok {
+			return nil
+		}
+		for _, pkg := range versions[name] {
+			if pkg.Version == best {
+				return pkg
+			}
+		}
+		return nil
+	}
+}
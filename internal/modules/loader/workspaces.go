@@ -0,0 +1,208 @@
+package loader
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/katungi/edon/internal/errors"
+)
+
+// workspaceProtocol prefixes dependency ranges that must be satisfied by a
+// workspace package, as in "workspace:*" or "workspace:^1.0.0"
+const workspaceProtocol = "workspace:"
+
+// Workspace is a package of a monorepo, found by FindWorkspaces. Other
+// packages' dependencies on it are linked to Dir rather than fetched.
+type Workspace struct {
+	Name    string
+	Version string
+	// Dir is the absolute path of the package's directory
+	Dir             string
+	Dependencies    map[string]string
+	DevDependencies map[string]string
+	peers           peerFields
+}
+
+// workspaceManifest holds the package.json fields a workspace is read from
+type workspaceManifest struct {
+	Name            string            `json:"name"`
+	Version         string            `json:"version"`
+	Dependencies    map[string]string `json:"dependencies"`
+	DevDependencies map[string]string `json:"devDependencies"`
+	peerFields
+}
+
+// FindWorkspaces returns the packages under root matching the "workspaces"
+// globs of its package.json, sorted by name. Patterns use filepath.Match
+// syntax relative to root, and one starting with "!" excludes the
+// directories it matches. Matching directories without a package.json are
+// skipped; a workspace without a name and version is an error, since
+// nothing could depend on it.
+func FindWorkspaces(root string, patterns []string) ([]*Workspace, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrFileRead, err.Error())
+	}
+
+	dirs := make(map[string]bool)
+	for _, pattern := range patterns {
+		exclude := strings.HasPrefix(pattern, "!")
+		pattern = strings.TrimPrefix(pattern, "!")
+		matches, err := filepath.Glob(filepath.Join(root, filepath.FromSlash(pattern)))
+		if err != nil {
+			return nil, errors.Wrap(errors.ErrInvalidPackage, "workspaces: "+err.Error())
+		}
+		for _, dir := range matches {
+			dirs[dir] = !exclude
+		}
+	}
+
+	var workspaces []*Workspace
+	byName := make(map[string]string)
+	for dir, included := range dirs {
+		if !included || dir == root {
+			continue
+		}
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, "package.json"))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrap(errors.ErrFileRead, err.Error())
+		}
+		var manifest workspaceManifest
+		if err := json.Unmarshal(data, &manifest); err != nil {
+			return nil, errors.Wrap(errors.ErrInvalidPackage, dir+": "+err.Error())
+		}
+		if manifest.Name == "" || !isExactVersion(manifest.Version) {
+			return nil, errors.Wrap(errors.ErrInvalidPackage, dir+": package.json must declare a name and a version")
+		}
+		if other, ok := byName[manifest.Name]; ok {
+			return nil, errors.Wrap(errors.ErrInvalidPackage, "workspaces "+other+" and "+dir+" are both named "+manifest.Name)
+		}
+		byName[manifest.Name] = dir
+		workspaces = append(workspaces, &Workspace{
+			Name:            manifest.Name,
+			Version:         manifest.Version,
+			Dir:             dir,
+			Dependencies:    manifest.Dependencies,
+			DevDependencies: manifest.DevDependencies,
+			peers:           manifest.peerFields,
+		})
+	}
+	sort.Slice(workspaces, func(i, j int) bool { return workspaces[i].Name < workspaces[j].Name })
+	return workspaces, nil
+}
+
+// WithWorkspaces makes ResolveTree take dependencies on the given packages
+// from their directories whenever the workspace's version satisfies the
+// range or the range uses the "workspace:" protocol. Install links such
+// packages into the cache instead of downloading them.
+func WithWorkspaces(workspaces []*Workspace) Option {
+	return func(c *config) {
+		c.workspaces = workspaces
+	}
+}
+
+// workspace returns the workspace that a dependency on name at spec links
+// to, or nil when it should come from the registry
+func (pm *NPMPackageManager) workspace(name, spec string) *Workspace {
+	ws, ok := pm.workspaces[name]
+	if !ok {
+		return nil
+	}
+	if strings.HasPrefix(spec, workspaceProtocol) {
+		return ws
+	}
+	r, ok := parseRange(spec)
+	if !ok {
+		// Tags such as "latest" say nothing about the version
+		r = anyRelease
+	}
+	v, ok := parseVersion(ws.Version)
+	if !ok || !r.matches(v) {
+		return nil
+	}
+	return ws
+}
+
+// resolved returns the workspace as a package ResolveTree can return
+func (ws *Workspace) resolved() *ResolvedPackage {
+	return &ResolvedPackage{
+		Name:             ws.Name,
+		Version:          ws.Version,
+		Dependencies:     ws.Dependencies,
+		PeerDependencies: ws.peers.PeerDependencies,
+		OptionalPeers:    ws.peers.optionalPeers(),
+		Workspace:        ws.Dir,
+	}
+}
+
+// linkWorkspace installs a workspace package by pointing its cache entry at
+// the workspace directory, so edits to the workspace show up without
+// reinstalling. Anything already cached under its name and version, such as
+// a copy from the registry, is replaced.
+func (pm *NPMPackageManager) linkWorkspace(pkg *ResolvedPackage) (*InstalledPackage, error) {
+	cachePath := filepath.Join(pm.cacheDir, pkg.Name, pkg.Version)
+	installed := &InstalledPackage{Name: pkg.Name, Version: pkg.Version, Path: cachePath, Workspace: pkg.Workspace}
+	if target, err := os.Readlink(cachePath); err == nil && target == pkg.Workspace {
+		// Set afterwards, so the workspace directory's times aren't touched
+		// to mark the entry used
+		installed, err := pm.finishInstall(installed)
+		if err != nil {
+			return nil, err
+		}
+		installed.FromCache = true
+		return installed, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err != nil {
+		return nil, errors.Wrap(errors.ErrCacheDir, err.Error())
+	}
+	// Link beside the final path and rename it into place, so readers see
+	// either the old entry or the link
+	staging := cachePath + ".link"
+	_ = os.Remove(staging)
+	if err := os.Symlink(pkg.Workspace, staging); err != nil {
+		return nil, errors.Wrap(errors.ErrCacheDir, err.Error())
+	}
+	if err := os.Rename(staging, cachePath); err != nil {
+		// A real directory can't be renamed over
+		if err := os.RemoveAll(cachePath); err != nil {
+			os.Remove(staging)
+			return nil, errors.Wrap(errors.ErrCacheDir, err.Error())
+		}
+		if err := os.Rename(staging, cachePath); err != nil {
+			os.Remove(staging)
+			return nil, errors.Wrap(errors.ErrCacheDir, err.Error())
+		}
+	}
+	return pm.finishInstall(installed)
+}
+
+// Resolved returns the packages of tree that the workspace's dependencies,
+// and its devDependencies when dev is set, were taken to be, sorted by name.
+// Dependencies tree has no version for are left out.
+func (ws *Workspace) Resolved(tree []*ResolvedPackage, dev bool) []*ResolvedPackage {
+	pick := versionPicker(tree)
+	var resolved []*ResolvedPackage
+	add := func(deps map[string]string) {
+		for name, spec := range deps {
+			if pkg := pick(name, strings.TrimPrefix(spec, workspaceProtocol)); pkg != nil {
+				resolved = append(resolved, pkg)
+			}
+		}
+	}
+	add(ws.Dependencies)
+	if dev {
+		add(ws.DevDependencies)
+	}
+	sort.Slice(resolved, func(i, j int) bool { return resolved[i].Name < resolved[j].Name })
+	return resolved
+}
@@ -0,0 +1,55 @@
+package runtime
+
+import (
+	"context"
+
+	"github.com/buke/quickjs-go"
+	"github.com/katungi/edon/internal/errors"
+	"github.com/katungi/edon/internal/modules/loader"
+)
+
+// RunLoaded runs entry as RunModule does, with ml loading it and everything
+// it imports. QuickJS can't call back into Go for a module, so the graph is
+// linked through ml up front and handed to the context before entry runs;
+// an import ml didn't link, such as a dynamic import of a computed
+// specifier, fails instead of being read from disk behind the loader's back.
+func (r *Runtime) RunLoaded(ctx context.Context, ml *loader.ModuleLoader, entry string) error {
+	modules, err := ml.Link(ctx, entry)
+	if err != nil {
+		return err
+	}
+	if err := r.register(modules); err != nil {
+		return err
+	}
+	return r.RunModule(ctx, modules[0].URL, modules[0].Source)
+}
+
+// register adds every module but the first, the entry, to the context
+// without evaluating it, so imports of its URL find it. QuickJS resolves a
+// module's imports as it compiles it, so each is compiled in a scratch
+// context where every module of the graph is an empty stub; that lets import
+// cycles compile, and loading the bytecode resolves nothing.
+func (r *Runtime) register(modules []loader.LinkedModule) error {
+	scratch := r.jsRuntime.NewContext()
+	defer scratch.Close()
+	for _, m := range modules {
+		stub := scratch.Eval("export {};", quickjs.EvalFlagModule(true), quickjs.EvalFlagCompileOnly(true), quickjs.EvalFileName(m.URL))
+		if stub.IsException() {
+			return errors.WrapWith(errors.ErrEvalFailed, scratch.Exception(), m.URL)
+		}
+		stub.Free()
+	}
+
+	for _, m := range modules[1:] {
+		bytecode, err := scratch.Compile(m.Source, quickjs.EvalFlagModule(true), quickjs.EvalFileName(m.URL))
+		if err != nil {
+			return errors.WrapWith(errors.ErrEvalFailed, err, m.URL)
+		}
+		module := r.context.LoadModuleBytecode(bytecode, quickjs.EvalLoadOnly(true))
+		if module.IsException() {
+			return errors.WrapWith(errors.ErrEvalFailed, r.context.Exception(), m.URL)
+		}
+		module.Free()
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package runtime
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/buke/quickjs-go"
+)
+
+// ExitError is returned by RunModule when the script calls process.exit
+// with a non-zero code
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exited with code %d", e.Code)
+}
+
+// initProcess defines the process global: argv, which SetArgs fills in, and
+// exit, which stops the script with the given code
+func (r *Runtime) initProcess() {
+	process := r.context.Object()
+	process.Set("argv", r.context.ParseJSON(`["edon"]`))
+	process.Set("exit", r.context.Function(func(ctx *quickjs.Context, this *quickjs.Value, args []*quickjs.Value) *quickjs.Value {
+		code := 0
+		if len(args) > 0 && !args[0].IsUndefined() {
+			code = int(args[0].ToInt32())
+		}
+		r.exitCode = &code
+		// Unwind the script now; the interrupt handler stops it for good
+		return ctx.ThrowError(fmt.Errorf("process.exit(%d)", code))
+	}))
+	r.context.Globals().Set("process", process)
+}
+
+// SetArgs sets process.argv as Node does: the runtime, then the script
+// being run, then its arguments
+func (r *Runtime) SetArgs(script string, args []string) {
+	argv, _ := json.Marshal(append([]string{"edon", script}, args...))
+	process := r.context.Globals().Get("process")
+	defer process.Free()
+	process.Set("argv", r.context.ParseJSON(string(argv)))
+}
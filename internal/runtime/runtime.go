@@ -1,6 +1,7 @@
 package runtime
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
@@ -16,6 +17,8 @@ import (
 type Runtime struct {
 	jsRuntime *quickjs.Runtime
 	context   *quickjs.Context
+	// exitCode is set once the script calls process.exit
+	exitCode *int
 }
 
 const (
@@ -52,6 +55,7 @@ func (r *Runtime) initializeBuiltins() error {
 	if err := console.Init(r.context); err != nil {
 		return errors.WrapWith(errors.ErrConsoleInit, err, "console module")
 	}
+	r.initProcess()
 	return nil
 }
 
@@ -82,6 +86,37 @@ func (r *Runtime) ExecuteFile(filename string) error {
 	return nil
 }
 
+// RunModule evaluates source as the script or ES module identified by name,
+// interrupting it when ctx is canceled. The source can import only modules
+// already in the context; RunLoaded puts what it imports there.
+func (r *Runtime) RunModule(ctx context.Context, name, source string) error {
+	r.jsRuntime.SetInterruptHandler(func() int {
+		// process.exit can be caught like any exception, but not this
+		if ctx.Err() != nil || r.exitCode != nil {
+			return 1
+		}
+		return 0
+	})
+	defer r.jsRuntime.ClearInterruptHandler()
+
+	result := r.context.Eval(source, quickjs.EvalFileName(name), quickjs.EvalAwait(true))
+	defer result.Free()
+	if r.exitCode != nil {
+		if *r.exitCode != 0 {
+			return &ExitError{Code: *r.exitCode}
+		}
+		return nil
+	}
+	if result.IsException() {
+		err := r.context.Exception()
+		if ctx.Err() != nil {
+			return errors.WrapWith(ErrInterrupt, ctx.Err(), "")
+		}
+		return errors.WrapWith(errors.ErrEvalFailed, err, name)
+	}
+	return nil
+}
+
 func (r *Runtime) Close() {
 	if r.context != nil {
 		r.context.Close()
@@ -0,0 +1,106 @@
+package integration
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExec(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds the CLI")
+	}
+	bin := buildEdon(t)
+
+	// greet prints its arguments and exits with the code it's given
+	greet := `console.log("args:", process.argv.slice(2).join(" "));
+const code = Number(process.argv[process.argv.length - 1]);
+if (code) process.exit(code);
+`
+	tarballs := map[string][]byte{
+		"greet": filesTarball(t, map[string]string{
+			"package.json": `{"name": "greet", "version": "1.0.0", "bin": "cli.js"}`,
+			"cli.js":       greet,
+		}),
+		"multi": filesTarball(t, map[string]string{
+			"package.json": `{"name": "multi", "version": "1.0.0", "bin": {"one": "one.js", "two": "two.js"}}`,
+			"one.js":       `console.log("one");`,
+			"two.js":       `console.log("two");`,
+		}),
+	}
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, tarball, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/-/")
+		data, ok := tarballs[name]
+		switch {
+		case !ok:
+			http.NotFound(w, r)
+		case tarball != "":
+			w.Write(data)
+		default:
+			json.NewEncoder(w).Encode(map[string]any{
+				"name":      name,
+				"dist-tags": map[string]string{"latest": "1.0.0"},
+				"versions": map[string]any{"1.0.0": map[string]any{
+					"name":    name,
+					"version": "1.0.0",
+					"dist":    map[string]string{"tarball": srv.URL + "/" + name + "/-/" + name + "-1.0.0.tgz"},
+				}},
+			})
+		}
+	}))
+	defer srv.Close()
+
+	project := t.TempDir()
+	config := `{"registry": "` + srv.URL + `"}`
+	if err := os.WriteFile(filepath.Join(project, "edon.json"), []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cache := t.TempDir()
+	run := func(args ...string) (string, int) {
+		t.Helper()
+		cmd := exec.Command(bin, append([]string{"exec"}, args...)...)
+		cmd.Dir = project
+		cmd.Env = append(os.Environ(), "HOME="+t.TempDir(), "EDON_CACHE_DIR="+cache, "NO_COLOR=1")
+		var out bytes.Buffer
+		cmd.Stdout, cmd.Stderr = &out, &out
+		err := cmd.Run()
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return out.String(), exitErr.ExitCode()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out.String(), 0
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		out  string
+		code int
+	}{
+		{"arguments", []string{"greet", "--", "--loud", "hi"}, "args: --loud hi", 0},
+		{"exit code", []string{"greet", "--", "7"}, "args: 7", 7},
+		{"named bin", []string{"multi", "two"}, "two", 0},
+		{"several bins", []string{"multi"}, "pick one of one, two", 1},
+		{"unknown bin", []string{"multi", "three"}, `no bin "three"`, 1},
+		{"missing package", []string{"nope"}, "failed to install nope", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, code := run(tt.args...)
+			if code != tt.code || !strings.Contains(out, tt.out) {
+				t.Errorf("exec %s = %q, exit code %d; want %q, exit code %d", strings.Join(tt.args, " "), out, code, tt.out, tt.code)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package integration
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGraph(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds the CLI")
+	}
+	bin := buildEdon(t)
+	dir := t.TempDir()
+	files := map[string]string{
+		"main.js":       "import { a } from './a.js';\nimport { b } from './b.js';\n",
+		"a.js":          "import { b } from './b.js';\nexport const a = 1;\n",
+		"b.js":          "import { a } from './a.js';\nimport { c } from './c.js';\nexport const b = 2;\n",
+		"c.js":          "export const c = 3;\n",
+		"unresolved.js": "import { x } from './missing.js';\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	graph := func(args ...string) string {
+		t.Helper()
+		cmd := exec.Command(bin, append([]string{"graph"}, args...)...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "HOME="+t.TempDir(), "EDON_CACHE_DIR="+t.TempDir(), "NO_COLOR=1")
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("edon graph %v: %v\n%s", args, err, out)
+		}
+		return string(out)
+	}
+	url := func(name string) string {
+		return filepath.Join(dir, name)
+	}
+
+	// The tree expands each module once, marking the way back into the
+	// current path as a cycle and later imports as deduped
+	tree := graph("main.js")
+	want := []string{
+		url("main.js") + " [Local]",
+		"├── " + url("a.js") + " [Local]",
+		"│   └── " + url("b.js") + " [Local]",
+		"│       ├── " + url("a.js") + " [Local] (cycle)",
+		"│       └── " + url("c.js") + " [Local]",
+		"└── " + url("b.js") + " [Local] (deduped)",
+	}
+	if got := strings.TrimSpace(tree); got != strings.Join(want, "\n") {
+		t.Errorf("graph main.js =\n%s\nwant\n%s", got, strings.Join(want, "\n"))
+	}
+
+	var root struct {
+		URL     string `json:"url"`
+		Type    string `json:"type"`
+		Imports []struct {
+			URL     string `json:"url"`
+			Deduped bool   `json:"deduped"`
+			Imports []struct {
+				URL     string `json:"url"`
+				Imports []struct {
+					URL   string `json:"url"`
+					Cycle bool   `json:"cycle"`
+				} `json:"imports"`
+			} `json:"imports"`
+		} `json:"imports"`
+	}
+	if err := json.Unmarshal([]byte(graph("--json", "main.js")), &root); err != nil {
+		t.Fatalf("graph --json isn't JSON: %v", err)
+	}
+	if root.URL != url("main.js") || root.Type != "Local" || len(root.Imports) != 2 {
+		t.Fatalf("graph --json root = %+v", root)
+	}
+	if !root.Imports[1].Deduped || !root.Imports[0].Imports[0].Imports[0].Cycle {
+		t.Errorf("graph --json = %+v, want b.js deduped and the a.js cycle marked", root)
+	}
+
+	dot := graph("--dot", "main.js")
+	for _, line := range []string{
+		"digraph imports {",
+		`"` + url("main.js") + `" -> "` + url("a.js") + `";`,
+		`"` + url("b.js") + `" -> "` + url("c.js") + `";`,
+	} {
+		if !strings.Contains(dot, line) {
+			t.Errorf("graph --dot = %s, want a line %s", dot, line)
+		}
+	}
+	if n := strings.Count(dot, `"`+url("c.js")+`" [label=`); n != 1 {
+		t.Errorf("graph --dot declares c.js %d times, want once", n)
+	}
+
+	// A module that can't be loaded is reported in place
+	if out := graph("unresolved.js"); !strings.Contains(out, url("missing.js")+" [Local] (error: ") {
+		t.Errorf("graph unresolved.js = %s, want the missing import's error", out)
+	}
+
+	cmd := exec.Command(bin, "graph", "--json", "--dot", "main.js")
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err == nil || !strings.Contains(string(out), "can't be used together") {
+		t.Errorf("graph --json --dot = %v, %s; want it refused", err, out)
+	}
+}
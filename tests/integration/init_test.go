@@ -0,0 +1,330 @@
+package integration
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// buildEdon compiles the edon CLI into a temporary directory
+func buildEdon(t *testing.T) string {
+	t.Helper()
+	bin := filepath.Join(t.TempDir(), "edon")
+	out, err := exec.Command("go", "build", "-o", bin, "github.com/katungi/edon/cmd/edon").CombinedOutput()
+	if err != nil {
+		t.Fatalf("go build: %v\n%s", err, out)
+	}
+	return bin
+}
+
+func TestInitRefusesToOverwrite(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds the CLI")
+	}
+	bin := buildEdon(t)
+	dir := t.TempDir()
+	manifest := filepath.Join(dir, "package.json")
+	entry := filepath.Join(dir, "index.js")
+	if err := os.WriteFile(manifest, []byte(`{"name": "existing"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(entry, []byte("keep me"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	init := func(args ...string) (string, error) {
+		cmd := exec.Command(bin, append([]string{"init", "--quiet"}, args...)...)
+		cmd.Env = append(os.Environ(), "HOME="+t.TempDir(), "NO_COLOR=1")
+		out, err := cmd.CombinedOutput()
+		return string(out), err
+	}
+
+	out, err := init(dir)
+	if err == nil {
+		t.Fatalf("init in an existing project succeeded, want it refused")
+	}
+	for _, path := range []string{manifest, entry} {
+		if !strings.Contains(out, path) {
+			t.Errorf("init output = %q, want it to name %s", out, path)
+		}
+	}
+	if data, _ := os.ReadFile(manifest); string(data) != `{"name": "existing"}` {
+		t.Errorf("package.json = %s, want it untouched", data)
+	}
+	if data, _ := os.ReadFile(entry); string(data) != "keep me" {
+		t.Errorf("index.js = %s, want it untouched", data)
+	}
+
+	if out, err := init("--force", dir); err != nil {
+		t.Fatalf("init --force: %v\n%s", err, out)
+	}
+	if data, _ := os.ReadFile(entry); string(data) == "keep me" {
+		t.Errorf("index.js wasn't overwritten with --force")
+	}
+}
+
+func TestInitEntry(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds the CLI")
+	}
+	bin := buildEdon(t)
+	init := func(dir string, args ...string) (string, error) {
+		cmd := exec.Command(bin, append(append([]string{"init", "--quiet"}, args...), dir)...)
+		cmd.Env = append(os.Environ(), "HOME="+t.TempDir(), "NO_COLOR=1")
+		out, err := cmd.CombinedOutput()
+		return string(out), err
+	}
+
+	// The entry is both main and the start script, and is created with a
+	// hello-world body
+	dir := t.TempDir()
+	if out, err := init(dir, "--entry", "src/app.ts"); err != nil {
+		t.Fatalf("init --entry: %v\n%s", err, out)
+	}
+	var manifest struct {
+		Main    string            `json:"main"`
+		Scripts map[string]string `json:"scripts"`
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "package.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Main != "src/app.ts" || manifest.Scripts["start"] != "edon src/app.ts" {
+		t.Errorf("package.json main = %q, start = %q; want src/app.ts", manifest.Main, manifest.Scripts["start"])
+	}
+	if body, err := os.ReadFile(filepath.Join(dir, "src", "app.ts")); err != nil || !strings.Contains(string(body), "Hello from Edon!") {
+		t.Errorf("src/app.ts = %q, %v; want a hello-world body", body, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "index.js")); !os.IsNotExist(err) {
+		t.Errorf("index.js was created alongside --entry")
+	}
+
+	// Only entries edon can run are accepted, and nothing is written otherwise
+	for _, entry := range []string{"main.py", "app.cjs", "src"} {
+		dir := t.TempDir()
+		if out, err := init(dir, "--entry", entry); err == nil || !strings.Contains(out, "must be a .js, .ts or .mjs file") {
+			t.Errorf("init --entry %s = %v, %q; want it rejected", entry, err, out)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "package.json")); !os.IsNotExist(err) {
+			t.Errorf("init --entry %s wrote package.json", entry)
+		}
+	}
+
+	// An existing entry is only replaced with --force
+	dir = t.TempDir()
+	entry := filepath.Join(dir, "main.mjs")
+	if err := os.WriteFile(entry, []byte("keep me"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := init(dir, "--entry", "main.mjs"); err == nil || !strings.Contains(out, entry) {
+		t.Errorf("init over an existing entry = %v, %q; want it refused", err, out)
+	}
+	if body, _ := os.ReadFile(entry); string(body) != "keep me" {
+		t.Errorf("main.mjs = %q, want it untouched", body)
+	}
+	if out, err := init(dir, "--entry", "main.mjs", "--force"); err != nil {
+		t.Fatalf("init --entry --force: %v\n%s", err, out)
+	}
+	if body, _ := os.ReadFile(entry); string(body) == "keep me" {
+		t.Errorf("main.mjs wasn't overwritten with --force")
+	}
+}
+
+func TestInitQuiet(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds the CLI")
+	}
+	bin := buildEdon(t)
+	// Output goes to a pipe, not a terminal, so even without NO_COLOR it
+	// must come out plain
+	var env []string
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, "NO_COLOR=") {
+			env = append(env, kv)
+		}
+	}
+	init := func(args ...string) (string, error) {
+		cmd := exec.Command(bin, append([]string{"init"}, args...)...)
+		cmd.Env = append(env, "HOME="+t.TempDir())
+		out, err := cmd.CombinedOutput()
+		return string(out), err
+	}
+
+	out, err := init(t.TempDir())
+	if err != nil {
+		t.Fatalf("init: %v\n%s", err, out)
+	}
+	if !strings.Contains(out, "Created package.json") || strings.Contains(out, "\x1b[") {
+		t.Errorf("init output = %q, want plain progress lines", out)
+	}
+
+	if out, err := init("--quiet", t.TempDir()); err != nil || out != "" {
+		t.Errorf("init --quiet = %v, %q; want no output", err, out)
+	}
+	// Errors still print
+	if out, err := init("--quiet", "--entry", "main.py", t.TempDir()); err == nil || !strings.Contains(out, "must be a .js, .ts or .mjs file") {
+		t.Errorf("init --quiet with a bad entry = %v, %q; want the error", err, out)
+	}
+}
+
+func TestInitCheck(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds the CLI")
+	}
+	bin := buildEdon(t)
+	check := func(dir string) (string, error) {
+		cmd := exec.Command(bin, "init", "--check", dir)
+		cmd.Env = append(os.Environ(), "HOME="+t.TempDir(), "NO_COLOR=1")
+		out, err := cmd.CombinedOutput()
+		return string(out), err
+	}
+
+	valid := t.TempDir()
+	manifest := "{\n  \"name\": \"app\",\n  \"version\": \"1.2.3\",\n  \"main\": \"index.js\"\n}\n"
+	if err := os.WriteFile(filepath.Join(valid, "package.json"), []byte(manifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(valid, "index.js"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := check(valid); err != nil {
+		t.Fatalf("init --check on a valid manifest: %v\n%s", err, out)
+	}
+
+	broken := t.TempDir()
+	manifest = "{\n  \"name\": \"App\",\n  \"version\": \"1.0\",\n  \"main\": \"missing.js\"\n}\n"
+	path := filepath.Join(broken, "package.json")
+	if err := os.WriteFile(path, []byte(manifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out, err := check(broken)
+	if err == nil {
+		t.Fatalf("init --check on a broken manifest succeeded\n%s", out)
+	}
+	for _, want := range []string{path + ":2: name", path + ":3: version", path + ":4: main"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("init --check output = %q, want %q", out, want)
+		}
+	}
+	if data, _ := os.ReadFile(path); string(data) != manifest {
+		t.Errorf("package.json = %s, want it untouched", data)
+	}
+	if _, err := os.Stat(filepath.Join(broken, "index.js")); !os.IsNotExist(err) {
+		t.Error("init --check created an entry file")
+	}
+
+	if err := os.WriteFile(path, []byte("{\n  \"name\": \"app\",\n  \"version\": \"1.0.0\"\n  \"main\": \"index.js\"\n}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := check(broken); err == nil || !strings.Contains(out, path+":4: invalid JSON") {
+		t.Errorf("init --check on malformed JSON = %v, %q; want a syntax error on line 4", err, out)
+	}
+}
+
+func TestWorkDir(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds the CLI")
+	}
+	bin := buildEdon(t)
+	cwd := t.TempDir()
+	edon := func(args ...string) (string, error) {
+		cmd := exec.Command(bin, args...)
+		cmd.Dir = cwd
+		cmd.Env = append(os.Environ(), "HOME="+t.TempDir(), "NO_COLOR=1")
+		out, err := cmd.CombinedOutput()
+		return string(out), err
+	}
+
+	// init creates a --dir that doesn't exist yet
+	project := filepath.Join(t.TempDir(), "app")
+	if out, err := edon("--dir", project, "init", "--quiet"); err != nil {
+		t.Fatalf("--dir init: %v\n%s", err, out)
+	}
+	for _, name := range []string{"package.json", "index.js"} {
+		if _, err := os.Stat(filepath.Join(project, name)); err != nil {
+			t.Errorf("--dir init didn't create %s: %v", name, err)
+		}
+	}
+	if entries, _ := os.ReadDir(cwd); len(entries) != 0 {
+		t.Errorf("--dir init wrote to the current directory: %v", entries)
+	}
+
+	// Its argument is taken from an existing --dir
+	if out, err := edon("-C", project, "init", "--quiet", "sub"); err != nil {
+		t.Fatalf("-C init sub: %v\n%s", err, out)
+	}
+	if _, err := os.Stat(filepath.Join(project, "sub", "package.json")); err != nil {
+		t.Errorf("-C init sub didn't create sub/package.json: %v", err)
+	}
+
+	// run resolves its entry and local imports from --dir
+	if err := os.WriteFile(filepath.Join(project, "index.js"), []byte("import { n } from './n.js';\nconsole.log('n is', n);"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(project, "n.js"), []byte("export const n = 42;"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := edon("-C", project, "run", "index.js"); err != nil || !strings.Contains(out, "n is 42") {
+		t.Errorf("-C run index.js = %v, %q; want it to print n is 42", err, out)
+	}
+
+	// Other commands need the directory to exist
+	missing := filepath.Join(t.TempDir(), "missing")
+	if out, err := edon("--dir", missing, "install"); err == nil {
+		t.Errorf("--dir install in a missing directory succeeded\n%s", out)
+	}
+	if out, err := edon("--dir", filepath.Join(project, "package.json"), "install"); err == nil || !strings.Contains(out, "not a directory") {
+		t.Errorf("--dir naming a file = %v, %q; want it refused", err, out)
+	}
+}
+
+func TestJSONErrorOutput(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds the CLI")
+	}
+	bin := buildEdon(t)
+	edon := func(args ...string) (stdout, stderr string, err error) {
+		cmd := exec.Command(bin, args...)
+		cmd.Dir = t.TempDir()
+		cmd.Env = append(os.Environ(), "HOME="+t.TempDir(), "NO_COLOR=1")
+		var out, errOut strings.Builder
+		cmd.Stdout, cmd.Stderr = &out, &errOut
+		err = cmd.Run()
+		return out.String(), errOut.String(), err
+	}
+
+	stdout, stderr, err := edon("--output=json", "why", "Bad_Name")
+	if err == nil {
+		t.Fatal("why with an invalid name succeeded")
+	}
+	var out struct {
+		Error struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+			Cause   string `json:"cause"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(stderr), &out); err != nil {
+		t.Fatalf("stderr isn't a JSON object: %v\n%s", err, stderr)
+	}
+	if out.Error.Code != "INVALID_PACKAGE_NAME" || !strings.Contains(out.Error.Message, "Bad_Name") || out.Error.Cause != "invalid package name" {
+		t.Errorf("error = %+v", out.Error)
+	}
+	if stdout != "" {
+		t.Errorf("stdout = %q, want nothing", stdout)
+	}
+
+	// Text stays the default
+	if stdout, _, _ := edon("why", "Bad_Name"); !strings.HasPrefix(stdout, "Error: ") {
+		t.Errorf("text output = %q", stdout)
+	}
+	if _, _, err := edon("--output=xml", "why", "left-pad"); err == nil {
+		t.Error("--output=xml was accepted")
+	}
+}
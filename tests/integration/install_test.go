@@ -0,0 +1,763 @@
+package integration
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// packageTarball builds an npm tarball holding only a package.json
+func packageTarball(t *testing.T, name string) []byte {
+	return filesTarball(t, map[string]string{"package.json": `{"name": "` + name + `", "version": "1.0.0"}`})
+}
+
+// filesTarball builds an npm tarball holding files under "package/"
+func filesTarball(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: "package/" + name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestInstallExitCodes(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds the CLI")
+	}
+	bin := buildEdon(t)
+
+	// "good" installs; "tampered" advertises the integrity of other bytes
+	tarballs := map[string][]byte{"good": packageTarball(t, "good"), "tampered": packageTarball(t, "tampered")}
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, tarball, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/-/")
+		data, ok := tarballs[name]
+		switch {
+		case !ok:
+			http.NotFound(w, r)
+		case tarball != "":
+			w.Write(data)
+		default:
+			advertised := data
+			if name == "tampered" {
+				advertised = []byte("something else")
+			}
+			sum := sha512.Sum512(advertised)
+			json.NewEncoder(w).Encode(map[string]any{
+				"name":      name,
+				"dist-tags": map[string]string{"latest": "1.0.0"},
+				"versions": map[string]any{"1.0.0": map[string]any{
+					"name":    name,
+					"version": "1.0.0",
+					"dist": map[string]string{
+						"tarball":   srv.URL + "/" + name + "/-/" + name + "-1.0.0.tgz",
+						"integrity": "sha512-" + base64.StdEncoding.EncodeToString(sum[:]),
+					},
+				}},
+			})
+		}
+	}))
+	defer srv.Close()
+
+	// Nothing listens on a port that was just released
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	unreachable := "http://" + listener.Addr().String()
+	listener.Close()
+
+	install := func(registry string, args ...string) (string, int) {
+		t.Helper()
+		cmd := exec.Command(bin, append([]string{"install", "--registry", registry}, args...)...)
+		cmd.Dir = t.TempDir()
+		cmd.Env = append(os.Environ(), "HOME="+t.TempDir(), "EDON_CACHE_DIR="+t.TempDir(), "NO_COLOR=1")
+		var stdout bytes.Buffer
+		cmd.Stdout = &stdout
+		err := cmd.Run()
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return stdout.String(), exitErr.ExitCode()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		return stdout.String(), 0
+	}
+
+	tests := []struct {
+		name     string
+		registry string
+		pkg      string
+		want     int
+	}{
+		{"installed", srv.URL, "good", 0},
+		{"not found", srv.URL, "missing", 4},
+		{"version not found", srv.URL, "good@2.0.0", 4},
+		{"integrity mismatch", srv.URL, "tampered", 5},
+		{"network failure", unreachable, "good", 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, code := install(tt.registry, "--silent", tt.pkg); code != tt.want {
+				t.Errorf("install %s exit code = %d, want %d", tt.pkg, code, tt.want)
+			}
+		})
+	}
+
+	// --silent only drops output, not errors
+	if out, _ := install(srv.URL, "good"); !strings.Contains(out, "Successfully installed") {
+		t.Errorf("install output = %q, want progress", out)
+	}
+	if out, _ := install(srv.URL, "--silent", "good"); out != "" {
+		t.Errorf("install --silent output = %q, want nothing", out)
+	}
+	if out, code := install(srv.URL, "--silent", "missing"); code == 0 || !strings.Contains(out, "Error:") {
+		t.Errorf("install --silent missing = %q, %d, want the error printed", out, code)
+	}
+
+	// JSON output while silenced goes nowhere rather than failing
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "package.json"), []byte(`{"name": "app"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{
+		{"install", "--silent", "--json"},
+		{"--output=json", "install", "--silent"},
+	} {
+		cmd := exec.Command(bin, args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "HOME="+t.TempDir(), "EDON_CACHE_DIR="+t.TempDir())
+		if out, err := cmd.CombinedOutput(); err != nil || len(out) != 0 {
+			t.Errorf("edon %s = %q, %v, want no output and exit 0", strings.Join(args, " "), out, err)
+		}
+	}
+}
+
+func TestJobs(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds the CLI")
+	}
+	bin := buildEdon(t)
+
+	names := []string{"a", "b", "c", "d", "e"}
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, tarball, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/-/")
+		data := packageTarball(t, name)
+		if tarball != "" {
+			w.Write(data)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"name":      name,
+			"dist-tags": map[string]string{"latest": "1.0.0"},
+			"versions": map[string]any{"1.0.0": map[string]any{
+				"name":    name,
+				"version": "1.0.0",
+				"dist":    map[string]string{"tarball": srv.URL + "/" + name + "/-/" + name + "-1.0.0.tgz"},
+			}},
+		})
+	}))
+	defer srv.Close()
+
+	edon := func(env string, args ...string) (string, int) {
+		t.Helper()
+		cmd := exec.Command(bin, args...)
+		cmd.Dir = t.TempDir()
+		cmd.Env = append(os.Environ(), "HOME="+t.TempDir(), "EDON_CACHE_DIR="+t.TempDir(), "NO_COLOR=1", env)
+		out, err := cmd.CombinedOutput()
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return string(out), exitErr.ExitCode()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(out), 0
+	}
+
+	// Packages install at once but are reported in order
+	out, code := edon("EDON_JOBS=", append([]string{"--jobs", "3", "install", "--registry", srv.URL}, names...)...)
+	if code != 0 {
+		t.Fatalf("install --jobs 3 exit code = %d\n%s", code, out)
+	}
+	last := -1
+	for _, name := range names {
+		at := strings.Index(out, "Successfully installed "+name+"@1.0.0")
+		if at < last {
+			t.Errorf("install --jobs 3 output = %q, want each package reported in order", out)
+			break
+		}
+		last = at
+	}
+
+	for _, tt := range []struct {
+		env  string
+		args []string
+	}{
+		{"EDON_JOBS=", []string{"--jobs", "0", "install", "a"}},
+		{"EDON_JOBS=many", []string{"install", "a"}},
+	} {
+		if out, code := edon(tt.env, tt.args...); code != 2 || !strings.Contains(out, "must be") {
+			t.Errorf("edon %v with %q = %q, %d, want a usage error and exit code 2", tt.args, tt.env, out, code)
+		}
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds the CLI")
+	}
+	bin := buildEdon(t)
+
+	tarballs := map[string][]byte{}
+	for _, v := range []string{"1.0.0", "1.1.0"} {
+		tarballs[v] = filesTarball(t, map[string]string{"package.json": `{"name": "demo", "version": "` + v + `"}`})
+	}
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/demo" {
+			v := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/demo/-/demo-"), ".tgz")
+			w.Write(tarballs[v])
+			return
+		}
+		versions := map[string]any{}
+		for v, data := range tarballs {
+			sum := sha512.Sum512(data)
+			versions[v] = map[string]any{
+				"name":    "demo",
+				"version": v,
+				"dist": map[string]string{
+					"tarball":   srv.URL + "/demo/-/demo-" + v + ".tgz",
+					"integrity": "sha512-" + base64.StdEncoding.EncodeToString(sum[:]),
+				},
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]any{"name": "demo", "dist-tags": map[string]string{"latest": "1.1.0"}, "versions": versions})
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"package.json": `{"name": "app", "version": "1.0.0", "dependencies": {"demo": "^1.0.0"}}`,
+		"edon.json":    `{"lock": "./deno.lock", "registry": "` + srv.URL + `"}`,
+		"deno.lock": `{"version": "3", "packages": {
+			"specifiers": {"npm:demo@^1.0.0": "npm:demo@1.0.0"},
+			"npm": {"demo@1.0.0": {"integrity": "", "dependencies": {}}}
+		}}`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(dir+"/"+name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cache := t.TempDir()
+	edon := func(args ...string) string {
+		t.Helper()
+		cmd := exec.Command(bin, args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "HOME="+t.TempDir(), "EDON_CACHE_DIR="+cache, "NO_COLOR=1")
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("edon %v: %v\n%s", args, err, out)
+		}
+		return string(out)
+	}
+	lock := func() string {
+		t.Helper()
+		data, err := os.ReadFile(dir + "/deno.lock")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	// A plain install keeps the locked version
+	if out := edon("install"); !strings.Contains(out, "Successfully installed demo@1.0.0") {
+		t.Errorf("install output = %q, want demo@1.0.0 from the lock", out)
+	}
+
+	out := edon("update")
+	if !strings.Contains(out, "Successfully installed demo@1.1.0") || !strings.Contains(out, "demo 1.0.0 → 1.1.0") {
+		t.Errorf("update output = %q, want demo updated to 1.1.0", out)
+	}
+	if l := lock(); !strings.Contains(l, `"npm:demo@1.1.0"`) || strings.Contains(l, `"demo@1.0.0"`) {
+		t.Errorf("deno.lock after update = %s, want only demo@1.1.0", l)
+	}
+
+	if out := edon("install", "--update", "--json", "demo"); strings.Contains(out, `"type":"update"`) {
+		t.Errorf("second update output = %q, want no changes", out)
+	}
+	if out := edon("update", "demo"); !strings.Contains(out, "Everything was already up to date") {
+		t.Errorf("update demo output = %q, want nothing to update", out)
+	}
+}
+
+func TestInstallCheck(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds the CLI")
+	}
+	bin := buildEdon(t)
+
+	tarballs := map[string][]byte{}
+	for _, v := range []string{"1.0.0", "1.1.0"} {
+		tarballs[v] = filesTarball(t, map[string]string{"package.json": `{"name": "demo", "version": "` + v + `"}`})
+	}
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/demo" {
+			v := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/demo/-/demo-"), ".tgz")
+			w.Write(tarballs[v])
+			return
+		}
+		versions := map[string]any{}
+		for v, data := range tarballs {
+			sum := sha512.Sum512(data)
+			versions[v] = map[string]any{
+				"name":    "demo",
+				"version": v,
+				"dist": map[string]string{
+					"tarball":   srv.URL + "/demo/-/demo-" + v + ".tgz",
+					"integrity": "sha512-" + base64.StdEncoding.EncodeToString(sum[:]),
+				},
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]any{"name": "demo", "dist-tags": map[string]string{"latest": "1.1.0"}, "versions": versions})
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.WriteFile(dir+"/"+name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("package.json", `{"name": "app", "version": "1.0.0", "dependencies": {"demo": "1.0.0"}}`)
+	write("edon.json", `{"lock": "./deno.lock", "registry": "`+srv.URL+`"}`)
+	cache := t.TempDir()
+	edon := func(args ...string) (string, int) {
+		t.Helper()
+		cmd := exec.Command(bin, args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "HOME="+t.TempDir(), "EDON_CACHE_DIR="+cache, "NO_COLOR=1")
+		out, err := cmd.CombinedOutput()
+		var exit *exec.ExitError
+		if errors.As(err, &exit) {
+			return string(out), exit.ExitCode()
+		}
+		if err != nil {
+			t.Fatalf("edon %v: %v", args, err)
+		}
+		return string(out), 0
+	}
+	if out, code := edon("install"); code != 0 {
+		t.Fatalf("install exit code = %d\n%s", code, out)
+	}
+	locked, err := os.ReadFile(dir + "/deno.lock")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if out, code := edon("install", "--check"); code != 0 || !strings.Contains(out, "matches package.json") {
+		t.Errorf("check of a current lock = %d, %q; want success", code, out)
+	}
+	// Not even an empty cache is created
+	fresh := cache
+	cache = filepath.Join(t.TempDir(), "cache")
+	if out, code := edon("install", "--check"); code != 0 {
+		t.Errorf("check with no cache = %d, %q; want success", code, out)
+	}
+	if _, err := os.Stat(cache); !os.IsNotExist(err) {
+		t.Errorf("check created the cache directory (stat error %v), want nothing written", err)
+	}
+	cache = fresh
+
+	// A range the locked version no longer satisfies
+	write("package.json", `{"name": "app", "version": "1.0.0", "dependencies": {"demo": "^1.1.0"}}`)
+	out, code := edon("install", "--check")
+	if code == 0 {
+		t.Errorf("check after package.json changed succeeded, want it to fail\n%s", out)
+	}
+	for _, want := range []string{"+ npm:demo@^1.1.0 → npm:demo@1.1.0", "+ demo@1.1.0", "deno.lock is out of date: 2 differences"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("check output = %q, want it to contain %q", out, want)
+		}
+	}
+	if _, err := os.Stat(cache + "/npm-cache/demo/1.1.0"); !os.IsNotExist(err) {
+		t.Errorf("check installed demo@1.1.0 (stat error %v), want nothing installed", err)
+	}
+
+	// An integrity that doesn't match the registry's
+	write("package.json", `{"name": "app", "version": "1.0.0", "dependencies": {"demo": "1.0.0"}}`)
+	sum := sha512.Sum512(tarballs["1.0.0"])
+	integrity := "sha512-" + base64.StdEncoding.EncodeToString(sum[:])
+	tampered := strings.Replace(string(locked), integrity, "sha512-AAAA", 1)
+	write("deno.lock", tampered)
+	out, code = edon("install", "--check", "--json")
+	if code == 0 || !strings.Contains(out, `{"type":"lock","key":"demo@1.0.0","field":"integrity","locked":"sha512-AAAA","resolved":"`+integrity+`"}`) {
+		t.Errorf("check of a tampered lock = %d, %q; want the integrity difference", code, out)
+	}
+
+	if data, _ := os.ReadFile(dir + "/deno.lock"); string(data) != tampered {
+		t.Errorf("deno.lock after checks = %s, want it untouched", data)
+	}
+}
+
+func TestInstallRegistry(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds the CLI")
+	}
+	bin := buildEdon(t)
+
+	tarball := packageTarball(t, "demo")
+	registry := func(hits *atomic.Int32) *httptest.Server {
+		var srv *httptest.Server
+		srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hits.Add(1)
+			if r.URL.Path != "/demo" {
+				w.Write(tarball)
+				return
+			}
+			sum := sha512.Sum512(tarball)
+			json.NewEncoder(w).Encode(map[string]any{
+				"name":      "demo",
+				"dist-tags": map[string]string{"latest": "1.0.0"},
+				"versions": map[string]any{"1.0.0": map[string]any{
+					"name":    "demo",
+					"version": "1.0.0",
+					"dist": map[string]string{
+						"tarball":   srv.URL + "/demo/-/demo-1.0.0.tgz",
+						"integrity": "sha512-" + base64.StdEncoding.EncodeToString(sum[:]),
+					},
+				}},
+			})
+		}))
+		return srv
+	}
+	var configuredHits, overrideHits atomic.Int32
+	configured := registry(&configuredHits)
+	defer configured.Close()
+	override := registry(&overrideHits)
+	defer override.Close()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "edon.json"), []byte(`{"registry": "`+configured.URL+`"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	install := func(args ...string) (string, int) {
+		t.Helper()
+		cmd := exec.Command(bin, append([]string{"install"}, args...)...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "HOME="+t.TempDir(), "EDON_CACHE_DIR="+t.TempDir(), "NO_COLOR=1")
+		out, err := cmd.CombinedOutput()
+		var exit *exec.ExitError
+		if errors.As(err, &exit) {
+			return string(out), exit.ExitCode()
+		}
+		if err != nil {
+			t.Fatalf("install %v: %v", args, err)
+		}
+		return string(out), 0
+	}
+
+	// --registry wins over edon.json for this run
+	if out, code := install("--registry", override.URL, "demo"); code != 0 {
+		t.Fatalf("install --registry exit code = %d\n%s", code, out)
+	}
+	if overrideHits.Load() == 0 || configuredHits.Load() != 0 {
+		t.Errorf("requests to the override = %d, to the configured registry = %d; want only the override", overrideHits.Load(), configuredHits.Load())
+	}
+
+	// A malformed URL is rejected before anything is fetched
+	overrideHits.Store(0)
+	for _, bad := range []string{"not a url", "ftp://registry.example.com", "://missing-scheme"} {
+		out, code := install("--registry", bad, "demo")
+		if code == 0 || !strings.Contains(out, "invalid registry URL") {
+			t.Errorf("install --registry %q = %d, %q; want an invalid registry URL error", bad, code, out)
+		}
+	}
+	if n := configuredHits.Load() + overrideHits.Load(); n != 0 {
+		t.Errorf("malformed --registry made %d requests, want none", n)
+	}
+}
+
+func TestCacheDir(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds the CLI")
+	}
+	bin := buildEdon(t)
+
+	tarball := packageTarball(t, "demo")
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/demo" {
+			w.Write(tarball)
+			return
+		}
+		sum := sha512.Sum512(tarball)
+		json.NewEncoder(w).Encode(map[string]any{
+			"name":      "demo",
+			"dist-tags": map[string]string{"latest": "1.0.0"},
+			"versions": map[string]any{"1.0.0": map[string]any{
+				"name":    "demo",
+				"version": "1.0.0",
+				"dist": map[string]string{
+					"tarball":   srv.URL + "/demo/-/demo-1.0.0.tgz",
+					"integrity": "sha512-" + base64.StdEncoding.EncodeToString(sum[:]),
+				},
+			}},
+		})
+	}))
+	defer srv.Close()
+
+	env, configured, flagged := t.TempDir(), t.TempDir(), t.TempDir()
+	edon := func(config string, args ...string) string {
+		t.Helper()
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, "edon.json"), []byte(`{"registry": "`+srv.URL+`"`+config+`}`), 0644); err != nil {
+			t.Fatal(err)
+		}
+		cmd := exec.Command(bin, args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "HOME="+t.TempDir(), "EDON_CACHE_DIR="+env, "NO_COLOR=1")
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("edon %v: %v\n%s", args, err, out)
+		}
+		return string(out)
+	}
+	installed := func(base string) bool {
+		_, err := os.Stat(filepath.Join(base, "npm-cache", "demo", "1.0.0"))
+		return err == nil
+	}
+
+	// The flag wins over both edon.json and EDON_CACHE_DIR, for every
+	// subcommand
+	withConfig := `, "cacheDir": "` + filepath.ToSlash(configured) + `"`
+	edon(withConfig, "--cache-dir", flagged, "install", "demo")
+	if !installed(flagged) || installed(configured) || installed(env) {
+		t.Errorf("install with --cache-dir didn't install into %s alone", flagged)
+	}
+	if out := edon(withConfig, "--cache-dir", flagged, "cache", "size"); !strings.Contains(out, flagged) {
+		t.Errorf("cache size with --cache-dir = %q, want it to report %s", out, flagged)
+	}
+
+	// Without it, edon.json wins over the environment, which wins over the
+	// default
+	edon(withConfig, "install", "demo")
+	if !installed(configured) || installed(env) {
+		t.Errorf("install with cacheDir in edon.json didn't install into %s", configured)
+	}
+	edon("", "install", "demo")
+	if !installed(env) {
+		t.Errorf("install with EDON_CACHE_DIR didn't install into %s", env)
+	}
+}
+
+func TestAddFailedWriteKeepsManifest(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds the CLI")
+	}
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("needs sh to limit the file size")
+	}
+	bin := buildEdon(t)
+
+	tarball := packageTarball(t, "demo")
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/demo" {
+			w.Write(tarball)
+			return
+		}
+		sum := sha512.Sum512(tarball)
+		json.NewEncoder(w).Encode(map[string]any{
+			"name":      "demo",
+			"dist-tags": map[string]string{"latest": "1.0.0"},
+			"versions": map[string]any{"1.0.0": map[string]any{
+				"name":    "demo",
+				"version": "1.0.0",
+				"dist": map[string]string{
+					"tarball":   srv.URL + "/demo/-/demo-1.0.0.tgz",
+					"integrity": "sha512-" + base64.StdEncoding.EncodeToString(sum[:]),
+				},
+			}},
+		})
+	}))
+	defer srv.Close()
+
+	// The rewritten manifest is over the file size limit, so writing it fails
+	// partway; the original must survive that, permissions and all
+	dir := t.TempDir()
+	manifest := `{"name": "app", "version": "1.0.0", "description": "` + strings.Repeat("x", 16<<10) + `"}`
+	path := filepath.Join(dir, "package.json")
+	if err := os.WriteFile(path, []byte(manifest), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "edon.json"), []byte(`{"registry": "`+srv.URL+`"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command("sh", "-c", `ulimit -f 8 && exec "$0" "$@"`, bin, "add", "demo")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "HOME="+t.TempDir(), "EDON_CACHE_DIR="+t.TempDir(), "NO_COLOR=1")
+	if out, err := cmd.CombinedOutput(); err == nil || !strings.Contains(string(out), "failed to write package.json") {
+		t.Fatalf("add with a failing write = %v, %s; want it to fail writing package.json", err, out)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != manifest {
+		t.Errorf("package.json after a failed write is %d bytes, want the original %d", len(data), len(manifest))
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("package.json mode = %v, want 0600", info.Mode().Perm())
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if strings.Contains(entry.Name(), ".tmp-") {
+			t.Errorf("failed write left %s behind", entry.Name())
+		}
+	}
+
+	// Without the limit the rewrite goes through, keeping the permissions
+	cmd = exec.Command(bin, "add", "demo")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "HOME="+t.TempDir(), "EDON_CACHE_DIR="+t.TempDir(), "NO_COLOR=1")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("add: %v\n%s", err, out)
+	}
+	if data, _ := os.ReadFile(path); !strings.Contains(string(data), `"demo": "^1.0.0"`) {
+		t.Errorf("package.json after add = %.200s..., want demo added", data)
+	}
+	if info, err = os.Stat(path); err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("package.json mode after add = %v, want 0600", info.Mode().Perm())
+	}
+}
+
+func TestManifestFormat(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds the CLI")
+	}
+	bin := buildEdon(t)
+
+	tarball := packageTarball(t, "demo")
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/demo" {
+			w.Write(tarball)
+			return
+		}
+		sum := sha512.Sum512(tarball)
+		json.NewEncoder(w).Encode(map[string]any{
+			"name":      "demo",
+			"dist-tags": map[string]string{"latest": "1.0.0"},
+			"versions": map[string]any{"1.0.0": map[string]any{
+				"name":    "demo",
+				"version": "1.0.0",
+				"dist": map[string]string{
+					"tarball":   srv.URL + "/demo/-/demo-1.0.0.tgz",
+					"integrity": "sha512-" + base64.StdEncoding.EncodeToString(sum[:]),
+				},
+			}},
+		})
+	}))
+	defer srv.Close()
+
+	edon := func(dir string, args ...string) (string, error) {
+		t.Helper()
+		cmd := exec.Command(bin, args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "HOME="+t.TempDir(), "EDON_CACHE_DIR="+t.TempDir(), "NO_COLOR=1")
+		out, err := cmd.CombinedOutput()
+		return string(out), err
+	}
+
+	// init writes the conventional key order in the requested indentation,
+	// two spaces by default
+	for _, tt := range []struct {
+		args   []string
+		indent string
+	}{
+		{nil, "  "},
+		{[]string{"--indent=2"}, "  "},
+		{[]string{"--indent=4"}, "    "},
+		{[]string{"--indent=tab"}, "\t"},
+	} {
+		dir := filepath.Join(t.TempDir(), "app")
+		if out, err := edon(t.TempDir(), append(append([]string{"init", "--quiet"}, tt.args...), dir)...); err != nil {
+			t.Fatalf("init %v: %v\n%s", tt.args, err, out)
+		}
+		i := tt.indent
+		want := "{\n" +
+			i + `"name": "app",` + "\n" +
+			i + `"version": "1.0.0",` + "\n" +
+			i + `"description": "A new Edon project",` + "\n" +
+			i + `"main": "index.js",` + "\n" +
+			i + `"scripts": {` + "\n" +
+			i + i + `"start": "edon index.js"` + "\n" +
+			i + "}\n" +
+			"}\n"
+		if data, _ := os.ReadFile(filepath.Join(dir, "package.json")); string(data) != want {
+			t.Errorf("init %v wrote\n%s\nwant\n%s", tt.args, data, want)
+		}
+	}
+	for _, bad := range []string{"3", "spaces", ""} {
+		if out, err := edon(t.TempDir(), "init", "--indent="+bad, filepath.Join(t.TempDir(), "app")); err == nil || !strings.Contains(out, "invalid --indent") {
+			t.Errorf("init --indent=%q = %v, %q; want it rejected", bad, err, out)
+		}
+	}
+
+	// Rewrites keep the file's indentation and put keys in the same order
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "edon.json"), []byte(`{"registry": "`+srv.URL+`"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	manifest := "{\n\t\"zeta\": true,\n\t\"dependencies\": {},\n\t\"version\": \"1.0.0\",\n\t\"name\": \"app\"\n}\n"
+	if err := os.WriteFile(filepath.Join(dir, "package.json"), []byte(manifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := edon(dir, "add", "demo"); err != nil {
+		t.Fatalf("add: %v\n%s", err, out)
+	}
+	want := "{\n\t\"name\": \"app\",\n\t\"version\": \"1.0.0\",\n\t\"dependencies\": {\n\t\t\"demo\": \"^1.0.0\"\n\t},\n\t\"zeta\": true\n}\n"
+	if data, _ := os.ReadFile(filepath.Join(dir, "package.json")); string(data) != want {
+		t.Errorf("add rewrote package.json as\n%s\nwant\n%s", data, want)
+	}
+}
@@ -0,0 +1,114 @@
+package integration
+
+import (
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds the CLI")
+	}
+	bin := buildEdon(t)
+
+	tarball := filesTarball(t, map[string]string{
+		"package.json": `{"name": "demo", "version": "1.0.0", "main": "index.js"}`,
+		"index.js":     "export { value } from './lib/value.js';\n",
+		"lib/value.js": "export const value = 'from npm';\n",
+	})
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/demo" {
+			w.Write(tarball)
+			return
+		}
+		sum := sha512.Sum512(tarball)
+		json.NewEncoder(w).Encode(map[string]any{
+			"name":      "demo",
+			"dist-tags": map[string]string{"latest": "1.0.0"},
+			"versions": map[string]any{"1.0.0": map[string]any{
+				"name":    "demo",
+				"version": "1.0.0",
+				"dist": map[string]string{
+					"tarball":   srv.URL + "/demo/-/demo-1.0.0.tgz",
+					"integrity": "sha512-" + base64.StdEncoding.EncodeToString(sum[:]),
+				},
+			}},
+		})
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	write := func(name, content string) {
+		t.Helper()
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("edon.json", `{"registry": "`+srv.URL+`"}`)
+	edon := func(args ...string) (string, int) {
+		t.Helper()
+		cmd := exec.Command(bin, args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "HOME="+t.TempDir(), "EDON_CACHE_DIR="+t.TempDir(), "NO_COLOR=1")
+		out, err := cmd.CombinedOutput()
+		var exit *exec.ExitError
+		if errors.As(err, &exit) {
+			return string(out), exit.ExitCode()
+		}
+		if err != nil {
+			t.Fatalf("edon %v: %v", args, err)
+		}
+		return string(out), 0
+	}
+
+	// Relative imports, nested and cyclic, and JSON
+	write("main.js", "import { greet } from './lib/greet.js';\nimport data from './data.json' with { type: 'json' };\nconsole.log(greet(data.name));\n")
+	write("lib/greet.js", "import { suffix } from '../suffix.js';\nimport { shout } from './shout.js';\nexport const greet = (name) => shout('hello ' + name) + suffix;\n")
+	write("lib/shout.js", "import { greet } from './greet.js';\nexport const shout = (s) => typeof greet === 'function' ? s.toUpperCase() : s;\n")
+	write("suffix.js", "export const suffix = '!';\n")
+	write("data.json", `{"name": "edon"}`)
+	if out, code := edon("run", "main.js"); code != 0 || strings.TrimSpace(out) != "HELLO EDON!" {
+		t.Errorf("run main.js = %d, %q; want HELLO EDON!", code, out)
+	}
+
+	// An npm: import, and the package's own relative import, come from the
+	// registry through the loader
+	write("npm.js", "import { value } from 'npm:demo@1.0.0';\nconsole.log(value);\n")
+	if out, code := edon("run", "--allow-net", "npm.js"); code != 0 || strings.TrimSpace(out) != "from npm" {
+		t.Errorf("run npm.js = %d, %q; want from npm", code, out)
+	}
+	if out, code := edon("run", "npm.js"); code == 0 || !strings.Contains(out, "permission denied") {
+		t.Errorf("run npm.js without --allow-net = %d, %q; want permission denied", code, out)
+	}
+
+	// Imports are read under the run's permissions, which only cover the
+	// entry's directory by default
+	write("app/main.js", "import { util } from '../shared/util.js';\nconsole.log(util);\n")
+	write("shared/util.js", "export const util = 'shared';\n")
+	if out, code := edon("run", "app/main.js"); code == 0 || !strings.Contains(out, "permission denied") {
+		t.Errorf("run of an import outside the entry directory = %d, %q; want permission denied", code, out)
+	}
+	if out, code := edon("run", "--allow-read="+filepath.Join(dir, "shared"), "app/main.js"); code != 0 || strings.TrimSpace(out) != "shared" {
+		t.Errorf("run with --allow-read = %d, %q; want shared", code, out)
+	}
+	// A computed specifier can't be loaded ahead of time, so it isn't loaded
+	// at all
+	write("app/dynamic.js", "export {};\nconst name = '../shared/' + 'util.js';\nawait import(name);\n")
+	if out, code := edon("run", "--allow-read", "app/dynamic.js"); code == 0 || !strings.Contains(out, "could not load module") {
+		t.Errorf("run of a computed import = %d, %q; want it to fail", code, out)
+	}
+}
@@ -1,10 +1,12 @@
 package integration
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"testing"
 
+	"github.com/katungi/edon/internal/modules/loader"
 	"github.com/katungi/edon/internal/runtime"
 )
 
@@ -85,7 +87,8 @@ func TestModuleLoading(t *testing.T) {
 	}
 	defer rt.Close()
 
-	if err := rt.ExecuteFile(mainFile); err != nil {
+	// Imports are loaded by the module loader, not by QuickJS
+	if err := rt.RunLoaded(context.Background(), loader.NewModuleLoader(), mainFile); err != nil {
 		t.Errorf("Module loading test failed: %v", err)
 	}
 }
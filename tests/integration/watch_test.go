@@ -0,0 +1,81 @@
+package integration
+
+import (
+	"bufio"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRunWatch(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds the CLI")
+	}
+	bin := buildEdon(t)
+	dir := t.TempDir()
+	write := func(name, content string) {
+		t.Helper()
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("main.js", "import { msg } from './lib/msg.js';\nimport { n } from './n.js';\nconsole.log(msg + n);\n")
+	write("lib/msg.js", "export const msg = 'one';\n")
+	write("n.js", "export const n = 1;\n")
+
+	cmd := exec.Command(bin, "run", "--watch", "main.js")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "HOME="+t.TempDir(), "NO_COLOR=1")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+	expect := func(want string) {
+		t.Helper()
+		timeout := time.After(10 * time.Second)
+		for {
+			select {
+			case line, ok := <-lines:
+				if !ok {
+					t.Fatalf("edon exited before printing %q", want)
+				}
+				if line == want {
+					return
+				}
+			case <-timeout:
+				t.Fatalf("timed out waiting for %q", want)
+			}
+		}
+	}
+
+	expect("one1")
+	// An import in a subdirectory, a sibling import, then the entry itself
+	write("lib/msg.js", "export const msg = 'two';\n")
+	expect("two1")
+	write("n.js", "export const n = 2;\n")
+	expect("two2")
+	write("main.js", "import { msg } from './lib/msg.js';\nimport { n } from './n.js';\nconsole.log('main ' + msg + n);\n")
+	expect("main two2")
+}
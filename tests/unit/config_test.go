@@ -0,0 +1,125 @@
+package unit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/katungi/edon/internal/config"
+	"github.com/katungi/edon/internal/errors"
+)
+
+func TestLoadConfig(t *testing.T) {
+	t.Run("missing", func(t *testing.T) {
+		cfg, err := config.Load(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Path != "" {
+			t.Errorf("Load() Path = %q, want empty", cfg.Path)
+		}
+	})
+
+	t.Run("edon.json preferred over deno.json", func(t *testing.T) {
+		dir := t.TempDir()
+		writeFile(t, filepath.Join(dir, "deno.json"), `{"registry": "https://deno.example"}`)
+		writeFile(t, filepath.Join(dir, "edon.json"), `{
+			"registry": "https://edon.example",
+			"importMap": "./import_map.json",
+			"cacheDir": "cache",
+			"lock": "edon.lock",
+			"offline": true,
+			"tasks": {}
+		}`)
+
+		cfg, err := config.Load(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Registry != "https://edon.example" {
+			t.Errorf("Registry = %q", cfg.Registry)
+		}
+		if !cfg.Offline {
+			t.Error("Offline = false")
+		}
+		// Relative paths resolve against the config file
+		if cfg.ImportMap != filepath.Join(dir, "import_map.json") {
+			t.Errorf("ImportMap = %q", cfg.ImportMap)
+		}
+		if cfg.CacheDir != filepath.Join(dir, "cache") || cfg.Lock != filepath.Join(dir, "edon.lock") {
+			t.Errorf("CacheDir = %q, Lock = %q", cfg.CacheDir, cfg.Lock)
+		}
+		if len(cfg.Warnings) != 1 {
+			t.Errorf("Warnings = %v, want one for the unknown key", cfg.Warnings)
+		}
+	})
+
+	t.Run("deno.json fallback", func(t *testing.T) {
+		dir := t.TempDir()
+		writeFile(t, filepath.Join(dir, "deno.json"), `{"registry": "https://deno.example"}`)
+
+		cfg, err := config.Load(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Registry != "https://deno.example" || cfg.Path != filepath.Join(dir, "deno.json") {
+			t.Errorf("Load() = %+v", cfg)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		dir := t.TempDir()
+		writeFile(t, filepath.Join(dir, "edon.json"), `{"offline": "yes"}`)
+
+		if _, err := config.Load(dir); !errors.Is(err, errors.ErrConfigInvalid) {
+			t.Errorf("Load() error = %v, want ErrConfigInvalid", err)
+		}
+	})
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadNPMRC(t *testing.T) {
+	home, project := t.TempDir(), t.TempDir()
+	t.Setenv("NPM_TOKEN", "from-env")
+	writeFile(t, filepath.Join(home, ".npmrc"), `registry=https://mirror.example/
+@myorg:registry=https://home.example
+//npm.example.com/:_authToken=home-token
+`)
+	writeFile(t, filepath.Join(project, ".npmrc"), `; project settings win
+# comments and settings edon doesn't use are skipped
+save-exact=true
+@myorg:registry = https://npm.example.com/private/
+@other:registry="https://other.example"
+//npm.example.com/private/:_authToken=${NPM_TOKEN}
+//localhost:4873/:_authToken=local
+`)
+
+	rc, err := config.LoadNPMRC(home, project, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rc.Registry != "https://mirror.example" {
+		t.Errorf("Registry = %q", rc.Registry)
+	}
+	if rc.Scopes["@myorg"] != "https://npm.example.com/private" || rc.Scopes["@other"] != "https://other.example" || len(rc.Scopes) != 2 {
+		t.Errorf("Scopes = %v", rc.Scopes)
+	}
+	// Tokens are keyed by host, so the project's replaces the home one
+	if rc.Tokens["npm.example.com"] != "from-env" || rc.Tokens["localhost:4873"] != "local" || len(rc.Tokens) != 2 {
+		t.Errorf("Tokens = %v", rc.Tokens)
+	}
+
+	empty, err := config.LoadNPMRC(t.TempDir())
+	if err != nil || empty.Registry != "" || len(empty.Scopes) != 0 {
+		t.Errorf("LoadNPMRC(no .npmrc) = %+v, %v, want it empty", empty, err)
+	}
+}
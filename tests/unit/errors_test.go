@@ -0,0 +1,29 @@
+package unit
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/katungi/edon/internal/errors"
+)
+
+func TestErrorCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{errors.ErrModuleNotFound, "MODULE_NOT_FOUND"},
+		{errors.Wrap(errors.ErrInvalidPackageName, `"Bad" must be lowercase`), "INVALID_PACKAGE_NAME"},
+		{fmt.Errorf("failed to install x: %w", errors.Wrap(errors.ErrIntegrityMismatch, "x")), "INTEGRITY_MISMATCH"},
+		// The category of WrapWith wins over its cause
+		{errors.WrapWith(errors.ErrPackageInstall, errors.ErrFileRead, "x"), "PACKAGE_INSTALL"},
+		{errors.Join(fmt.Errorf("plain"), errors.ErrOffline), "OFFLINE"},
+		{fmt.Errorf("plain"), errors.CodeUnknown},
+		{nil, ""},
+	}
+	for _, tt := range tests {
+		if got := errors.Code(tt.err); got != tt.want {
+			t.Errorf("Code(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package unit
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/katungi/edon/internal/errors"
+	"github.com/katungi/edon/internal/modules/loader"
+)
+
+// gitRepo creates a repository with a v1 tag and a later commit on its
+// default branch, returning its git+file specifier and the v1 commit
+func gitRepo(t *testing.T) (specifier, commit string) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	git := func(args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=edon", "-c", "user.email=edon@example.com"}, args...)...)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	git("init", "-q")
+	write("package.json", `{"name": "private", "version": "1.0.0", "main": "index.js"}`)
+	write("index.js", "export { util } from './lib/util.js';")
+	write("lib/util.js", "export const util = 'v1';")
+	git("add", ".")
+	git("commit", "-q", "-m", "v1")
+	git("tag", "v1")
+	commit = git("rev-parse", "HEAD")
+
+	write("lib/util.js", "export const util = 'v2';")
+	git("commit", "-q", "-am", "v2")
+	return "git+file://" + filepath.ToSlash(dir), commit
+}
+
+func TestGitModule(t *testing.T) {
+	repo, commit := gitRepo(t)
+	t.Setenv(loader.CacheDirEnv, t.TempDir())
+	ctx := context.Background()
+	ml := loader.NewModuleLoader()
+
+	if v := loader.ValidateURL("git+ssh://git@github.com:org/repo.git#v1"); !v.IsValid || v.PackageType != loader.TypeGit {
+		t.Fatalf("ValidateURL(git+ssh) = %+v, want a git module", v)
+	}
+
+	// The entry comes from package.json, and relative imports stay on the ref
+	entry, err := ml.LoadModule(ctx, repo+"#v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Type != loader.TypeGit || !strings.Contains(entry.Content, "./lib/util.js") {
+		t.Errorf("entry = %s %q, want index.js", entry.Type, entry.Content)
+	}
+	dep, err := loader.ResolveRelative(entry, "./lib/util.js")
+	if err != nil || dep != repo+"#v1:lib/util.js" {
+		t.Fatalf("ResolveRelative(./lib/util.js) = %q, %v", dep, err)
+	}
+
+	tests := []struct {
+		specifier string
+		want      string
+	}{
+		{dep, "'v1'"},
+		{repo + "#" + commit + ":lib/util.js", "'v1'"},
+		{repo + "#" + commit[:10] + ":lib/util.js", "'v1'"},
+		// No ref is the default branch
+		{repo + "#:lib/util.js", "'v2'"},
+	}
+	for _, tt := range tests {
+		module, err := ml.LoadModule(ctx, tt.specifier)
+		if err != nil {
+			t.Errorf("LoadModule(%s) error = %v", tt.specifier, err)
+			continue
+		}
+		if !strings.Contains(module.Content, tt.want) {
+			t.Errorf("LoadModule(%s) = %q, want %s", tt.specifier, module.Content, tt.want)
+		}
+	}
+
+	if ok, err := ml.Exists(ctx, repo+"#v1:lib/missing.js"); ok || err != nil {
+		t.Errorf("Exists(missing file) = %v, %v, want false, nil", ok, err)
+	}
+	if _, err := ml.LoadModule(ctx, repo+"#no-such-tag"); !errors.Is(err, errors.ErrGitClone) {
+		t.Errorf("LoadModule(unknown ref) error = %v, want ErrGitClone", err)
+	}
+	if _, err := ml.LoadModule(ctx, repo+"#--upload-pack=evil"); !errors.Is(err, errors.ErrInvalidURL) {
+		t.Errorf("LoadModule(option-like ref) error = %v, want ErrInvalidURL", err)
+	}
+	// Files in a clone are held to the module size limit like local ones
+	limited := loader.NewModuleLoader(loader.WithMaxModuleSize(10))
+	if _, err := limited.LoadModule(ctx, repo+"#v1:lib/util.js"); !errors.Is(err, errors.ErrModuleTooLarge) {
+		t.Errorf("LoadModule over the size limit error = %v, want ErrModuleTooLarge", err)
+	}
+
+	// Clones are cached by repository and ref, so a fresh loader needs
+	// neither the repository nor git
+	if err := os.RemoveAll(strings.TrimPrefix(repo, "git+file://")); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", t.TempDir())
+	module, err := loader.NewModuleLoader().LoadModule(ctx, repo+"#v1:lib/util.js")
+	if err != nil || !strings.Contains(module.Content, "'v1'") {
+		t.Errorf("cached LoadModule() = %v, %v, want v1 from the cache", module, err)
+	}
+	if _, err := loader.NewModuleLoader().LoadModule(ctx, repo+"#other"); !errors.Is(err, errors.ErrGitUnavailable) {
+		t.Errorf("LoadModule() without git error = %v, want ErrGitUnavailable", err)
+	}
+}
+
+func TestGitInsecureTransports(t *testing.T) {
+	t.Setenv(loader.CacheDirEnv, t.TempDir())
+	ctx := context.Background()
+	specifiers := []string{
+		"git+http://git.internal:8080/org/repo.git#v1",
+		"git://git.internal/org/repo.git#v1:lib/a.js",
+	}
+	for _, specifier := range specifiers {
+		if _, err := loader.NewModuleLoader().LoadModule(ctx, specifier); !errors.Is(err, errors.ErrInsecureURL) {
+			t.Errorf("LoadModule(%s) error = %v, want ErrInsecureURL", specifier, err)
+		}
+	}
+
+	// A trusted host gets as far as cloning, which offline stops
+	trusted := loader.NewModuleLoader(loader.WithAllowInsecureHosts([]string{"git.internal"}), loader.WithOffline(true))
+	for _, specifier := range specifiers {
+		if _, err := trusted.LoadModule(ctx, specifier); !errors.Is(err, errors.ErrOffline) {
+			t.Errorf("LoadModule(%s) from a trusted host error = %v, want ErrOffline", specifier, err)
+		}
+	}
+	if _, err := loader.NewModuleLoader(loader.WithAllowInsecureHosts([]string{"other.internal"})).LoadModule(ctx, specifiers[0]); !errors.Is(err, errors.ErrInsecureURL) {
+		t.Errorf("LoadModule from an untrusted host error = %v, want ErrInsecureURL", err)
+	}
+}
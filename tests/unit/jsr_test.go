@@ -0,0 +1,157 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/katungi/edon/internal/errors"
+	"github.com/katungi/edon/internal/modules/loader"
+)
+
+// fakeJSR serves meta.json, version metadata and source files for @std/path
+func fakeJSR(t *testing.T) *httptest.Server {
+	t.Helper()
+	files := map[string]any{
+		"/@std/path/meta.json": map[string]any{
+			"latest": "1.1.0",
+			"versions": map[string]any{
+				"1.0.0": map[string]any{},
+				"1.1.0": map[string]any{},
+				"1.2.0": map[string]any{"yanked": true},
+			},
+		},
+		"/@std/path/1.0.0_meta.json":    map[string]any{"exports": map[string]string{".": "./mod.ts"}},
+		"/@std/path/1.1.0_meta.json":    map[string]any{"exports": map[string]string{".": "./mod.ts", "./posix": "./posix/mod.ts"}},
+		"/@std/path/1.0.0/mod.ts":       "export const version: string = '1.0.0';",
+		"/@std/path/1.1.0/mod.ts":       "export const version: string = '1.1.0';",
+		"/@std/path/1.1.0/posix/mod.ts": "export const sep = '/';",
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		file, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if s, ok := file.(string); ok {
+			w.Write([]byte(s))
+			return
+		}
+		json.NewEncoder(w).Encode(file)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestLoadJSRModule(t *testing.T) {
+	t.Setenv(loader.CacheDirEnv, t.TempDir())
+	ml := loader.NewModuleLoader(loader.WithHTTPClient(cdnClient(t, fakeJSR(t))))
+
+	tests := []struct {
+		spec        string
+		wantContent string
+		wantVersion string
+		wantErr     error
+	}{
+		{spec: "jsr:@std/path", wantContent: "export const version: string = '1.1.0';", wantVersion: "1.1.0"},
+		{spec: "jsr:@std/path@1.0.0", wantContent: "export const version: string = '1.0.0';", wantVersion: "1.0.0"},
+		// Yanked versions are skipped when resolving ranges
+		{spec: "jsr:@std/path@^1.0.0", wantContent: "export const version: string = '1.1.0';", wantVersion: "1.1.0"},
+		{spec: "jsr:@std/path@1.1.0/posix", wantContent: "export const sep = '/';", wantVersion: "1.1.0"},
+		{spec: "jsr:@std/path@1.1.0/missing", wantErr: errors.ErrModuleNotFound},
+		{spec: "jsr:@std/path@^3.0.0", wantErr: errors.ErrVersionNotFound},
+		{spec: "jsr:@std/nope", wantErr: errors.ErrModuleNotFound},
+		{spec: "jsr:unscoped", wantErr: errors.ErrInvalidURL},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			module, err := ml.LoadModule(context.Background(), tt.spec)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("LoadModule(%q) error = %v, want %v", tt.spec, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadModule(%q) error = %v", tt.spec, err)
+			}
+			if module.Content != tt.wantContent {
+				t.Errorf("Content = %q, want %q", module.Content, tt.wantContent)
+			}
+			if module.Type != loader.TypeJSR || module.MediaType != loader.MediaTypeScript {
+				t.Errorf("Type, MediaType = %s, %s, want JSR, ts", module.Type, module.MediaType)
+			}
+			if module.ResolvedVersion != tt.wantVersion {
+				t.Errorf("ResolvedVersion = %q, want %q", module.ResolvedVersion, tt.wantVersion)
+			}
+		})
+	}
+
+	t.Run("cached", func(t *testing.T) {
+		// An exact version still reports itself when served from the disk cache
+		module, err := loader.NewModuleLoader(loader.WithOffline(true)).LoadModule(context.Background(), "jsr:@std/path@1.0.0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if module.ResolvedVersion != "1.0.0" {
+			t.Errorf("ResolvedVersion = %q, want 1.0.0", module.ResolvedVersion)
+		}
+	})
+
+	t.Run("exists", func(t *testing.T) {
+		for spec, want := range map[string]bool{
+			"jsr:@std/path":             true,
+			"jsr:@std/path@1.1.0/posix": true,
+			"jsr:@std/path@1.0.0/posix": false,
+			"jsr:@std/path@9.0.0":       false,
+			"jsr:@std/does-not-exist":   false,
+		} {
+			got, err := ml.Exists(context.Background(), spec)
+			if err != nil || got != want {
+				t.Errorf("Exists(%q) = %v, %v, want %v, nil", spec, got, err, want)
+			}
+		}
+	})
+}
+
+func TestLoadJSRModuleNpmCompat(t *testing.T) {
+	t.Setenv(loader.CacheDirEnv, t.TempDir())
+	// npm.jsr.io publishes @std/path as @jsr/std__path, compiled to JavaScript
+	registry := fakeRegistryVersions(t, "@jsr/std__path", map[string]string{"latest": "1.1.0"},
+		map[string][]byte{
+			"1.1.0": buildTarball(t, map[string]string{
+				"package.json": `{"name": "@jsr/std__path", "exports": {".": "./mod.js", "./posix": "./posix/mod.js"}}`,
+				"mod.js":       "export const version = '1.1.0';",
+				"posix/mod.js": "export const sep = '/';",
+			}),
+		})
+
+	ml := loader.NewModuleLoader(
+		loader.WithHTTPClient(cdnClient(t, registry)),
+		loader.WithJSRNpmCompat(true),
+	)
+
+	for spec, want := range map[string]string{
+		"jsr:@std/path":          "export const version = '1.1.0';",
+		"jsr:@std/path@^1/posix": "export const sep = '/';",
+	} {
+		module, err := ml.LoadModule(context.Background(), spec)
+		if err != nil {
+			t.Fatalf("LoadModule(%q) error = %v", spec, err)
+		}
+		if module.Content != want || module.Type != loader.TypeJSR || module.MediaType != loader.MediaJavaScript {
+			t.Errorf("LoadModule(%q) = %q (%s, %s), want %q (JSR, js)", spec, module.Content, module.Type, module.MediaType, want)
+		}
+		if module.ResolvedVersion != "1.1.0" {
+			t.Errorf("LoadModule(%q) ResolvedVersion = %q, want 1.1.0", spec, module.ResolvedVersion)
+		}
+	}
+
+	if ok, err := ml.Exists(context.Background(), "jsr:@std/missing"); ok || err != nil {
+		t.Errorf("Exists(missing) = %v, %v, want false, nil", ok, err)
+	}
+}
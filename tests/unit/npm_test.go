@@ -0,0 +1,2784 @@
+package unit
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/katungi/edon/internal/errors"
+	"github.com/katungi/edon/internal/modules/loader"
+	"github.com/katungi/edon/internal/modules/loader/loadertest"
+)
+
+// buildTarball creates an npm-style gzipped tarball with files nested under "package/"
+func buildTarball(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{
+			Name:     "package/" + name,
+			Mode:     0644,
+			Size:     int64(len(content)),
+			Typeflag: tar.TypeReg,
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func sriSHA512(data []byte) string {
+	sum := sha512.Sum512(data)
+	return "sha512-" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func hexSHA1(data []byte) string {
+	sum := sha1.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// fakeRegistry serves a packument for a single package version. The
+// advertised integrity and shasum are computed over advertised, while the
+// tarball endpoint serves served.
+func fakeRegistry(t *testing.T, name, version string, advertised, served []byte, useShasum bool) *httptest.Server {
+	t.Helper()
+	dist := func(srv *httptest.Server, v string) map[string]string {
+		d := map[string]string{"tarball": srv.URL + "/" + name + "/-/" + name + "-" + v + ".tgz"}
+		if useShasum {
+			d["shasum"] = hexSHA1(advertised)
+		} else {
+			d["integrity"] = sriSHA512(advertised)
+		}
+		return d
+	}
+	return serveRegistry(t, name, map[string]string{"latest": version}, map[string][]byte{version: served}, dist)
+}
+
+// fakeRegistryVersions serves a packument with several versions and dist-tags,
+// each version advertising the integrity of its own tarball
+func fakeRegistryVersions(t *testing.T, name string, distTags map[string]string, tarballs map[string][]byte) *httptest.Server {
+	t.Helper()
+	dist := func(srv *httptest.Server, v string) map[string]string {
+		return map[string]string{
+			"tarball":   srv.URL + "/" + name + "/-/" + name + "-" + v + ".tgz",
+			"integrity": sriSHA512(tarballs[v]),
+		}
+	}
+	return serveRegistry(t, name, distTags, tarballs, dist)
+}
+
+func serveRegistry(t *testing.T, name string, distTags map[string]string, tarballs map[string][]byte,
+	dist func(*httptest.Server, string) map[string]string) *httptest.Server {
+	t.Helper()
+	var versions map[string]any
+	// Paths are compared decoded because scoped names arrive as "@scope%2Fname",
+	// which a ServeMux pattern can't match
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/"+name {
+			_ = json.NewEncoder(w).Encode(map[string]any{"name": name, "dist-tags": distTags, "versions": versions})
+			return
+		}
+		for v, data := range tarballs {
+			if r.URL.Path == "/"+name+"/-/"+name+"-"+v+".tgz" {
+				_, _ = w.Write(data)
+				return
+			}
+		}
+		http.NotFound(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	versions = map[string]any{}
+	for v := range tarballs {
+		versions[v] = map[string]any{"name": name, "version": v, "dist": dist(srv, v)}
+	}
+	return srv
+}
+
+func TestInstallPackageIntegrity(t *testing.T) {
+	good := buildTarball(t, map[string]string{
+		"package.json": `{"name": "demo", "version": "1.0.0", "main": "main.js"}`,
+		"main.js":      "export default 'demo';",
+	})
+	tampered := buildTarball(t, map[string]string{
+		"package.json": `{"name": "demo", "version": "1.0.0", "main": "main.js"}`,
+		"main.js":      "export default 'evil';",
+	})
+
+	tests := []struct {
+		name      string
+		served    []byte
+		useShasum bool
+		wantErr   bool
+	}{
+		{name: "matching integrity", served: good},
+		{name: "matching shasum", served: good, useShasum: true},
+		{name: "integrity mismatch", served: tampered, wantErr: true},
+		{name: "shasum mismatch", served: tampered, useShasum: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			home := t.TempDir()
+			t.Setenv("HOME", home)
+			srv := fakeRegistry(t, "demo", "1.0.0", good, tt.served, tt.useShasum)
+
+			pm, err := loader.NewNPMPackageManager(loader.WithRegistry(srv.URL))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			installed, err := pm.InstallPackage(context.Background(), "demo@1.0.0")
+			cacheDir := filepath.Join(home, ".edon", "npm-cache")
+
+			if tt.wantErr {
+				if !errors.Is(err, errors.ErrIntegrityMismatch) {
+					t.Fatalf("InstallPackage() error = %v, want ErrIntegrityMismatch", err)
+				}
+				// Neither the download nor extracted content may remain
+				entries, _ := os.ReadDir(cacheDir)
+				if len(entries) != 0 {
+					t.Errorf("cache not clean after mismatch: %v", entries)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("InstallPackage() error = %v", err)
+			}
+			content, err := os.ReadFile(filepath.Join(installed.Path, "main.js"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(content) != "export default 'demo';" {
+				t.Errorf("extracted main.js = %q", content)
+			}
+		})
+	}
+}
+
+func TestInstallPackageResume(t *testing.T) {
+	tarball := buildTarball(t, map[string]string{
+		"package.json": `{"name": "demo", "version": "1.0.0", "main": "main.js"}`,
+		"main.js":      "export default 'demo';",
+	})
+	tampered := buildTarball(t, map[string]string{
+		"package.json": `{"name": "demo", "version": "1.0.0", "main": "main.js"}`,
+		"main.js":      "export default 'evil';",
+	})
+
+	tests := []struct {
+		name string
+		// ranges makes the server honor Range requests
+		ranges bool
+		// resumeFrom serves the rest of the download from another tarball
+		resumeFrom []byte
+		wantRanges []string
+	}{
+		{
+			name:       "resumes where the download broke off",
+			ranges:     true,
+			wantRanges: []string{"", fmt.Sprintf("bytes=%d-", len(tarball)/2)},
+		},
+		{
+			name:       "starts over without ranges",
+			wantRanges: []string{"", ""},
+		},
+		{
+			name:       "starts over when the resumed file fails verification",
+			ranges:     true,
+			resumeFrom: tampered,
+			wantRanges: []string{"", fmt.Sprintf("bytes=%d-", len(tarball)/2), ""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			home := t.TempDir()
+			t.Setenv("HOME", home)
+
+			var mu sync.Mutex
+			var ranges []string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/demo" {
+					_ = json.NewEncoder(w).Encode(map[string]any{
+						"name":      "demo",
+						"dist-tags": map[string]string{"latest": "1.0.0"},
+						"versions": map[string]any{"1.0.0": map[string]any{
+							"name":    "demo",
+							"version": "1.0.0",
+							"dist":    map[string]string{"tarball": "http://" + r.Host + "/demo/-/demo-1.0.0.tgz", "integrity": sriSHA512(tarball)},
+						}},
+					})
+					return
+				}
+				mu.Lock()
+				ranges = append(ranges, r.Header.Get("Range"))
+				first := len(ranges) == 1
+				mu.Unlock()
+
+				if first {
+					// Send half the tarball, then drop the connection
+					if tt.ranges {
+						w.Header().Set("Accept-Ranges", "bytes")
+					}
+					w.Header().Set("Content-Length", fmt.Sprint(len(tarball)))
+					_, _ = w.Write(tarball[:len(tarball)/2])
+					w.(http.Flusher).Flush()
+					panic(http.ErrAbortHandler)
+				}
+				served := tarball
+				if tt.resumeFrom != nil && r.Header.Get("Range") != "" {
+					served = tt.resumeFrom
+				}
+				if tt.ranges {
+					http.ServeContent(w, r, "demo-1.0.0.tgz", time.Time{}, bytes.NewReader(served))
+					return
+				}
+				_, _ = w.Write(served)
+			}))
+			t.Cleanup(srv.Close)
+
+			pm, err := loader.NewNPMPackageManager(loader.WithRegistry(srv.URL))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := pm.InstallPackage(context.Background(), "demo@1.0.0"); !errors.Is(err, errors.ErrPackageFetch) {
+				t.Fatalf("interrupted InstallPackage() error = %v, want ErrPackageFetch", err)
+			}
+			installed, err := pm.InstallPackage(context.Background(), "demo@1.0.0")
+			if err != nil {
+				t.Fatalf("InstallPackage() error = %v", err)
+			}
+
+			content, err := os.ReadFile(filepath.Join(installed.Path, "main.js"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(content) != "export default 'demo';" {
+				t.Errorf("extracted main.js = %q", content)
+			}
+			if installed.Bytes != int64(len(tarball)) {
+				t.Errorf("Bytes = %d, want %d", installed.Bytes, len(tarball))
+			}
+			if !slices.Equal(ranges, tt.wantRanges) {
+				t.Errorf("Range headers = %q, want %q", ranges, tt.wantRanges)
+			}
+			// Nothing of the download is left once it is installed
+			leftover, _ := filepath.Glob(filepath.Join(home, ".edon", "npm-cache", "download-*"))
+			if len(leftover) != 0 {
+				t.Errorf("downloads left in the cache: %v", leftover)
+			}
+		})
+	}
+
+	t.Run("an error response leaves nothing behind", func(t *testing.T) {
+		home := t.TempDir()
+		t.Setenv("HOME", home)
+		srv := fakeRegistry(t, "demo", "1.0.0", tarball, tarball, false)
+		pm, err := loader.NewNPMPackageManager(loader.WithRegistry(srv.URL))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := pm.Install(context.Background(), &loader.ResolvedPackage{Name: "demo", Version: "1.0.0", Tarball: srv.URL + "/missing.tgz"}); !errors.Is(err, errors.ErrPackageFetch) {
+			t.Fatalf("Install() of a missing tarball error = %v, want ErrPackageFetch", err)
+		}
+		if leftover, _ := filepath.Glob(filepath.Join(home, ".edon", "npm-cache", "download-*")); len(leftover) != 0 {
+			t.Errorf("downloads left in the cache: %v", leftover)
+		}
+	})
+}
+
+func TestPackageIntegrity(t *testing.T) {
+	tarball := buildTarball(t, map[string]string{"index.js": "export default 1;"})
+	tampered := buildTarball(t, map[string]string{"index.js": "export default 2;"})
+
+	t.Run("reports sha512 without installing", func(t *testing.T) {
+		home := t.TempDir()
+		t.Setenv("HOME", home)
+		srv := fakeRegistry(t, "demo", "1.0.0", tarball, tarball, true)
+
+		pm, err := loader.NewNPMPackageManager(loader.WithRegistry(srv.URL))
+		if err != nil {
+			t.Fatal(err)
+		}
+		pkg, err := pm.Resolve(context.Background(), "demo@1.0.0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		integrity, err := pm.Integrity(context.Background(), pkg)
+		if err != nil {
+			t.Fatalf("Integrity() error = %v", err)
+		}
+		if want := sriSHA512(tarball); integrity != want {
+			t.Errorf("Integrity() = %q, want %q", integrity, want)
+		}
+		if entries, _ := os.ReadDir(filepath.Join(home, ".edon", "npm-cache")); len(entries) != 0 {
+			t.Errorf("Integrity() left files in the cache: %v", entries)
+		}
+	})
+
+	t.Run("resolves packages without a tarball", func(t *testing.T) {
+		t.Setenv("HOME", t.TempDir())
+		srv := fakeRegistry(t, "demo", "1.0.0", tarball, tarball, false)
+
+		pm, err := loader.NewNPMPackageManager(loader.WithRegistry(srv.URL))
+		if err != nil {
+			t.Fatal(err)
+		}
+		integrity, err := pm.Integrity(context.Background(), &loader.ResolvedPackage{Name: "demo", Version: "1.0.0"})
+		if err != nil {
+			t.Fatalf("Integrity() error = %v", err)
+		}
+		if want := sriSHA512(tarball); integrity != want {
+			t.Errorf("Integrity() = %q, want %q", integrity, want)
+		}
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+		t.Setenv("HOME", t.TempDir())
+		srv := fakeRegistry(t, "demo", "1.0.0", tarball, tampered, false)
+
+		pm, err := loader.NewNPMPackageManager(loader.WithRegistry(srv.URL))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = pm.Integrity(context.Background(), &loader.ResolvedPackage{Name: "demo", Version: "1.0.0"})
+		if !errors.Is(err, errors.ErrIntegrityMismatch) {
+			t.Fatalf("Integrity() error = %v, want ErrIntegrityMismatch", err)
+		}
+	})
+}
+
+func TestIntegrityAlgorithms(t *testing.T) {
+	tarball := buildTarball(t, map[string]string{"index.js": "export default 1;"})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(tarball)
+	}))
+	t.Cleanup(srv.Close)
+	sri := func(algorithm string, h hash.Hash) string {
+		h.Write(tarball)
+		return algorithm + "-" + base64.StdEncoding.EncodeToString(h.Sum(nil))
+	}
+	sums := map[string]string{
+		"sha256": sri("sha256", sha256.New()),
+		"sha384": sri("sha384", sha512.New384()),
+		"sha512": sri("sha512", sha512.New()),
+	}
+
+	for algorithm, want := range sums {
+		t.Run(algorithm, func(t *testing.T) {
+			t.Setenv(loader.CacheDirEnv, t.TempDir())
+			pm, err := loader.NewNPMPackageManager(loader.WithIntegrityAlgorithm(algorithm))
+			if err != nil {
+				t.Fatal(err)
+			}
+			// What Integrity generates verifies the tarball it came from
+			pkg := &loader.ResolvedPackage{Name: "demo", Version: "1.0.0", Tarball: srv.URL + "/demo-1.0.0.tgz", Integrity: want}
+			integrity, err := pm.Integrity(context.Background(), pkg)
+			if err != nil {
+				t.Fatalf("Integrity() error = %v", err)
+			}
+			if integrity != want {
+				t.Errorf("Integrity() = %q, want %q", integrity, want)
+			}
+			pkg.Integrity = integrity
+			if _, err := pm.Install(context.Background(), pkg); err != nil {
+				t.Errorf("Install() with %s integrity error = %v", algorithm, err)
+			}
+		})
+	}
+
+	t.Run("verification", func(t *testing.T) {
+		t.Setenv(loader.CacheDirEnv, t.TempDir())
+		pm, err := loader.NewNPMPackageManager()
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, sha512Digest, _ := strings.Cut(sums["sha512"], "-")
+		for integrity, wantErr := range map[string]bool{
+			// A digest labelled with the wrong algorithm never matches
+			"sha256-" + sha512Digest: true,
+			// Only the strongest algorithm given is checked, against any of
+			// its digests
+			"sha256-AAAA " + sums["sha512"]:                  false,
+			sums["sha256"] + " sha512-AAAA":                  true,
+			"sha384-AAAA " + sums["sha384"] + "?opt":         false,
+			"md5-AAAA " + sums["sha384"] + " whirlpool-AAAA": false,
+			// Nothing checkable is a failure, not a pass
+			"md5-AAAA whirlpool-AAAA": true,
+		} {
+			pkg := &loader.ResolvedPackage{Name: "demo", Version: "1.0.0", Tarball: srv.URL + "/demo-1.0.0.tgz", Integrity: integrity}
+			_, err := pm.Integrity(context.Background(), pkg)
+			if wantErr && !errors.Is(err, errors.ErrIntegrityMismatch) {
+				t.Errorf("Integrity() with %q error = %v, want ErrIntegrityMismatch", integrity, err)
+			}
+			if !wantErr && err != nil {
+				t.Errorf("Integrity() with %q error = %v", integrity, err)
+			}
+		}
+	})
+
+	if _, err := loader.NewNPMPackageManager(loader.WithIntegrityAlgorithm("md5")); !errors.Is(err, errors.ErrIntegrityAlgorithm) {
+		t.Errorf("NewNPMPackageManager(md5) error = %v, want ErrIntegrityAlgorithm", err)
+	}
+}
+
+func TestNPMCacheDir(t *testing.T) {
+	tarball := buildTarball(t, map[string]string{"index.js": "export default 1;"})
+
+	t.Run("env var", func(t *testing.T) {
+		t.Setenv("HOME", t.TempDir())
+		envDir := t.TempDir()
+		t.Setenv(loader.CacheDirEnv, envDir)
+		srv := fakeRegistry(t, "demo", "1.0.0", tarball, tarball, false)
+
+		pm, err := loader.NewNPMPackageManager(loader.WithRegistry(srv.URL))
+		if err != nil {
+			t.Fatal(err)
+		}
+		installed, err := pm.InstallPackage(context.Background(), "demo@1.0.0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := filepath.Join(envDir, "npm-cache", "demo", "1.0.0"); installed.Path != want {
+			t.Errorf("InstallPackage() path = %q, want %q", installed.Path, want)
+		}
+	})
+
+	t.Run("option overrides env var", func(t *testing.T) {
+		t.Setenv(loader.CacheDirEnv, t.TempDir())
+		optDir := t.TempDir()
+		srv := fakeRegistry(t, "demo", "1.0.0", tarball, tarball, false)
+
+		pm, err := loader.NewNPMPackageManager(loader.WithRegistry(srv.URL), loader.WithCacheDir(optDir))
+		if err != nil {
+			t.Fatal(err)
+		}
+		installed, err := pm.InstallPackage(context.Background(), "demo@1.0.0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := filepath.Join(optDir, "npm-cache", "demo", "1.0.0"); installed.Path != want {
+			t.Errorf("InstallPackage() path = %q, want %q", installed.Path, want)
+		}
+	})
+
+	t.Run("unwritable", func(t *testing.T) {
+		// A regular file can't be used as a directory
+		file := filepath.Join(t.TempDir(), "file")
+		if err := os.WriteFile(file, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv(loader.CacheDirEnv, file)
+
+		if _, err := loader.NewNPMPackageManager(); !errors.Is(err, errors.ErrCacheDir) {
+			t.Errorf("NewNPMPackageManager() error = %v, want ErrCacheDir", err)
+		}
+	})
+}
+
+func TestNPMProxy(t *testing.T) {
+	t.Setenv(loader.CacheDirEnv, t.TempDir())
+	tarball := buildTarball(t, map[string]string{"index.js": "export default 1;"})
+	registry := fakeRegistry(t, "demo", "1.0.0", tarball, tarball, false)
+	target, err := url.Parse(registry.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The proxy forwards everything to the fake registry and records what it saw
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = append(proxied, r.URL.String())
+		r.URL.Scheme = target.Scheme
+		r.URL.Host = target.Host
+		registry.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer proxy.Close()
+	proxyURL, err := url.Parse(proxy.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pm, err := loader.NewNPMPackageManager(
+		loader.WithRegistry("http://registry.example"),
+		loader.WithProxy(proxyURL),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Metadata and tarball requests both go through the proxy
+	if _, err := pm.InstallPackage(context.Background(), "demo@1.0.0"); err != nil {
+		t.Fatalf("InstallPackage() error = %v", err)
+	}
+	if len(proxied) == 0 || proxied[0] != "http://registry.example/demo" {
+		t.Errorf("proxied requests = %v, want metadata request via proxy", proxied)
+	}
+}
+
+func TestTLSConfig(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"name":      "demo",
+			"dist-tags": map[string]string{"latest": "1.0.0"},
+			"versions": map[string]any{"1.0.0": map[string]any{
+				"name": "demo", "version": "1.0.0",
+				"dist": map[string]string{"tarball": "https://" + r.Host + "/demo/-/demo-1.0.0.tgz"},
+			}},
+		})
+	}))
+	t.Cleanup(srv.Close)
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	block := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(caFile, block, 0644); err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+
+	resolve := func(opts ...loader.Option) error {
+		pm, err := loader.NewNPMPackageManager(append(opts, loader.WithRegistry(srv.URL), loader.WithRetries(0))...)
+		if err != nil {
+			return err
+		}
+		_, err = pm.Resolve(context.Background(), "demo")
+		return err
+	}
+
+	t.Run("system roots reject the test CA", func(t *testing.T) {
+		if err := resolve(); err == nil || !strings.Contains(err.Error(), "certificate") {
+			t.Fatalf("Resolve() error = %v, want a certificate error", err)
+		}
+	})
+
+	t.Run("CA file", func(t *testing.T) {
+		if err := resolve(loader.WithCACertFile(caFile)); err != nil {
+			t.Fatalf("Resolve() error = %v", err)
+		}
+	})
+
+	t.Run("TLS config", func(t *testing.T) {
+		if err := resolve(loader.WithTLSConfig(&tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12})); err != nil {
+			t.Fatalf("Resolve() error = %v", err)
+		}
+	})
+
+	t.Run("stricter policy", func(t *testing.T) {
+		old := httptest.NewUnstartedServer(srv.Config.Handler)
+		old.TLS = &tls.Config{MaxVersion: tls.VersionTLS12}
+		old.StartTLS()
+		t.Cleanup(old.Close)
+		oldRoots := x509.NewCertPool()
+		oldRoots.AddCert(old.Certificate())
+
+		pm, err := loader.NewNPMPackageManager(loader.WithRegistry(old.URL), loader.WithRetries(0),
+			loader.WithTLSConfig(&tls.Config{RootCAs: oldRoots, MinVersion: tls.VersionTLS13}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := pm.Resolve(context.Background(), "demo"); err == nil {
+			t.Fatal("Resolve() succeeded against a TLS 1.2 server with MinVersion TLS 1.3")
+		}
+	})
+
+	t.Run("invalid CA file", func(t *testing.T) {
+		bad := filepath.Join(t.TempDir(), "bad.pem")
+		if err := os.WriteFile(bad, []byte("not a certificate"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		for _, path := range []string{bad, filepath.Join(t.TempDir(), "missing.pem")} {
+			if err := resolve(loader.WithCACertFile(path)); !errors.Is(err, errors.ErrTLSConfig) {
+				t.Errorf("NewNPMPackageManager(%s) error = %v, want ErrTLSConfig", filepath.Base(path), err)
+			}
+		}
+		// The loader hands its client to the package managers it creates
+		_, err := loader.NewModuleLoader(loader.WithCACertFile(bad), loader.WithRegistry(srv.URL)).LoadModule(context.Background(), "npm:demo")
+		if err == nil || !strings.Contains(err.Error(), errors.ErrTLSConfig.Error()) {
+			t.Errorf("LoadModule() error = %v, want the TLS setup error", err)
+		}
+	})
+}
+
+func TestConnectionReuse(t *testing.T) {
+	t.Setenv(loader.CacheDirEnv, t.TempDir())
+	tarball := buildTarball(t, map[string]string{"index.js": "export default 1;"})
+	registry := fakeRegistry(t, "demo", "1.0.0", tarball, tarball, false)
+	target, err := url.Parse(registry.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Each connection the client opens shows up as a distinct remote address
+	var mu sync.Mutex
+	conns := make(map[string]bool)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		conns[r.RemoteAddr] = true
+		mu.Unlock()
+		r.URL.Scheme = target.Scheme
+		r.URL.Host = target.Host
+		registry.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer proxy.Close()
+	proxyURL, err := url.Parse(proxy.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pm, err := loader.NewNPMPackageManager(
+		loader.WithRegistry("http://registry.example"),
+		loader.WithProxy(proxyURL),
+		loader.WithMaxIdleConnsPerHost(4),
+		loader.WithMaxConnsPerHost(1),
+		loader.WithIdleConnTimeout(time.Minute),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The metadata and tarball requests share one pooled connection
+	if _, err := pm.InstallPackage(context.Background(), "demo@1.0.0"); err != nil {
+		t.Fatalf("InstallPackage() error = %v", err)
+	}
+	if len(conns) != 1 {
+		t.Errorf("opened %d connections, want 1 reused connection", len(conns))
+	}
+}
+
+func TestNPMContextCancellation(t *testing.T) {
+	t.Setenv(loader.CacheDirEnv, t.TempDir())
+
+	// A registry that never answers
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	pm, err := loader.NewNPMPackageManager(
+		loader.WithRegistry(srv.URL),
+		loader.WithHTTPClient(&http.Client{}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err = pm.InstallPackage(ctx, "demo@1.0.0")
+	if !errors.Is(err, errors.ErrPackageFetch) {
+		t.Errorf("InstallPackage() error = %v, want ErrPackageFetch", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("InstallPackage() took %v, context deadline was ignored", elapsed)
+	}
+}
+
+func TestInstallPackageDistTags(t *testing.T) {
+	t.Setenv(loader.CacheDirEnv, t.TempDir())
+	srv := fakeRegistryVersions(t, "demo",
+		map[string]string{"latest": "1.0.0", "next": "2.0.0-beta.1"},
+		map[string][]byte{
+			"1.0.0":        buildTarball(t, map[string]string{"index.js": "export default 1;"}),
+			"2.0.0-beta.1": buildTarball(t, map[string]string{"index.js": "export default 2;"}),
+		})
+
+	pm, err := loader.NewNPMPackageManager(loader.WithRegistry(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		spec        string
+		wantVersion string
+		wantErr     error
+	}{
+		{spec: "demo", wantVersion: "1.0.0"},
+		{spec: "demo@latest", wantVersion: "1.0.0"},
+		{spec: "demo@next", wantVersion: "2.0.0-beta.1"},
+		{spec: "demo@1.0.0", wantVersion: "1.0.0"},
+		{spec: "demo@canary", wantErr: errors.ErrVersionNotFound},
+		{spec: "demo@3.0.0", wantErr: errors.ErrVersionNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			installed, err := pm.InstallPackage(context.Background(), tt.spec)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("InstallPackage(%q) error = %v, want %v", tt.spec, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("InstallPackage(%q) error = %v", tt.spec, err)
+			}
+			if installed.Version != tt.wantVersion {
+				t.Errorf("InstallPackage(%q) resolved %q, want %q", tt.spec, installed.Version, tt.wantVersion)
+			}
+			// The cache directory is named by the concrete version, not the tag
+			if got := filepath.Base(installed.Path); got != tt.wantVersion {
+				t.Errorf("InstallPackage(%q) installed %q, want %q", tt.spec, got, tt.wantVersion)
+			}
+		})
+	}
+}
+
+func TestInstallPackageRanges(t *testing.T) {
+	t.Setenv(loader.CacheDirEnv, t.TempDir())
+	versions := []string{"1.0.0", "1.2.0", "1.2.5", "1.3.0", "2.0.0-beta.1", "2.0.0", "2.1.0"}
+	tarballs := make(map[string][]byte, len(versions))
+	for _, v := range versions {
+		tarballs[v] = buildTarball(t, map[string]string{"index.js": "export default '" + v + "';"})
+	}
+	srv := fakeRegistryVersions(t, "demo", map[string]string{"latest": "2.1.0"}, tarballs)
+
+	pm, err := loader.NewNPMPackageManager(loader.WithRegistry(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		spec        string
+		wantVersion string
+		wantErr     error
+	}{
+		{spec: "demo@^1.0.0", wantVersion: "1.3.0"},
+		{spec: "demo@~1.2.0", wantVersion: "1.2.5"},
+		{spec: "demo@1.x", wantVersion: "1.3.0"},
+		{spec: "demo@1.2", wantVersion: "1.2.5"},
+		{spec: "demo@*", wantVersion: "2.1.0"},
+		{spec: "demo@>=1.2.0", wantVersion: "2.1.0"},
+		{spec: "demo@<2", wantVersion: "1.3.0"},
+		// Prereleases are only selected when the range asks for one
+		{spec: "demo@^2.0.0-beta.1", wantVersion: "2.1.0"},
+		{spec: "demo@~2.0.0-beta.1", wantVersion: "2.0.0"},
+		{spec: "demo@^3.0.0", wantErr: errors.ErrVersionNotFound},
+		// Space-separated terms must all hold
+		{spec: "demo@>=1.2.0 <1.3.0", wantVersion: "1.2.5"},
+		{spec: "demo@>= 1.0.0 < 2", wantVersion: "1.3.0"},
+		// Unions pick the highest version any alternative allows
+		{spec: "demo@1.0.0 || ~1.2.0", wantVersion: "1.2.5"},
+		{spec: "demo@^3 || 1.x", wantVersion: "1.3.0"},
+		{spec: "demo@^3 || ^4", wantErr: errors.ErrVersionNotFound},
+		// Hyphen ranges are inclusive, and partial upper bounds cover what they stand for
+		{spec: "demo@1.0.0 - 1.2.0", wantVersion: "1.2.0"},
+		{spec: "demo@1 - 1.2", wantVersion: "1.2.5"},
+		{spec: "demo@1.2.0 - 2.0.0", wantVersion: "2.0.0"},
+		// A prerelease is only allowed by the alternative that names it
+		{spec: "demo@>=2.0.0-beta.1 <2.0.0", wantVersion: "2.0.0-beta.1"},
+		{spec: "demo@<2.0.0 || >=2.0.0-beta.1 <2.0.0", wantVersion: "2.0.0-beta.1"},
+		{spec: "demo@1.x || >=2.0.0-alpha <2.0.0", wantVersion: "2.0.0-beta.1"},
+		{spec: "demo@<2.0.0-0 || <1", wantVersion: "1.3.0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			installed, err := pm.InstallPackage(context.Background(), tt.spec)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("InstallPackage(%q) error = %v, want %v", tt.spec, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("InstallPackage(%q) error = %v", tt.spec, err)
+			}
+			if installed.Version != tt.wantVersion || filepath.Base(installed.Path) != tt.wantVersion {
+				t.Errorf("InstallPackage(%q) installed %+v, want version %q", tt.spec, installed, tt.wantVersion)
+			}
+		})
+	}
+}
+
+func TestPinVersion(t *testing.T) {
+	t.Setenv(loader.CacheDirEnv, t.TempDir())
+	versions := []string{"0.1.2", "0.1.9", "0.2.0", "1.2.3-beta.1", "1.2.3-beta.2", "1.2.3", "1.2.4-beta.1", "1.2.9", "1.9.0", "2.0.0"}
+	tarballs := make(map[string][]byte, len(versions))
+	for _, v := range versions {
+		tarballs[v] = buildTarball(t, map[string]string{"index.js": "export default '" + v + "';"})
+	}
+	srv := fakeRegistryVersions(t, "demo", map[string]string{"latest": "2.0.0"}, tarballs)
+
+	pm, err := loader.NewNPMPackageManager(loader.WithRegistry(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Each saved range is installed again to check what it allows
+	tests := []struct {
+		version     string
+		prefix      string
+		want        string
+		wantVersion string
+	}{
+		{version: "1.2.3", prefix: "^", want: "^1.2.3", wantVersion: "1.9.0"},
+		{version: "1.2.3", prefix: "~", want: "~1.2.3", wantVersion: "1.2.9"},
+		{version: "1.2.3", prefix: "", want: "1.2.3", wantVersion: "1.2.3"},
+		{version: "v1.2.3+build.5", prefix: "", want: "1.2.3", wantVersion: "1.2.3"},
+		// Caret ranges on 0.x stay within the minor version
+		{version: "0.1.2", prefix: "^", want: "^0.1.2", wantVersion: "0.1.9"},
+		{version: "0.1.2", prefix: "~", want: "~0.1.2", wantVersion: "0.1.9"},
+		{version: "0.1.2", prefix: "", want: "0.1.2", wantVersion: "0.1.2"},
+		// A prerelease range reaches releases, but no other version's prereleases
+		{version: "1.2.3-beta.1", prefix: "^", want: "^1.2.3-beta.1", wantVersion: "1.9.0"},
+		{version: "1.2.3-beta.1", prefix: "~", want: "~1.2.3-beta.1", wantVersion: "1.2.9"},
+		{version: "1.2.3-beta.1", prefix: "", want: "1.2.3-beta.1", wantVersion: "1.2.3-beta.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.prefix+tt.version, func(t *testing.T) {
+			got, err := loader.PinVersion(tt.version, tt.prefix)
+			if err != nil {
+				t.Fatalf("PinVersion(%q, %q) error = %v", tt.version, tt.prefix, err)
+			}
+			if got != tt.want {
+				t.Fatalf("PinVersion(%q, %q) = %q, want %q", tt.version, tt.prefix, got, tt.want)
+			}
+			installed, err := pm.InstallPackage(context.Background(), "demo@"+got)
+			if err != nil {
+				t.Fatalf("InstallPackage(%q) error = %v", "demo@"+got, err)
+			}
+			if installed.Version != tt.wantVersion {
+				t.Errorf("InstallPackage(%q) installed %s, want %s", "demo@"+got, installed.Version, tt.wantVersion)
+			}
+		})
+	}
+
+	if _, err := loader.PinVersion("1.2.3", ">="); !errors.Is(err, errors.ErrInvalidSavePrefix) {
+		t.Errorf("PinVersion() with prefix >= error = %v, want ErrInvalidSavePrefix", err)
+	}
+	if _, err := loader.PinVersion("latest", "^"); !errors.Is(err, errors.ErrInvalidVersion) {
+		t.Errorf("PinVersion() of a dist-tag error = %v, want ErrInvalidVersion", err)
+	}
+}
+
+// fakeRegistryTree serves packuments for several packages, mapping each
+// version to its dependencies. Tarballs aren't served.
+func fakeRegistryTree(t *testing.T, packages map[string]map[string]map[string]string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/")
+		versions, ok := packages[name]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		doc := map[string]any{}
+		latest := ""
+		for v, deps := range versions {
+			doc[v] = map[string]any{
+				"name":         name,
+				"version":      v,
+				"dependencies": deps,
+				// The registry doesn't have this package, so following
+				// devDependencies would fail every resolution
+				"devDependencies": map[string]string{"dev-only": "^1.0.0"},
+				"dist":            map[string]string{"tarball": "http://" + r.Host + "/" + name + "/-/" + name + "-" + v + ".tgz"},
+			}
+			if latest == "" || v > latest {
+				latest = v
+			}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"name": name, "dist-tags": map[string]string{"latest": latest}, "versions": doc})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestValidatePackageName(t *testing.T) {
+	for _, name := range []string{"lodash", "@types/node", "@jsr/std__path", "lodash.merge", "a-b_c9"} {
+		if err := loader.ValidatePackageName(name); err != nil {
+			t.Errorf("ValidatePackageName(%q) = %v, want nil", name, err)
+		}
+	}
+
+	for _, name := range []string{
+		"../../evil", "@scope/../x", "@../x", "with space", "React", "_private",
+		".hidden", "@scope", "@/name", "@scope/", "node_modules", "a/b",
+		strings.Repeat("a", 215),
+	} {
+		if err := loader.ValidatePackageName(name); !errors.Is(err, errors.ErrInvalidPackageName) {
+			t.Errorf("ValidatePackageName(%q) = %v, want ErrInvalidPackageName", name, err)
+		}
+	}
+
+	// Bad names are rejected before the registry is contacted
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+	pm, err := loader.NewNPMPackageManager(loader.WithCacheDir(t.TempDir()), loader.WithRegistry(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pm.InstallPackage(context.Background(), "@scope/../../evil@1.0.0"); !errors.Is(err, errors.ErrInvalidPackageName) {
+		t.Errorf("InstallPackage error = %v, want ErrInvalidPackageName", err)
+	}
+	if _, err := pm.ResolveTree(context.Background(), []string{"Bad Name"}); !errors.Is(err, errors.ErrInvalidPackageName) {
+		t.Errorf("ResolveTree error = %v, want ErrInvalidPackageName", err)
+	}
+	if requests != 0 {
+		t.Errorf("registry saw %d requests, want none", requests)
+	}
+}
+
+func TestFallbackRegistries(t *testing.T) {
+	tarball := buildTarball(t, map[string]string{"index.js": "module.exports = 1;"})
+	mirror := fakeRegistryVersions(t, "demo", map[string]string{"latest": "1.0.0"}, map[string][]byte{"1.0.0": tarball})
+
+	status := func(code int) *httptest.Server {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(code)
+		}))
+		t.Cleanup(srv.Close)
+		return srv
+	}
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	ctx := context.Background()
+	install := func(primary string, fallbacks ...string) (*loader.InstalledPackage, error) {
+		t.Helper()
+		pm, err := loader.NewNPMPackageManager(loader.WithCacheDir(t.TempDir()),
+			loader.WithRegistry(primary), loader.WithFallbackRegistries(fallbacks...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pm.InstallPackage(ctx, "demo")
+	}
+
+	installed, err := install(down.URL, status(http.StatusServiceUnavailable).URL, status(http.StatusNotFound).URL, mirror.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if installed.Version != "1.0.0" || installed.Registry != mirror.URL {
+		t.Errorf("installed %s@%s from %q, want 1.0.0 from the mirror", installed.Name, installed.Version, installed.Registry)
+	}
+
+	// Only connection failures, 404s and server errors fall through
+	if _, err := install(status(http.StatusForbidden).URL, mirror.URL); !errors.Is(err, errors.ErrPackageFetch) {
+		t.Errorf("403 error = %v, want ErrPackageFetch without falling back", err)
+	}
+	// A 404 is only reported when no registry could be reached otherwise
+	if _, err := install(status(http.StatusNotFound).URL, status(http.StatusNotFound).URL); !errors.Is(err, errors.ErrPackageNotFound) {
+		t.Errorf("all-404 error = %v, want ErrPackageNotFound", err)
+	}
+	if _, err := install(status(http.StatusNotFound).URL, status(http.StatusBadGateway).URL); errors.Is(err, errors.ErrPackageNotFound) || !errors.Is(err, errors.ErrPackageFetch) {
+		t.Errorf("404 then 502 error = %v, want ErrPackageFetch", err)
+	}
+}
+
+func TestInstallMaliciousTarball(t *testing.T) {
+	// craft builds a tarball holding a package.json and the given entry
+	craft := func(t *testing.T, entry *tar.Header) []byte {
+		t.Helper()
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(gz)
+		manifest := `{"name": "evil", "version": "1.0.0"}`
+		for _, h := range []*tar.Header{
+			{Name: "package/package.json", Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(manifest))},
+			entry,
+		} {
+			if err := tw.WriteHeader(h); err != nil {
+				t.Fatal(err)
+			}
+			body := manifest
+			if h == entry {
+				body = strings.Repeat("x", int(h.Size))
+			}
+			if _, err := tw.Write([]byte(body)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := tw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err := gz.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+
+	for name, entry := range map[string]*tar.Header{
+		"traversal":         {Name: "package/../../escaped.js", Typeflag: tar.TypeReg, Mode: 0644, Size: 1},
+		"absolute":          {Name: "/tmp/escaped.js", Typeflag: tar.TypeReg, Mode: 0644, Size: 1},
+		"symlink outside":   {Name: "package/link", Typeflag: tar.TypeSymlink, Linkname: "../../../escaped.js"},
+		"absolute symlink":  {Name: "package/link", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"},
+		"hard link outside": {Name: "package/link", Typeflag: tar.TypeLink, Linkname: "package/../../escaped.js"},
+		"fifo":              {Name: "package/pipe", Typeflag: tar.TypeFifo, Mode: 0644},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cacheDir := t.TempDir()
+			registry := fakeRegistryVersions(t, "evil", map[string]string{"latest": "1.0.0"},
+				map[string][]byte{"1.0.0": craft(t, entry)})
+			pm, err := loader.NewNPMPackageManager(loader.WithCacheDir(cacheDir), loader.WithRegistry(registry.URL))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := pm.InstallPackage(context.Background(), "evil"); !errors.Is(err, errors.ErrMaliciousArchive) {
+				t.Fatalf("InstallPackage error = %v, want ErrMaliciousArchive", err)
+			}
+			if _, err := os.Stat(filepath.Join(cacheDir, "npm-cache", "evil", "1.0.0")); !os.IsNotExist(err) {
+				t.Error("a rejected package was left in the cache")
+			}
+			if _, err := os.Stat(filepath.Join(cacheDir, "npm-cache", "escaped.js")); !os.IsNotExist(err) {
+				t.Error("an entry was written outside the package")
+			}
+		})
+	}
+
+	// Links that stay inside the package are harmless and skipped
+	registry := fakeRegistryVersions(t, "evil", map[string]string{"latest": "1.0.0"}, map[string][]byte{
+		"1.0.0": craft(t, &tar.Header{Name: "package/lib/link", Typeflag: tar.TypeSymlink, Linkname: "../package.json"}),
+	})
+	pm, err := loader.NewNPMPackageManager(loader.WithCacheDir(t.TempDir()), loader.WithRegistry(registry.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pm.InstallPackage(context.Background(), "evil"); err != nil {
+		t.Errorf("InstallPackage with an internal symlink = %v, want success", err)
+	}
+}
+
+func TestPingRegistry(t *testing.T) {
+	code := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead || r.URL.Path != "/" {
+			t.Errorf("got %s %s, want HEAD /", r.Method, r.URL.Path)
+		}
+		w.WriteHeader(code)
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	pm, err := loader.NewNPMPackageManager(loader.WithCacheDir(t.TempDir()), loader.WithRegistry(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pm.Ping(ctx); err != nil {
+		t.Errorf("Ping = %v, want nil", err)
+	}
+	code = http.StatusServiceUnavailable
+	if err := pm.Ping(ctx); !errors.Is(err, errors.ErrPackageFetch) {
+		t.Errorf("Ping on a 503 = %v, want ErrPackageFetch", err)
+	}
+
+	offline, err := loader.NewNPMPackageManager(loader.WithCacheDir(t.TempDir()), loader.WithOffline(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := offline.Ping(ctx); !errors.Is(err, errors.ErrOffline) {
+		t.Errorf("offline Ping = %v, want ErrOffline", err)
+	}
+}
+
+func TestResolveTree(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv(loader.CacheDirEnv, filepath.Join(home, ".edon"))
+	srv := fakeRegistryTree(t, map[string]map[string]map[string]string{
+		"app": {"1.0.0": {"a": "^1.0.0", "b": "~2.1.0"}},
+		"a":   {"1.0.0": nil, "1.4.0": {"b": "^2.0.0", "c": "1"}},
+		"b":   {"2.1.0": nil, "2.1.3": nil, "2.5.0": nil},
+		"c":   {"1.0.0": {"a": "^1.0.0"}},
+	})
+
+	pm, err := loader.NewNPMPackageManager(loader.WithRegistry(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tree, err := pm.ResolveTree(context.Background(), []string{"app"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, pkg := range tree {
+		got = append(got, pkg.String())
+	}
+	// b is needed at two different versions; the cycle between a and c
+	// resolves to a single a@1.4.0
+	want := []string{"a@1.4.0", "app@1.0.0", "b@2.1.3", "b@2.5.0", "c@1.0.0"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("ResolveTree() = %q, want %q", got, want)
+	}
+
+	if _, err := pm.ResolveTree(context.Background(), []string{"missing"}); !errors.Is(err, errors.ErrPackageNotFound) {
+		t.Errorf("ResolveTree(missing) error = %v, want ErrPackageNotFound", err)
+	}
+
+	t.Run("max depth", func(t *testing.T) {
+		for depth, want := range map[int]string{
+			0: "app@1.0.0*",
+			1: "a@1.4.0* app@1.0.0 b@2.1.3",
+			2: "a@1.4.0 app@1.0.0 b@2.1.3 b@2.5.0 c@1.0.0*",
+		} {
+			shallow, err := loader.NewNPMPackageManager(loader.WithRegistry(srv.URL), loader.WithMaxDepth(depth))
+			if err != nil {
+				t.Fatal(err)
+			}
+			tree, err := shallow.ResolveTree(context.Background(), []string{"app"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Packages whose dependencies were left out are starred
+			var got []string
+			for _, pkg := range tree {
+				if pkg.Truncated {
+					got = append(got, pkg.String()+"*")
+				} else {
+					got = append(got, pkg.String())
+				}
+			}
+			if strings.Join(got, " ") != want {
+				t.Errorf("ResolveTree() with max depth %d = %q, want %q", depth, got, want)
+			}
+		}
+	})
+
+	t.Run("offline from cache", func(t *testing.T) {
+		writeCachedPackage(t, home, "cached", "1.0.0", map[string]string{
+			"package.json": `{"name": "cached", "version": "1.0.0", "dependencies": {"dep": "1.0.0"}}`,
+		})
+		writeCachedPackage(t, home, "dep", "1.0.0", map[string]string{"index.js": ""})
+
+		offline, err := loader.NewNPMPackageManager(loader.WithOffline(true))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree, err := offline.ResolveTree(context.Background(), []string{"cached@1.0.0"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tree) != 2 || tree[0].String() != "cached@1.0.0" || tree[1].String() != "dep@1.0.0" {
+			t.Errorf("ResolveTree() = %v, want cached@1.0.0 and dep@1.0.0", tree)
+		}
+	})
+}
+
+func TestOptionalDependencies(t *testing.T) {
+	t.Setenv(loader.CacheDirEnv, t.TempDir())
+	packuments := map[string]string{
+		"app": `{"versions": {"1.0.0": {"name": "app", "version": "1.0.0",
+			"dependencies": {"shared": "1.0.0"},
+			"optionalDependencies": {"native": "1.0.0", "native-missing": "1.0.0"}}}}`,
+		"shared": `{"versions": {"1.0.0": {"name": "shared", "version": "1.0.0", "dependencies": {"helper": "1.0.0"}}}}`,
+		"native": `{"versions": {"1.0.0": {"name": "native", "version": "1.0.0",
+			"dependencies": {"helper": "1.0.0", "binding": "1.0.0"}}}}`,
+		"helper":  `{"versions": {"1.0.0": {"name": "helper", "version": "1.0.0"}}}`,
+		"binding": `{"versions": {"1.0.0": {"name": "binding", "version": "1.0.0"}}}`,
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		doc, ok := packuments[strings.TrimPrefix(r.URL.Path, "/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		// Resolution only needs a tarball to be named
+		_, _ = w.Write([]byte(strings.ReplaceAll(doc, `"version": "1.0.0"`, `"version": "1.0.0", "dist": {"tarball": "http://`+r.Host+`/t.tgz"}`)))
+	}))
+	t.Cleanup(srv.Close)
+
+	pm, err := loader.NewNPMPackageManager(loader.WithRegistry(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, skipped, err := pm.ResolveOptionalTree(context.Background(), []string{"app@1.0.0"}, []string{"absent@^2.0.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Packages only optional dependencies lead to are starred; helper is
+	// also required through shared
+	var got []string
+	for _, pkg := range tree {
+		if pkg.Optional {
+			got = append(got, pkg.String()+"*")
+		} else {
+			got = append(got, pkg.String())
+		}
+	}
+	want := "app@1.0.0 binding@1.0.0* helper@1.0.0 native@1.0.0* shared@1.0.0"
+	if strings.Join(got, " ") != want {
+		t.Errorf("ResolveOptionalTree() = %q, want %q", got, want)
+	}
+	if len(skipped) != 2 {
+		t.Fatalf("ResolveOptionalTree() skipped %v, want absent and native-missing", skipped)
+	}
+	for i, want := range []loader.SkippedOptional{
+		{Spec: "absent@^2.0.0"},
+		{Spec: "native-missing@1.0.0", Dependent: "app@1.0.0"},
+	} {
+		if skipped[i].Spec != want.Spec || skipped[i].Dependent != want.Dependent || !errors.Is(skipped[i].Err, errors.ErrPackageNotFound) {
+			t.Errorf("skipped[%d] = %+v, want %s of %q, not found", i, skipped[i], want.Spec, want.Dependent)
+		}
+	}
+
+	// ResolveTree follows optional dependencies too, without failing
+	if tree, err := pm.ResolveTree(context.Background(), []string{"app@1.0.0"}); err != nil || len(tree) != 5 {
+		t.Errorf("ResolveTree() = %v, %v, want 5 packages", tree, err)
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		pm, err := loader.NewNPMPackageManager(loader.WithRegistry(srv.URL), loader.WithOptionalDependencies(false))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree, skipped, err := pm.ResolveOptionalTree(context.Background(), []string{"app@1.0.0"}, []string{"absent@^2.0.0"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, pkg := range tree {
+			got = append(got, pkg.String())
+		}
+		if want := "app@1.0.0 helper@1.0.0 shared@1.0.0"; strings.Join(got, " ") != want || len(skipped) != 0 {
+			t.Errorf("ResolveOptionalTree() = %q, skipped %v, want %q, none skipped", got, skipped, want)
+		}
+	})
+}
+
+func TestInstallPackageConcurrent(t *testing.T) {
+	cacheDir := t.TempDir()
+	t.Setenv(loader.CacheDirEnv, cacheDir)
+	files := map[string]string{"index.js": "export default 1;"}
+	for i := 0; i < 50; i++ {
+		files[fmt.Sprintf("lib/file%d.js", i)] = strings.Repeat("x", 1024)
+	}
+	srv := fakeRegistryVersions(t, "demo", map[string]string{"latest": "1.0.0"},
+		map[string][]byte{"1.0.0": buildTarball(t, files)})
+
+	const installers = 8
+	var wg sync.WaitGroup
+	paths := make([]string, installers)
+	errs := make([]error, installers)
+	for i := 0; i < installers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// Separate managers behave like separate processes
+			pm, err := loader.NewNPMPackageManager(loader.WithRegistry(srv.URL))
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			installed, err := pm.InstallPackage(context.Background(), "demo@1.0.0")
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			paths[i] = installed.Path
+			// Whatever path is returned must already be complete
+			entries, err := os.ReadDir(filepath.Join(paths[i], "lib"))
+			if err != nil || len(entries) != 50 {
+				errs[i] = fmt.Errorf("saw %d of 50 files (%v)", len(entries), err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("installer %d: %v", i, err)
+		}
+		if paths[i] != paths[0] {
+			t.Errorf("installer %d got %s, want %s", i, paths[i], paths[0])
+		}
+	}
+
+	// Staging directories never outlive an install
+	entries, err := os.ReadDir(filepath.Dir(paths[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "1.0.0" {
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		t.Errorf("package directory contains %q, want only 1.0.0", names)
+	}
+}
+
+// cancelOnClose cancels a context once a tarball response body is closed,
+// i.e. after the download finishes and before extraction starts
+type cancelOnClose struct {
+	http.RoundTripper
+	cancel context.CancelFunc
+}
+
+func (t *cancelOnClose) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.RoundTripper.RoundTrip(req)
+	if err == nil && strings.HasSuffix(req.URL.Path, ".tgz") {
+		resp.Body = &cancelingBody{ReadCloser: resp.Body, cancel: t.cancel}
+	}
+	return resp, err
+}
+
+type cancelingBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelingBody) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
+
+func TestInstallCanceledDuringExtraction(t *testing.T) {
+	cacheDir := t.TempDir()
+	t.Setenv(loader.CacheDirEnv, cacheDir)
+	srv := fakeRegistryVersions(t, "demo", map[string]string{"latest": "1.0.0"},
+		map[string][]byte{"1.0.0": buildTarball(t, map[string]string{"index.js": "export default 1;"})})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := &http.Client{Transport: &cancelOnClose{RoundTripper: http.DefaultTransport, cancel: cancel}}
+	pm, err := loader.NewNPMPackageManager(loader.WithRegistry(srv.URL), loader.WithHTTPClient(client))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = pm.InstallPackage(ctx, "demo@1.0.0")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("InstallPackage() error = %v, want context.Canceled", err)
+	}
+	// Neither the package nor its staging directory may be left behind
+	entries, _ := os.ReadDir(filepath.Join(cacheDir, "npm-cache", "demo"))
+	if len(entries) != 0 {
+		t.Errorf("cache not clean after cancellation: %v", entries)
+	}
+}
+
+func TestInstallCanceledDuringDownload(t *testing.T) {
+	cacheDir := t.TempDir()
+	t.Setenv(loader.CacheDirEnv, cacheDir)
+	tarball := buildTarball(t, map[string]string{
+		"package.json": `{"name": "demo", "version": "1.0.0", "main": "index.js"}`,
+		"index.js":     "export default 1;",
+	})
+	// The first download sends half the tarball and then stalls until the
+	// client gives up
+	started := make(chan struct{})
+	var downloads atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/demo" {
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"name":      "demo",
+				"dist-tags": map[string]string{"latest": "1.0.0"},
+				"versions": map[string]any{"1.0.0": map[string]any{
+					"name":    "demo",
+					"version": "1.0.0",
+					"dist":    map[string]string{"tarball": "http://" + r.Host + "/demo/-/demo-1.0.0.tgz", "integrity": sriSHA512(tarball)},
+				}},
+			})
+			return
+		}
+		if downloads.Add(1) > 1 {
+			_, _ = w.Write(tarball)
+			return
+		}
+		w.Header().Set("Content-Length", fmt.Sprint(len(tarball)))
+		_, _ = w.Write(tarball[:len(tarball)/2])
+		w.(http.Flusher).Flush()
+		close(started)
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	pm, err := loader.NewNPMPackageManager(loader.WithRegistry(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-started
+		cancel()
+	}()
+
+	start := time.Now()
+	if _, err := pm.InstallPackage(ctx, "demo@1.0.0"); err == nil {
+		t.Fatal("InstallPackage() succeeded after being canceled mid-download")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("InstallPackage() took %v to notice the cancellation", elapsed)
+	}
+	// Nothing half-installed is left for the next install to pick up
+	if entries, _ := os.ReadDir(filepath.Join(cacheDir, "npm-cache", "demo")); len(entries) != 0 {
+		t.Errorf("cache after cancellation = %v, want nothing installed", entries)
+	}
+	installed, err := pm.InstallPackage(context.Background(), "demo@1.0.0")
+	if err != nil {
+		t.Fatalf("InstallPackage() after a canceled install error = %v", err)
+	}
+	if content, err := os.ReadFile(filepath.Join(installed.Path, "index.js")); err != nil || string(content) != "export default 1;" {
+		t.Errorf("index.js after reinstalling = %q, %v", content, err)
+	}
+}
+
+func TestInstallEngines(t *testing.T) {
+	tarball := func(engines string) []byte {
+		return buildTarball(t, map[string]string{
+			"package.json": `{"name": "demo", "version": "1.0.0", "engines": ` + engines + `}`,
+			"index.js":     "export default 1;",
+		})
+	}
+
+	tests := []struct {
+		name     string
+		engines  string
+		opts     []loader.Option
+		warnings int
+		wantErr  bool
+	}{
+		{name: "satisfied", engines: `{"node": ">=14"}`},
+		{name: "unknown engines ignored", engines: `{"npm": ">=99", "deno": "*"}`},
+		{name: "legacy array ignored", engines: `["node >= 99"]`},
+		{name: "too new", engines: `{"node": ">=20"}`, warnings: 1},
+		{name: "configured engines", engines: `{"node": ">=20"}`, opts: []loader.Option{loader.WithEngines(map[string]string{"node": "20.1.0"})}},
+		{name: "strict", engines: `{"node": "^16"}`, opts: []loader.Option{loader.WithStrictEngines(true)}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(loader.CacheDirEnv, t.TempDir())
+			srv := fakeRegistryVersions(t, "demo", map[string]string{"latest": "1.0.0"},
+				map[string][]byte{"1.0.0": tarball(tt.engines)})
+
+			pm, err := loader.NewNPMPackageManager(append(tt.opts, loader.WithRegistry(srv.URL))...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			installed, err := pm.InstallPackage(context.Background(), "demo@1.0.0")
+			if tt.wantErr {
+				if !errors.Is(err, errors.ErrEngineMismatch) {
+					t.Fatalf("InstallPackage() error = %v, want ErrEngineMismatch", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("InstallPackage() error = %v", err)
+			}
+			if len(installed.EngineWarnings) != tt.warnings {
+				t.Errorf("EngineWarnings = %q, want %d", installed.EngineWarnings, tt.warnings)
+			}
+
+			// Cached installs are checked too
+			cached, err := pm.InstallPackage(context.Background(), "demo@1.0.0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !cached.FromCache || len(cached.EngineWarnings) != tt.warnings {
+				t.Errorf("cached install: FromCache = %v, EngineWarnings = %q", cached.FromCache, cached.EngineWarnings)
+			}
+		})
+	}
+}
+
+func TestInstallScripts(t *testing.T) {
+	t.Setenv(loader.CacheDirEnv, t.TempDir())
+	marker := filepath.Join(t.TempDir(), "ran")
+	srv := fakeRegistryVersions(t, "demo", map[string]string{"latest": "1.0.0"}, map[string][]byte{
+		"1.0.0": buildTarball(t, map[string]string{
+			"package.json": `{"name": "demo", "version": "1.0.0", "scripts": {
+				"test": "node test.js",
+				"postinstall": "touch ` + marker + `",
+				"preinstall": "node check.js"
+			}}`,
+			"index.js": "export default 1;",
+		}),
+	})
+
+	pm, err := loader.NewNPMPackageManager(loader.WithRegistry(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	installed, err := pm.InstallPackage(context.Background(), "demo@1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Only install scripts count, in the order npm would run them
+	if len(installed.ScriptWarnings) != 2 ||
+		!strings.Contains(installed.ScriptWarnings[0], "demo@1.0.0 has a preinstall script") ||
+		!strings.Contains(installed.ScriptWarnings[1], "postinstall script that edon did not run: touch") {
+		t.Errorf("ScriptWarnings = %q, want the preinstall and postinstall scripts", installed.ScriptWarnings)
+	}
+	if _, err := os.Stat(marker); !os.IsNotExist(err) {
+		t.Errorf("postinstall script ran (stat error %v)", err)
+	}
+
+	cached, err := pm.InstallPackage(context.Background(), "demo@1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cached.FromCache || len(cached.ScriptWarnings) != 2 {
+		t.Errorf("cached install: FromCache = %v, ScriptWarnings = %q", cached.FromCache, cached.ScriptWarnings)
+	}
+}
+
+func TestInstallReportsDownload(t *testing.T) {
+	t.Setenv(loader.CacheDirEnv, t.TempDir())
+	tarball := buildTarball(t, map[string]string{"index.js": "export default 1;"})
+	srv := fakeRegistryVersions(t, "demo", map[string]string{"latest": "1.2.0"}, map[string][]byte{"1.2.0": tarball})
+
+	pm, err := loader.NewNPMPackageManager(loader.WithRegistry(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	pkg, err := pm.Resolve(ctx, "demo@latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := pm.Install(ctx, pkg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Name != "demo" || first.Version != "1.2.0" || first.FromCache || first.Bytes != int64(len(tarball)) {
+		t.Errorf("first Install = %+v, want a %d byte download of demo@1.2.0", first, len(tarball))
+	}
+	if _, err := os.Stat(filepath.Join(first.Path, "index.js")); err != nil {
+		t.Errorf("installed path: %v", err)
+	}
+
+	second, err := pm.Install(ctx, pkg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !second.FromCache || second.Bytes != 0 || second.Path != first.Path {
+		t.Errorf("second Install = %+v, want a cache hit at %s", second, first.Path)
+	}
+
+	// InstallPackage reports what a tag or range resolved to
+	for _, spec := range []string{"demo@latest", "demo@1.2.0", "demo@^1.0.0"} {
+		installed, err := pm.InstallPackage(ctx, spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if installed.Name != "demo" || installed.Version != "1.2.0" || !installed.FromCache {
+			t.Errorf("InstallPackage(%q) = %+v, want demo@1.2.0 from the cache", spec, installed)
+		}
+	}
+}
+
+func TestInstallLocal(t *testing.T) {
+	t.Setenv(loader.CacheDirEnv, t.TempDir())
+	pm, err := loader.NewNPMPackageManager(loader.WithRegistry("http://registry.invalid"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	t.Run("directory", func(t *testing.T) {
+		dir := t.TempDir()
+		writeFile(t, filepath.Join(dir, "package.json"), `{"name": "local-dir", "version": "0.1.0"}`)
+		writeFile(t, filepath.Join(dir, "index.js"), "export default 1;")
+		writeFile(t, filepath.Join(dir, "node_modules", "dep", "index.js"), "ignored")
+
+		installed, err := pm.InstallPackage(ctx, dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := installed.Path
+		if filepath.Base(filepath.Dir(path)) != "local-dir" || filepath.Base(path) != "0.1.0" {
+			t.Errorf("installed at %s, want .../local-dir/0.1.0", path)
+		}
+		if _, err := os.Stat(filepath.Join(path, "node_modules")); !os.IsNotExist(err) {
+			t.Error("node_modules was copied into the cache")
+		}
+
+		// A rebuilt package replaces the cached copy even at the same version
+		writeFile(t, filepath.Join(dir, "index.js"), "export default 2;")
+		if _, err := pm.InstallPackage(ctx, dir); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(filepath.Join(path, "index.js"))
+		if err != nil || string(data) != "export default 2;" {
+			t.Errorf("index.js after reinstall = %q, %v; want the rebuilt file", data, err)
+		}
+	})
+
+	t.Run("tarball", func(t *testing.T) {
+		tarball := filepath.Join(t.TempDir(), "pkg.tgz")
+		data := buildTarball(t, map[string]string{
+			"package.json": `{"name": "@scope/local-tgz", "version": "2.0.0"}`,
+			"index.js":     "export default 1;",
+		})
+		if err := os.WriteFile(tarball, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		installed, err := pm.InstallLocal(tarball)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if installed.Name != "@scope/local-tgz" || installed.Version != "2.0.0" {
+			t.Errorf("InstallLocal = %+v, want @scope/local-tgz@2.0.0", installed)
+		}
+		if _, err := os.Stat(filepath.Join(installed.Path, "index.js")); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		dir := t.TempDir()
+		writeFile(t, filepath.Join(dir, "index.js"), "export default 1;")
+		if _, err := pm.InstallLocal(dir); !errors.Is(err, errors.ErrInvalidPackage) {
+			t.Errorf("InstallLocal without package.json = %v, want ErrInvalidPackage", err)
+		}
+		if _, err := pm.InstallLocal(filepath.Join(dir, "missing.tgz")); !errors.Is(err, errors.ErrPackageNotFound) {
+			t.Errorf("InstallLocal of a missing file = %v, want ErrPackageNotFound", err)
+		}
+	})
+
+	for spec, want := range map[string]bool{"./pkg": true, "pkg.tgz": true, "/abs/pkg": true, "lodash": false, "@scope/pkg@1.0.0": false} {
+		if got := loader.IsLocalPackage(spec); got != want {
+			t.Errorf("IsLocalPackage(%q) = %v, want %v", spec, got, want)
+		}
+	}
+}
+
+func TestInstallBins(t *testing.T) {
+	t.Setenv(loader.CacheDirEnv, t.TempDir())
+	pm, err := loader.NewNPMPackageManager(loader.WithRegistry("http://registry.invalid"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		manifest string
+		want     map[string]string
+		wantErr  error
+	}{
+		{
+			name:     "string",
+			manifest: `{"name": "@scope/tool", "version": "1.0.0", "bin": "./bin/cli.js"}`,
+			// A lone bin is named after the package, without its scope
+			want: map[string]string{"tool": "bin/cli.js"},
+		},
+		{
+			name:     "map",
+			manifest: `{"name": "tools", "version": "1.0.0", "bin": {"tsc": "bin/tsc", "tsserver": "./bin/tsserver"}}`,
+			want:     map[string]string{"tsc": "bin/tsc", "tsserver": "bin/tsserver"},
+		},
+		{
+			name:     "none",
+			manifest: `{"name": "library", "version": "1.0.0"}`,
+		},
+		{
+			name:     "escaping file",
+			manifest: `{"name": "escape", "version": "1.0.0", "bin": {"evil": "../../outside.js"}}`,
+			wantErr:  errors.ErrInvalidPackage,
+		},
+		{
+			name:     "path in command",
+			manifest: `{"name": "slashed", "version": "1.0.0", "bin": {"../evil": "cli.js"}}`,
+			wantErr:  errors.ErrInvalidPackage,
+		},
+		{
+			name:     "wrong shape",
+			manifest: `{"name": "shape", "version": "1.0.0", "bin": ["cli.js"]}`,
+			wantErr:  errors.ErrInvalidPackage,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFile(t, filepath.Join(dir, "package.json"), tt.manifest)
+
+			installed, err := pm.InstallPackage(ctx, dir)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("InstallPackage() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := make(map[string]string, len(tt.want))
+			for command, file := range tt.want {
+				want[command] = filepath.Join(installed.Path, filepath.FromSlash(file))
+			}
+			if len(installed.Bins) != len(want) {
+				t.Fatalf("Bins = %v, want %v", installed.Bins, want)
+			}
+			for command, file := range want {
+				if installed.Bins[command] != file {
+					t.Errorf("Bins[%q] = %q, want %q", command, installed.Bins[command], file)
+				}
+			}
+
+			// Installs served from the cache report the same bins
+			cached, err := pm.InstallPackage(ctx, installed.Name+"@"+installed.Version)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !cached.FromCache || len(cached.Bins) != len(want) {
+				t.Errorf("cached install = %+v, want the bins %v from the cache", cached, want)
+			}
+		})
+	}
+}
+
+func TestCacheArchive(t *testing.T) {
+	src := t.TempDir()
+	t.Setenv(loader.CacheDirEnv, src)
+	writeFile(t, filepath.Join(src, "npm-cache", "demo", "1.0.0", "package.json"), `{"name": "demo", "version": "1.0.0"}`)
+	writeFile(t, filepath.Join(src, "npm-cache", "demo", "1.0.0", "lib", "index.js"), "export default 1;")
+	writeFile(t, filepath.Join(src, "npm-cache", "@scope", "pkg", "2.0.0", "package.json"), `{"name": "@scope/pkg", "version": "2.0.0"}`)
+	writeFile(t, filepath.Join(src, "npm-cache", "demo", ".extract-1.1.0-123", "partial.js"), "half")
+
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("export default 'remote';"))
+	}))
+	defer cdn.Close()
+	if _, err := loader.NewModuleLoader(loader.WithHTTPClient(cdnClient(t, cdn))).LoadModule(context.Background(), "https://unpkg.com/mod.js"); err != nil {
+		t.Fatal(err)
+	}
+
+	pm, err := loader.NewNPMPackageManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var archive bytes.Buffer
+	if err := pm.ExportCache(&archive); err != nil {
+		t.Fatal(err)
+	}
+
+	dest := t.TempDir()
+	t.Setenv(loader.CacheDirEnv, dest)
+	// Entries already present win over the archive
+	writeFile(t, filepath.Join(dest, "npm-cache", "demo", "1.0.0", "package.json"), `{"name": "demo", "version": "1.0.0"}`)
+	writeFile(t, filepath.Join(dest, "npm-cache", "demo", "1.0.0", "lib", "index.js"), "local copy")
+
+	pm, err = loader.NewNPMPackageManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pm.ImportCache(bytes.NewReader(archive.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+
+	if data, _ := os.ReadFile(filepath.Join(dest, "npm-cache", "demo", "1.0.0", "lib", "index.js")); string(data) != "local copy" {
+		t.Errorf("existing package was overwritten with %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "npm-cache", "@scope", "pkg", "2.0.0", "package.json")); err != nil {
+		t.Errorf("scoped package wasn't imported: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "npm-cache", "demo", ".extract-1.1.0-123")); !os.IsNotExist(err) {
+		t.Error("staging directory was exported")
+	}
+	module, err := loader.NewModuleLoader(loader.WithOffline(true)).LoadModule(context.Background(), "https://unpkg.com/mod.js")
+	if err != nil || module.Content != "export default 'remote';" {
+		t.Errorf("remote module after import = %v, %v", module, err)
+	}
+
+	t.Run("rejected", func(t *testing.T) {
+		archiveOf := func(files map[string]string) []byte {
+			var buf bytes.Buffer
+			gz := gzip.NewWriter(&buf)
+			tw := tar.NewWriter(gz)
+			for name, content := range files {
+				tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg})
+				tw.Write([]byte(content))
+			}
+			tw.Close()
+			gz.Close()
+			return buf.Bytes()
+		}
+
+		for name, files := range map[string]map[string]string{
+			"path escape":  {"npm-cache/../../evil.js": "x"},
+			"unknown root": {"bin/evil": "x"},
+			"wrong package": {
+				"npm-cache/left-pad/1.0.0/package.json": `{"name": "evil", "version": "6.6.6"}`,
+			},
+		} {
+			err := pm.ImportCache(bytes.NewReader(archiveOf(files)))
+			if !errors.Is(err, errors.ErrCacheArchive) {
+				t.Errorf("%s: ImportCache = %v, want ErrCacheArchive", name, err)
+			}
+		}
+		if _, err := os.Stat(filepath.Join(dest, "npm-cache", "left-pad")); !os.IsNotExist(err) {
+			t.Error("a rejected archive left entries in the cache")
+		}
+	})
+}
+
+func TestPruneCache(t *testing.T) {
+	base := t.TempDir()
+	t.Setenv(loader.CacheDirEnv, base)
+	cacheDir := filepath.Join(base, "npm-cache")
+	hourAgo := time.Now().Add(-time.Hour)
+	for i, dir := range []string{"pinned/1.0.0", "new/1.0.0", "old/1.0.0", "@scope/mid/1.0.0"} {
+		path := filepath.Join(cacheDir, filepath.FromSlash(dir))
+		writeFile(t, filepath.Join(path, "index.js"), strings.Repeat("x", 1000))
+		used := hourAgo.Add(time.Duration(i) * time.Minute)
+		if err := os.Chtimes(path, used, used); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pm, err := loader.NewNPMPackageManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size, err := pm.CacheSize(); err != nil || size != 4000 {
+		t.Fatalf("CacheSize() = %d, %v, want 4000", size, err)
+	}
+
+	// new starts out older than old and mid, but serving it from the cache
+	// makes it the most recently used, so old goes first, then mid; pinned
+	// is the oldest but kept
+	if _, err := pm.InstallPackage(context.Background(), "new@1.0.0"); err != nil {
+		t.Fatal(err)
+	}
+	freed, err := pm.PruneCache(2500, "pinned@1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if freed != 2000 {
+		t.Errorf("PruneCache() freed %d, want 2000", freed)
+	}
+	for dir, want := range map[string]bool{"pinned/1.0.0": true, "new/1.0.0": true, "old": false, "@scope": false} {
+		if _, err := os.Stat(filepath.Join(cacheDir, filepath.FromSlash(dir))); (err == nil) != want {
+			t.Errorf("%s present = %v, want %v", dir, err == nil, want)
+		}
+	}
+
+	// Kept packages may leave the cache over budget
+	if freed, err := pm.PruneCache(0, "pinned@1.0.0"); err != nil || freed != 1000 {
+		t.Errorf("PruneCache(0) = %d, %v, want 1000", freed, err)
+	}
+	if size, err := pm.CacheSize(); err != nil || size != 1000 {
+		t.Errorf("CacheSize() after pruning = %d, %v, want 1000", size, err)
+	}
+}
+
+func TestUninstallPackage(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv(loader.CacheDirEnv, filepath.Join(home, ".edon"))
+	for _, pkg := range []string{"left-pad@1.10.0", "left-pad@1.9.0", "@scope/util@2.0.0"} {
+		name, version, _ := loader.ParseNPMSpecifier(pkg)
+		writeCachedPackage(t, home, name, version, map[string]string{"index.js": ""})
+	}
+
+	pm, err := loader.NewNPMPackageManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := func() string {
+		t.Helper()
+		installed, err := pm.ListInstalled()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, pkg := range installed {
+			got = append(got, pkg.Name+"@"+pkg.Version)
+		}
+		return strings.Join(got, " ")
+	}
+	if got, want := list(), "@scope/util@2.0.0 left-pad@1.9.0 left-pad@1.10.0"; got != want {
+		t.Errorf("ListInstalled() = %q, want %q", got, want)
+	}
+
+	ctx := context.Background()
+	if err := pm.UninstallPackage(ctx, "left-pad@1.9.0"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := list(), "@scope/util@2.0.0 left-pad@1.10.0"; got != want {
+		t.Errorf("ListInstalled() after uninstalling left-pad@1.9.0 = %q, want %q", got, want)
+	}
+	if err := pm.UninstallPackage(ctx, "@scope/util"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(home, ".edon", "npm-cache", "@scope")); !os.IsNotExist(err) {
+		t.Errorf("empty scope directory left behind: %v", err)
+	}
+	if err := pm.UninstallPackage(ctx, "@scope/util"); !errors.Is(err, errors.ErrPackageNotFound) {
+		t.Errorf("UninstallPackage(not installed) error = %v, want ErrPackageNotFound", err)
+	}
+	if err := pm.UninstallPackage(ctx, "left-pad@^1.0.0"); !errors.Is(err, errors.ErrInvalidVersion) {
+		t.Errorf("UninstallPackage(range) error = %v, want ErrInvalidVersion", err)
+	}
+}
+
+func TestFakePackageManager(t *testing.T) {
+	var packages []*loadertest.Package
+	for _, version := range []string{"1.0.0", "1.2.0", "2.0.0"} {
+		pkg, err := loadertest.NewPackage(`{"name": "demo", "version": "`+version+`"}`, map[string]string{"lib/index.js": "export default 1;"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		packages = append(packages, pkg)
+	}
+	if _, err := loadertest.NewPackage(`{"name": "demo", "version": "1.x"}`, nil); !errors.Is(err, errors.ErrInvalidVersion) {
+		t.Errorf("NewPackage(range version) error = %v, want ErrInvalidVersion", err)
+	}
+
+	var installer loader.PackageInstaller = loadertest.NewFakePackageManager(t.TempDir(), packages...)
+	fake := installer.(*loadertest.FakePackageManager)
+	ctx := context.Background()
+	for spec, want := range map[string]string{"demo": "2.0.0", "demo@^1.0.0": "1.2.0", "demo@1.0.0": "1.0.0"} {
+		installed, err := installer.InstallPackage(ctx, spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if installed.Version != want {
+			t.Errorf("InstallPackage(%s) version = %s, want %s", spec, installed.Version, want)
+		}
+		if _, err := os.Stat(filepath.Join(installed.Path, "lib", "index.js")); err != nil {
+			t.Errorf("InstallPackage(%s) didn't write its files: %v", spec, err)
+		}
+	}
+	if installed, err := installer.InstallPackage(ctx, "demo@2.0.0"); err != nil || !installed.FromCache {
+		t.Errorf("InstallPackage(demo@2.0.0) again = %+v, %v, want it from the cache", installed, err)
+	}
+	if _, err := installer.InstallPackage(ctx, "demo@^3.0.0"); !errors.Is(err, errors.ErrVersionNotFound) {
+		t.Errorf("InstallPackage(demo@^3.0.0) error = %v, want ErrVersionNotFound", err)
+	}
+	if _, err := installer.InstallPackage(ctx, "missing"); !errors.Is(err, errors.ErrPackageNotFound) {
+		t.Errorf("InstallPackage(missing) error = %v, want ErrPackageNotFound", err)
+	}
+
+	if err := installer.UninstallPackage(ctx, "demo@1.2.0"); err != nil {
+		t.Fatal(err)
+	}
+	installed, err := installer.ListInstalled()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(installed) != 2 || installed[0].Version != "1.0.0" || installed[1].Version != "2.0.0" {
+		t.Errorf("ListInstalled() = %v, want demo 1.0.0 and 2.0.0", installed)
+	}
+
+	calls := fake.Calls()
+	if len(calls) != 8 || calls[6].Method != "UninstallPackage" || calls[6].Args[0] != "demo@1.2.0" || calls[7].Method != "ListInstalled" {
+		t.Errorf("Calls() = %+v, want 6 installs, an uninstall and a list", calls)
+	}
+}
+
+func TestOutdated(t *testing.T) {
+	tarballs := map[string][]byte{}
+	for _, v := range []string{"1.0.0", "1.2.0", "2.0.0", "3.0.0-beta.1"} {
+		tarballs[v] = buildTarball(t, map[string]string{"package.json": `{"name": "demo", "version": "` + v + `"}`})
+	}
+	srv := fakeRegistryVersions(t, "demo", map[string]string{"latest": "2.0.0", "next": "3.0.0-beta.1"}, tarballs)
+	t.Setenv(loader.CacheDirEnv, t.TempDir())
+	ctx := context.Background()
+
+	pm, err := loader.NewNPMPackageManager(loader.WithRegistry(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pm.InstallPackage(ctx, "demo@1.0.0"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		spec     string
+		want     loader.OutdatedPackage
+		outdated bool
+	}{
+		{"^1.0.0", loader.OutdatedPackage{Name: "demo", Range: "^1.0.0", Current: "1.0.0", Wanted: "1.2.0", Latest: "2.0.0"}, true},
+		{"~1.0.0", loader.OutdatedPackage{Name: "demo", Range: "~1.0.0", Current: "1.0.0", Wanted: "1.0.0", Latest: "2.0.0"}, true},
+		// Nothing installed satisfies ^2
+		{"^2.0.0", loader.OutdatedPackage{Name: "demo", Range: "^2.0.0", Wanted: "2.0.0", Latest: "2.0.0"}, true},
+		{"next", loader.OutdatedPackage{Name: "demo", Range: "next", Current: "1.0.0", Wanted: "3.0.0-beta.1", Latest: "2.0.0"}, true},
+	}
+	for _, tt := range tests {
+		got, err := pm.Outdated(ctx, "demo", tt.spec)
+		if err != nil {
+			t.Errorf("Outdated(%s) error = %v", tt.spec, err)
+			continue
+		}
+		if *got != tt.want || got.IsOutdated() != tt.outdated {
+			t.Errorf("Outdated(%s) = %+v, want %+v", tt.spec, *got, tt.want)
+		}
+	}
+
+	if _, err := pm.InstallPackage(ctx, "demo@2.0.0"); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := pm.Outdated(ctx, "demo", "^2.0.0"); err != nil || got.IsOutdated() {
+		t.Errorf("Outdated(^2.0.0) after installing 2.0.0 = %+v, %v, want up to date", got, err)
+	}
+	if _, err := pm.Outdated(ctx, "missing", "^1.0.0"); !errors.Is(err, errors.ErrPackageNotFound) {
+		t.Errorf("Outdated(missing) error = %v, want ErrPackageNotFound", err)
+	}
+}
+
+func TestInfo(t *testing.T) {
+	doc := `{
+		"name": "demo",
+		"description": "A demo package",
+		"license": "MIT",
+		"dist-tags": {"latest": "1.10.0", "next": "2.0.0-rc.1"},
+		"versions": {
+			"1.2.0": {"name": "demo", "version": "1.2.0", "license": {"type": "ISC"},
+				"dist": {"tarball": "http://registry/demo-1.2.0.tgz"}},
+			"1.10.0": {"name": "demo", "version": "1.10.0", "dependencies": {"left-pad": "^1.0.0"},
+				"dist": {"tarball": "http://registry/demo-1.10.0.tgz", "integrity": "sha512-abc"}},
+			"2.0.0-rc.1": {"name": "demo", "version": "2.0.0-rc.1", "description": "The next demo",
+				"dist": {"tarball": "http://registry/demo-2.0.0-rc.1.tgz"}}
+		}
+	}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/demo":
+			_, _ = io.WriteString(w, doc)
+		case "/@private/demo":
+			w.WriteHeader(http.StatusUnauthorized)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	t.Setenv(loader.CacheDirEnv, t.TempDir())
+	ctx := context.Background()
+
+	pm, err := loader.NewNPMPackageManager(loader.WithRegistry(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := pm.Info(ctx, "demo", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Name != "demo" || info.Description != "A demo package" || info.License != "MIT" ||
+		info.Latest != "1.10.0" || info.Version != "1.10.0" || info.Integrity != "sha512-abc" {
+		t.Errorf("Info(demo) = %+v", info)
+	}
+	if want := []string{"1.2.0", "1.10.0", "2.0.0-rc.1"}; !slices.Equal(info.Versions, want) {
+		t.Errorf("Info(demo) versions = %v, want %v", info.Versions, want)
+	}
+	if info.Dependencies["left-pad"] != "^1.0.0" || info.DistTags["next"] != "2.0.0-rc.1" {
+		t.Errorf("Info(demo) dependencies = %v, dist-tags = %v", info.Dependencies, info.DistTags)
+	}
+	if !strings.Contains(string(info.Raw), `"dist-tags"`) {
+		t.Errorf("Info(demo) raw = %s, want the whole document", info.Raw)
+	}
+
+	// A version's own description and license win over the package's
+	tests := []struct {
+		spec, version, description, license string
+	}{
+		{"1.2.0", "1.2.0", "A demo package", "ISC"},
+		{"~1.2", "1.2.0", "A demo package", "ISC"},
+		{"next", "2.0.0-rc.1", "The next demo", "MIT"},
+	}
+	for _, tt := range tests {
+		info, err := pm.Info(ctx, "demo", tt.spec)
+		if err != nil {
+			t.Errorf("Info(demo@%s) error = %v", tt.spec, err)
+			continue
+		}
+		if info.Version != tt.version || info.Description != tt.description || info.License != tt.license {
+			t.Errorf("Info(demo@%s) = %s, %q, %q, want %s, %q, %q", tt.spec,
+				info.Version, info.Description, info.License, tt.version, tt.description, tt.license)
+		}
+		var raw struct{ Version string }
+		if err := json.Unmarshal(info.Raw, &raw); err != nil || raw.Version != tt.version {
+			t.Errorf("Info(demo@%s) raw = %s, want the version's entry", tt.spec, info.Raw)
+		}
+	}
+
+	if _, err := pm.Info(ctx, "demo", "9.0.0"); !errors.Is(err, errors.ErrVersionNotFound) {
+		t.Errorf("Info(demo@9.0.0) error = %v, want ErrVersionNotFound", err)
+	}
+	if _, err := pm.Info(ctx, "missing", ""); !errors.Is(err, errors.ErrPackageNotFound) {
+		t.Errorf("Info(missing) error = %v, want ErrPackageNotFound", err)
+	}
+	if _, err := pm.Info(ctx, "@private/demo", ""); !errors.Is(err, errors.ErrRegistryAuth) {
+		t.Errorf("Info(@private/demo) error = %v, want ErrRegistryAuth", err)
+	}
+}
+
+func TestPackumentRevalidation(t *testing.T) {
+	cache := t.TempDir()
+	t.Setenv(loader.CacheDirEnv, cache)
+	var mu sync.Mutex
+	latest := "1.0.0"
+	var requests, notModified int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+		etag := `"demo-` + latest + `"`
+		if r.Header.Get("If-None-Match") == etag {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"name":      "demo",
+			"dist-tags": map[string]string{"latest": latest},
+			"versions": map[string]any{latest: map[string]any{
+				"name": "demo", "version": latest, "dist": map[string]string{"tarball": "http://registry/demo.tgz"},
+			}},
+		})
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+	counts := func() (int, int) {
+		mu.Lock()
+		defer mu.Unlock()
+		return requests, notModified
+	}
+	latestOf := func(pm *loader.NPMPackageManager) string {
+		t.Helper()
+		info, err := pm.Info(ctx, "demo", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info.Latest
+	}
+
+	pm, err := loader.NewNPMPackageManager(loader.WithRegistry(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Within the TTL the cached document is used without asking
+	for i := 0; i < 2; i++ {
+		if got := latestOf(pm); got != "1.0.0" {
+			t.Errorf("latest = %s, want 1.0.0", got)
+		}
+	}
+	if n, _ := counts(); n != 1 {
+		t.Errorf("%d requests within the TTL, want 1", n)
+	}
+	if entries, err := os.ReadDir(filepath.Join(cache, "packuments")); err != nil || len(entries) == 0 {
+		t.Errorf("packument cache = %v, %v, want entries", entries, err)
+	}
+
+	// Past it, a 304 keeps the cached document
+	revalidating, err := loader.NewNPMPackageManager(loader.WithRegistry(srv.URL), loader.WithPackumentTTL(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := latestOf(revalidating); got != "1.0.0" {
+		t.Errorf("latest after a 304 = %s, want 1.0.0", got)
+	}
+	if n, unchanged := counts(); n != 2 || unchanged != 1 {
+		t.Errorf("%d requests, %d not modified, want 2 and 1", n, unchanged)
+	}
+
+	// A new publish changes the ETag, so the whole document is fetched again
+	mu.Lock()
+	latest = "1.1.0"
+	mu.Unlock()
+	if got := latestOf(revalidating); got != "1.1.0" {
+		t.Errorf("latest after a publish = %s, want 1.1.0", got)
+	}
+	if n, unchanged := counts(); n != 3 || unchanged != 1 {
+		t.Errorf("%d requests, %d not modified, want 3 and 1", n, unchanged)
+	}
+
+	// Bypassing the cache fetches in full
+	bypass, err := loader.NewNPMPackageManager(loader.WithRegistry(srv.URL), loader.WithCacheMode(loader.CacheBypassRead))
+	if err != nil {
+		t.Fatal(err)
+	}
+	latestOf(bypass)
+	if n, unchanged := counts(); n != 4 || unchanged != 1 {
+		t.Errorf("%d requests, %d not modified with CacheBypassRead, want 4 and 1", n, unchanged)
+	}
+
+	// Documents are held to the module size limit
+	limited, err := loader.NewNPMPackageManager(loader.WithRegistry(srv.URL), loader.WithCacheMode(loader.CacheBypassRead), loader.WithMaxModuleSize(50))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := limited.Info(ctx, "demo", ""); !errors.Is(err, errors.ErrModuleTooLarge) {
+		t.Errorf("Info() over the size limit error = %v, want ErrModuleTooLarge", err)
+	}
+}
+
+// gatedTarballs holds tarball downloads until release is closed, counting
+// how many were started
+type gatedTarballs struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (g *gatedTarballs) RoundTrip(req *http.Request) (*http.Response, error) {
+	if strings.HasSuffix(req.URL.Path, ".tgz") {
+		g.started <- struct{}{}
+		<-g.release
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestInstallLock(t *testing.T) {
+	t.Setenv(loader.CacheDirEnv, t.TempDir())
+	srv := fakeRegistryVersions(t, "demo", map[string]string{"latest": "1.0.0"},
+		map[string][]byte{"1.0.0": buildTarball(t, map[string]string{"index.js": "export default 1;"})})
+	gate := &gatedTarballs{started: make(chan struct{}, 10), release: make(chan struct{})}
+	// Separate managers behave like separate processes
+	newPM := func() *loader.NPMPackageManager {
+		pm, err := loader.NewNPMPackageManager(loader.WithRegistry(srv.URL), loader.WithHTTPClient(&http.Client{Transport: gate}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pm
+	}
+	ctx := context.Background()
+
+	first := make(chan error, 1)
+	go func() {
+		_, err := newPM().InstallPackage(ctx, "demo@1.0.0")
+		first <- err
+	}()
+	<-gate.started
+
+	// A waiter gives up when its context is canceled
+	canceled, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	if _, err := newPM().InstallPackage(canceled, "demo@1.0.0"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("InstallPackage() while locked error = %v, want context.DeadlineExceeded", err)
+	}
+
+	// Another waiter reuses the first install instead of downloading again
+	second := make(chan *loader.InstalledPackage, 1)
+	go func() {
+		installed, err := newPM().InstallPackage(ctx, "demo@1.0.0")
+		if err != nil {
+			t.Error(err)
+		}
+		second <- installed
+	}()
+	time.Sleep(100 * time.Millisecond)
+	close(gate.release)
+	if err := <-first; err != nil {
+		t.Fatal(err)
+	}
+	if installed := <-second; installed == nil || !installed.FromCache {
+		t.Errorf("waiting install = %+v, want it served from the cache", installed)
+	}
+	if n := len(gate.started); n != 0 {
+		t.Errorf("%d more tarball downloads started, want only the first", n)
+	}
+}
+
+func TestDependencyPaths(t *testing.T) {
+	pkg := func(name, version string, deps ...string) *loader.ResolvedPackage {
+		p := &loader.ResolvedPackage{Name: name, Version: version, Dependencies: map[string]string{}}
+		for i := 0; i < len(deps); i += 2 {
+			p.Dependencies[deps[i]] = deps[i+1]
+		}
+		return p
+	}
+	tree := []*loader.ResolvedPackage{
+		pkg("express", "4.18.2", "body-parser", "^1.20.0", "debug", "2.6.9"),
+		pkg("body-parser", "1.20.1", "left-pad", "^1.0.0", "debug", "2.6.9"),
+		pkg("left-pad", "1.3.0"),
+		pkg("left-pad", "2.0.0"),
+		pkg("debug", "2.6.9", "ms", "2.0.0"),
+		pkg("ms", "2.0.0", "debug", "*"),
+		pkg("tool", "1.0.0", "left-pad", "latest"),
+	}
+	roots := []string{"express@^4", "tool@1.0.0", "unrelated@^1"}
+
+	render := func(paths [][]*loader.ResolvedPackage) []string {
+		var lines []string
+		for _, path := range paths {
+			var parts []string
+			for _, p := range path {
+				parts = append(parts, p.String())
+			}
+			lines = append(lines, strings.Join(parts, " > "))
+		}
+		return lines
+	}
+
+	got := render(loader.DependencyPaths(roots, tree, "left-pad"))
+	want := []string{
+		"tool@1.0.0 > left-pad@2.0.0",
+		"express@4.18.2 > body-parser@1.20.1 > left-pad@1.3.0",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("DependencyPaths(left-pad) = %q, want %q", got, want)
+	}
+
+	// Cycles end a chain rather than looping
+	got = render(loader.DependencyPaths(roots, tree, "ms"))
+	want = []string{
+		"express@4.18.2 > debug@2.6.9 > ms@2.0.0",
+		"express@4.18.2 > body-parser@1.20.1 > debug@2.6.9 > ms@2.0.0",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("DependencyPaths(ms) = %q, want %q", got, want)
+	}
+
+	if paths := loader.DependencyPaths(roots, tree, "react"); len(paths) != 0 {
+		t.Errorf("DependencyPaths(react) = %q, want none", render(paths))
+	}
+}
+
+func TestResolveTreeOverrides(t *testing.T) {
+	t.Setenv(loader.CacheDirEnv, t.TempDir())
+	srv := fakeRegistryTree(t, map[string]map[string]map[string]string{
+		"app":      {"1.0.0": {"express": "^4.0.0", "tool": "^1.0.0"}},
+		"express":  {"4.0.0": {"left-pad": "^1.0.0", "debug": "^2.0.0"}},
+		"tool":     {"1.0.0": {"left-pad": "^1.0.0", "debug": "^2.0.0"}},
+		"debug":    {"2.0.0": nil, "2.6.9": nil},
+		"left-pad": {"1.0.0": nil, "1.3.0": nil, "2.0.0": nil},
+	})
+
+	resolve := func(t *testing.T, overrides string) string {
+		t.Helper()
+		var block map[string]any
+		if err := json.Unmarshal([]byte(overrides), &block); err != nil {
+			t.Fatal(err)
+		}
+		parsed, err := loader.ParseOverrides(block)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pm, err := loader.NewNPMPackageManager(loader.WithRegistry(srv.URL), loader.WithOverrides(parsed))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree, err := pm.ResolveTree(context.Background(), []string{"app@1.0.0", "debug@^2.0.0"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, pkg := range tree {
+			got = append(got, pkg.String())
+		}
+		return strings.Join(got, " ")
+	}
+
+	for _, tt := range []struct {
+		name, overrides, want string
+	}{
+		{
+			name:      "none",
+			overrides: `{}`,
+			want:      "app@1.0.0 debug@2.6.9 express@4.0.0 left-pad@1.3.0 tool@1.0.0",
+		},
+		{
+			name:      "name",
+			overrides: `{"left-pad": "1.0.0"}`,
+			want:      "app@1.0.0 debug@2.6.9 express@4.0.0 left-pad@1.0.0 tool@1.0.0",
+		},
+		{
+			// Only the copies below express are forced
+			name:      "path",
+			overrides: `{"express": {"left-pad": "2.0.0", "debug": "2.0.0"}}`,
+			want:      "app@1.0.0 debug@2.0.0 debug@2.6.9 express@4.0.0 left-pad@1.3.0 left-pad@2.0.0 tool@1.0.0",
+		},
+		{
+			name:      "version selector",
+			overrides: `{"left-pad@1.3": "1.0.0", "left-pad@2": "2.0.0"}`,
+			want:      "app@1.0.0 debug@2.6.9 express@4.0.0 left-pad@1.0.0 tool@1.0.0",
+		},
+		{
+			// "$debug" is the range the project itself asks for
+			name:      "reference",
+			overrides: `{"tool": {"debug": "$debug"}, "debug": "2.0.0"}`,
+			want:      "app@1.0.0 debug@2.0.0 debug@2.6.9 express@4.0.0 left-pad@1.3.0 tool@1.0.0",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resolve(t, tt.overrides); got != tt.want {
+				t.Errorf("ResolveTree() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	for _, bad := range []string{`{"left-pad": 1}`, `{"Bad Name": "1.0.0"}`, `{"express": {".": {}}}`} {
+		var block map[string]any
+		json.Unmarshal([]byte(bad), &block)
+		if _, err := loader.ParseOverrides(block); !errors.Is(err, errors.ErrInvalidOverride) {
+			t.Errorf("ParseOverrides(%s) error = %v, want ErrInvalidOverride", bad, err)
+		}
+	}
+}
+
+func TestLockedVersions(t *testing.T) {
+	t.Setenv(loader.CacheDirEnv, t.TempDir())
+	srv := fakeRegistryTree(t, map[string]map[string]map[string]string{
+		"app": {"1.0.0": {"lib": "^1.0.0"}, "1.1.0": {"lib": "^1.0.0"}},
+		"lib": {"1.0.0": nil, "1.2.0": nil},
+	})
+	resolve := func(locked []string) []string {
+		t.Helper()
+		pm, err := loader.NewNPMPackageManager(loader.WithRegistry(srv.URL), loader.WithLockedVersions(locked))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree, err := pm.ResolveTree(context.Background(), []string{"app@^1.0.0"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, pkg := range tree {
+			got = append(got, pkg.String())
+		}
+		return got
+	}
+
+	tests := []struct {
+		locked []string
+		want   []string
+	}{
+		{nil, []string{"app@1.1.0", "lib@1.2.0"}},
+		// Pins hold transitive dependencies back too, and the highest
+		// satisfying pin wins
+		{[]string{"app@1.0.0", "lib@0.9.0", "lib@1.0.0"}, []string{"app@1.0.0", "lib@1.0.0"}},
+		// A pin the range doesn't allow is ignored
+		{[]string{"app@2.0.0"}, []string{"app@1.1.0", "lib@1.2.0"}},
+	}
+	for _, tt := range tests {
+		if got := resolve(tt.locked); !slices.Equal(got, tt.want) {
+			t.Errorf("locked %v: resolved %v, want %v", tt.locked, got, tt.want)
+		}
+	}
+
+	lock := loader.NewDenoLock()
+	for _, pkg := range []string{"app@1.0.0", "lib@1.0.0", "other@1.0.0"} {
+		lock.NPM[pkg] = loader.DenoLockPackage{}
+	}
+	tree := []*loader.ResolvedPackage{{Name: "app", Version: "1.1.0"}, {Name: "lib", Version: "1.0.0"}}
+	if !lock.RemoveSuperseded(tree) {
+		t.Error("RemoveSuperseded reported no change")
+	}
+	if got := lock.Packages(); !slices.Equal(got, []string{"lib@1.0.0", "other@1.0.0"}) {
+		t.Errorf("after RemoveSuperseded the lock has %v, want lib@1.0.0 and other@1.0.0", got)
+	}
+}
+
+func TestPeerWarnings(t *testing.T) {
+	t.Setenv(loader.CacheDirEnv, t.TempDir())
+	packuments := map[string]string{
+		"app": `{"1.0.0": {"dependencies": {"plugin": "^1.0.0", "react": "^17.0.0"}}}`,
+		"plugin": `{"1.0.0": {
+			"peerDependencies": {"react": "^18.0.0", "react-dom": "^18.0.0", "@types/react": "*", "lodash": "^4.0.0"},
+			"peerDependenciesMeta": {"@types/react": {"optional": true}, "lodash": {"optional": true}},
+			"dependencies": {"lodash": "3.0.0"}
+		}}`,
+		"react":  `{"17.0.2": {}}`,
+		"lodash": `{"3.0.0": {}}`,
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/")
+		var versions map[string]map[string]any
+		if err := json.Unmarshal([]byte(packuments[name]), &versions); err != nil || versions == nil {
+			http.NotFound(w, r)
+			return
+		}
+		latest := ""
+		for v, meta := range versions {
+			meta["name"], meta["version"] = name, v
+			meta["dist"] = map[string]string{"tarball": "http://" + r.Host + "/" + name + "-" + v + ".tgz"}
+			latest = v
+		}
+		json.NewEncoder(w).Encode(map[string]any{"name": name, "dist-tags": map[string]string{"latest": latest}, "versions": versions})
+	}))
+	defer srv.Close()
+
+	pm, err := loader.NewNPMPackageManager(loader.WithRegistry(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := pm.ResolveTree(context.Background(), []string{"app"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A missing optional peer is fine, but one at the wrong version isn't
+	got := loader.PeerWarnings(tree)
+	want := []string{
+		"plugin@1.0.0 needs peer lodash@^4.0.0, but lodash@3.0.0 is installed",
+		"plugin@1.0.0 needs peer react-dom@^18.0.0, which isn't installed",
+		"plugin@1.0.0 needs peer react@^18.0.0, but react@17.0.2 is installed",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("PeerWarnings() = %q, want %q", got, want)
+	}
+}
+
+func TestCredentialProvider(t *testing.T) {
+	t.Setenv(loader.CacheDirEnv, t.TempDir())
+	tarball := buildTarball(t, map[string]string{"index.js": "export default 1;"})
+	registry := fakeRegistryVersions(t, "private", map[string]string{"latest": "1.0.0"}, map[string][]byte{"1.0.0": tarball})
+	// Every request, metadata and tarball alike, needs the current token
+	var token atomic.Value
+	token.Store("first")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+token.Load().(string) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		registry.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	host := strings.TrimPrefix(registry.URL, "http://")
+
+	var hosts []string
+	var mu sync.Mutex
+	var fail error
+	provider := func(ctx context.Context, h string) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		hosts = append(hosts, h)
+		if fail != nil {
+			return "", fail
+		}
+		return token.Load().(string), nil
+	}
+	// The tarball URLs name the inner registry, so everything goes through srv
+	pm, err := loader.NewNPMPackageManager(loader.WithRegistry(registry.URL), loader.WithHTTPClient(cdnClient(t, srv)),
+		// Asking the registry every time, so each resolution needs the token
+		loader.WithCredentialProvider(provider), loader.WithPackumentTTL(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if _, err := pm.InstallPackage(ctx, "private@1.0.0"); err != nil {
+		t.Fatalf("InstallPackage with a token: %v", err)
+	}
+	if len(hosts) != 2 || hosts[0] != host || hosts[1] != host {
+		t.Errorf("provider asked for %v, want %s for the packument and the tarball", hosts, host)
+	}
+
+	// The provider is asked again, so a refreshed token is picked up
+	token.Store("second")
+	if _, err := pm.ResolveTree(ctx, []string{"private@^1.0.0"}); err != nil {
+		t.Fatalf("ResolveTree after the token changed: %v", err)
+	}
+
+	// A failing provider is an auth error, not a fetch or not-found error
+	mu.Lock()
+	fail = fmt.Errorf("token expired")
+	mu.Unlock()
+	_, err = pm.ResolveTree(ctx, []string{"private@^1.0.0"})
+	if !errors.Is(err, errors.ErrRegistryAuth) || !strings.Contains(err.Error(), "token expired") {
+		t.Errorf("ResolveTree with a failing provider = %v, want ErrRegistryAuth with the cause", err)
+	}
+}
+
+// authRecorder records the Authorization header each request is sent with,
+// by host
+type authRecorder struct {
+	mu    sync.Mutex
+	seen  map[string][]string
+	paths []string
+}
+
+func (r *authRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	r.mu.Lock()
+	r.seen[req.URL.Host] = append(r.seen[req.URL.Host], req.Header.Get("Authorization"))
+	r.paths = append(r.paths, req.URL.Host+req.URL.Path)
+	r.mu.Unlock()
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestScopedRegistries(t *testing.T) {
+	t.Setenv(loader.CacheDirEnv, t.TempDir())
+	tarball := buildTarball(t, map[string]string{"index.js": "export default 1;"})
+	public := fakeRegistryVersions(t, "left-pad", map[string]string{"latest": "1.0.0"}, map[string][]byte{"1.0.0": tarball})
+	private := fakeRegistryVersions(t, "@myorg/utils", map[string]string{"latest": "2.0.0"}, map[string][]byte{"2.0.0": tarball})
+	publicHost, privateHost := strings.TrimPrefix(public.URL, "http://"), strings.TrimPrefix(private.URL, "http://")
+
+	recorder := &authRecorder{seen: make(map[string][]string)}
+	pm, err := loader.NewNPMPackageManager(
+		loader.WithRegistry(public.URL),
+		loader.WithFallbackRegistries(public.URL),
+		loader.WithScopedRegistries(map[string]string{"@myorg": private.URL + "/"}),
+		loader.WithCredentialProvider(loader.TokenCredentials(map[string]string{privateHost: "private-token"})),
+		loader.WithHTTPClient(&http.Client{Transport: recorder}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// The scoped package's metadata and tarball come from the private
+	// registry, with its token
+	installed, err := pm.InstallPackage(ctx, "@myorg/utils")
+	if err != nil {
+		t.Fatalf("InstallPackage(@myorg/utils) error = %v", err)
+	}
+	if installed.Version != "2.0.0" {
+		t.Errorf("InstallPackage(@myorg/utils) version = %s, want 2.0.0", installed.Version)
+	}
+	if got := recorder.seen[privateHost]; len(got) != 2 || got[0] != "Bearer private-token" || got[1] != "Bearer private-token" {
+		t.Errorf("private registry saw Authorization %q, want the token on the packument and tarball", got)
+	}
+
+	// The unscoped package comes from the default registry, without it
+	if _, err := pm.InstallPackage(ctx, "left-pad"); err != nil {
+		t.Fatalf("InstallPackage(left-pad) error = %v", err)
+	}
+	if got := recorder.seen[publicHost]; len(got) != 2 || got[0] != "" || got[1] != "" {
+		t.Errorf("default registry saw Authorization %q, want no token on either request", got)
+	}
+
+	// A scoped package the private registry lacks isn't looked for on the
+	// fallback registries
+	if _, err := pm.Resolve(ctx, "@myorg/missing"); !errors.Is(err, errors.ErrPackageNotFound) {
+		t.Errorf("Resolve(@myorg/missing) error = %v, want ErrPackageNotFound", err)
+	}
+	for _, path := range recorder.paths {
+		if strings.HasPrefix(path, publicHost) && strings.Contains(path, "myorg") {
+			t.Errorf("default registry was asked for %s", path)
+		}
+	}
+}
+
+func TestWorkspaces(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv(loader.CacheDirEnv, filepath.Join(home, ".edon"))
+	srv := fakeRegistryTree(t, map[string]map[string]map[string]string{
+		"left-pad": {"1.3.0": nil},
+		// The registry also has a "utils", which the workspace shadows
+		"utils": {"1.0.0": nil, "2.0.0": nil},
+	})
+
+	root := t.TempDir()
+	write := func(path, content string) {
+		t.Helper()
+		full := filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("packages/app/package.json", `{"name": "app", "version": "0.1.0", "dependencies": {"utils": "workspace:*", "left-pad": "^1.0.0"}}`)
+	write("packages/utils/package.json", `{"name": "utils", "version": "2.0.0", "devDependencies": {"left-pad": "1.3.0"}}`)
+	write("packages/legacy/package.json", `{"name": "legacy", "version": "1.0.0", "dependencies": {"utils": "^1.0.0"}}`)
+	write("packages/docs/README.md", "not a package")
+
+	workspaces, err := loader.FindWorkspaces(root, []string{"packages/*", "!packages/legacy"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, ws := range workspaces {
+		names = append(names, ws.Name)
+	}
+	if got := strings.Join(names, " "); got != "app utils" {
+		t.Fatalf("FindWorkspaces() = %q, want app and utils", got)
+	}
+
+	pm, err := loader.NewNPMPackageManager(loader.WithRegistry(srv.URL), loader.WithWorkspaces(workspaces))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A range the workspace doesn't satisfy still comes from the registry
+	tree, err := pm.ResolveTree(context.Background(), []string{"app@0.1.0", "utils@^1.0.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, pkg := range tree {
+		entry := pkg.String()
+		if pkg.Workspace != "" {
+			entry += "(linked)"
+		}
+		got = append(got, entry)
+	}
+	want := "app@0.1.0(linked) left-pad@1.3.0 utils@1.0.0 utils@2.0.0(linked)"
+	if strings.Join(got, " ") != want {
+		t.Errorf("ResolveTree() = %q, want %q", got, want)
+	}
+
+	var deps []string
+	for _, pkg := range workspaces[0].Resolved(tree, false) {
+		deps = append(deps, pkg.String())
+	}
+	if got := strings.Join(deps, " "); got != "left-pad@1.3.0 utils@2.0.0" {
+		t.Errorf("Resolved() = %q, want left-pad@1.3.0 and the utils workspace", got)
+	}
+
+	// Installing a workspace links the cache entry to its directory
+	var utils *loader.ResolvedPackage
+	for _, pkg := range tree {
+		if pkg.String() == "utils@2.0.0" {
+			utils = pkg
+		}
+	}
+	for _, cached := range []bool{false, true} {
+		installed, err := pm.Install(context.Background(), utils)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if installed.FromCache != cached || installed.Workspace != filepath.Join(root, "packages", "utils") {
+			t.Errorf("Install() = cached %v, workspace %q", installed.FromCache, installed.Workspace)
+		}
+		if target, err := os.Readlink(installed.Path); err != nil || target != installed.Workspace {
+			t.Errorf("cache entry links to %q (%v), want the workspace", target, err)
+		}
+	}
+
+	if _, err := loader.FindWorkspaces(root, []string{"packages/*"}); err != nil {
+		t.Errorf("FindWorkspaces(legacy included) error = %v", err)
+	}
+	write("packages/copy/package.json", `{"name": "utils", "version": "2.0.0"}`)
+	if _, err := loader.FindWorkspaces(root, []string{"packages/*"}); !errors.Is(err, errors.ErrInvalidPackage) {
+		t.Errorf("FindWorkspaces(duplicate names) error = %v, want ErrInvalidPackage", err)
+	}
+}
@@ -1,8 +1,10 @@
 package unit
 
 import (
+	"context"
 	"testing"
 
+	"github.com/katungi/edon/internal/errors"
 	"github.com/katungi/edon/internal/runtime"
 )
 
@@ -46,3 +48,30 @@ func TestBasicExecution(t *testing.T) {
 	}
 
 }
+
+func TestProcess(t *testing.T) {
+	ctx := context.Background()
+	run := func(script string) error {
+		rt, err := runtime.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rt.Close()
+		rt.SetArgs("/bin/cli.js", []string{"--name", "edon"})
+		return rt.RunModule(ctx, "/bin/cli.js", script)
+	}
+
+	argv := `if (process.argv.join(" ") !== "edon /bin/cli.js --name edon") throw new Error(process.argv.join(" "));`
+	if err := run(argv); err != nil {
+		t.Errorf("process.argv: %v", err)
+	}
+
+	// Exiting stops the script, even when the exit is caught
+	var exit *runtime.ExitError
+	if err := run(`try { process.exit(3) } catch {} throw new Error("still running");`); !errors.As(err, &exit) || exit.Code != 3 {
+		t.Errorf("process.exit(3) error = %v, want ExitError with code 3", err)
+	}
+	if err := run(`process.exit(0); throw new Error("still running");`); err != nil {
+		t.Errorf("process.exit(0) error = %v, want nil", err)
+	}
+}